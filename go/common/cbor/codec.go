@@ -9,11 +9,13 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// Maximum message size.
-const maxMessageSize = 16 * 1024 * 1024 // 16 MiB
+// DefaultMaxMessageSize is the default maximum message size.
+const DefaultMaxMessageSize = 16 * 1024 * 1024 // 16 MiB
 
 var (
-	errMessageTooLarge  = errors.New("codec: message too large")
+	// ErrMessageTooLarge is the error returned when a message exceeds the maximum message size.
+	ErrMessageTooLarge = errors.New("codec: message too large")
+
 	errMessageMalformed = errors.New("codec: message is malformed")
 
 	codecValueSize = prometheus.NewSummaryVec(
@@ -35,6 +37,9 @@ var (
 type MessageReader struct {
 	reader io.Reader
 
+	// maxMessageSize is the maximum size of a message that will be read.
+	maxMessageSize uint32
+
 	// module is the module name where the message is read to.
 	module string
 }
@@ -50,8 +55,9 @@ func (c *MessageReader) Read(msg interface{}) error {
 	labels := prometheus.Labels{"module": c.module, "call": "read"}
 	length := binary.BigEndian.Uint32(rawLength)
 	codecValueSize.With(labels).Observe(float64(length))
-	if length > maxMessageSize {
-		return errMessageTooLarge
+	if length > c.maxMessageSize {
+		// Bail out before reading any of the message bytes.
+		return ErrMessageTooLarge
 	}
 
 	// Decode message bytes.
@@ -71,6 +77,9 @@ func (c *MessageReader) Read(msg interface{}) error {
 type MessageWriter struct {
 	writer io.Writer
 
+	// maxMessageSize is the maximum size of a message that will be written.
+	maxMessageSize uint32
+
 	// module is the module name where the message was created.
 	module string
 }
@@ -82,8 +91,8 @@ func (c *MessageWriter) Write(msg interface{}) error {
 	length := len(data)
 	labels := prometheus.Labels{"module": c.module, "call": "write"}
 	codecValueSize.With(labels).Observe(float64(length))
-	if length > maxMessageSize {
-		return errMessageTooLarge
+	if uint64(length) > uint64(c.maxMessageSize) {
+		return ErrMessageTooLarge
 	}
 
 	// Write 32-bit length prefix and encoded data.
@@ -107,12 +116,18 @@ type MessageCodec struct {
 
 // NewMessageCodec constructs a new Message encoder/decoder.
 func NewMessageCodec(rw io.ReadWriter, module string) *MessageCodec {
+	return NewMessageCodecWithLimits(rw, module, DefaultMaxMessageSize, DefaultMaxMessageSize)
+}
+
+// NewMessageCodecWithLimits constructs a new Message encoder/decoder which refuses to read and
+// write messages larger than the given sizes.
+func NewMessageCodecWithLimits(rw io.ReadWriter, module string, maxReadSize, maxWriteSize uint32) *MessageCodec {
 	metricsOnce.Do(func() {
 		prometheus.MustRegister(codecCollectors...)
 	})
 
 	return &MessageCodec{
-		MessageReader: MessageReader{module: module, reader: rw},
-		MessageWriter: MessageWriter{module: module, writer: rw},
+		MessageReader: MessageReader{module: module, reader: rw, maxMessageSize: maxReadSize},
+		MessageWriter: MessageWriter{module: module, writer: rw, maxMessageSize: maxWriteSize},
 	}
 }
@@ -46,12 +46,31 @@ func TestCodecOversized(t *testing.T) {
 	require.NoError(err, "Write")
 
 	// Corrupt the buffer to include a huge length.
-	binary.BigEndian.PutUint32(buffer.Bytes()[:4], maxMessageSize+1)
+	binary.BigEndian.PutUint32(buffer.Bytes()[:4], DefaultMaxMessageSize+1)
 
 	var x int
 	err = codec.Read(&x)
 	require.Error(err, "Read should fail with oversized message")
-	require.EqualValues(errMessageTooLarge, err)
+	require.EqualValues(ErrMessageTooLarge, err)
+}
+
+func TestCodecLimits(t *testing.T) {
+	require := require.New(t)
+
+	var buffer bytes.Buffer
+	codec := NewMessageCodecWithLimits(&buffer, t.Name(), 8, 16)
+
+	err := codec.Write([]byte("this message is too large"))
+	require.ErrorIs(err, ErrMessageTooLarge, "Write should fail with oversized message")
+	require.Zero(buffer.Len(), "nothing should be written for an oversized message")
+
+	err = codec.Write([]byte("not too large"))
+	require.NoError(err, "Write")
+
+	var x []byte
+	err = codec.Read(&x)
+	require.ErrorIs(err, ErrMessageTooLarge, "Read should fail with oversized message")
+	require.NotZero(buffer.Len(), "message bytes should not be read for an oversized message")
 }
 
 func TestCodecMalformed(t *testing.T) {
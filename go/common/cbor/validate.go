@@ -0,0 +1,112 @@
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrMalformed is the error returned when a CBOR value is malformed.
+	ErrMalformed = errors.New("cbor: malformed value")
+
+	// ErrNestingTooDeep is the error returned when a CBOR value exceeds the maximum nesting depth.
+	ErrNestingTooDeep = errors.New("cbor: maximum nesting depth exceeded")
+)
+
+// CBOR major types.
+const (
+	majorTypeBytes = 2
+	majorTypeText  = 3
+	majorTypeArray = 4
+	majorTypeMap   = 5
+	majorTypeTag   = 6
+)
+
+// ValidateStructure performs a streaming validation of the structure of the given encoded CBOR
+// value without decoding it.
+//
+// The value must consist of a single well-formed definite-length data item which does not nest
+// arrays, maps or tags deeper than maxDepth. This makes it possible to cheaply reject adversarial
+// inputs before attempting to decode them.
+func ValidateStructure(data []byte, maxDepth int) error {
+	var offset int
+	// Number of data items remaining at each nesting level.
+	pending := []uint64{1}
+	for len(pending) > 0 {
+		top := len(pending) - 1
+		if pending[top] == 0 {
+			pending = pending[:top]
+			continue
+		}
+		pending[top]--
+
+		if offset >= len(data) {
+			return fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+		}
+		majorType := data[offset] >> 5
+		info := data[offset] & 0x1f
+		offset++
+
+		// Decode the argument.
+		var arg uint64
+		switch {
+		case info < 24:
+			arg = uint64(info)
+		case info <= 27:
+			size := 1 << (info - 24)
+			if len(data)-offset < size {
+				return fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+			}
+			switch size {
+			case 1:
+				arg = uint64(data[offset])
+			case 2:
+				arg = uint64(binary.BigEndian.Uint16(data[offset:]))
+			case 4:
+				arg = uint64(binary.BigEndian.Uint32(data[offset:]))
+			case 8:
+				arg = binary.BigEndian.Uint64(data[offset:])
+			}
+			offset += size
+		default:
+			return fmt.Errorf("%w: unsupported additional information (%d)", ErrMalformed, info)
+		}
+
+		var items uint64
+		switch majorType {
+		case majorTypeBytes, majorTypeText:
+			if arg > uint64(len(data)-offset) {
+				return fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+			}
+			offset += int(arg)
+			continue
+		case majorTypeArray:
+			items = arg
+		case majorTypeMap:
+			if arg > uint64(len(data)) {
+				return fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+			}
+			items = 2 * arg
+		case majorTypeTag:
+			items = 1
+		default:
+			// Integers and simple values have no content beyond the argument.
+			continue
+		}
+
+		// Each data item is at least one byte long.
+		if items > uint64(len(data)-offset) {
+			return fmt.Errorf("%w: unexpected end of data", ErrMalformed)
+		}
+		if len(pending) > maxDepth {
+			return ErrNestingTooDeep
+		}
+		pending = append(pending, items)
+	}
+
+	if offset != len(data) {
+		return fmt.Errorf("%w: trailing data", ErrMalformed)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package cbor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStructure(t *testing.T) {
+	require := require.New(t)
+
+	type nested struct {
+		A []uint64          `json:"a"`
+		B map[string]string `json:"b"`
+		C []byte            `json:"c"`
+	}
+	valid := Marshal(&nested{
+		A: []uint64{1, 2, 1 << 40},
+		B: map[string]string{"hello": "world"},
+		C: []byte("foo"),
+	})
+	require.NoError(ValidateStructure(valid, 2), "ValidateStructure")
+	require.ErrorIs(ValidateStructure(valid, 1), ErrNestingTooDeep, "nested value should exceed depth")
+
+	// Deeply nested arrays.
+	deep := append(bytes.Repeat([]byte{0x81}, 100), 0x00)
+	require.NoError(ValidateStructure(deep, 100), "ValidateStructure")
+	require.ErrorIs(ValidateStructure(deep, 99), ErrNestingTooDeep, "deeply nested value should exceed depth")
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"Empty", []byte{}},
+		{"TruncatedArgument", []byte{0x19, 0x01}},
+		{"TruncatedString", []byte{0x45, 'a', 'b'}},
+		{"TruncatedArray", []byte{0x83, 0x01, 0x02}},
+		{"HugeArray", []byte("\x9b\x00\x00\x81112233")},
+		{"HugeMap", []byte("\xbb\xff\xff\xff\xff\xff\xff\xff\xff")},
+		{"IndefiniteLength", []byte{0x9f, 0x01, 0xff}},
+		{"TrailingData", []byte{0x01, 0x02}},
+	} {
+		require.ErrorIs(ValidateStructure(tc.data, 10), ErrMalformed, tc.name)
+	}
+}
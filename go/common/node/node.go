@@ -423,13 +423,18 @@ const (
 	TEEHardwareInvalid TEEHardware = 0
 	// TEEHardwareIntelSGX is an Intel SGX TEE implementation.
 	TEEHardwareIntelSGX TEEHardware = 1
+	// TEEHardwareIntelTDX is an Intel TDX TEE implementation.
+	//
+	// Registration of runtimes requiring Intel TDX is not yet supported.
+	TEEHardwareIntelTDX TEEHardware = 2
 
 	// TEEHardwareReserved is the first reserved hardware implementation
 	// identifier. All equal or greater identifiers are reserved.
-	TEEHardwareReserved TEEHardware = TEEHardwareIntelSGX + 1
+	TEEHardwareReserved TEEHardware = TEEHardwareIntelTDX + 1
 
 	teeInvalid  = "invalid"
 	teeIntelSGX = "intel-sgx"
+	teeIntelTDX = "intel-tdx"
 )
 
 // String returns the string representation of a TEEHardware.
@@ -439,6 +444,8 @@ func (h TEEHardware) String() string {
 		return teeInvalid
 	case TEEHardwareIntelSGX:
 		return teeIntelSGX
+	case TEEHardwareIntelTDX:
+		return teeIntelTDX
 	default:
 		return "[unsupported TEEHardware]"
 	}
@@ -451,6 +458,8 @@ func (h *TEEHardware) FromString(str string) error {
 		*h = TEEHardwareInvalid
 	case teeIntelSGX:
 		*h = TEEHardwareIntelSGX
+	case teeIntelTDX:
+		*h = TEEHardwareIntelTDX
 	default:
 		return ErrInvalidTEEHardware
 	}
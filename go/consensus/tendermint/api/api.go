@@ -115,9 +115,9 @@ func (bld *EventBuilder) Attribute(key, value []byte) *EventBuilder {
 // TypedAttribute appends a typed attribute to the event.
 //
 // The typed attribute is automatically converted to a key/value pair where its EventKind is used
-// as the key and a CBOR-marshalled value is used as value.
+// as the key and the value encoded via EncodeValue is used as value.
 func (bld *EventBuilder) TypedAttribute(value TypedAttribute) *EventBuilder {
-	return bld.Attribute([]byte(value.EventKind()), cbor.Marshal(value))
+	return bld.Attribute([]byte(value.EventKind()), EncodeValue(value))
 }
 
 // Dirty returns true iff the EventBuilder has attributes.
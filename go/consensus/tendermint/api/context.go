@@ -8,7 +8,6 @@ import (
 
 	"github.com/tendermint/tendermint/abci/types"
 
-	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
 	staking "github.com/oasisprotocol/oasis-core/go/staking/api"
@@ -357,7 +356,7 @@ func (c *Context) DecodeTypedEvent(index int, ev TypedAttribute) error {
 	raw := c.events[index]
 	for _, pair := range raw.Attributes {
 		if bytes.Equal(pair.GetKey(), []byte(ev.EventKind())) {
-			return cbor.Unmarshal(pair.GetValue(), ev)
+			return DecodeValue(pair.GetValue(), ev)
 		}
 	}
 	return fmt.Errorf("incompatible event")
@@ -0,0 +1,403 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/tendermint/tendermint/abci/types"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+var (
+	// ErrNoEventReference is the error returned when an event does not contain an event reference.
+	ErrNoEventReference = errors.New("tendermint/api: event does not contain an event reference")
+
+	// ErrMalformedEventReference is the error returned when an event reference cannot be decoded.
+	ErrMalformedEventReference = errors.New("tendermint/api: malformed event reference")
+
+	// ErrInvalidEventReference is the error returned when an event reference does not point to
+	// an event that precedes the referencing event.
+	ErrInvalidEventReference = errors.New("tendermint/api: invalid event reference")
+
+	// ErrAttributeLimitsExceeded is the error returned when an attribute value exceeds the
+	// configured decode limits.
+	ErrAttributeLimitsExceeded = errors.New("tendermint/api: attribute value exceeds decode limits")
+
+	// ErrMalformedAttribute is the error returned when an attribute value cannot be decoded.
+	ErrMalformedAttribute = errors.New("tendermint/api: malformed attribute value")
+
+	// ErrAttributeKindMismatch is the error returned when an attribute is not of the expected
+	// kind.
+	ErrAttributeKindMismatch = errors.New("tendermint/api: attribute kind mismatch")
+
+	// ErrUnknownAttributeKind is the error returned when no typed attribute has been registered
+	// for an attribute kind.
+	ErrUnknownAttributeKind = errors.New("tendermint/api: unknown attribute kind")
+
+	// ErrAttributeEncrypted is the error returned when an attribute value is encrypted and no
+	// decryptor is available. Use errors.As with *EncryptedAttributeError to obtain the
+	// encrypted value.
+	ErrAttributeEncrypted = errors.New("tendermint/api: attribute value is encrypted")
+)
+
+// encryptedAttributeKeyPrefix is the prefix of keys of encrypted attributes.
+const encryptedAttributeKeyPrefix = "encrypted/"
+
+// AttributeDecodeLimits are the limits enforced when decoding potentially untrusted attribute
+// values.
+type AttributeDecodeLimits struct {
+	// MaxSize is the maximum size of an encoded attribute value in bytes.
+	MaxSize int
+	// MaxDepth is the maximum nesting depth of an attribute value.
+	MaxDepth int
+}
+
+// DefaultAttributeDecodeLimits are the default attribute decode limits.
+var DefaultAttributeDecodeLimits = AttributeDecodeLimits{
+	MaxSize:  1024 * 1024,
+	MaxDepth: 32,
+}
+
+// TypedAttributeEncoding is the encoding of typed attribute values.
+type TypedAttributeEncoding uint8
+
+const (
+	// EncodingCBOR encodes attribute values as raw CBOR. This is the default encoding.
+	EncodingCBOR TypedAttributeEncoding = 0
+	// EncodingBase64CBOR encodes attribute values as base64-encoded CBOR.
+	EncodingBase64CBOR TypedAttributeEncoding = 1
+	// EncodingHexCBOR encodes attribute values as hex-encoded CBOR.
+	EncodingHexCBOR TypedAttributeEncoding = 2
+)
+
+// EncodedTypedAttribute is an interface implemented by typed attributes which use an encoding other
+// than the default raw CBOR encoding for their values.
+type EncodedTypedAttribute interface {
+	TypedAttribute
+
+	// EventEncoding returns the encoding of this event's values.
+	EventEncoding() TypedAttributeEncoding
+}
+
+func attributeEncoding(attr TypedAttribute) TypedAttributeEncoding {
+	if enc, ok := attr.(EncodedTypedAttribute); ok {
+		return enc.EventEncoding()
+	}
+	return EncodingCBOR
+}
+
+// EncodeValue encodes the given typed attribute into an attribute value using the encoding
+// declared by the attribute.
+func EncodeValue(attr TypedAttribute) []byte {
+	value := cbor.Marshal(attr)
+	switch attributeEncoding(attr) {
+	case EncodingBase64CBOR:
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(value)))
+		base64.StdEncoding.Encode(encoded, value)
+		return encoded
+	case EncodingHexCBOR:
+		encoded := make([]byte, hex.EncodedLen(len(value)))
+		hex.Encode(encoded, value)
+		return encoded
+	default:
+		return value
+	}
+}
+
+// DecodeValue decodes the given trusted attribute value into the given typed attribute using the
+// encoding declared by the attribute.
+//
+// Use DecodeTypedAttribute for potentially untrusted attribute values.
+func DecodeValue(value []byte, attr TypedAttribute) error {
+	value, err := unwrapAttributeValue(value, attr)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformedAttribute, err)
+	}
+	return cbor.Unmarshal(value, attr)
+}
+
+// unwrapAttributeValue removes the encoding declared by the attribute from the given value,
+// returning the CBOR-encoded value.
+func unwrapAttributeValue(value []byte, attr TypedAttribute) ([]byte, error) {
+	switch enc := attributeEncoding(attr); enc {
+	case EncodingCBOR:
+		return value, nil
+	case EncodingBase64CBOR:
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(value)))
+		n, err := base64.StdEncoding.Decode(decoded, value)
+		if err != nil {
+			return nil, err
+		}
+		return decoded[:n], nil
+	case EncodingHexCBOR:
+		decoded := make([]byte, hex.DecodedLen(len(value)))
+		n, err := hex.Decode(decoded, value)
+		if err != nil {
+			return nil, err
+		}
+		return decoded[:n], nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute encoding: %d", enc)
+	}
+}
+
+// DecodeTypedAttribute decodes a potentially untrusted attribute value into the given typed
+// attribute.
+//
+// Before decoding, the encoded value is validated against the given limits so that adversarial
+// values cannot exhaust resources during decoding.
+func DecodeTypedAttribute(value []byte, attr TypedAttribute, limits AttributeDecodeLimits) error {
+	if len(value) > limits.MaxSize {
+		return fmt.Errorf("%w: size %d exceeds maximum size %d",
+			ErrAttributeLimitsExceeded, len(value), limits.MaxSize,
+		)
+	}
+
+	value, err := unwrapAttributeValue(value, attr)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformedAttribute, err)
+	}
+	return decodeAttributeValue(value, attr, limits)
+}
+
+// DecodeAll decodes all attributes of the given kind and invokes the callback for each of them.
+//
+// The kind must be a pointer to a typed attribute and each matching value is decoded into a fresh
+// instance of the same type. Decoding stops at the first decoding or callback error.
+func DecodeAll(attrs []types.EventAttribute, kind TypedAttribute, fn func(TypedAttribute) error) error {
+	typ := reflect.TypeOf(kind)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		return fmt.Errorf("tendermint/api: attribute kind must be a pointer, got %T", kind)
+	}
+
+	for _, pair := range attrs {
+		if !IsAttributeKind(pair.GetKey(), kind) {
+			continue
+		}
+
+		attr := reflect.New(typ.Elem()).Interface().(TypedAttribute)
+		if err := DecodeTypedAttribute(pair.GetValue(), attr, DefaultAttributeDecodeLimits); err != nil {
+			return err
+		}
+		if err := fn(attr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttributeRegistry is a registry of typed attribute kinds that can be used to dynamically decode
+// attributes of arbitrary registered kinds.
+type AttributeRegistry struct {
+	sync.RWMutex
+
+	factories map[string]func() TypedAttribute
+}
+
+// Register registers a factory for typed attributes of the kind of the attributes it produces.
+func (r *AttributeRegistry) Register(factory func() TypedAttribute) error {
+	kind := factory().EventKind()
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, exists := r.factories[kind]; exists {
+		return fmt.Errorf("tendermint/api: attribute kind '%s' already registered", kind)
+	}
+	r.factories[kind] = factory
+	return nil
+}
+
+// Dispatch decodes the given potentially untrusted attribute into a fresh instance of the typed
+// attribute registered for its kind.
+func (r *AttributeRegistry) Dispatch(key, value []byte) (TypedAttribute, error) {
+	r.RLock()
+	factory, ok := r.factories[string(key)]
+	r.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownAttributeKind, key)
+	}
+
+	attr := factory()
+	if err := DecodeTypedAttribute(value, attr, DefaultAttributeDecodeLimits); err != nil {
+		return nil, err
+	}
+	return attr, nil
+}
+
+// NewAttributeRegistry creates a new empty typed attribute registry.
+func NewAttributeRegistry() *AttributeRegistry {
+	return &AttributeRegistry{
+		factories: make(map[string]func() TypedAttribute),
+	}
+}
+
+func decodeAttributeValue(value []byte, dst interface{}, limits AttributeDecodeLimits) error {
+	if len(value) > limits.MaxSize {
+		return fmt.Errorf("%w: size %d exceeds maximum size %d",
+			ErrAttributeLimitsExceeded, len(value), limits.MaxSize,
+		)
+	}
+
+	err := cbor.ValidateStructure(value, limits.MaxDepth)
+	switch {
+	case err == nil:
+	case errors.Is(err, cbor.ErrNestingTooDeep):
+		return fmt.Errorf("%w: nesting depth exceeds maximum depth %d",
+			ErrAttributeLimitsExceeded, limits.MaxDepth,
+		)
+	default:
+		return fmt.Errorf("%w: %s", ErrMalformedAttribute, err)
+	}
+
+	if err = cbor.Unmarshal(value, dst); err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformedAttribute, err)
+	}
+	return nil
+}
+
+// EncryptedAttribute is an encrypted typed attribute value.
+//
+// Encrypted attributes are emitted under a key derived from the kind of the typed attribute (see
+// EncryptedAttributeKey) so that decoders can recognize them without attempting to decode the
+// ciphertext as a plain value.
+type EncryptedAttribute struct {
+	// KeyReference identifies the key that can be used to decrypt the value (e.g., a key manager
+	// key pair identifier).
+	KeyReference []byte `json:"key_ref"`
+	// Ciphertext is the encrypted CBOR-encoded attribute value.
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptedAttributeKey returns the attribute key used for encrypted attributes of the given kind.
+func EncryptedAttributeKey(kind TypedAttribute) []byte {
+	return []byte(encryptedAttributeKeyPrefix + kind.EventKind())
+}
+
+// IsEncryptedAttributeKind checks whether the given attribute key corresponds to an encrypted
+// attribute of the passed typed attribute kind.
+func IsEncryptedAttributeKind(key []byte, kind TypedAttribute) bool {
+	return bytes.Equal(key, EncryptedAttributeKey(kind))
+}
+
+// EncryptedTypedAttribute appends an encrypted typed attribute of the given kind to the event.
+func (bld *EventBuilder) EncryptedTypedAttribute(kind TypedAttribute, value *EncryptedAttribute) *EventBuilder {
+	return bld.Attribute(EncryptedAttributeKey(kind), cbor.Marshal(value))
+}
+
+// EncryptedAttributeError is the error returned when decoding an encrypted attribute value without
+// a decryptor.
+type EncryptedAttributeError struct {
+	// Kind is the kind of the encrypted typed attribute.
+	Kind string
+	// Attribute is the encrypted attribute value.
+	Attribute *EncryptedAttribute
+}
+
+// Error implements the error interface.
+func (e *EncryptedAttributeError) Error() string {
+	return fmt.Sprintf("%s (kind: %s)", ErrAttributeEncrypted, e.Kind)
+}
+
+// Is returns true iff the target is ErrAttributeEncrypted.
+func (e *EncryptedAttributeError) Is(target error) bool {
+	return target == ErrAttributeEncrypted
+}
+
+// AttributeDecryptor decrypts encrypted attribute values.
+type AttributeDecryptor interface {
+	// DecryptAttribute decrypts the given encrypted attribute value of the given kind and returns
+	// the CBOR-encoded plaintext value.
+	DecryptAttribute(kind string, attr *EncryptedAttribute) ([]byte, error)
+}
+
+// DecodeAttribute decodes a potentially untrusted attribute, which may be encrypted, into the given
+// typed attribute.
+//
+// In case the attribute is encrypted and no decryptor is given, an *EncryptedAttributeError is
+// returned instead of attempting to decode the ciphertext.
+func DecodeAttribute(
+	pair types.EventAttribute,
+	attr TypedAttribute,
+	limits AttributeDecodeLimits,
+	decryptor AttributeDecryptor,
+) error {
+	switch {
+	case IsAttributeKind(pair.GetKey(), attr):
+		return DecodeTypedAttribute(pair.GetValue(), attr, limits)
+	case IsEncryptedAttributeKind(pair.GetKey(), attr):
+	default:
+		return fmt.Errorf("%w: expected '%s'", ErrAttributeKindMismatch, attr.EventKind())
+	}
+
+	var enc EncryptedAttribute
+	if err := decodeAttributeValue(pair.GetValue(), &enc, limits); err != nil {
+		return err
+	}
+	if decryptor == nil {
+		return &EncryptedAttributeError{
+			Kind:      attr.EventKind(),
+			Attribute: &enc,
+		}
+	}
+
+	plaintext, err := decryptor.DecryptAttribute(attr.EventKind(), &enc)
+	if err != nil {
+		return fmt.Errorf("tendermint/api: failed to decrypt attribute: %w", err)
+	}
+	return decodeAttributeValue(plaintext, attr, limits)
+}
+
+// EventReference is a typed attribute that references an earlier event emitted within the same
+// block by its index.
+//
+// This can be used to build causal chains of events within a block.
+type EventReference struct {
+	// Index is the index of the referenced event.
+	Index uint64 `json:"index"`
+}
+
+// EventKind returns a string representation of this event's kind.
+func (er *EventReference) EventKind() string {
+	return "event_ref"
+}
+
+// EventReference appends a reference to the event at the given index to the event.
+func (bld *EventBuilder) EventReference(index int) *EventBuilder {
+	return bld.TypedAttribute(&EventReference{Index: uint64(index)})
+}
+
+// ResolveEventReference resolves the event reference contained in the event at the given index
+// and returns the index of the referenced event.
+//
+// The referenced event must exist and must precede the referencing event.
+func ResolveEventReference(events []types.Event, index int) (int, error) {
+	if index < 0 || index >= len(events) {
+		return 0, fmt.Errorf("%w: referencing event %d does not exist", ErrInvalidEventReference, index)
+	}
+
+	var kind EventReference
+	for _, pair := range events[index].Attributes {
+		if !IsAttributeKind(pair.GetKey(), &kind) {
+			continue
+		}
+
+		var ref EventReference
+		if err := DecodeTypedAttribute(pair.GetValue(), &ref, DefaultAttributeDecodeLimits); err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrMalformedEventReference, err)
+		}
+		if ref.Index >= uint64(index) {
+			return 0, fmt.Errorf("%w: event %d references event %d which does not precede it",
+				ErrInvalidEventReference, index, ref.Index,
+			)
+		}
+		return int(ref.Index), nil
+	}
+	return 0, ErrNoEventReference
+}
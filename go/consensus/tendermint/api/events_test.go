@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/abci/types"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+func TestEventReference(t *testing.T) {
+	require := require.New(t)
+
+	events := []types.Event{
+		NewEventBuilder("test").Attribute([]byte("a"), []byte("b")).Event(),
+		NewEventBuilder("test").EventReference(0).Event(),
+		NewEventBuilder("test").EventReference(1).Event(),
+		NewEventBuilder("test").EventReference(3).Event(),
+		NewEventBuilder("test").EventReference(5).Event(),
+		NewEventBuilder("test").Attribute([]byte((&EventReference{}).EventKind()), []byte("garbage")).Event(),
+	}
+
+	ref, err := ResolveEventReference(events, 1)
+	require.NoError(err, "ResolveEventReference")
+	require.Equal(0, ref, "reference should resolve to the correct event")
+
+	ref, err = ResolveEventReference(events, 2)
+	require.NoError(err, "ResolveEventReference")
+	require.Equal(1, ref, "reference should resolve to the correct event")
+
+	_, err = ResolveEventReference(events, 0)
+	require.ErrorIs(err, ErrNoEventReference, "event without a reference should fail")
+
+	_, err = ResolveEventReference(events, 3)
+	require.ErrorIs(err, ErrInvalidEventReference, "self reference should fail")
+
+	_, err = ResolveEventReference(events, 4)
+	require.ErrorIs(err, ErrInvalidEventReference, "forward reference should fail")
+
+	_, err = ResolveEventReference(events, 5)
+	require.ErrorIs(err, ErrMalformedEventReference, "malformed reference should fail")
+
+	_, err = ResolveEventReference(events, len(events))
+	require.ErrorIs(err, ErrInvalidEventReference, "missing referencing event should fail")
+}
+
+type testAttribute struct {
+	Value interface{} `json:"value"`
+}
+
+func (ta *testAttribute) EventKind() string {
+	return "test"
+}
+
+type encodedTestAttribute struct {
+	Value uint64 `json:"value"`
+
+	encoding TypedAttributeEncoding
+}
+
+func (ta *encodedTestAttribute) EventKind() string {
+	return "encoded_test"
+}
+
+func (ta *encodedTestAttribute) EventEncoding() TypedAttributeEncoding {
+	return ta.encoding
+}
+
+func TestTypedAttributeEncoding(t *testing.T) {
+	require := require.New(t)
+
+	raw := cbor.Marshal(&encodedTestAttribute{Value: 42})
+	for _, tc := range []struct {
+		encoding TypedAttributeEncoding
+		value    []byte
+	}{
+		{EncodingCBOR, raw},
+		{EncodingBase64CBOR, []byte(base64.StdEncoding.EncodeToString(raw))},
+		{EncodingHexCBOR, []byte(hex.EncodeToString(raw))},
+	} {
+		ev := NewEventBuilder("test").TypedAttribute(&encodedTestAttribute{Value: 42, encoding: tc.encoding}).Event()
+		require.Len(ev.Attributes, 1)
+		require.Equal(tc.value, ev.Attributes[0].GetValue(), "value should use the declared encoding")
+
+		ta := encodedTestAttribute{encoding: tc.encoding}
+		err := DecodeTypedAttribute(ev.Attributes[0].GetValue(), &ta, DefaultAttributeDecodeLimits)
+		require.NoError(err, "DecodeTypedAttribute")
+		require.EqualValues(42, ta.Value)
+	}
+
+	ta := encodedTestAttribute{encoding: EncodingHexCBOR}
+	err := DecodeTypedAttribute(raw, &ta, DefaultAttributeDecodeLimits)
+	require.ErrorIs(err, ErrMalformedAttribute, "values not using the declared encoding should fail")
+
+	// Types that do not declare an encoding should use raw CBOR.
+	ev := NewEventBuilder("test").TypedAttribute(&testAttribute{Value: uint64(1)}).Event()
+	require.Equal(cbor.Marshal(&testAttribute{Value: uint64(1)}), ev.Attributes[0].GetValue())
+}
+
+func TestEncodeValueRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	for _, encoding := range []TypedAttributeEncoding{EncodingCBOR, EncodingBase64CBOR, EncodingHexCBOR} {
+		x := encodedTestAttribute{Value: 42, encoding: encoding}
+		y := encodedTestAttribute{encoding: encoding}
+		err := DecodeValue(EncodeValue(&x), &y)
+		require.NoError(err, "DecodeValue")
+		require.Equal(x, y, "round trip should yield an equal value")
+	}
+
+	x := EventReference{Index: 7}
+	var y EventReference
+	err := DecodeValue(EncodeValue(&x), &y)
+	require.NoError(err, "DecodeValue")
+	require.Equal(x, y, "round trip should yield an equal value for default-encoded types")
+}
+
+func TestDecodeAll(t *testing.T) {
+	require := require.New(t)
+
+	ev := NewEventBuilder("test").
+		TypedAttribute(&testAttribute{Value: uint64(1)}).
+		Attribute([]byte("other"), []byte("garbage")).
+		TypedAttribute(&testAttribute{Value: uint64(2)}).
+		Event()
+
+	var values []interface{}
+	err := DecodeAll(ev.Attributes, &testAttribute{}, func(attr TypedAttribute) error {
+		values = append(values, attr.(*testAttribute).Value)
+		return nil
+	})
+	require.NoError(err, "DecodeAll")
+	require.EqualValues([]interface{}{uint64(1), uint64(2)}, values, "all matching attributes should be decoded")
+
+	errStop := fmt.Errorf("stop")
+	var calls int
+	err = DecodeAll(ev.Attributes, &testAttribute{}, func(attr TypedAttribute) error {
+		calls++
+		return errStop
+	})
+	require.ErrorIs(err, errStop, "callback errors should be propagated")
+	require.Equal(1, calls, "decoding should stop on callback errors")
+
+	ev = NewEventBuilder("test").Attribute([]byte((&testAttribute{}).EventKind()), []byte("garbage")).Event()
+	err = DecodeAll(ev.Attributes, &testAttribute{}, func(attr TypedAttribute) error {
+		return nil
+	})
+	require.ErrorIs(err, ErrMalformedAttribute, "malformed attributes should fail")
+}
+
+func TestAttributeRegistry(t *testing.T) {
+	require := require.New(t)
+
+	registry := NewAttributeRegistry()
+	err := registry.Register(func() TypedAttribute { return &EventReference{} })
+	require.NoError(err, "Register")
+	err = registry.Register(func() TypedAttribute { return &encodedTestAttribute{encoding: EncodingHexCBOR} })
+	require.NoError(err, "Register")
+	err = registry.Register(func() TypedAttribute { return &EventReference{} })
+	require.Error(err, "registering a kind twice should fail")
+
+	ev := NewEventBuilder("test").
+		EventReference(3).
+		TypedAttribute(&encodedTestAttribute{Value: 42, encoding: EncodingHexCBOR}).
+		TypedAttribute(&testAttribute{Value: uint64(1)}).
+		Event()
+
+	attr, err := registry.Dispatch(ev.Attributes[0].GetKey(), ev.Attributes[0].GetValue())
+	require.NoError(err, "Dispatch")
+	require.Equal(&EventReference{Index: 3}, attr, "attribute should be decoded into the registered type")
+
+	attr, err = registry.Dispatch(ev.Attributes[1].GetKey(), ev.Attributes[1].GetValue())
+	require.NoError(err, "Dispatch")
+	require.EqualValues(42, attr.(*encodedTestAttribute).Value, "attribute should use the declared encoding")
+
+	_, err = registry.Dispatch(ev.Attributes[2].GetKey(), ev.Attributes[2].GetValue())
+	require.ErrorIs(err, ErrUnknownAttributeKind, "unregistered kinds should fail")
+
+	_, err = registry.Dispatch(ev.Attributes[0].GetKey(), []byte("garbage"))
+	require.ErrorIs(err, ErrMalformedAttribute, "malformed attributes should fail")
+}
+
+func TestDecodeTypedAttribute(t *testing.T) {
+	require := require.New(t)
+
+	limits := AttributeDecodeLimits{
+		MaxSize:  128,
+		MaxDepth: 8,
+	}
+
+	var ta testAttribute
+	err := DecodeTypedAttribute(cbor.Marshal(&testAttribute{Value: []uint64{1, 2, 3}}), &ta, limits)
+	require.NoError(err, "DecodeTypedAttribute")
+
+	// Oversized value.
+	err = DecodeTypedAttribute(cbor.Marshal(&testAttribute{Value: bytes.Repeat([]byte{0x42}, 256)}), &ta, limits)
+	require.ErrorIs(err, ErrAttributeLimitsExceeded, "oversized value should fail")
+
+	// Deeply nested value.
+	var nested interface{} = uint64(42)
+	for i := 0; i < 10; i++ {
+		nested = []interface{}{nested}
+	}
+	err = DecodeTypedAttribute(cbor.Marshal(&testAttribute{Value: nested}), &ta, limits)
+	require.ErrorIs(err, ErrAttributeLimitsExceeded, "deeply nested value should fail")
+
+	// Value claiming a huge number of elements.
+	huge := append([]byte{0xa1, 0x65, 'v', 'a', 'l', 'u', 'e'}, bytes.Repeat([]byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 4)...)
+	err = DecodeTypedAttribute(huge, &ta, limits)
+	require.ErrorIs(err, ErrMalformedAttribute, "truncated value should fail")
+
+	// Malformed value.
+	err = DecodeTypedAttribute([]byte{0xa1, 0x65}, &ta, limits)
+	require.ErrorIs(err, ErrMalformedAttribute, "malformed value should fail")
+}
+
+// xorDecryptor is a test decryptor that XORs the ciphertext with the key reference.
+type xorDecryptor struct{}
+
+func (d *xorDecryptor) DecryptAttribute(kind string, attr *EncryptedAttribute) ([]byte, error) {
+	if len(attr.KeyReference) == 0 {
+		return nil, fmt.Errorf("missing key")
+	}
+	plaintext := make([]byte, len(attr.Ciphertext))
+	for i, b := range attr.Ciphertext {
+		plaintext[i] = b ^ attr.KeyReference[0]
+	}
+	return plaintext, nil
+}
+
+func TestDecodeEncryptedAttribute(t *testing.T) {
+	require := require.New(t)
+
+	value := &testAttribute{Value: "secret"}
+	enc := &EncryptedAttribute{KeyReference: []byte{0x42}}
+	for _, b := range cbor.Marshal(value) {
+		enc.Ciphertext = append(enc.Ciphertext, b^0x42)
+	}
+
+	var bld EventBuilder
+	bld.TypedAttribute(value).EncryptedTypedAttribute(value, enc).EventReference(0)
+	attrs := bld.Event().Attributes
+	require.True(IsEncryptedAttributeKind(attrs[1].GetKey(), value), "IsEncryptedAttributeKind")
+	require.False(IsAttributeKind(attrs[1].GetKey(), value), "encrypted attribute should not match plain kind")
+
+	// Plain attributes should be decoded directly.
+	var ta testAttribute
+	err := DecodeAttribute(attrs[0], &ta, DefaultAttributeDecodeLimits, nil)
+	require.NoError(err, "DecodeAttribute")
+	require.EqualValues("secret", ta.Value)
+
+	// Encrypted attributes without a decryptor should not be decoded.
+	ta = testAttribute{}
+	err = DecodeAttribute(attrs[1], &ta, DefaultAttributeDecodeLimits, nil)
+	require.ErrorIs(err, ErrAttributeEncrypted, "encrypted attribute without decryptor should fail")
+	var encErr *EncryptedAttributeError
+	require.ErrorAs(err, &encErr)
+	require.Equal(value.EventKind(), encErr.Kind, "kind")
+	require.EqualValues(enc, encErr.Attribute, "encrypted attribute")
+	require.Nil(ta.Value, "value should not be decoded")
+
+	// Encrypted attributes with a decryptor should be decrypted.
+	err = DecodeAttribute(attrs[1], &ta, DefaultAttributeDecodeLimits, &xorDecryptor{})
+	require.NoError(err, "DecodeAttribute")
+	require.EqualValues("secret", ta.Value)
+
+	// Decryption failures should be propagated.
+	var bld2 EventBuilder
+	bld2.EncryptedTypedAttribute(value, &EncryptedAttribute{Ciphertext: enc.Ciphertext})
+	err = DecodeAttribute(bld2.Event().Attributes[0], &ta, DefaultAttributeDecodeLimits, &xorDecryptor{})
+	require.Error(err, "decryption failure should fail")
+
+	// Attributes of other kinds should be rejected.
+	err = DecodeAttribute(attrs[2], &ta, DefaultAttributeDecodeLimits, nil)
+	require.ErrorIs(err, ErrAttributeKindMismatch, "other attribute kind should fail")
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sync"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
@@ -476,9 +478,36 @@ func (n *Node) startRuntimeWorkers() error {
 	// Close readyCh once all workers and runtimes are initialized.
 	go n.waitReady()
 
+	// Reload the runtime configuration on SIGHUP.
+	if n.RuntimeRegistry.Mode() != runtimeRegistry.RuntimeModeNone {
+		go n.watchRuntimeReload()
+	}
+
 	return nil
 }
 
+// watchRuntimeReload reloads the runtime configuration whenever SIGHUP is received.
+func (n *Node) watchRuntimeReload() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-n.svcMgr.Ctx.Done():
+			return
+		case <-sigCh:
+		}
+
+		n.logger.Info("reloading runtime configuration")
+		if err := n.RuntimeRegistry.Reload(n.svcMgr.Ctx); err != nil {
+			n.logger.Error("failed to reload runtime configuration",
+				"err", err,
+			)
+		}
+	}
+}
+
 func (n *Node) initGenesis() error {
 	var err error
 	n.Genesis, err = genesisFile.DefaultFileProvider()
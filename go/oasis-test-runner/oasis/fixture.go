@@ -56,11 +56,25 @@ func (f *NetworkFixture) Create(env *env.Env) (*Network, error) {
 		}
 	}
 
-	// Provision runtimes.
+	// Provision runtimes. Runtimes are provisioned concurrently in batches such that key manager
+	// runtimes are provisioned before any compute runtimes that depend on them.
+	var runtimeCfgs []*RuntimeCfg
 	for _, fx := range f.Runtimes {
-		if _, err = fx.Create(f, net); err != nil {
+		if fx.Keymanager >= len(net.Runtimes()) && len(runtimeCfgs) > 0 {
+			if _, err = net.NewRuntimes(runtimeCfgs); err != nil {
+				return nil, err
+			}
+			runtimeCfgs = nil
+		}
+
+		var cfg *RuntimeCfg
+		if cfg, err = fx.runtimeCfg(f, net); err != nil {
 			return nil, err
 		}
+		runtimeCfgs = append(runtimeCfgs, cfg)
+	}
+	if _, err = net.NewRuntimes(runtimeCfgs); err != nil {
+		return nil, err
 	}
 
 	// Provision the sentry nodes.
@@ -224,6 +238,8 @@ type RuntimeFixture struct { // nolint: maligned
 	Binaries     map[node.TEEHardware][]string `json:"binaries"`
 	GenesisRound uint64                        `json:"genesis_round,omitempty"`
 
+	Versions []RuntimeVersionCfg `json:"versions,omitempty"`
+
 	Executor     registry.ExecutorParameters     `json:"executor"`
 	TxnScheduler registry.TxnSchedulerParameters `json:"txn_scheduler"`
 	Storage      registry.StorageParameters      `json:"storage"`
@@ -241,6 +257,15 @@ type RuntimeFixture struct { // nolint: maligned
 
 // Create instantiates the runtime described by the fixture.
 func (f *RuntimeFixture) Create(netFixture *NetworkFixture, net *Network) (*Runtime, error) {
+	cfg, err := f.runtimeCfg(netFixture, net)
+	if err != nil {
+		return nil, err
+	}
+	return net.NewRuntime(cfg)
+}
+
+// runtimeCfg returns the configuration of the runtime described by the fixture.
+func (f *RuntimeFixture) runtimeCfg(netFixture *NetworkFixture, net *Network) (*RuntimeCfg, error) {
 	entity, err := resolveEntity(net, f.Entity)
 	if err != nil {
 		return nil, err
@@ -258,7 +283,7 @@ func (f *RuntimeFixture) Create(netFixture *NetworkFixture, net *Network) (*Runt
 		}
 	}
 
-	return net.NewRuntime(&RuntimeCfg{
+	return &RuntimeCfg{
 		ID:                 f.ID,
 		Kind:               f.Kind,
 		Entity:             entity,
@@ -273,10 +298,11 @@ func (f *RuntimeFixture) Create(netFixture *NetworkFixture, net *Network) (*Runt
 		Staking:            f.Staking,
 		Binaries:           f.Binaries,
 		GenesisRound:       f.GenesisRound,
+		Versions:           f.Versions,
 		Pruner:             f.Pruner,
 		ExcludeFromGenesis: f.ExcludeFromGenesis,
 		GovernanceModel:    f.GovernanceModel,
-	})
+	}, nil
 }
 
 // KeymangerPolicyFixgure is a key manager policy fixture.
@@ -7,9 +7,15 @@ import (
 	"testing"
 
 	"github.com/oasisprotocol/curve25519-voi/primitives/ed25519"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 
+	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/drbg"
+	"github.com/oasisprotocol/oasis-core/go/common/entity"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/oasis-test-runner/env"
+	registry "github.com/oasisprotocol/oasis-core/go/registry/api"
 )
 
 func generateDeterministicNodeKeys(t *testing.T, rawSeed string) (ed25519.PublicKey, ed25519.PrivateKey) {
@@ -39,3 +45,41 @@ func TestNodeIdentity(t *testing.T) {
 	require.Equal(t, 1, bytes.Compare(b1, c0))
 	require.Equal(t, 1, bytes.Compare(c2, b1))
 }
+
+func TestNewRuntimes(t *testing.T) {
+	require := require.New(t)
+
+	var baseDir env.Dir
+	err := baseDir.Init(&cobra.Command{Use: "oasis-test-runner-runtimes-test"})
+	require.NoError(err, "Init")
+	defer baseDir.Cleanup()
+
+	net := &Network{
+		logger:  logging.GetLogger("oasis/test"),
+		baseDir: &baseDir,
+	}
+	ent := &Entity{
+		entity: &entity.Entity{},
+	}
+
+	var cfgs []*RuntimeCfg
+	for i := 0; i < 2*maxParallelRuntimeProvisioning+1; i++ {
+		cfgs = append(cfgs, &RuntimeCfg{
+			ID:     common.NewTestNamespaceFromSeed([]byte(fmt.Sprintf("oasis runtimes test %d", i)), 0),
+			Kind:   registry.KindCompute,
+			Entity: ent,
+		})
+	}
+
+	rts, err := net.NewRuntimes(cfgs)
+	require.NoError(err, "NewRuntimes")
+	require.Len(rts, len(cfgs))
+	require.Equal(rts, net.Runtimes(), "all runtimes should be added to the network")
+	for i, rt := range rts {
+		require.Equal(cfgs[i].ID, rt.ID(), "runtimes should be in configuration order")
+
+		descriptor, dErr := rt.LoadDescriptor()
+		require.NoError(dErr, "LoadDescriptor")
+		require.Equal(cfgs[i].ID, descriptor.ID)
+	}
+}
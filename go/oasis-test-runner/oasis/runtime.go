@@ -6,8 +6,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
+
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
@@ -20,6 +23,9 @@ import (
 
 const (
 	rtDescriptorFile = "runtime_genesis.json"
+
+	// maxParallelRuntimeProvisioning is the maximum number of runtimes provisioned concurrently.
+	maxParallelRuntimeProvisioning = 4
 )
 
 // Runtime is an Oasis runtime.
@@ -53,6 +59,12 @@ type RuntimeCfg struct { // nolint: maligned
 	Binaries     map[node.TEEHardware][]string
 	GenesisRound uint64
 
+	// Versions optionally configures multiple runtime versions (e.g., current and next), each
+	// with its own binaries. The first version is registered in the runtime descriptor while the
+	// binaries of all versions are used to derive the allowed enclave identities. If set, Version
+	// and Binaries must not be.
+	Versions []RuntimeVersionCfg
+
 	Executor     registry.ExecutorParameters
 	TxnScheduler registry.TxnSchedulerParameters
 	Storage      registry.StorageParameters
@@ -68,6 +80,38 @@ type RuntimeCfg struct { // nolint: maligned
 	ExcludeFromGenesis bool
 }
 
+// RuntimeVersionCfg is the provisioning configuration of a single runtime version.
+type RuntimeVersionCfg struct {
+	Version  version.Version             `json:"version"`
+	Binaries map[node.TEEHardware]string `json:"binaries"`
+}
+
+// resolveVersions returns the registered runtime version and the binaries of all configured
+// versions, in the order the versions are configured.
+func (cfg *RuntimeCfg) resolveVersions() (version.Version, map[node.TEEHardware][]string, error) {
+	if len(cfg.Versions) == 0 {
+		return cfg.Version, cfg.Binaries, nil
+	}
+	if cfg.Binaries != nil || cfg.Version != (version.Version{}) {
+		return version.Version{}, nil, fmt.Errorf("oasis/runtime: versions and version/binaries are mutually exclusive")
+	}
+
+	binaries := make(map[node.TEEHardware][]string)
+	for i, v := range cfg.Versions {
+		// Make sure binary indices correspond to versions for all TEE hardware.
+		if len(v.Binaries) != len(cfg.Versions[0].Binaries) {
+			return version.Version{}, nil, fmt.Errorf("oasis/runtime: version %s has binaries for different TEE hardware", v.Version)
+		}
+		for tee, binary := range v.Binaries {
+			if len(binaries[tee]) != i {
+				return version.Version{}, nil, fmt.Errorf("oasis/runtime: version %s has binaries for different TEE hardware", v.Version)
+			}
+			binaries[tee] = append(binaries[tee], binary)
+		}
+	}
+	return cfg.Versions[0].Version, binaries, nil
+}
+
 // RuntimePrunerCfg is the pruner configuration for an Oasis runtime.
 type RuntimePrunerCfg struct {
 	Strategy string        `json:"strategy"`
@@ -86,6 +130,49 @@ func (rt *Runtime) Kind() registry.RuntimeKind {
 	return rt.kind
 }
 
+// TEEHardware returns the TEE hardware used by the runtime.
+func (rt *Runtime) TEEHardware() node.TEEHardware {
+	return rt.teeHardware
+}
+
+// MrEnclave returns the MRENCLAVE of the runtime's first enclave binary or nil in case the runtime
+// does not use Intel SGX.
+func (rt *Runtime) MrEnclave() *sgx.MrEnclave {
+	if len(rt.mrEnclaves) == 0 {
+		return nil
+	}
+	return rt.mrEnclaves[0]
+}
+
+// MrEnclaves returns the MRENCLAVEs of all of the runtime's enclave binaries.
+func (rt *Runtime) MrEnclaves() []*sgx.MrEnclave {
+	return rt.mrEnclaves
+}
+
+// MrSigner returns the runtime's MRSIGNER.
+func (rt *Runtime) MrSigner() *sgx.MrSigner {
+	return rt.mrSigner
+}
+
+// DescriptorPath returns the path to the runtime descriptor file.
+func (rt *Runtime) DescriptorPath() string {
+	return filepath.Join(rt.dir.String(), rtDescriptorFile)
+}
+
+// LoadDescriptor loads the runtime descriptor from the runtime descriptor file.
+func (rt *Runtime) LoadDescriptor() (*registry.Runtime, error) {
+	raw, err := ioutil.ReadFile(rt.DescriptorPath())
+	if err != nil {
+		return nil, fmt.Errorf("oasis/runtime: failed to read runtime descriptor: %w", err)
+	}
+
+	var descriptor registry.Runtime
+	if err = json.Unmarshal(raw, &descriptor); err != nil {
+		return nil, fmt.Errorf("oasis/runtime: failed to parse runtime descriptor: %w", err)
+	}
+	return &descriptor, nil
+}
+
 // GetEnclaveIdentity returns the runtime's enclave ID.
 func (rt *Runtime) GetEnclaveIdentity() *sgx.EnclaveIdentity {
 	if rt.mrEnclaves != nil && rt.mrSigner != nil {
@@ -130,7 +217,7 @@ func (rt *Runtime) toGenesisArgs() []string {
 	}
 
 	return []string{
-		"--runtime", filepath.Join(rt.dir.String(), rtDescriptorFile),
+		"--runtime", rt.DescriptorPath(),
 	}
 }
 
@@ -139,15 +226,54 @@ func (rt *Runtime) ToRuntimeDescriptor() registry.Runtime {
 	return rt.descriptor
 }
 
-// NewRuntime provisions a new runtime and adds it to the network.
-func (net *Network) NewRuntime(cfg *RuntimeCfg) (*Runtime, error) {
+// UpdateParameters updates the runtime descriptor based on the given configuration and rewrites
+// the descriptor file so that it can be used in a subsequent register runtime transaction.
+//
+// The runtime identifier, kind, owning entity and key manager binding are preserved, the
+// corresponding fields of the configuration are ignored.
+func (rt *Runtime) UpdateParameters(cfg RuntimeCfg) error {
+	rtVersion, binaries, err := cfg.resolveVersions()
+	if err != nil {
+		return err
+	}
+
+	descriptor := newRuntimeDescriptor(&cfg, rtVersion)
+	descriptor.ID = rt.id
+	descriptor.Kind = rt.kind
+	descriptor.EntityID = rt.descriptor.EntityID
+	descriptor.KeyManager = rt.descriptor.KeyManager
+	descriptor.Genesis = rt.descriptor.Genesis
+
+	rt.binaries = binaries
+	rt.teeHardware = cfg.TEEHardware
+	rt.mrSigner = cfg.MrSigner
+	rt.mrEnclaves = nil
+	rt.descriptor = descriptor
+
+	if err = rt.RefreshEnclaveIdentity(); err != nil {
+		return err
+	}
+	return rt.saveDescriptor()
+}
+
+// saveDescriptor saves the runtime descriptor into the descriptor file.
+func (rt *Runtime) saveDescriptor() error {
+	rtDescStr, _ := json.Marshal(rt.descriptor)
+	if err := ioutil.WriteFile(rt.DescriptorPath(), rtDescStr, 0o600); err != nil {
+		return fmt.Errorf("failed to write runtime descriptor to file: %w", err)
+	}
+	return nil
+}
+
+// newRuntimeDescriptor creates a runtime descriptor from the runtime provisioning configuration,
+// without the entity and key manager binding.
+func newRuntimeDescriptor(cfg *RuntimeCfg, rtVersion version.Version) registry.Runtime {
 	descriptor := registry.Runtime{
 		Versioned:       cbor.NewVersioned(registry.LatestRuntimeDescriptorVersion),
 		ID:              cfg.ID,
-		EntityID:        cfg.Entity.entity.ID,
 		Kind:            cfg.Kind,
 		TEEHardware:     cfg.TEEHardware,
-		Version:         registry.VersionInfo{Version: cfg.Version},
+		Version:         registry.VersionInfo{Version: rtVersion},
 		Executor:        cfg.Executor,
 		TxnScheduler:    cfg.TxnScheduler,
 		Storage:         cfg.Storage,
@@ -157,6 +283,69 @@ func (net *Network) NewRuntime(cfg *RuntimeCfg) (*Runtime, error) {
 		GovernanceModel: cfg.GovernanceModel,
 	}
 	descriptor.Genesis.StateRoot.Empty()
+	return descriptor
+}
+
+// NewRuntime provisions a new runtime and adds it to the network.
+func (net *Network) NewRuntime(cfg *RuntimeCfg) (*Runtime, error) {
+	rt, err := net.provisionRuntime(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	net.runtimes = append(net.runtimes, rt)
+
+	return rt, nil
+}
+
+// NewRuntimes concurrently provisions new runtimes and adds them to the network in the order of
+// the given configurations.
+//
+// In case provisioning of any runtime fails, no runtimes are added to the network.
+func (net *Network) NewRuntimes(cfgs []*RuntimeCfg) ([]*Runtime, error) {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(cfgs))
+		rts  = make([]*Runtime, len(cfgs))
+		sem  = make(chan struct{}, maxParallelRuntimeProvisioning)
+	)
+	for i, cfg := range cfgs {
+		wg.Add(1)
+		go func(i int, cfg *RuntimeCfg) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			rts[i], errs[i] = net.provisionRuntime(cfg)
+		}(i, cfg)
+	}
+	wg.Wait()
+
+	var result error
+	for i, err := range errs {
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("runtime %s: %w", cfgs[i].ID, err))
+		}
+	}
+	if result != nil {
+		return nil, result
+	}
+
+	net.runtimes = append(net.runtimes, rts...)
+
+	return rts, nil
+}
+
+// provisionRuntime provisions a new runtime without adding it to the network.
+func (net *Network) provisionRuntime(cfg *RuntimeCfg) (*Runtime, error) {
+	rtVersion, binaries, err := cfg.resolveVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor := newRuntimeDescriptor(cfg, rtVersion)
+	descriptor.EntityID = cfg.Entity.entity.ID
 
 	rtDir, err := net.baseDir.NewSubDir("runtime-" + cfg.ID.String())
 	if err != nil {
@@ -175,7 +364,7 @@ func (net *Network) NewRuntime(cfg *RuntimeCfg) (*Runtime, error) {
 		dir:                rtDir,
 		id:                 cfg.ID,
 		kind:               cfg.Kind,
-		binaries:           cfg.Binaries,
+		binaries:           binaries,
 		teeHardware:        cfg.TEEHardware,
 		mrSigner:           cfg.MrSigner,
 		pruner:             cfg.Pruner,
@@ -183,19 +372,15 @@ func (net *Network) NewRuntime(cfg *RuntimeCfg) (*Runtime, error) {
 		descriptor:         descriptor,
 	}
 
-	if err := rt.RefreshEnclaveIdentity(); err != nil {
+	if err = rt.RefreshEnclaveIdentity(); err != nil {
 		return nil, err
 	}
 
 	// Save runtime descriptor into file.
-	rtDescStr, _ := json.Marshal(rt.descriptor)
-	path := filepath.Join(rtDir.String(), rtDescriptorFile)
-	if err := ioutil.WriteFile(path, rtDescStr, 0o600); err != nil {
-		return nil, fmt.Errorf("failed to write runtime descriptor to file: %w", err)
+	if err = rt.saveDescriptor(); err != nil {
+		return nil, err
 	}
 
-	net.runtimes = append(net.runtimes, rt)
-
 	return rt, nil
 }
 
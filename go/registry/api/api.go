@@ -957,8 +957,9 @@ func VerifyRuntime( // nolint: gocyclo
 		return fmt.Errorf("%w: runtime governance model is not enabled: %s", ErrForbidden, rt.GovernanceModel.String())
 	}
 
-	// Ensure a valid TEE hardware is specified.
-	if rt.TEEHardware >= node.TEEHardwareReserved {
+	// Ensure a valid TEE hardware is specified. Runtimes requiring Intel TDX cannot be registered
+	// yet as there is no support for verifying TDX attestations.
+	if rt.TEEHardware >= node.TEEHardwareReserved || rt.TEEHardware == node.TEEHardwareIntelTDX {
 		logger.Error("RegisterRuntime: invalid TEE hardware specified",
 			"runtime", rt,
 		)
@@ -315,3 +315,74 @@ func TestHistoryPruneError(t *testing.T) {
 		require.NoError(err, "GetBlock(%d)", i)
 	}
 }
+
+func TestHistoryPruneComposite(t *testing.T) {
+	require := require.New(t)
+
+	// Create a new random temporary directory under /tmp.
+	dataDir, err := ioutil.TempDir("", "oasis-runtime-history-test_")
+	require.NoError(err, "TempDir")
+	defer os.RemoveAll(dataDir)
+
+	runtimeID := common.NewTestNamespaceFromSeed([]byte("history prune composite test ns"), 0)
+
+	history, err := New(dataDir, runtimeID, &Config{
+		Pruner: NewCompositePruner(
+			NewKeepLastPruner(10),
+			NewKeepDurationPruner(10*time.Minute),
+		),
+		PruneInterval: 100 * time.Millisecond,
+	})
+	require.NoError(err, "New")
+	defer history.Close()
+
+	// The keep duration pruner retains more rounds, so only the old rounds should be pruned.
+	ph := testPruneHandler{
+		doneCh:     make(chan struct{}),
+		waitRounds: 30,
+	}
+	history.Pruner().RegisterHandler(&ph)
+
+	// Create some blocks, the first 30 of which are old.
+	now := time.Now()
+	for i := 0; i <= 50; i++ {
+		blk := roothash.AnnotatedBlock{
+			Height: int64(i),
+			Block:  block.NewGenesisBlock(runtimeID, 0),
+		}
+		blk.Block.Header.Round = uint64(i)
+		blk.Block.Header.Timestamp = block.Timestamp(now.Unix())
+		if i < 30 {
+			blk.Block.Header.Timestamp = block.Timestamp(now.Add(-time.Hour).Unix())
+		}
+
+		err = history.Commit(&blk, nil)
+		require.NoError(err, "Commit")
+	}
+
+	// Wait for pruning to complete.
+	select {
+	case <-ph.doneCh:
+	case <-time.After(recvTimeout):
+		t.Fatalf("failed to wait for prune to complete")
+	}
+
+	// Wait for some more pruning to make sure nothing else gets pruned.
+	time.Sleep(200 * time.Millisecond)
+
+	for i := 0; i <= 50; i++ {
+		_, err = history.GetBlock(context.Background(), uint64(i))
+		if i < 30 {
+			require.Error(err, "GetBlock should fail for pruned block %d", i)
+			require.Equal(roothash.ErrNotFound, err)
+		} else {
+			require.NoError(err, "GetBlock(%d)", i)
+		}
+	}
+
+	// Ensure the prune handler was called.
+	require.Len(ph.prunedRounds, 30)
+	for i := 0; i < 30; i++ {
+		require.EqualValues(ph.prunedRounds[i], i)
+	}
+}
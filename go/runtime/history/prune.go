@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v3"
 
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	roothash "github.com/oasisprotocol/oasis-core/go/roothash/api"
 )
 
 const (
@@ -15,6 +18,9 @@ const (
 	PrunerStrategyNone = "none"
 	// PrunerStrategyKeepLast is the name of the keep last pruner strategy.
 	PrunerStrategyKeepLast = "keep_last"
+	// PrunerStrategyKeepLastAndDuration is the name of the pruner strategy
+	// that keeps both the last rounds and all rounds within a duration.
+	PrunerStrategyKeepLastAndDuration = "keep_last_and_duration"
 
 	// maxBatchSize is the maximum number of rounds to prune in one pass.
 	maxBatchSize = 64
@@ -63,42 +69,36 @@ func newPrunerBase() prunerBase {
 	return prunerBase{}
 }
 
-type nonePruner struct{}
-
-func (p *nonePruner) RegisterHandler(handler PruneHandler) {
-}
+// roundPruner is a pruner that can report the rounds it would prune.
+type roundPruner interface {
+	Pruner
 
-func (p *nonePruner) Prune(ctx context.Context, latestRound uint64) error {
-	return nil
+	// lastPrunableRound returns the last round that may be pruned, given
+	// the latest round. The boolean is false when nothing may be pruned.
+	lastPrunableRound(tx *badger.Txn, latestRound uint64) (uint64, bool, error)
 }
 
-// NewNonePruner creates a new pruner that never prunes anything.
-func NewNonePruner() PrunerFactory {
-	return func(db *DB) (Pruner, error) {
-		return &nonePruner{}, nil
-	}
-}
-
-type keepLastPruner struct {
-	prunerBase
-
-	logger *logging.Logger
-	db     *DB
-
-	numKept uint64
-}
-
-func (p *keepLastPruner) Prune(ctx context.Context, latestRound uint64) error {
-	if latestRound < p.numKept {
-		return nil
-	}
-
-	p.prunerBase.RLock()
-	defer p.prunerBase.RUnlock()
-
-	lastPrunedRound := latestRound - p.numKept
+// prune purges at most maxBatchSize rounds up to and including the last
+// prunable round, calling all registered prune handlers first.
+func (p *prunerBase) prune(
+	ctx context.Context,
+	logger *logging.Logger,
+	db *DB,
+	latestRound uint64,
+	lastPrunableRound func(tx *badger.Txn, latestRound uint64) (uint64, bool, error),
+) error {
+	p.RLock()
+	defer p.RUnlock()
+
+	return db.db.Update(func(tx *badger.Txn) error {
+		lastPrunedRound, ok, err := lastPrunableRound(tx, latestRound)
+		if err != nil {
+			return fmt.Errorf("runtime/history: failed to determine prunable rounds: %w", err)
+		}
+		if !ok {
+			return nil
+		}
 
-	return p.db.db.Update(func(tx *badger.Txn) error {
 		// NOTE: Do not prefetch values as we are only looking at keys.
 		it := tx.NewIterator(badger.IteratorOptions{
 			Prefix: blockKeyFmt.Encode(),
@@ -120,7 +120,7 @@ func (p *keepLastPruner) Prune(ctx context.Context, latestRound uint64) error {
 				break
 			}
 
-			if err := tx.Delete(roundResultsKeyFmt.Encode(round)); err != nil {
+			if err = tx.Delete(roundResultsKeyFmt.Encode(round)); err != nil {
 				if err == badger.ErrTxnTooBig {
 					// We can't prune any more rounds in this transaction.
 					break
@@ -128,7 +128,7 @@ func (p *keepLastPruner) Prune(ctx context.Context, latestRound uint64) error {
 				return err
 			}
 
-			if err := tx.Delete(item.KeyCopy(nil)); err != nil {
+			if err = tx.Delete(item.KeyCopy(nil)); err != nil {
 				return err
 			}
 
@@ -142,9 +142,9 @@ func (p *keepLastPruner) Prune(ctx context.Context, latestRound uint64) error {
 
 		// Before pruning anything, run all prune handlers. If any of them
 		// fails we abort the prune.
-		for _, ph := range p.prunerBase.handlers {
-			if err := ph.Prune(ctx, pruned); err != nil {
-				p.logger.Error("prune handler failed, aborting prune",
+		for _, ph := range p.handlers {
+			if err = ph.Prune(ctx, pruned); err != nil {
+				logger.Error("prune handler failed, aborting prune",
 					"err", err,
 					"round_count", len(pruned),
 					"round_min", pruned[0],
@@ -158,6 +158,46 @@ func (p *keepLastPruner) Prune(ctx context.Context, latestRound uint64) error {
 	})
 }
 
+type nonePruner struct{}
+
+func (p *nonePruner) RegisterHandler(handler PruneHandler) {
+}
+
+func (p *nonePruner) Prune(ctx context.Context, latestRound uint64) error {
+	return nil
+}
+
+func (p *nonePruner) lastPrunableRound(tx *badger.Txn, latestRound uint64) (uint64, bool, error) {
+	return 0, false, nil
+}
+
+// NewNonePruner creates a new pruner that never prunes anything.
+func NewNonePruner() PrunerFactory {
+	return func(db *DB) (Pruner, error) {
+		return &nonePruner{}, nil
+	}
+}
+
+type keepLastPruner struct {
+	prunerBase
+
+	logger *logging.Logger
+	db     *DB
+
+	numKept uint64
+}
+
+func (p *keepLastPruner) lastPrunableRound(tx *badger.Txn, latestRound uint64) (uint64, bool, error) {
+	if latestRound < p.numKept {
+		return 0, false, nil
+	}
+	return latestRound - p.numKept, true, nil
+}
+
+func (p *keepLastPruner) Prune(ctx context.Context, latestRound uint64) error {
+	return p.prunerBase.prune(ctx, p.logger, p.db, latestRound, p.lastPrunableRound)
+}
+
 // NewKeepLastPruner creates a pruner that keeps the last configured
 // number of rounds.
 func NewKeepLastPruner(numKept uint64) PrunerFactory {
@@ -170,3 +210,133 @@ func NewKeepLastPruner(numKept uint64) PrunerFactory {
 		}, nil
 	}
 }
+
+type keepDurationPruner struct {
+	prunerBase
+
+	logger *logging.Logger
+	db     *DB
+
+	keepDuration time.Duration
+}
+
+func (p *keepDurationPruner) lastPrunableRound(tx *badger.Txn, latestRound uint64) (uint64, bool, error) {
+	cutoff := time.Now().Add(-p.keepDuration).Unix()
+
+	it := tx.NewIterator(badger.IteratorOptions{
+		Prefix: blockKeyFmt.Encode(),
+	})
+	defer it.Close()
+
+	// Start with the smallest round and proceed forward until the first block that is recent
+	// enough. There is no need to look further than a single prune batch.
+	var (
+		lastRound uint64
+		ok        bool
+		scanned   int
+	)
+	for it.Rewind(); it.Valid() && scanned < maxBatchSize; it.Next() {
+		item := it.Item()
+
+		var round uint64
+		if !blockKeyFmt.Decode(item.Key(), &round) {
+			// This should not happen as the Badger iterator should take care of it.
+			panic("runtime/history: bad iterator")
+		}
+
+		// Always keep the latest round, even when the chain is stalled.
+		if round >= latestRound {
+			break
+		}
+
+		var blk roothash.AnnotatedBlock
+		if err := item.Value(func(val []byte) error {
+			return cbor.UnmarshalTrusted(val, &blk)
+		}); err != nil {
+			return 0, false, err
+		}
+		if int64(blk.Block.Header.Timestamp) >= cutoff {
+			break
+		}
+
+		lastRound = round
+		ok = true
+		scanned++
+	}
+	return lastRound, ok, nil
+}
+
+func (p *keepDurationPruner) Prune(ctx context.Context, latestRound uint64) error {
+	return p.prunerBase.prune(ctx, p.logger, p.db, latestRound, p.lastPrunableRound)
+}
+
+// NewKeepDurationPruner creates a pruner that keeps all rounds with a
+// block timestamp within the configured duration.
+func NewKeepDurationPruner(keepDuration time.Duration) PrunerFactory {
+	return func(db *DB) (Pruner, error) {
+		return &keepDurationPruner{
+			prunerBase:   newPrunerBase(),
+			logger:       logging.GetLogger("history/prune/keep_duration"),
+			db:           db,
+			keepDuration: keepDuration,
+		}, nil
+	}
+}
+
+type compositePruner struct {
+	prunerBase
+
+	logger *logging.Logger
+	db     *DB
+
+	pruners []roundPruner
+}
+
+func (p *compositePruner) lastPrunableRound(tx *badger.Txn, latestRound uint64) (uint64, bool, error) {
+	var lastRound uint64
+	for i, sp := range p.pruners {
+		round, ok, err := sp.lastPrunableRound(tx, latestRound)
+		if err != nil {
+			return 0, false, err
+		}
+		if !ok {
+			// A round is retained if any of the pruners would retain it.
+			return 0, false, nil
+		}
+		if i == 0 || round < lastRound {
+			lastRound = round
+		}
+	}
+	return lastRound, len(p.pruners) > 0, nil
+}
+
+func (p *compositePruner) Prune(ctx context.Context, latestRound uint64) error {
+	return p.prunerBase.prune(ctx, p.logger, p.db, latestRound, p.lastPrunableRound)
+}
+
+// NewCompositePruner creates a pruner that retains a round if any of
+// the given pruners would retain it.
+//
+// Prune handlers must be registered with the composite pruner as the
+// handlers of the individual pruners are never called.
+func NewCompositePruner(pruners ...PrunerFactory) PrunerFactory {
+	return func(db *DB) (Pruner, error) {
+		p := &compositePruner{
+			prunerBase: newPrunerBase(),
+			logger:     logging.GetLogger("history/prune/composite"),
+			db:         db,
+		}
+		for _, factory := range pruners {
+			sp, err := factory(db)
+			if err != nil {
+				return nil, err
+			}
+			rp, ok := sp.(roundPruner)
+			if !ok {
+				return nil, fmt.Errorf("runtime/history: pruner %T cannot be composed", sp)
+			}
+			p.pruners = append(p.pruners, rp)
+		}
+		return p, nil
+	}
+}
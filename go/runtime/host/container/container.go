@@ -0,0 +1,212 @@
+// Package container implements the runtime provisioner for runtimes in managed containers.
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/protocol"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox/process"
+)
+
+const (
+	containerMountBinary   = "/entrypoint"
+	containerHostname      = "oasis-runtime"
+	containerNamePrefix    = "oasis-runtime-"
+	containerNameRandBytes = 8
+)
+
+// Config contains the container provisioner configuration options.
+type Config struct {
+	// HostInfo provides information about the host environment.
+	HostInfo *protocol.HostInfo
+
+	// Logger is an optional logger to use with this provisioner. In case it is not specified a
+	// default logger will be created.
+	Logger *logging.Logger
+
+	// BinaryPath is the path to the container runtime binary (e.g., docker or podman).
+	BinaryPath string
+
+	// Image is the container image in which runtimes are executed.
+	//
+	// The image must provide any dynamic libraries required by the runtime binary as the binary
+	// itself is bind-mounted into the container.
+	Image string
+}
+
+type containerProcess struct {
+	process.Process
+
+	binaryPath string
+	name       string
+}
+
+// Implements process.Process.
+func (c *containerProcess) Kill() {
+	// Killing the client does not necessarily stop the container, so remove it explicitly.
+	_ = exec.Command(c.binaryPath, "rm", "--force", c.name).Run() // nolint: gosec
+	c.Process.Kill()
+}
+
+func containerArgs(cfg Config, pcfg process.Config, name, dataDir string) []string {
+	args := []string{
+		"run",
+		// Remove the container once the runtime exits.
+		"--rm",
+		"--name", name,
+		// Runtimes communicate with the host only over the bound socket.
+		"--network", "none",
+		// Drop all capabilities.
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		// Ensure all workers have the same hostname.
+		"--hostname", containerHostname,
+		// Temporary directory.
+		"--tmpfs", "/tmp",
+		// Entrypoint binary.
+		"--volume", pcfg.Path + ":" + containerMountBinary + ":ro",
+		"--entrypoint", containerMountBinary,
+	}
+	for _, key := range sortedKeys(pcfg.Env) {
+		args = append(args, "--env", key+"="+pcfg.Env[key])
+	}
+	for _, path := range sortedKeys(pcfg.BindRW) {
+		args = append(args, "--volume", path+":"+pcfg.BindRW[path])
+	}
+	for _, path := range sortedKeys(pcfg.BindRO) {
+		args = append(args, "--volume", path+":"+pcfg.BindRO[path]+":ro")
+	}
+	for _, path := range sortedKeys(pcfg.BindDev) {
+		args = append(args, "--device", path+":"+pcfg.BindDev[path])
+	}
+	for i, path := range sortedDataPaths(pcfg.BindData) {
+		args = append(args, "--volume", dataPath(dataDir, i)+":"+path+":ro")
+	}
+
+	args = append(args, cfg.Image)
+	// Append entrypoint binary args.
+	return append(args, pcfg.Args...)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedDataPaths(m map[string]io.Reader) []string {
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// dataPath returns the host path of the i-th bound data file.
+func dataPath(dataDir string, i int) string {
+	return filepath.Join(dataDir, strconv.Itoa(i))
+}
+
+func newContainer(cfg Config, pcfg process.Config) (process.Process, error) {
+	var rawName [containerNameRandBytes]byte
+	if _, err := rand.Read(rawName[:]); err != nil {
+		return nil, fmt.Errorf("container: failed to generate container name: %w", err)
+	}
+	name := containerNamePrefix + hex.EncodeToString(rawName[:])
+
+	// Write any bound data to files that get mounted into the container.
+	dataDir, err := ioutil.TempDir("", "oasis-runtime-container-data")
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to create data directory: %w", err)
+	}
+	var ok bool
+	defer func() {
+		if !ok {
+			_ = os.RemoveAll(dataDir)
+		}
+	}()
+
+	for i, path := range sortedDataPaths(pcfg.BindData) {
+		if err = writeBindData(dataPath(dataDir, i), pcfg.BindData[path]); err != nil {
+			return nil, fmt.Errorf("container: %w", err)
+		}
+	}
+
+	p, err := process.NewNaked(process.Config{
+		Path:   cfg.BinaryPath,
+		Args:   containerArgs(cfg, pcfg, name, dataDir),
+		Stdout: pcfg.Stdout,
+		Stderr: pcfg.Stderr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("container: failed to start container: %w", err)
+	}
+	ok = true
+
+	go func() {
+		<-p.Wait()
+		_ = os.RemoveAll(dataDir)
+	}()
+
+	return &containerProcess{
+		Process:    p,
+		binaryPath: cfg.BinaryPath,
+		name:       name,
+	}, nil
+}
+
+func writeBindData(path string, reader io.Reader) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write bound data: %w", err)
+	}
+	if _, err = io.Copy(file, reader); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to copy bound data: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failed to copy bound data: %w", err)
+	}
+	return nil
+}
+
+// New creates a new runtime provisioner that executes runtimes in managed containers.
+//
+// Only runtimes that do not require any TEE hardware are supported.
+func New(cfg Config) (host.Provisioner, error) {
+	if cfg.BinaryPath == "" {
+		return nil, fmt.Errorf("no container runtime binary configured")
+	}
+	if cfg.Image == "" {
+		return nil, fmt.Errorf("no container image configured")
+	}
+	// Use a default Logger if none was provided.
+	if cfg.Logger == nil {
+		cfg.Logger = logging.GetLogger("runtime/host/container")
+	}
+
+	return sandbox.New(sandbox.Config{
+		HostInfo: cfg.HostInfo,
+		Logger:   cfg.Logger,
+		NewSandbox: func(pcfg process.Config) (process.Process, error) {
+			return newContainer(cfg, pcfg)
+		},
+		SandboxBinaryPath: cfg.BinaryPath,
+	})
+}
@@ -0,0 +1,71 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox/process"
+)
+
+func TestContainerArgs(t *testing.T) {
+	require := require.New(t)
+
+	args := containerArgs(
+		Config{Image: "oasis/runtime:latest"},
+		process.Config{
+			Path: "/runtimes/simple-keyvalue",
+			Args: []string{"--foo"},
+			Env: map[string]string{
+				"OASIS_WORKER_HOST": "/host.sock",
+			},
+			BindRW: map[string]string{
+				"/tmp/runtime/host.sock": "/host.sock",
+			},
+			BindRO: map[string]string{
+				"/etc/resolv.conf": "/etc/resolv.conf",
+			},
+			BindDev: map[string]string{
+				"/dev/null": "/dev/null",
+			},
+			BindData: map[string]io.Reader{
+				"/b.data": bytes.NewBufferString("b"),
+				"/a.data": bytes.NewBufferString("a"),
+			},
+		},
+		"oasis-runtime-test",
+		"/tmp/data",
+	)
+	require.Equal([]string{
+		"run",
+		"--rm",
+		"--name", "oasis-runtime-test",
+		"--network", "none",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--hostname", containerHostname,
+		"--tmpfs", "/tmp",
+		"--volume", "/runtimes/simple-keyvalue:/entrypoint:ro",
+		"--entrypoint", "/entrypoint",
+		"--env", "OASIS_WORKER_HOST=/host.sock",
+		"--volume", "/tmp/runtime/host.sock:/host.sock",
+		"--volume", "/etc/resolv.conf:/etc/resolv.conf:ro",
+		"--device", "/dev/null:/dev/null",
+		"--volume", "/tmp/data/0:/a.data:ro",
+		"--volume", "/tmp/data/1:/b.data:ro",
+		"oasis/runtime:latest",
+		"--foo",
+	}, args, "container arguments should be built deterministically")
+}
+
+func TestNew(t *testing.T) {
+	require := require.New(t)
+
+	_, err := New(Config{Image: "oasis/runtime:latest"})
+	require.Error(err, "New should fail without a container runtime binary")
+
+	_, err = New(Config{BinaryPath: "/usr/bin/docker"})
+	require.Error(err, "New should fail without an image")
+}
@@ -3,6 +3,9 @@ package host
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
@@ -29,6 +32,85 @@ type Config struct {
 
 	// LocalConfig is the node-local runtime configuration.
 	LocalConfig map[string]interface{}
+
+	// Env are additional environment variables passed to the runtime process. Variables set by
+	// the provisioner itself take precedence.
+	Env map[string]string
+
+	// RestartPolicy is the policy used when restarting the runtime after it terminates or fails
+	// to start. The zero value retains the default behavior of restarting indefinitely.
+	RestartPolicy RestartPolicy
+}
+
+// ErrRestartLimitExceeded is the error reported when a runtime is no longer restarted because it
+// exceeded the maximum number of restarts allowed by its restart policy.
+var ErrRestartLimitExceeded = errors.New("runtime/host: restart limit exceeded")
+
+const (
+	// DefaultRestartInitialBackoff is the default initial backoff between runtime restarts.
+	DefaultRestartInitialBackoff = 500 * time.Millisecond
+	// DefaultRestartMaxBackoff is the default maximum backoff between runtime restarts.
+	DefaultRestartMaxBackoff = 60 * time.Second
+)
+
+// RestartPolicy is the runtime restart policy.
+type RestartPolicy struct {
+	// MaxRestarts is the maximum number of restarts allowed within Window. After the limit is
+	// reached the runtime is no longer restarted. Zero means that the number of restarts is not
+	// limited.
+	MaxRestarts uint64
+
+	// InitialBackoff is the initial backoff between consecutive failed restarts. Zero means
+	// DefaultRestartInitialBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the maximum backoff between consecutive failed restarts. Zero means
+	// DefaultRestartMaxBackoff.
+	MaxBackoff time.Duration
+
+	// Window is the sliding time window over which restarts are counted. It must be set iff
+	// MaxRestarts is non-zero.
+	Window time.Duration
+}
+
+// ValidateBasic performs basic restart policy validity checks.
+func (rp *RestartPolicy) ValidateBasic() error {
+	if rp.InitialBackoff < 0 {
+		return fmt.Errorf("initial backoff must not be negative")
+	}
+	if rp.MaxBackoff < 0 {
+		return fmt.Errorf("maximum backoff must not be negative")
+	}
+	if rp.GetMaxBackoff() < rp.GetInitialBackoff() {
+		return fmt.Errorf("maximum backoff (%s) must not be smaller than initial backoff (%s)",
+			rp.GetMaxBackoff(), rp.GetInitialBackoff(),
+		)
+	}
+	switch {
+	case rp.Window < 0:
+		return fmt.Errorf("restart window must not be negative")
+	case rp.MaxRestarts > 0 && rp.Window == 0:
+		return fmt.Errorf("restart window must be set when maximum restarts are limited")
+	case rp.MaxRestarts == 0 && rp.Window != 0:
+		return fmt.Errorf("restart window requires maximum restarts to be set")
+	}
+	return nil
+}
+
+// GetInitialBackoff returns the initial backoff, taking defaults into account.
+func (rp *RestartPolicy) GetInitialBackoff() time.Duration {
+	if rp.InitialBackoff == 0 {
+		return DefaultRestartInitialBackoff
+	}
+	return rp.InitialBackoff
+}
+
+// GetMaxBackoff returns the maximum backoff, taking defaults into account.
+func (rp *RestartPolicy) GetMaxBackoff() time.Duration {
+	if rp.MaxBackoff == 0 {
+		return DefaultRestartMaxBackoff
+	}
+	return rp.MaxBackoff
 }
 
 // Provisioner is the runtime provisioner interface.
@@ -260,6 +260,12 @@ type CheckTxMetadata struct {
 
 	// Weight are runtime specific transaction weights.
 	Weights map[transaction.Weight]uint64 `json:"weights,omitempty"`
+
+	// Sender is an opaque identifier of the transaction sender (if any).
+	Sender []byte `json:"sender,omitempty"`
+
+	// SenderSeq is the per-sender sequence number (nonce) of the transaction.
+	SenderSeq uint64 `json:"sender_seq,omitempty"`
 }
 
 // IsSuccess returns true if transaction execution was successful.
@@ -275,7 +281,7 @@ func (r *CheckTxResult) ToCheckedTransaction(rawTx []byte) *transaction.CheckedT
 	case nil:
 		return transaction.NewCheckedTransaction(rawTx, 0, nil)
 	default:
-		return transaction.NewCheckedTransaction(rawTx, r.Meta.Priority, r.Meta.Weights)
+		return transaction.NewCheckedTransactionWithSender(rawTx, r.Meta.Priority, r.Meta.Weights, string(r.Meta.Sender), r.Meta.SenderSeq)
 	}
 }
 
@@ -187,6 +187,21 @@ func NewBubbleWrap(cfg Config) (Process, error) {
 		return nil, err
 	}
 
+	// Apply any resource limits. This must happen before the configuration arguments are sent as
+	// the sandbox only spawns the entrypoint binary after receiving them. Limits were explicitly
+	// requested, so failing to enforce them is an error.
+	if !cfg.Limits.IsEmpty() {
+		cleanup, lerr := applyLimits(n.GetPID(), cfg.Limits)
+		if lerr != nil {
+			n.Kill()
+			return nil, fmt.Errorf("sandbox: failed to apply resource limits: %w", lerr)
+		}
+		go func() {
+			<-n.Wait()
+			cleanup()
+		}()
+	}
+
 	// Send configuration arguments.
 	for _, arg := range fdArgs {
 		if _, err = fdArgsPipe.Write([]byte(arg + "\x00")); err != nil {
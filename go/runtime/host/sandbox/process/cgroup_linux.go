@@ -0,0 +1,198 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	cgroupCPUPeriod = 100000
+
+	// accessWrite is the access(2) mode checking for write permission (W_OK).
+	accessWrite = 0x2
+
+	// nodeCgroupLeaf is the name of the leaf cgroup into which the processes of the node's own
+	// cgroup are moved. Cgroup v2 does not allow enabling controllers for child cgroups of a
+	// (non-root) cgroup that contains processes itself.
+	nodeCgroupLeaf = "oasis-node"
+)
+
+var (
+	// cgroupRoot is the mount point of the cgroup v2 hierarchy.
+	cgroupRoot = "/sys/fs/cgroup"
+	// selfCgroupPath is the path of the file describing the cgroup membership of the node.
+	selfCgroupPath = "/proc/self/cgroup"
+
+	// writeCgroupFile writes the given value into a cgroup interface file.
+	writeCgroupFile = func(path, value string) error {
+		return ioutil.WriteFile(path, []byte(value), 0o644) // nolint: gosec
+	}
+	// checkWritable checks whether the given cgroup path is writable by the node.
+	checkWritable = func(path string) error {
+		return syscall.Access(path, accessWrite)
+	}
+)
+
+// applyLimits moves the process with the given PID into a new cgroup that enforces the given
+// resource limits and returns a function that removes the cgroup once the process has exited.
+//
+// As cgroup v2 only allows enabling controllers for child cgroups of cgroups without processes of
+// their own, all processes of the node's cgroup are moved into a leaf cgroup first. This requires
+// the node's cgroup to be delegated to the node.
+func applyLimits(pid int, limits *Limits) (func(), error) {
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%w: cgroup v2 is not mounted at %s", ErrCgroupUnavailable, cgroupRoot)
+	}
+	self, err := selfCgroup()
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Join(cgroupRoot, self)
+	if filepath.Base(parent) == nodeCgroupLeaf {
+		// The node has already been moved into its leaf cgroup by a previous invocation.
+		parent = filepath.Dir(parent)
+	}
+
+	limitFiles := make(map[string]string)
+	var controllers []string
+	if limits.MemoryBytes > 0 {
+		controllers = append(controllers, "memory")
+		limitFiles["memory.max"] = strconv.FormatUint(limits.MemoryBytes, 10)
+	}
+	if limits.CPUQuota > 0 {
+		controllers = append(controllers, "cpu")
+		quota := uint64(limits.CPUQuota * cgroupCPUPeriod)
+		limitFiles["cpu.max"] = fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)
+	}
+
+	// Make sure the required controllers are available and enabled for child cgroups.
+	rawAvailable, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCgroupUnavailable, err)
+	}
+	available := strings.Fields(string(rawAvailable))
+	for _, c := range controllers {
+		if !containsString(available, c) {
+			return nil, fmt.Errorf("%w: %s controller is not available", ErrCgroupUnavailable, c)
+		}
+	}
+
+	// Make sure the node can manage its cgroup before changing anything.
+	for _, path := range []string{
+		parent,
+		filepath.Join(parent, "cgroup.procs"),
+		filepath.Join(parent, "cgroup.subtree_control"),
+	} {
+		if err = checkWritable(path); err != nil {
+			return nil, fmt.Errorf("%w: %s is not writable (%s), delegate the cgroup to the node (e.g., Delegate=yes in the systemd unit)",
+				ErrCgroupNotDelegated, path, err,
+			)
+		}
+	}
+
+	// Controllers can only be enabled for child cgroups once the parent has no processes of its
+	// own, so move them into a leaf cgroup first. The root cgroup is exempt from this rule.
+	if parent != filepath.Clean(cgroupRoot) {
+		if err = moveToLeafCgroup(parent, pid); err != nil {
+			return nil, fmt.Errorf("failed to move node processes into a leaf cgroup: %w", err)
+		}
+	}
+	for _, c := range controllers {
+		if err = writeCgroupFile(filepath.Join(parent, "cgroup.subtree_control"), "+"+c); err != nil {
+			return nil, fmt.Errorf("failed to enable %s controller in %s: %w", c, parent, err)
+		}
+	}
+
+	dir := filepath.Join(parent, fmt.Sprintf("oasis-runtime-%d", pid))
+	if err = os.Mkdir(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	cleanup := func() {
+		_ = os.Remove(dir)
+	}
+
+	for name, value := range limitFiles {
+		if err = writeCgroupFile(filepath.Join(dir, name), value); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	if err = writeCgroupFile(filepath.Join(dir, "cgroup.procs"), strconv.Itoa(pid)); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to move process into cgroup: %w", err)
+	}
+	return cleanup, nil
+}
+
+// moveToLeafCgroup moves all processes of the given cgroup, except for the process with the given
+// PID, into the node leaf cgroup.
+func moveToLeafCgroup(parent string, skipPid int) error {
+	rawProcs, err := ioutil.ReadFile(filepath.Join(parent, "cgroup.procs"))
+	if err != nil {
+		return err
+	}
+	var pids []string
+	for _, pid := range strings.Fields(string(rawProcs)) {
+		if pid != strconv.Itoa(skipPid) {
+			pids = append(pids, pid)
+		}
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+
+	leaf := filepath.Join(parent, nodeCgroupLeaf)
+	if err = os.Mkdir(leaf, 0o755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	for _, pid := range pids {
+		err = writeCgroupFile(filepath.Join(leaf, "cgroup.procs"), pid)
+		switch {
+		case err == nil:
+		case errors.Is(err, syscall.ESRCH):
+			// Process has exited in the meantime.
+		default:
+			return fmt.Errorf("failed to move process %s: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// selfCgroup returns the cgroup v2 path of the current process.
+func selfCgroup() (string, error) {
+	f, err := os.Open(selfCgroupPath)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrCgroupUnavailable, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: process is not in a cgroup v2 hierarchy", ErrCgroupUnavailable)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestCgroup sets up a fake cgroup v2 hierarchy with the node in a service cgroup.
+func setupTestCgroup(t *testing.T) string {
+	require := require.New(t)
+
+	root := t.TempDir()
+	service := filepath.Join(root, "service")
+	require.NoError(os.Mkdir(service, 0o755))
+	for path, content := range map[string]string{
+		filepath.Join(root, "cgroup.controllers"):        "cpu memory",
+		filepath.Join(root, "self"):                      "0::/service\n",
+		filepath.Join(service, "cgroup.controllers"):     "cpu memory",
+		filepath.Join(service, "cgroup.procs"):           "100\n200\n",
+		filepath.Join(service, "cgroup.subtree_control"): "",
+	} {
+		require.NoError(ioutil.WriteFile(path, []byte(content), 0o644))
+	}
+
+	origRoot, origSelf, origWrite, origCheck := cgroupRoot, selfCgroupPath, writeCgroupFile, checkWritable
+	cgroupRoot, selfCgroupPath = root, filepath.Join(root, "self")
+	t.Cleanup(func() {
+		cgroupRoot, selfCgroupPath, writeCgroupFile, checkWritable = origRoot, origSelf, origWrite, origCheck
+	})
+	return service
+}
+
+func TestApplyLimits(t *testing.T) {
+	require := require.New(t)
+
+	service := setupTestCgroup(t)
+
+	cleanup, err := applyLimits(200, &Limits{MemoryBytes: 1024})
+	require.NoError(err, "applyLimits")
+
+	// Node processes should be moved into a leaf cgroup, but not the sandboxed process.
+	procs, err := ioutil.ReadFile(filepath.Join(service, nodeCgroupLeaf, "cgroup.procs"))
+	require.NoError(err)
+	require.Equal("100", string(procs), "node processes should be moved into the leaf cgroup")
+
+	rtCgroup := filepath.Join(service, "oasis-runtime-200")
+	memoryMax, err := ioutil.ReadFile(filepath.Join(rtCgroup, "memory.max"))
+	require.NoError(err)
+	require.Equal("1024", string(memoryMax), "memory limit should be set")
+	procs, err = ioutil.ReadFile(filepath.Join(rtCgroup, "cgroup.procs"))
+	require.NoError(err)
+	require.Equal("200", string(procs), "sandboxed process should be moved into its cgroup")
+
+	// Remove the limit files, as a real cgroup directory would not contain any.
+	require.NoError(os.Remove(filepath.Join(rtCgroup, "memory.max")))
+	require.NoError(os.Remove(filepath.Join(rtCgroup, "cgroup.procs")))
+	cleanup()
+	_, err = os.Stat(rtCgroup)
+	require.True(os.IsNotExist(err), "cgroup should be removed")
+}
+
+func TestApplyLimitsBusy(t *testing.T) {
+	require := require.New(t)
+
+	setupTestCgroup(t)
+	writeCgroupFile = func(path, value string) error {
+		if filepath.Base(path) == "cgroup.subtree_control" {
+			return &os.PathError{Op: "write", Path: path, Err: syscall.EBUSY}
+		}
+		return ioutil.WriteFile(path, []byte(value), 0o644)
+	}
+
+	_, err := applyLimits(200, &Limits{CPUQuota: 1.5})
+	require.Error(err, "applyLimits should fail when controllers cannot be enabled")
+	require.ErrorIs(err, syscall.EBUSY, "the underlying error should be surfaced")
+	require.NotErrorIs(err, ErrCgroupUnavailable, "failing to enable controllers should not be reported as missing support")
+}
+
+func TestApplyLimitsNotDelegated(t *testing.T) {
+	require := require.New(t)
+
+	service := setupTestCgroup(t)
+	checkWritable = func(path string) error {
+		if filepath.Base(path) == "cgroup.subtree_control" {
+			return syscall.EACCES
+		}
+		return nil
+	}
+
+	_, err := applyLimits(200, &Limits{MemoryBytes: 1024})
+	require.ErrorIs(err, ErrCgroupNotDelegated, "applyLimits should fail when the cgroup is not delegated")
+	_, err = os.Stat(filepath.Join(service, nodeCgroupLeaf))
+	require.True(os.IsNotExist(err), "node processes should not be moved")
+}
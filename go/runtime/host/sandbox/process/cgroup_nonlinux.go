@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import "fmt"
+
+func applyLimits(pid int, limits *Limits) (func(), error) {
+	return nil, fmt.Errorf("%w: cgroups are only supported on Linux", ErrCgroupUnavailable)
+}
@@ -0,0 +1,49 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MinCPUQuota is the minimum CPU quota, expressed as a number of CPUs, that can be enforced. It
+// corresponds to the minimum cgroup CPU bandwidth quota of 1ms per 100ms period.
+const MinCPUQuota = 0.01
+
+// ErrCgroupUnavailable is the error returned when resource limits cannot be enforced because the
+// kernel lacks support for the required cgroup controllers.
+//
+// Since limits are only applied when explicitly configured, failing to apply them causes the
+// sandboxed process to fail to start.
+var ErrCgroupUnavailable = errors.New("sandbox: required cgroup controllers are not available")
+
+// ErrCgroupNotDelegated is the error returned when resource limits cannot be enforced because the
+// node is not allowed to manage its own cgroup (e.g., the systemd unit does not set Delegate=yes).
+var ErrCgroupNotDelegated = errors.New("sandbox: node cgroup is not delegated to the node")
+
+// Limits are the resource limits applied to the sandboxed process.
+//
+// Limits are enforced via cgroups (v2). Zero values mean that the given resource is not limited.
+type Limits struct {
+	// MemoryBytes is the maximum amount of memory (in bytes) the sandboxed process can use.
+	MemoryBytes uint64
+
+	// CPUQuota is the maximum amount of CPU time the sandboxed process can use, expressed as a
+	// number of CPUs (e.g., 1.5 allows using one and a half CPUs).
+	CPUQuota float64
+}
+
+// Validate checks that the limits can be enforced.
+func (l *Limits) Validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.CPUQuota < 0 || (l.CPUQuota > 0 && l.CPUQuota < MinCPUQuota) {
+		return fmt.Errorf("CPU quota must be at least %g CPUs (got %g)", MinCPUQuota, l.CPUQuota)
+	}
+	return nil
+}
+
+// IsEmpty returns true iff no resource is limited.
+func (l *Limits) IsEmpty() bool {
+	return l == nil || (l.MemoryBytes == 0 && l.CPUQuota <= 0)
+}
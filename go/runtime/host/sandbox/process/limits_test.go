@@ -0,0 +1,30 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits *Limits
+		valid  bool
+	}{
+		{"Nil", nil, true},
+		{"Unlimited", &Limits{}, true},
+		{"MinCPUQuota", &Limits{CPUQuota: MinCPUQuota}, true},
+		{"CPUQuotaTooSmall", &Limits{CPUQuota: 0.000001}, false},
+		{"NegativeCPUQuota", &Limits{CPUQuota: -1}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.limits.Validate()
+			if tc.valid {
+				require.NoError(t, err, "Validate")
+				return
+			}
+			require.Error(t, err, "Validate")
+		})
+	}
+}
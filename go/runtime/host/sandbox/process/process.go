@@ -42,6 +42,10 @@ type Config struct {
 	// SandboxBinaryPath is the path to the sandbox support binary.
 	SandboxBinaryPath string
 
+	// Limits are the resource limits applied to the sandboxed process. They are only enforced by
+	// the bubblewrap sandbox. If not specified, no limits are enforced.
+	Limits *Limits
+
 	extraFiles []*os.File
 }
 
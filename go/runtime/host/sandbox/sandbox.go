@@ -51,11 +51,20 @@ type Config struct {
 	// default logger will be created.
 	Logger *logging.Logger
 
+	// NewSandbox is a function that spawns the sandboxed runtime process. In case it is not
+	// specified the bubblewrap sandbox is used.
+	NewSandbox func(cfg process.Config) (process.Process, error)
+
 	// SandboxBinaryPath is the path to the sandbox support binary.
 	SandboxBinaryPath string
 
 	// InsecureNoSandbox disables the sandbox and runs the runtime binary directly.
 	InsecureNoSandbox bool
+
+	// Limits are the resource limits applied to sandboxed runtimes unless the sandbox configuration
+	// specifies its own. If not specified, no limits are enforced. Limits are not enforced when
+	// running without a sandbox.
+	Limits *process.Limits
 }
 
 type provisioner struct {
@@ -239,6 +248,7 @@ func (r *sandboxedRuntime) startProcess() (err error) {
 		if cErr != nil {
 			return fmt.Errorf("failed to configure process: %w", cErr)
 		}
+		applyRuntimeEnv(&cfg, r.rtCfg.Env)
 
 		p, err = process.NewNaked(cfg)
 		if err != nil {
@@ -250,13 +260,17 @@ func (r *sandboxedRuntime) startProcess() (err error) {
 		if cErr != nil {
 			return fmt.Errorf("failed to configure sandbox: %w", cErr)
 		}
+		applyRuntimeEnv(&cfg, r.rtCfg.Env)
 
 		if cfg.BindRW == nil {
 			cfg.BindRW = make(map[string]string)
 		}
 		cfg.BindRW[hostSocket] = bindHostSocketPath
+		if cfg.Limits == nil {
+			cfg.Limits = r.cfg.Limits
+		}
 
-		p, err = process.NewBubbleWrap(cfg)
+		p, err = r.cfg.NewSandbox(cfg)
 		if err != nil {
 			return fmt.Errorf("failed to spawn sandbox: %w", err)
 		}
@@ -440,7 +454,12 @@ func (r *sandboxedRuntime) manager() {
 		close(r.quitCh)
 	}()
 
-	var attempt int
+	var (
+		attempt  int
+		initial  = true
+		restarts []time.Time
+	)
+	rp := r.rtCfg.RestartPolicy
 	for {
 		// Make sure to restart the process if terminated.
 		if r.process == nil {
@@ -449,6 +468,27 @@ func (r *sandboxedRuntime) manager() {
 				r.logger.Warn("termination requested")
 				return
 			case <-tickerCh:
+				// Enforce the restart limit, if any.
+				if !initial && rp.MaxRestarts > 0 {
+					now := time.Now()
+					restarts = pruneRestarts(restarts, now.Add(-rp.Window))
+					if uint64(len(restarts)) >= rp.MaxRestarts {
+						r.logger.Error("runtime restart limit exceeded, not restarting",
+							"max_restarts", rp.MaxRestarts,
+							"window", rp.Window,
+						)
+
+						r.notifier.Broadcast(&host.Event{
+							FailedToStart: &host.FailedToStartEvent{
+								Error: host.ErrRestartLimitExceeded,
+							},
+						})
+						return
+					}
+					restarts = append(restarts, now)
+				}
+				initial = false
+
 				attempt++
 				r.logger.Info("starting runtime",
 					"attempt", attempt,
@@ -467,7 +507,10 @@ func (r *sandboxedRuntime) manager() {
 					})
 
 					if ticker == nil {
-						ticker = backoff.NewTicker(cmnBackoff.NewExponentialBackOff())
+						boff := cmnBackoff.NewExponentialBackOff()
+						boff.InitialInterval = rp.GetInitialBackoff()
+						boff.MaxInterval = rp.GetMaxBackoff()
+						ticker = backoff.NewTicker(boff)
 						tickerCh = ticker.C
 					}
 					continue
@@ -532,6 +575,10 @@ func New(cfg Config) (host.Provisioner, error) {
 			}, nil
 		}
 	}
+	// Use the bubblewrap sandbox if no NewSandbox was provided.
+	if cfg.NewSandbox == nil {
+		cfg.NewSandbox = process.NewBubbleWrap
+	}
 	// Make sure host environment information was provided in HostInfo.
 	if cfg.HostInfo == nil {
 		return nil, fmt.Errorf("no host information provided")
@@ -556,3 +603,29 @@ func New(cfg Config) (host.Provisioner, error) {
 	}
 	return &provisioner{cfg: cfg}, nil
 }
+
+// applyRuntimeEnv adds the configured runtime environment variables to the process configuration
+// without overriding any variables set by the provisioner.
+func applyRuntimeEnv(cfg *process.Config, env map[string]string) {
+	if len(env) == 0 {
+		return
+	}
+	if cfg.Env == nil {
+		cfg.Env = make(map[string]string)
+	}
+	for key, value := range env {
+		if _, exists := cfg.Env[key]; exists {
+			continue
+		}
+		cfg.Env[key] = value
+	}
+}
+
+// pruneRestarts removes all restart timestamps that are before the given cutoff.
+func pruneRestarts(restarts []time.Time, cutoff time.Time) []time.Time {
+	var i int
+	for i < len(restarts) && restarts[i].Before(cutoff) {
+		i++
+	}
+	return restarts[i:]
+}
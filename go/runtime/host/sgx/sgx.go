@@ -66,6 +66,10 @@ type Config struct {
 
 	// InsecureNoSandbox disables the sandbox and runs the loader directly.
 	InsecureNoSandbox bool
+
+	// Limits are the resource limits applied to the sandboxed loader. If not specified, no limits
+	// are enforced.
+	Limits *process.Limits
 }
 
 // RuntimeExtra is the extra configuration for SGX runtimes.
@@ -146,7 +150,10 @@ func (s *sgxProvisioner) loadEnclaveBinaries(rtCfg host.Config) ([]byte, []byte,
 	return sgxs, sig, nil
 }
 
-func (s *sgxProvisioner) discoverSGXDevice() (string, error) {
+// DiscoverDevice probes the system for SGX support and returns the path of the SGX device.
+//
+// An error is returned in case no SGX device is available.
+func DiscoverDevice() (string, error) {
 	// Different versions of Intel SGX drivers provide different names for
 	// the SGX device.  Autodetect which one actually exists.
 	sgxDevices := []string{"/dev/sgx", "/dev/sgx/enclave", "/dev/sgx_enclave", "/dev/isgx"}
@@ -179,7 +186,7 @@ func (s *sgxProvisioner) getSandboxConfig(rtCfg host.Config, socketPath, runtime
 		return process.Config{}, fmt.Errorf("host/sgx: failed to load enclave/signature: %w", err)
 	}
 
-	sgxDev, err := s.discoverSGXDevice()
+	sgxDev, err := DiscoverDevice()
 	if err != nil {
 		return process.Config{}, fmt.Errorf("host/sgx: %w", err)
 	}
@@ -398,6 +405,7 @@ func New(cfg Config) (host.Provisioner, error) {
 		HostInfo:          cfg.HostInfo,
 		HostInitializer:   s.hostInitializer,
 		InsecureNoSandbox: cfg.InsecureNoSandbox,
+		Limits:            cfg.Limits,
 		Logger:            s.logger,
 	})
 	if err != nil {
@@ -0,0 +1,122 @@
+// Package tdx implements the runtime provisioner for runtimes in Intel TDX trust domains.
+package tdx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/protocol"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox/process"
+)
+
+const (
+	// kvmDevicePath is the path to the KVM device used to launch trust domains.
+	kvmDevicePath = "/dev/kvm"
+
+	sandboxMountRuntime = "/runtime"
+)
+
+// Config contains TDX-specific provisioner configuration options.
+type Config struct {
+	// HostInfo provides information about the host environment.
+	HostInfo *protocol.HostInfo
+
+	// LoaderPath is the path to the runtime loader binary.
+	LoaderPath string
+
+	// SandboxBinaryPath is the path to the sandbox support binary.
+	SandboxBinaryPath string
+
+	// InsecureNoSandbox disables the sandbox and runs the loader directly.
+	InsecureNoSandbox bool
+
+	// Limits are the resource limits applied to the sandboxed loader. If not specified, no limits
+	// are enforced.
+	Limits *process.Limits
+}
+
+type tdxProvisioner struct {
+	cfg Config
+
+	sandbox        host.Provisioner
+	discoverDevice func() (string, error)
+	logger         *logging.Logger
+}
+
+// DiscoverDevice returns the path of the device required to launch trust domains.
+func DiscoverDevice() (string, error) {
+	if _, err := os.Stat(kvmDevicePath); err != nil {
+		return "", fmt.Errorf("no KVM device was found on this system: %w", err)
+	}
+	return kvmDevicePath, nil
+}
+
+func (t *tdxProvisioner) getSandboxConfig(rtCfg host.Config, socketPath, runtimeDir string) (process.Config, error) {
+	runtimePath := sandboxMountRuntime
+	if t.cfg.InsecureNoSandbox {
+		runtimePath = rtCfg.Path
+	}
+
+	kvmDev, err := t.discoverDevice()
+	if err != nil {
+		return process.Config{}, fmt.Errorf("host/tdx: %w", err)
+	}
+	t.logger.Info("found KVM device", "path", kvmDev)
+
+	cfg := process.Config{
+		Path: t.cfg.LoaderPath,
+		Args: []string{
+			"--host-socket", socketPath,
+			runtimePath,
+		},
+		BindDev: map[string]string{
+			kvmDev: kvmDev,
+		},
+		SandboxBinaryPath: t.cfg.SandboxBinaryPath,
+	}
+	if !t.cfg.InsecureNoSandbox {
+		cfg.BindRO = map[string]string{
+			filepath.Clean(rtCfg.Path): sandboxMountRuntime,
+		}
+	}
+	return cfg, nil
+}
+
+// Implements host.Provisioner.
+func (t *tdxProvisioner) NewRuntime(ctx context.Context, cfg host.Config) (host.Runtime, error) {
+	return t.sandbox.NewRuntime(ctx, cfg)
+}
+
+// New creates a new Intel TDX runtime provisioner.
+//
+// Runtimes are launched through the configured loader which is responsible for setting up the
+// trust domain. Attestation of TDX runtimes is not yet supported.
+func New(cfg Config) (host.Provisioner, error) {
+	if cfg.LoaderPath == "" {
+		return nil, fmt.Errorf("host/tdx: no loader configured")
+	}
+
+	t := &tdxProvisioner{
+		cfg:            cfg,
+		discoverDevice: DiscoverDevice,
+		logger:         logging.GetLogger("runtime/host/tdx"),
+	}
+	p, err := sandbox.New(sandbox.Config{
+		GetSandboxConfig:  t.getSandboxConfig,
+		HostInfo:          cfg.HostInfo,
+		InsecureNoSandbox: cfg.InsecureNoSandbox,
+		Limits:            cfg.Limits,
+		Logger:            t.logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.sandbox = p
+
+	return t, nil
+}
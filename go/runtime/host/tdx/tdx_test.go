@@ -0,0 +1,130 @@
+package tdx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/version"
+	tendermint "github.com/oasisprotocol/oasis-core/go/consensus/tendermint/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/protocol"
+	"github.com/oasisprotocol/oasis-core/go/runtime/host/tests"
+)
+
+const mockDevicePath = "/dev/null"
+
+// mockLoader is a runtime loader that runs the runtime directly instead of in a trust domain. It
+// accepts the same arguments as the real loader.
+const mockLoader = `#!/bin/sh
+[ "$#" -eq 3 ] && [ "$1" = "--host-socket" ] || exit 1
+OASIS_WORKER_HOST="$2" exec "$3"
+`
+
+var envRuntimePath = os.Getenv("OASIS_TEST_RUNTIME_HOST_RUNTIME_PATH")
+
+func mockDiscoverDevice() (string, error) {
+	return mockDevicePath, nil
+}
+
+func newTestProvisioner(cfg Config) (host.Provisioner, error) {
+	p, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.(*tdxProvisioner).discoverDevice = mockDiscoverDevice
+	return p, nil
+}
+
+func writeMockLoader(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "loader")
+	err := ioutil.WriteFile(path, []byte(mockLoader), 0o700) // nolint: gosec
+	require.NoError(t, err, "WriteFile")
+	return path
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{
+		HostInfo: &protocol.HostInfo{},
+	})
+	require.Error(t, err, "New should fail without a loader")
+}
+
+func TestSandboxConfig(t *testing.T) {
+	rtCfg := host.Config{
+		Path: "/path/to/runtime",
+	}
+
+	for _, tc := range []struct {
+		name              string
+		insecureNoSandbox bool
+		runtimePath       string
+		bindRO            map[string]string
+	}{
+		{"Naked", true, rtCfg.Path, nil},
+		{"Sandboxed", false, sandboxMountRuntime, map[string]string{rtCfg.Path: sandboxMountRuntime}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			p, err := newTestProvisioner(Config{
+				HostInfo:          &protocol.HostInfo{},
+				LoaderPath:        "/path/to/loader",
+				SandboxBinaryPath: "/path/to/bwrap",
+				InsecureNoSandbox: tc.insecureNoSandbox,
+			})
+			require.NoError(err, "New")
+
+			cfg, err := p.(*tdxProvisioner).getSandboxConfig(rtCfg, "/path/to/socket", "/path/to/runtime-dir")
+			require.NoError(err, "getSandboxConfig")
+			require.Equal("/path/to/loader", cfg.Path, "loader should be executed")
+			require.Equal([]string{"--host-socket", "/path/to/socket", tc.runtimePath}, cfg.Args, "only arguments supported by the loader should be passed")
+			require.Equal(map[string]string{mockDevicePath: mockDevicePath}, cfg.BindDev, "KVM device should be bound")
+			require.Equal(tc.bindRO, cfg.BindRO)
+			require.Equal("/path/to/bwrap", cfg.SandboxBinaryPath)
+		})
+	}
+
+	t.Run("NoDevice", func(t *testing.T) {
+		require := require.New(t)
+
+		p, err := New(Config{
+			HostInfo:   &protocol.HostInfo{},
+			LoaderPath: "/path/to/loader",
+		})
+		require.NoError(err, "New")
+		p.(*tdxProvisioner).discoverDevice = func() (string, error) {
+			return "", fmt.Errorf("no KVM device")
+		}
+
+		_, err = p.(*tdxProvisioner).getSandboxConfig(rtCfg, "/path/to/socket", "/path/to/runtime-dir")
+		require.Error(err, "getSandboxConfig should fail without a KVM device")
+	})
+}
+
+func TestProvisionerTDX(t *testing.T) {
+	// Skip test if there is no runtime configured.
+	if envRuntimePath == "" {
+		t.Skip("skipping as OASIS_TEST_RUNTIME_HOST_RUNTIME_PATH is not set")
+	}
+
+	cfg := host.Config{
+		Path: envRuntimePath,
+	}
+	loaderPath := writeMockLoader(t)
+
+	tests.TestProvisioner(t, cfg, func() (host.Provisioner, error) {
+		return newTestProvisioner(Config{
+			HostInfo: &protocol.HostInfo{
+				ConsensusBackend:         tendermint.BackendName,
+				ConsensusProtocolVersion: version.Versions.ConsensusProtocol,
+			},
+			LoaderPath:        loaderPath,
+			InsecureNoSandbox: true,
+		})
+	}, nil)
+}
@@ -4,23 +4,30 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
 	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
 	ias "github.com/oasisprotocol/oasis-core/go/ias/api"
 	cmdFlags "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/flags"
 	"github.com/oasisprotocol/oasis-core/go/runtime/history"
 	runtimeHost "github.com/oasisprotocol/oasis-core/go/runtime/host"
+	hostContainer "github.com/oasisprotocol/oasis-core/go/runtime/host/container"
 	hostMock "github.com/oasisprotocol/oasis-core/go/runtime/host/mock"
 	hostProtocol "github.com/oasisprotocol/oasis-core/go/runtime/host/protocol"
 	hostSandbox "github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox"
+	hostProcess "github.com/oasisprotocol/oasis-core/go/runtime/host/sandbox/process"
 	hostSgx "github.com/oasisprotocol/oasis-core/go/runtime/host/sgx"
+	hostTdx "github.com/oasisprotocol/oasis-core/go/runtime/host/tdx"
 )
 
 const (
@@ -31,10 +38,42 @@ const (
 	// CfgRuntimePaths confgures the paths for supported runtimes.
 	//
 	// The value should be a map of runtime IDs to corresponding resource paths (type of the
-	// resource depends on the provisioner).
+	// resource depends on the provisioner). Instead of a local path, an https:// URL with a
+	// #sha256=<hex> checksum fragment may be given in which case the resource is downloaded
+	// into the runtime's cache directory.
 	CfgRuntimePaths = "runtime.paths"
+	// CfgRuntimeAllowedIDs configures the runtime IDs that are allowed to be hosted.
+	//
+	// If empty, all runtime IDs are allowed.
+	CfgRuntimeAllowedIDs = "runtime.allowed_ids"
 	// CfgSandboxBinary configures the runtime sandbox binary location.
 	CfgSandboxBinary = "runtime.sandbox.binary"
+	// CfgSandboxMemoryLimit configures the maximum amount of memory a sandboxed runtime can use.
+	//
+	// When unset, memory usage is not limited. Limits are enforced via cgroups (v2) and in case
+	// the limit cannot be enforced (e.g., the required cgroup controller is not available or the
+	// node's cgroup is not delegated to the node) the runtime fails to start.
+	//
+	// Note that enforcing any limit moves all processes in the node's cgroup into a new
+	// oasis-node child cgroup as cgroup v2 does not allow enabling controllers otherwise.
+	CfgSandboxMemoryLimit = "runtime.sandbox.memory_limit"
+	// CfgSandboxCPUQuota configures the maximum amount of CPU time, expressed as a number of CPUs,
+	// a sandboxed runtime can use.
+	//
+	// When unset, CPU usage is not limited. The quota must be at least 0.01 CPUs. Limits are
+	// enforced the same way as CfgSandboxMemoryLimit.
+	CfgSandboxCPUQuota = "runtime.sandbox.cpu_quota"
+	// CfgBinaryRetryAttempts configures the number of times the existence of the sandbox or
+	// container runtime binary is rechecked before failing. This is useful in deployments where
+	// the binary may only appear shortly after the node starts.
+	CfgBinaryRetryAttempts = "runtime.binary_retry.attempts"
+	// CfgBinaryRetryDelay configures the delay between checks for the existence of the sandbox or
+	// container runtime binary.
+	CfgBinaryRetryDelay = "runtime.binary_retry.delay"
+	// CfgContainerBinary configures the container runtime binary location.
+	CfgContainerBinary = "runtime.container.binary"
+	// CfgContainerImage configures the container image used by the container provisioner.
+	CfgContainerImage = "runtime.container.image"
 	// CfgRuntimeSGXLoader configures the runtime loader binary required for SGX runtimes.
 	//
 	// The same loader is used for all runtimes.
@@ -43,10 +82,33 @@ const (
 	//
 	// The value should be a map of runtime IDs to corresponding resource paths.
 	CfgRuntimeSGXSignatures = "runtime.sgx.signatures"
+	// CfgRuntimeTDXLoader configures the runtime loader binary required for TDX runtimes.
+	//
+	// The same loader is used for all runtimes.
+	CfgRuntimeTDXLoader = "runtime.tdx.loader"
 
 	// CfgRuntimeConfig configures node-local runtime configuration.
+	//
+	// The value should be a map of runtime IDs to runtime configuration. The reserved provisioner
+	// key may be used to override CfgRuntimeProvisioner for a specific runtime and is not passed
+	// to the runtime.
+	//
+	// The reserved env key may be used to configure a map of environment variables that are
+	// passed to the runtime process. As configuration keys are case-insensitive, variable names
+	// are converted to upper case.
 	CfgRuntimeConfig = "runtime.config"
 
+	// CfgRuntimeRestart configures per-runtime restart policies.
+	//
+	// The value should be a map of runtime IDs to restart policies, each containing any of the
+	// max_restarts, initial_backoff, max_backoff and window keys. By default runtimes are
+	// restarted indefinitely using an exponential backoff between 500ms and 60s.
+	CfgRuntimeRestart = "runtime.restart"
+
+	// CfgRuntimeDrainTimeout configures the maximum time to wait for in-flight rounds of a runtime
+	// that has been removed from the configuration to complete before it is stopped.
+	CfgRuntimeDrainTimeout = "runtime.drain_timeout"
+
 	// CfgHistoryPrunerStrategy configures the history pruner strategy.
 	CfgHistoryPrunerStrategy = "runtime.history.pruner.strategy"
 	// CfgHistoryPrunerInterval configures the history pruner interval.
@@ -54,11 +116,30 @@ const (
 	// CfgHistoryPrunerKeepLastNum configures the number of last kept
 	// rounds when using the "keep last" pruner strategy.
 	CfgHistoryPrunerKeepLastNum = "runtime.history.pruner.num_kept"
+	// CfgHistoryPrunerKeepDuration configures the duration for which rounds
+	// are kept when using the "keep last and duration" pruner strategy.
+	CfgHistoryPrunerKeepDuration = "runtime.history.pruner.keep_duration"
 
 	// CfgRuntimeMode configures how the runtime workers should behave on this node.
 	CfgRuntimeMode = "runtime.mode"
 )
 
+const (
+	// runtimeConfigProvisionerKey is the reserved key in the node-local runtime configuration that
+	// overrides the configured runtime provisioner.
+	runtimeConfigProvisionerKey = "provisioner"
+	// runtimeConfigEnvKey is the reserved key in the node-local runtime configuration that
+	// configures environment variables passed to the runtime process.
+	runtimeConfigEnvKey = "env"
+
+	// runtimeEnvReservedPrefix is the prefix of environment variables reserved for use by the
+	// runtime provisioners.
+	runtimeEnvReservedPrefix = "OASIS_"
+)
+
+// runtimeEnvKeyRegexp is the regular expression that valid environment variable names match.
+var runtimeEnvKeyRegexp = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
 // Flags has the configuration flags.
 var Flags = flag.NewFlagSet("", flag.ContinueOnError)
 
@@ -75,6 +156,16 @@ const (
 	// RuntimeProvisionerSandboxed is the name of the sandboxed runtime provisioner that executes
 	// runtimes as regular processes in a Linux namespaces/cgroups/SECCOMP sandbox.
 	RuntimeProvisionerSandboxed = "sandboxed"
+	// RuntimeProvisionerContainer is the name of the container runtime provisioner that executes
+	// runtimes inside containers managed by a container runtime (e.g., docker or podman).
+	RuntimeProvisionerContainer = "container"
+
+	// provisionerNameSGX is the name reported for the Intel SGX provisioner that is used when an
+	// SGX loader is configured.
+	provisionerNameSGX = "sgx"
+	// provisionerNameTDX is the name reported for the Intel TDX provisioner that is used when a
+	// TDX loader is configured.
+	provisionerNameTDX = "tdx"
 )
 
 // RuntimeMode defines the behavior of runtime workers on this node.
@@ -96,6 +187,11 @@ const (
 	// stateless client for all the configured runtimes. No state is kept locally and the node must
 	// connect to remote nodes to perform any runtime queries.
 	RuntimeModeClientStateless RuntimeMode = "client-stateless"
+	// RuntimeModeMaintenance is the runtime mode where the node hosts and keeps all configured
+	// runtimes (and their state) synced, but intentionally does not register and does not take
+	// part in any committees. This is useful for warming up new compute nodes before they start
+	// participating.
+	RuntimeModeMaintenance RuntimeMode = "maintenance"
 )
 
 // UnmarshalText decodes a text marshaled runtime mode.
@@ -111,6 +207,8 @@ func (m *RuntimeMode) UnmarshalText(text []byte) error {
 		*m = RuntimeModeClient
 	case string(RuntimeModeClientStateless):
 		*m = RuntimeModeClientStateless
+	case string(RuntimeModeMaintenance):
+		*m = RuntimeModeMaintenance
 	default:
 		return fmt.Errorf("invalid mode: %s", string(text))
 	}
@@ -136,6 +234,9 @@ func (cfg *RuntimeConfig) Runtimes() (runtimes []common.Namespace) {
 		return
 	}
 
+	cfg.Host.lock.Lock()
+	defer cfg.Host.lock.Unlock()
+
 	for id := range cfg.Host.Runtimes {
 		runtimes = append(runtimes, id)
 	}
@@ -147,12 +248,196 @@ type RuntimeHostConfig struct {
 	// Provisioners contains a set of supported runtime provisioners, based on TEE hardware.
 	Provisioners map[node.TEEHardware]runtimeHost.Provisioner
 
+	// RuntimeProvisioners contains per-runtime provisioner overrides, based on TEE hardware. Runtimes
+	// without an override use Provisioners.
+	//
+	// After initialization the map may only be accessed while holding the lock as it is updated
+	// when the configuration is reloaded.
+	RuntimeProvisioners map[common.Namespace]map[node.TEEHardware]runtimeHost.Provisioner
+
 	// Runtimes contains per-runtime provisioning configuration. Some fields may be omitted as they
 	// are provided when the runtime is provisioned.
+	//
+	// After initialization the map may only be accessed while holding the lock as it is updated
+	// when the configuration is reloaded.
 	Runtimes map[common.Namespace]*runtimeHost.Config
+
+	lock   sync.Mutex
+	hosted map[common.Namespace]*hostedRuntime
+
+	provisioner      string
+	provisionerNames map[node.TEEHardware]string
+	overrides        map[common.Namespace]string
+	newProvisioners  func(string) (map[node.TEEHardware]runtimeHost.Provisioner, map[node.TEEHardware]string, error)
+	provisioners     map[string]map[node.TEEHardware]runtimeHost.Provisioner
+}
+
+// ProvisionersFor returns the set of runtime provisioners, based on TEE hardware, that should be
+// used for the given runtime.
+func (rh *RuntimeHostConfig) ProvisionersFor(id common.Namespace) map[node.TEEHardware]runtimeHost.Provisioner {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	if provisioners, ok := rh.RuntimeProvisioners[id]; ok {
+		return provisioners
+	}
+	return rh.Provisioners
+}
+
+// setRuntimeProvisioners replaces the per-runtime provisioner overrides, creating any provisioners
+// that have not been used before.
+func (rh *RuntimeHostConfig) setRuntimeProvisioners(overrides map[common.Namespace]string) error {
+	// Determine which provisioners already exist.
+	available := make(map[string]map[node.TEEHardware]runtimeHost.Provisioner)
+	rh.lock.Lock()
+	for _, p := range overrides {
+		if provisioners, ok := rh.provisioners[p]; ok {
+			available[p] = provisioners
+		}
+	}
+	rh.lock.Unlock()
+
+	// Create any missing provisioners without holding the lock as this may need to access the
+	// filesystem.
+	for id, p := range overrides {
+		if _, ok := available[p]; ok {
+			continue
+		}
+		provisioners, _, err := rh.newProvisioners(p)
+		if err != nil {
+			return fmt.Errorf("failed to configure provisioner for runtime '%s': %w", id, err)
+		}
+		available[p] = provisioners
+	}
+
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	if rh.provisioners == nil {
+		rh.provisioners = make(map[string]map[node.TEEHardware]runtimeHost.Provisioner)
+	}
+
+	runtimeProvisioners := make(map[common.Namespace]map[node.TEEHardware]runtimeHost.Provisioner)
+	for id, p := range overrides {
+		// Prefer provisioners created concurrently by someone else so that they are shared.
+		provisioners, ok := rh.provisioners[p]
+		if !ok {
+			provisioners = available[p]
+			rh.provisioners[p] = provisioners
+		}
+		runtimeProvisioners[id] = provisioners
+	}
+	rh.RuntimeProvisioners = runtimeProvisioners
+	rh.overrides = overrides
+	return nil
+}
+
+// RuntimeConfig returns the provisioning configuration for the given runtime or nil in case the
+// runtime is not configured.
+func (rh *RuntimeHostConfig) RuntimeConfig(id common.Namespace) *runtimeHost.Config {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	return rh.Runtimes[id]
+}
+
+// setRuntimeConfig updates the provisioning configuration for the given runtime.
+func (rh *RuntimeHostConfig) setRuntimeConfig(id common.Namespace, cfg *runtimeHost.Config) {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	rh.Runtimes[id] = cfg
+}
+
+// addRuntimeConfig adds the provisioning configuration for a newly configured runtime. In case the
+// runtime has been drained before, it may be provisioned again.
+func (rh *RuntimeHostConfig) addRuntimeConfig(id common.Namespace, cfg *runtimeHost.Config) {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	rh.Runtimes[id] = cfg
+	if hr := rh.hosted[id]; hr != nil {
+		hr.draining = false
+	}
+}
+
+// removeRuntimeConfig removes the provisioning configuration for the given runtime.
+func (rh *RuntimeHostConfig) removeRuntimeConfig(id common.Namespace) {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	delete(rh.Runtimes, id)
+}
+
+// statBinary checks that the given binary exists, rechecking up to the configured number of
+// attempts in case it does not exist yet.
+func statBinary(path string) error {
+	attempts := viper.GetUint(CfgBinaryRetryAttempts)
+	delay := viper.GetDuration(CfgBinaryRetryDelay)
+
+	for attempt := uint(0); ; attempt++ {
+		_, err := os.Stat(path)
+		if err == nil || !os.IsNotExist(err) || attempt >= attempts {
+			return err
+		}
+
+		logging.GetLogger("runtime/registry/config").Warn("binary does not exist, retrying",
+			"path", path,
+			"attempt", attempt+1,
+			"max_attempts", attempts,
+			"delay", delay,
+		)
+		time.Sleep(delay)
+	}
 }
 
-func newConfig(consensus consensus.Backend, ias ias.Endpoint) (*RuntimeConfig, error) {
+// checkSGXConfig probes for SGX support and warns about likely SGX misconfiguration.
+//
+// The SGX loader is never configured automatically as it must be explicitly provided.
+func checkSGXConfig(sgxLoader string, haveSGXRuntimes bool) {
+	sgxDev, err := hostSgx.DiscoverDevice()
+	if msg, kvs := sgxConfigWarning(sgxDev, err, sgxLoader, haveSGXRuntimes); msg != "" {
+		logging.GetLogger("runtime/registry/config").Warn(msg, kvs...)
+	}
+}
+
+// sgxConfigWarning returns the warning (and its context) to emit in case the SGX configuration
+// does not match the result of SGX device discovery. An empty message is returned if the
+// configuration is consistent.
+func sgxConfigWarning(sgxDev string, discoverErr error, sgxLoader string, haveSGXRuntimes bool) (string, []interface{}) {
+	switch {
+	case discoverErr == nil && sgxLoader == "" && haveSGXRuntimes:
+		return "SGX is available but no SGX loader is configured, SGX runtimes will run without SGX", []interface{}{
+			"sgx_device", sgxDev,
+			"config_key", CfgRuntimeSGXLoader,
+		}
+	case discoverErr != nil && sgxLoader != "":
+		return "SGX loader is configured, but SGX does not seem to be available", []interface{}{
+			"err", discoverErr,
+		}
+	default:
+		return "", nil
+	}
+}
+
+func getRestartPolicy(runtimeID string) (*runtimeHost.RestartPolicy, error) {
+	var rp runtimeHost.RestartPolicy
+	sub := viper.Sub(CfgRuntimeRestart + "." + runtimeID)
+	if sub == nil {
+		return &rp, nil
+	}
+
+	rp.MaxRestarts = sub.GetUint64("max_restarts")
+	rp.InitialBackoff = sub.GetDuration("initial_backoff")
+	rp.MaxBackoff = sub.GetDuration("max_backoff")
+	rp.Window = sub.GetDuration("window")
+	if err := rp.ValidateBasic(); err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
+func newConfig(dataDir string, consensus consensus.Backend, ias ias.Endpoint) (*RuntimeConfig, error) {
 	var cfg RuntimeConfig
 
 	// Parse configured runtime mode.
@@ -161,17 +446,16 @@ func newConfig(consensus consensus.Backend, ias ias.Endpoint) (*RuntimeConfig, e
 	}
 
 	// Validate configured runtimes based on the runtime mode.
-	switch cfg.Mode {
-	case RuntimeModeNone:
-		// No runtimes should be configured.
-		if viper.IsSet(CfgRuntimePaths) && !cmdFlags.DebugDontBlameOasis() {
-			return nil, fmt.Errorf("no runtimes should be configured when not in runtime mode")
-		}
-	default:
-		// In any other mode, at least one runtime should be configured.
-		if !viper.IsSet(CfgRuntimePaths) && !cmdFlags.DebugDontBlameOasis() {
-			return nil, fmt.Errorf("at least one runtime must be configured when in runtime mode")
-		}
+	if err := validateRuntimeMode(cfg.Mode); err != nil {
+		return nil, err
+	}
+
+	// Hosting runtimes contradicts the stateless client mode as no state should be kept locally.
+	if cfg.Mode == RuntimeModeClientStateless && viper.IsSet(CfgRuntimePaths) {
+		logging.GetLogger("runtime/registry/config").Warn("runtimes are configured to be hosted in stateless client mode, some runtime state will be kept locally",
+			"mode", cfg.Mode,
+			"config_key", CfgRuntimePaths,
+		)
 	}
 
 	// Check if any runtimes are configured to be hosted.
@@ -194,149 +478,528 @@ func newConfig(consensus consensus.Backend, ias ias.Endpoint) (*RuntimeConfig, e
 		}
 
 		// Register provisioners based on the configured provisioner.
-		var insecureNoSandbox bool
-		sandboxBinary := viper.GetString(CfgSandboxBinary)
-		rh.Provisioners = make(map[node.TEEHardware]runtimeHost.Provisioner)
-		switch p := viper.GetString(CfgRuntimeProvisioner); p {
-		case RuntimeProvisionerMock:
-			// Mock provisioner, only supported when the runtime requires no TEE hardware.
-			if !cmdFlags.DebugDontBlameOasis() {
-				return nil, fmt.Errorf("mock provisioner requires use of unsafe debug flags")
-			}
+		rh.newProvisioners = func(p string) (map[node.TEEHardware]runtimeHost.Provisioner, map[node.TEEHardware]string, error) {
+			return newProvisioners(p, hostInfo, ias)
+		}
+		rh.provisioner = viper.GetString(CfgRuntimeProvisioner)
+		if rh.Provisioners, rh.provisionerNames, err = rh.newProvisioners(rh.provisioner); err != nil {
+			return nil, err
+		}
+
+		// Configure runtimes.
+		var overrides map[common.Namespace]string
+		if rh.Runtimes, overrides, err = loadRuntimes(dataDir); err != nil {
+			return nil, err
+		}
+		if err = rh.setRuntimeProvisioners(overrides); err != nil {
+			return nil, err
+		}
+
+		cfg.Host = &rh
+	}
+
+	// Maintenance mode only makes sense when runtimes can actually be hosted.
+	if cfg.Mode == RuntimeModeMaintenance && cfg.Host == nil {
+		return nil, fmt.Errorf("maintenance mode requires runtimes to be hosted")
+	}
 
-			rh.Provisioners[node.TEEHardwareInvalid] = hostMock.New()
-		case RuntimeProvisionerUnconfined:
-			// Unconfined provisioner, can be used with no TEE or with Intel SGX.
-			if !cmdFlags.DebugDontBlameOasis() {
-				return nil, fmt.Errorf("unconfined provisioner requires use of unsafe debug flags")
+	historyCfg, err := newHistoryConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.History = *historyCfg
+
+	return &cfg, nil
+}
+
+// ValidateConfig validates the runtime registry configuration and returns all detected problems.
+//
+// In contrast to creating a runtime registry the validation has no side effects: remote runtime
+// resources are not fetched into the data directory and runtime provisioners are not created, so
+// binaries they require (e.g., the sandbox binary) need not be present.
+func ValidateConfig(dataDir string) []error {
+	var mode RuntimeMode
+	if err := mode.UnmarshalText([]byte(viper.GetString(CfgRuntimeMode))); err != nil {
+		return []error{fmt.Errorf("failed to parse mode: %w", err)}
+	}
+
+	var errs []error
+	if err := validateRuntimeMode(mode); err != nil {
+		errs = append(errs, err)
+	}
+
+	if viper.IsSet(CfgRuntimePaths) {
+		provisioner := viper.GetString(CfgRuntimeProvisioner)
+		if err := validateProvisioner(provisioner); err != nil {
+			errs = append(errs, err)
+		}
+		if err := newSandboxLimits().Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("bad sandbox resource limits: %w", err))
+		}
+		validated := map[string]bool{provisioner: true}
+
+		allowedIDs, err := parseAllowedRuntimeIDs()
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		// Validate runtimes in a deterministic order so that diagnostics are stable.
+		paths := viper.GetStringMapString(CfgRuntimePaths)
+		runtimeIDs := make([]string, 0, len(paths))
+		for runtimeID := range paths {
+			runtimeIDs = append(runtimeIDs, runtimeID)
+		}
+		sort.Strings(runtimeIDs)
+
+		for _, runtimeID := range runtimeIDs {
+			var override string
+			if _, override, err = loadRuntime(dataDir, runtimeID, paths[runtimeID], allowedIDs, true); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if override == "" || validated[override] {
+				continue
+			}
+			validated[override] = true
+			if err = validateProvisioner(override); err != nil {
+				errs = append(errs, fmt.Errorf("failed to configure provisioner for runtime '%s': %w", runtimeID, err))
 			}
+		}
+		if len(runtimeIDs) == 0 {
+			errs = append(errs, fmt.Errorf("no runtimes configured"))
+		}
+	} else if mode == RuntimeModeMaintenance {
+		errs = append(errs, fmt.Errorf("maintenance mode requires runtimes to be hosted"))
+	}
+
+	if _, err := newHistoryConfig(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateRuntimeMode validates the configured runtimes based on the given runtime mode.
+func validateRuntimeMode(mode RuntimeMode) error {
+	switch mode {
+	case RuntimeModeNone:
+		// No runtimes should be configured.
+		if viper.IsSet(CfgRuntimePaths) && !cmdFlags.DebugDontBlameOasis() {
+			return fmt.Errorf("no runtimes should be configured when not in runtime mode")
+		}
+	case RuntimeModeKeymanager:
+		// Exactly one runtime (the key manager runtime) should be configured.
+		if n := len(viper.GetStringMapString(CfgRuntimePaths)); n != 1 {
+			return fmt.Errorf("keymanager mode requires exactly one runtime path (the key manager runtime) in %s, got %d",
+				CfgRuntimePaths,
+				n,
+			)
+		}
+	default:
+		// In any other mode, at least one runtime should be configured.
+		if !viper.IsSet(CfgRuntimePaths) && !cmdFlags.DebugDontBlameOasis() {
+			return fmt.Errorf("at least one runtime must be configured when in runtime mode")
+		}
+	}
+	return nil
+}
+
+// newHistoryConfig creates the runtime history keeper configuration.
+func newHistoryConfig() (*history.Config, error) {
+	var cfg history.Config
+
+	strategy := viper.GetString(CfgHistoryPrunerStrategy)
+	switch strings.ToLower(strategy) {
+	case history.PrunerStrategyNone:
+		cfg.Pruner = history.NewNonePruner()
+	case history.PrunerStrategyKeepLast:
+		numKept := viper.GetUint64(CfgHistoryPrunerKeepLastNum)
+		cfg.Pruner = history.NewKeepLastPruner(numKept)
+	case history.PrunerStrategyKeepLastAndDuration:
+		numKept := viper.GetUint64(CfgHistoryPrunerKeepLastNum)
+		keepDuration := viper.GetDuration(CfgHistoryPrunerKeepDuration)
+		if keepDuration <= 0 {
+			return nil, fmt.Errorf("runtime/registry: %s must be positive when using the %s history pruner strategy",
+				CfgHistoryPrunerKeepDuration,
+				strategy,
+			)
+		}
+		cfg.Pruner = history.NewCompositePruner(
+			history.NewKeepLastPruner(numKept),
+			history.NewKeepDurationPruner(keepDuration),
+		)
+	default:
+		return nil, fmt.Errorf("runtime/registry: unknown history pruner strategy: %s", strategy)
+	}
+
+	cfg.PruneInterval = viper.GetDuration(CfgHistoryPrunerInterval)
+	const minPruneInterval = 1 * time.Second
+	if cfg.PruneInterval < minPruneInterval {
+		cfg.PruneInterval = minPruneInterval
+	}
+
+	return &cfg, nil
+}
+
+// validateProvisioner checks that the given runtime provisioner is supported by the current
+// configuration without creating it or checking that the binaries it requires exist.
+func validateProvisioner(p string) error {
+	switch p {
+	case RuntimeProvisionerMock, RuntimeProvisionerUnconfined:
+		if !cmdFlags.DebugDontBlameOasis() {
+			return fmt.Errorf("%s provisioner requires use of unsafe debug flags", p)
+		}
+	case RuntimeProvisionerSandboxed:
+	case RuntimeProvisionerContainer:
+		if !newSandboxLimits().IsEmpty() {
+			return fmt.Errorf("container provisioner does not support resource limits (%s, %s)", CfgSandboxMemoryLimit, CfgSandboxCPUQuota)
+		}
+		if viper.GetString(CfgRuntimeSGXLoader) != "" {
+			return fmt.Errorf("container provisioner does not support SGX runtimes")
+		}
+		if viper.GetString(CfgRuntimeTDXLoader) != "" {
+			return fmt.Errorf("container provisioner does not support TDX runtimes")
+		}
+	default:
+		return fmt.Errorf("unsupported runtime provisioner: %s", p)
+	}
+	return nil
+}
+
+// newSandboxLimits returns the configured resource limits of sandboxed runtimes.
+func newSandboxLimits() *hostProcess.Limits {
+	return &hostProcess.Limits{
+		MemoryBytes: uint64(viper.GetSizeInBytes(CfgSandboxMemoryLimit)),
+		CPUQuota:    viper.GetFloat64(CfgSandboxCPUQuota),
+	}
+}
+
+// newProvisioners creates the set of runtime provisioners, based on TEE hardware, for the given
+// provisioner name. It also returns the name of the provisioner that actually handles each TEE
+// hardware as some TEE hardware may be remapped or handled by a dedicated provisioner.
+func newProvisioners(
+	p string,
+	hostInfo *hostProtocol.HostInfo,
+	ias ias.Endpoint,
+) (map[node.TEEHardware]runtimeHost.Provisioner, map[node.TEEHardware]string, error) {
+	var (
+		err               error
+		insecureNoSandbox bool
+	)
+	sandboxBinary := viper.GetString(CfgSandboxBinary)
+	sandboxLimits := newSandboxLimits()
+	if err = sandboxLimits.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("bad sandbox resource limits: %w", err)
+	}
+	provisioners := make(map[node.TEEHardware]runtimeHost.Provisioner)
+	names := make(map[node.TEEHardware]string)
+	switch p {
+	case RuntimeProvisionerMock:
+		// Mock provisioner, only supported when the runtime requires no TEE hardware.
+		if !cmdFlags.DebugDontBlameOasis() {
+			return nil, nil, fmt.Errorf("mock provisioner requires use of unsafe debug flags")
+		}
+
+		provisioners[node.TEEHardwareInvalid] = hostMock.New()
+		names[node.TEEHardwareInvalid] = p
+	case RuntimeProvisionerUnconfined:
+		// Unconfined provisioner, can be used with no TEE or with Intel SGX/TDX.
+		if !cmdFlags.DebugDontBlameOasis() {
+			return nil, nil, fmt.Errorf("unconfined provisioner requires use of unsafe debug flags")
+		}
 
-			insecureNoSandbox = true
+		insecureNoSandbox = true
 
-			fallthrough
-		case RuntimeProvisionerSandboxed:
-			if !insecureNoSandbox {
-				if _, err = os.Stat(sandboxBinary); err != nil {
-					return nil, fmt.Errorf("failed to stat sandbox binary: %w", err)
-				}
+		fallthrough
+	case RuntimeProvisionerSandboxed:
+		if !insecureNoSandbox {
+			if err = statBinary(sandboxBinary); err != nil {
+				return nil, nil, fmt.Errorf("failed to stat sandbox binary: %w", err)
 			}
+		}
+
+		// Sandboxed provisioner, can be used with no TEE or with Intel SGX/TDX.
+		provisioners[node.TEEHardwareInvalid], err = hostSandbox.New(hostSandbox.Config{
+			HostInfo:          hostInfo,
+			InsecureNoSandbox: insecureNoSandbox,
+			SandboxBinaryPath: sandboxBinary,
+			Limits:            sandboxLimits,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create runtime provisioner: %w", err)
+		}
+		names[node.TEEHardwareInvalid] = p
 
-			// Sandboxed provisioner, can be used with no TEE or with Intel SGX.
-			rh.Provisioners[node.TEEHardwareInvalid], err = hostSandbox.New(hostSandbox.Config{
+		sgxLoader := viper.GetString(CfgRuntimeSGXLoader)
+		checkSGXConfig(sgxLoader, len(viper.GetStringMapString(CfgRuntimeSGXSignatures)) > 0)
+
+		switch sgxLoader {
+		case "":
+			// No SGX loader is configured, remap to non-SGX.
+			provisioners[node.TEEHardwareIntelSGX], err = hostSandbox.New(hostSandbox.Config{
 				HostInfo:          hostInfo,
 				InsecureNoSandbox: insecureNoSandbox,
 				SandboxBinaryPath: sandboxBinary,
+				Limits:            sandboxLimits,
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create runtime provisioner: %w", err)
+			}
+			names[node.TEEHardwareIntelSGX] = p
+		default:
+			// Configure the provided SGX loader.
+			provisioners[node.TEEHardwareIntelSGX], err = hostSgx.New(hostSgx.Config{
+				HostInfo:          hostInfo,
+				LoaderPath:        sgxLoader,
+				IAS:               ias,
+				SandboxBinaryPath: sandboxBinary,
+				InsecureNoSandbox: insecureNoSandbox,
+				Limits:            sandboxLimits,
 			})
 			if err != nil {
-				return nil, fmt.Errorf("failed to create runtime provisioner: %w", err)
+				return nil, nil, fmt.Errorf("failed to create SGX runtime provisioner: %w", err)
 			}
+			names[node.TEEHardwareIntelSGX] = provisionerNameSGX
+		}
 
-			switch sgxLoader := viper.GetString(CfgRuntimeSGXLoader); sgxLoader {
-			case "":
-				// No SGX loader is configured, remap to non-SGX.
-				rh.Provisioners[node.TEEHardwareIntelSGX], err = hostSandbox.New(hostSandbox.Config{
-					HostInfo:          hostInfo,
-					InsecureNoSandbox: insecureNoSandbox,
-					SandboxBinaryPath: sandboxBinary,
-				})
-				if err != nil {
-					return nil, fmt.Errorf("failed to create runtime provisioner: %w", err)
-				}
-			default:
-				// Configure the provided SGX loader.
-				rh.Provisioners[node.TEEHardwareIntelSGX], err = hostSgx.New(hostSgx.Config{
-					HostInfo:          hostInfo,
-					LoaderPath:        sgxLoader,
-					IAS:               ias,
-					SandboxBinaryPath: sandboxBinary,
-					InsecureNoSandbox: insecureNoSandbox,
-				})
-				if err != nil {
-					return nil, fmt.Errorf("failed to create SGX runtime provisioner: %w", err)
-				}
+		switch tdxLoader := viper.GetString(CfgRuntimeTDXLoader); tdxLoader {
+		case "":
+			// No TDX loader is configured, remap to non-TDX.
+			provisioners[node.TEEHardwareIntelTDX], err = hostSandbox.New(hostSandbox.Config{
+				HostInfo:          hostInfo,
+				InsecureNoSandbox: insecureNoSandbox,
+				SandboxBinaryPath: sandboxBinary,
+				Limits:            sandboxLimits,
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create runtime provisioner: %w", err)
 			}
+			names[node.TEEHardwareIntelTDX] = p
 		default:
-			return nil, fmt.Errorf("unsupported runtime provisioner: %s", p)
+			// Configure the provided TDX loader.
+			provisioners[node.TEEHardwareIntelTDX], err = hostTdx.New(hostTdx.Config{
+				HostInfo:          hostInfo,
+				LoaderPath:        tdxLoader,
+				SandboxBinaryPath: sandboxBinary,
+				InsecureNoSandbox: insecureNoSandbox,
+				Limits:            sandboxLimits,
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create TDX runtime provisioner: %w", err)
+			}
+			names[node.TEEHardwareIntelTDX] = provisionerNameTDX
+		}
+	case RuntimeProvisionerContainer:
+		if !sandboxLimits.IsEmpty() {
+			return nil, nil, fmt.Errorf("container provisioner does not support resource limits (%s, %s)", CfgSandboxMemoryLimit, CfgSandboxCPUQuota)
 		}
 
-		// Configure runtimes.
-		runtimeSGXSignatures := viper.GetStringMapString(CfgRuntimeSGXSignatures)
-		rh.Runtimes = make(map[common.Namespace]*runtimeHost.Config)
-		for runtimeID, path := range viper.GetStringMapString(CfgRuntimePaths) {
-			var id common.Namespace
-			if err := id.UnmarshalHex(runtimeID); err != nil {
-				return nil, fmt.Errorf("bad runtime identifier '%s': %w", runtimeID, err)
-			}
+		containerBinary := viper.GetString(CfgContainerBinary)
+		if err = statBinary(containerBinary); err != nil {
+			return nil, nil, fmt.Errorf("failed to stat container runtime binary: %w", err)
+		}
 
-			// Unmarshal any local runtime configuration.
-			var localConfig map[string]interface{}
-			if sub := viper.Sub(CfgRuntimeConfig); sub != nil {
-				if err := sub.UnmarshalKey(runtimeID, &localConfig); err != nil {
-					return nil, fmt.Errorf("bad runtime configuration: %w", err)
-				}
-			}
+		// Container provisioner, can only be used with no TEE.
+		provisioners[node.TEEHardwareInvalid], err = hostContainer.New(hostContainer.Config{
+			HostInfo:   hostInfo,
+			BinaryPath: containerBinary,
+			Image:      viper.GetString(CfgContainerImage),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create runtime provisioner: %w", err)
+		}
+		names[node.TEEHardwareInvalid] = p
 
-			runtimeHostCfg := &runtimeHost.Config{
-				RuntimeID:   id,
-				Path:        path,
-				LocalConfig: localConfig,
-			}
+		sgxLoader := viper.GetString(CfgRuntimeSGXLoader)
+		checkSGXConfig(sgxLoader, len(viper.GetStringMapString(CfgRuntimeSGXSignatures)) > 0)
 
-			// This config is SGX specific, but that's all that's supported
-			// right now that needs this anyway, the non-SGX provisioner
-			// currently ignores this.
-			if sigPath := runtimeSGXSignatures[runtimeID]; sigPath != "" {
-				runtimeHostCfg.Extra = &hostSgx.RuntimeExtra{
-					SignaturePath: sigPath,
-				}
-			} else {
-				// HACK HACK HACK: Allow dummy SIGSTRUCT generation.
-				runtimeHostCfg.Extra = &hostSgx.RuntimeExtra{
-					UnsafeDebugGenerateSigstruct: true,
-				}
-			}
+		if sgxLoader != "" {
+			return nil, nil, fmt.Errorf("container provisioner does not support SGX runtimes")
+		}
+		// No SGX loader is configured, remap to non-SGX.
+		provisioners[node.TEEHardwareIntelSGX] = provisioners[node.TEEHardwareInvalid]
+		names[node.TEEHardwareIntelSGX] = p
+
+		if viper.GetString(CfgRuntimeTDXLoader) != "" {
+			return nil, nil, fmt.Errorf("container provisioner does not support TDX runtimes")
+		}
+		// No TDX loader is configured, remap to non-TDX.
+		provisioners[node.TEEHardwareIntelTDX] = provisioners[node.TEEHardwareInvalid]
+		names[node.TEEHardwareIntelTDX] = p
+	default:
+		return nil, nil, fmt.Errorf("unsupported runtime provisioner: %s", p)
+	}
+	return provisioners, names, nil
+}
+
+// loadRuntimes loads the provisioning configuration of all runtimes configured via
+// CfgRuntimePaths together with any per-runtime provisioner overrides.
+func loadRuntimes(dataDir string) (map[common.Namespace]*runtimeHost.Config, map[common.Namespace]string, error) {
+	allowedIDs, err := parseAllowedRuntimeIDs()
+	if err != nil {
+		return nil, nil, err
+	}
 
-			rh.Runtimes[id] = runtimeHostCfg
+	runtimes := make(map[common.Namespace]*runtimeHost.Config)
+	provisioners := make(map[common.Namespace]string)
+	for runtimeID, path := range viper.GetStringMapString(CfgRuntimePaths) {
+		var (
+			runtimeHostCfg *runtimeHost.Config
+			provisioner    string
+		)
+		if runtimeHostCfg, provisioner, err = loadRuntime(dataDir, runtimeID, path, allowedIDs, false); err != nil {
+			return nil, nil, err
 		}
-		if len(rh.Runtimes) == 0 {
-			return nil, fmt.Errorf("no runtimes configured")
+		runtimes[runtimeHostCfg.RuntimeID] = runtimeHostCfg
+		if provisioner != "" {
+			provisioners[runtimeHostCfg.RuntimeID] = provisioner
 		}
+	}
+	if len(runtimes) == 0 {
+		return nil, nil, fmt.Errorf("no runtimes configured")
+	}
+	return runtimes, provisioners, nil
+}
 
-		cfg.Host = &rh
+// parseAllowedRuntimeIDs parses the runtime ID allowlist configured via CfgRuntimeAllowedIDs.
+func parseAllowedRuntimeIDs() (map[common.Namespace]bool, error) {
+	allowedIDs := make(map[common.Namespace]bool)
+	for _, rawID := range viper.GetStringSlice(CfgRuntimeAllowedIDs) {
+		var id common.Namespace
+		if err := id.UnmarshalHex(rawID); err != nil {
+			return nil, fmt.Errorf("bad allowed runtime identifier '%s': %w", rawID, err)
+		}
+		allowedIDs[id] = true
 	}
+	return allowedIDs, nil
+}
 
-	strategy := viper.GetString(CfgHistoryPrunerStrategy)
-	switch strings.ToLower(strategy) {
-	case history.PrunerStrategyNone:
-		cfg.History.Pruner = history.NewNonePruner()
-	case history.PrunerStrategyKeepLast:
-		numKept := viper.GetUint64(CfgHistoryPrunerKeepLastNum)
-		cfg.History.Pruner = history.NewKeepLastPruner(numKept)
-	default:
-		return nil, fmt.Errorf("runtime/registry: unknown history pruner strategy: %s", strategy)
+// loadRuntime loads the provisioning configuration of a single runtime and returns the name of
+// the provisioner overriding CfgRuntimeProvisioner, if any.
+//
+// In case dryRun is set, remote runtime URLs are validated but not fetched.
+func loadRuntime(dataDir, runtimeID, path string, allowedIDs map[common.Namespace]bool, dryRun bool) (*runtimeHost.Config, string, error) {
+	var id common.Namespace
+	if err := id.UnmarshalHex(runtimeID); err != nil {
+		return nil, "", fmt.Errorf("bad runtime identifier '%s': %w", runtimeID, err)
+	}
+	if len(allowedIDs) > 0 && !allowedIDs[id] {
+		return nil, "", fmt.Errorf("runtime '%s' is not in the allowed runtime identifiers (%s)", id, CfgRuntimeAllowedIDs)
 	}
 
-	cfg.History.PruneInterval = viper.GetDuration(CfgHistoryPrunerInterval)
-	const minPruneInterval = 1 * time.Second
-	if cfg.History.PruneInterval < minPruneInterval {
-		cfg.History.PruneInterval = minPruneInterval
+	// Unmarshal any local runtime configuration.
+	var localConfig map[string]interface{}
+	if sub := viper.Sub(CfgRuntimeConfig); sub != nil {
+		if err := sub.UnmarshalKey(runtimeID, &localConfig); err != nil {
+			return nil, "", fmt.Errorf("bad runtime configuration: %w", err)
+		}
 	}
 
-	return &cfg, nil
+	// Extract any per-runtime provisioner override.
+	var provisioner string
+	if raw, ok := localConfig[runtimeConfigProvisionerKey]; ok {
+		if provisioner, ok = raw.(string); !ok || provisioner == "" {
+			return nil, "", fmt.Errorf("bad provisioner override for runtime '%s'", id)
+		}
+		delete(localConfig, runtimeConfigProvisionerKey)
+	}
+
+	// Extract any environment variables.
+	var env map[string]string
+	if raw, ok := localConfig[runtimeConfigEnvKey]; ok {
+		var err error
+		if env, err = parseRuntimeEnv(raw); err != nil {
+			return nil, "", fmt.Errorf("bad environment for runtime '%s': %w", id, err)
+		}
+		delete(localConfig, runtimeConfigEnvKey)
+	}
+
+	restartPolicy, err := getRestartPolicy(runtimeID)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad restart policy for runtime '%s': %w", id, err)
+	}
+
+	// Fetch the runtime in case a remote URL is configured.
+	if dryRun {
+		if _, _, err = parseRuntimeURL(path); err != nil {
+			return nil, "", err
+		}
+	} else if path, err = resolveRuntimePath(dataDir, id, path); err != nil {
+		return nil, "", err
+	}
+
+	runtimeHostCfg := &runtimeHost.Config{
+		RuntimeID:     id,
+		Path:          path,
+		LocalConfig:   localConfig,
+		Env:           env,
+		RestartPolicy: *restartPolicy,
+	}
+
+	// This config is SGX specific, but that's all that's supported
+	// right now that needs this anyway, the non-SGX provisioner
+	// currently ignores this.
+	if sigPath := viper.GetStringMapString(CfgRuntimeSGXSignatures)[runtimeID]; sigPath != "" {
+		runtimeHostCfg.Extra = &hostSgx.RuntimeExtra{
+			SignaturePath: sigPath,
+		}
+	} else {
+		// HACK HACK HACK: Allow dummy SIGSTRUCT generation.
+		runtimeHostCfg.Extra = &hostSgx.RuntimeExtra{
+			UnsafeDebugGenerateSigstruct: true,
+		}
+	}
+
+	return runtimeHostCfg, provisioner, nil
+}
+
+// parseRuntimeEnv parses and validates the environment variables configured for a runtime.
+func parseRuntimeEnv(raw interface{}) (map[string]string, error) {
+	vars, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("environment must be a map of variable names to values")
+	}
+
+	env := make(map[string]string, len(vars))
+	for key, rawValue := range vars {
+		key = strings.ToUpper(key)
+		if !runtimeEnvKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("invalid environment variable name '%s'", key)
+		}
+		if strings.HasPrefix(key, runtimeEnvReservedPrefix) {
+			return nil, fmt.Errorf("environment variable '%s' uses reserved prefix '%s'", key, runtimeEnvReservedPrefix)
+		}
+		value, ok := rawValue.(string)
+		if !ok {
+			return nil, fmt.Errorf("value of environment variable '%s' must be a string", key)
+		}
+		env[key] = value
+	}
+	return env, nil
 }
 
 func init() {
 	Flags.String(CfgRuntimeProvisioner, RuntimeProvisionerSandboxed, "Runtime provisioner to use")
 	Flags.StringToString(CfgRuntimePaths, nil, "Paths to runtime resources (format: <rt1-ID>=<path>,<rt2-ID>=<path>)")
+	Flags.StringSlice(CfgRuntimeAllowedIDs, nil, "Runtime IDs that are allowed to be hosted (if empty, all runtimes are allowed)")
 	Flags.String(CfgSandboxBinary, "/usr/bin/bwrap", "Path to the sandbox binary (bubblewrap)")
+	Flags.String(CfgSandboxMemoryLimit, "", "Maximum amount of memory a sandboxed runtime can use (e.g., 4GiB, unlimited if not set). Requires a delegated cgroup v2 and moves all processes in the node's cgroup into an oasis-node child cgroup")
+	Flags.Float64(CfgSandboxCPUQuota, 0, "Maximum number of CPUs a sandboxed runtime can use (at least 0.01, unlimited if not set). Requires a delegated cgroup v2 and moves all processes in the node's cgroup into an oasis-node child cgroup")
+	Flags.Uint(CfgBinaryRetryAttempts, 0, "Number of times to recheck for a missing sandbox or container runtime binary")
+	Flags.Duration(CfgBinaryRetryDelay, 1*time.Second, "Delay between checks for a missing sandbox or container runtime binary")
+	Flags.String(CfgContainerBinary, "/usr/bin/docker", "Path to the container runtime binary (docker or podman)")
+	Flags.String(CfgContainerImage, "", "Container image in which runtimes are executed")
 	Flags.String(CfgRuntimeSGXLoader, "", "(for SGX runtimes) Path to SGXS runtime loader binary")
 	Flags.StringToString(CfgRuntimeSGXSignatures, nil, "(for SGX runtimes) Paths to signatures (format: <rt1-ID>=<path>,<rt2-ID>=<path>")
+	Flags.String(CfgRuntimeTDXLoader, "", "(for TDX runtimes) Path to TDX runtime loader binary")
+	Flags.Duration(CfgRuntimeDrainTimeout, 30*time.Second, "Maximum time to wait for in-flight rounds of a removed runtime before it is stopped on reload")
 
 	Flags.String(CfgHistoryPrunerStrategy, history.PrunerStrategyNone, "History pruner strategy")
 	Flags.Duration(CfgHistoryPrunerInterval, 2*time.Minute, "History pruning interval")
 	Flags.Uint64(CfgHistoryPrunerKeepLastNum, 600, "Keep last history pruner: number of last rounds to keep")
+	Flags.Duration(CfgHistoryPrunerKeepDuration, 24*time.Hour, "Keep last and duration history pruner: duration of rounds to keep")
 
-	Flags.String(CfgRuntimeMode, string(RuntimeModeNone), "Runtime mode (none, compute, keymanager, client, client-stateless)")
+	Flags.String(CfgRuntimeMode, string(RuntimeModeNone), "Runtime mode (none, compute, keymanager, client, client-stateless, maintenance)")
 
 	_ = viper.BindPFlags(Flags)
 }
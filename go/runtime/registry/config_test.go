@@ -0,0 +1,450 @@
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/node"
+	cmdFlags "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/flags"
+	runtimeHost "github.com/oasisprotocol/oasis-core/go/runtime/host"
+	hostMock "github.com/oasisprotocol/oasis-core/go/runtime/host/mock"
+)
+
+func TestSetRuntimeProvisioners(t *testing.T) {
+	require := require.New(t)
+
+	var id1, id2 common.Namespace
+	id2[31] = 1
+
+	rh := newTestHostConfig(id1)
+	var created []string
+	rh.newProvisioners = func(p string) (map[node.TEEHardware]runtimeHost.Provisioner, map[node.TEEHardware]string, error) {
+		// Provisioners must be created without holding the lock so that readers are not blocked.
+		doneCh := make(chan struct{})
+		go func() {
+			_ = rh.ProvisionersFor(id1)
+			close(doneCh)
+		}()
+		select {
+		case <-doneCh:
+		case <-time.After(time.Second):
+			t.Errorf("provisioners created while holding the host configuration lock")
+		}
+
+		created = append(created, p)
+		provisioners := map[node.TEEHardware]runtimeHost.Provisioner{
+			node.TEEHardwareInvalid: hostMock.New(),
+		}
+		return provisioners, map[node.TEEHardware]string{node.TEEHardwareInvalid: p}, nil
+	}
+
+	err := rh.setRuntimeProvisioners(map[common.Namespace]string{
+		id1: RuntimeProvisionerMock,
+		id2: RuntimeProvisionerMock,
+	})
+	require.NoError(err, "setRuntimeProvisioners")
+	require.Equal([]string{RuntimeProvisionerMock}, created, "provisioners should be created once")
+	require.NotNil(rh.ProvisionersFor(id1), "override should be configured")
+	require.Equal(rh.ProvisionersFor(id1), rh.ProvisionersFor(id2), "provisioners should be shared")
+
+	// Already created provisioners should be reused.
+	err = rh.setRuntimeProvisioners(map[common.Namespace]string{
+		id2: RuntimeProvisionerMock,
+	})
+	require.NoError(err, "setRuntimeProvisioners")
+	require.Len(created, 1, "provisioners should be reused")
+	require.Nil(rh.ProvisionersFor(id1), "removed override should fall back to default provisioners")
+}
+
+func TestValidateConfig(t *testing.T) {
+	var id1, id2 common.Namespace
+	id2[31] = 1
+	remotePath := "https://example.invalid/runtime#sha256=" + strings.Repeat("00", 32)
+
+	for _, tc := range []struct {
+		name string
+		cfg  map[string]interface{}
+		errs []string
+	}{
+		{
+			"Valid",
+			map[string]interface{}{
+				CfgRuntimeMode:        string(RuntimeModeCompute),
+				CfgRuntimeProvisioner: RuntimeProvisionerSandboxed,
+				CfgSandboxBinary:      "/nonexistent/bwrap",
+				CfgRuntimePaths: map[string]string{
+					id1.String(): remotePath,
+					id2.String(): "/path/to/runtime",
+				},
+			},
+			nil,
+		},
+		{
+			"BadMode",
+			map[string]interface{}{
+				CfgRuntimeMode: "bogus",
+			},
+			[]string{"failed to parse mode"},
+		},
+		{
+			"MaintenanceWithoutRuntimes",
+			map[string]interface{}{
+				CfgRuntimeMode: string(RuntimeModeMaintenance),
+			},
+			[]string{"at least one runtime must be configured", "maintenance mode requires runtimes to be hosted"},
+		},
+		{
+			"UnsafeProvisioner",
+			map[string]interface{}{
+				CfgRuntimeMode:        string(RuntimeModeCompute),
+				CfgRuntimeProvisioner: RuntimeProvisionerMock,
+				CfgRuntimePaths:       map[string]string{id1.String(): "/path/to/runtime"},
+			},
+			[]string{"mock provisioner requires use of unsafe debug flags"},
+		},
+		{
+			"BadProvisionerOverride",
+			map[string]interface{}{
+				CfgRuntimeMode:  string(RuntimeModeCompute),
+				CfgRuntimePaths: map[string]string{id1.String(): "/path/to/runtime"},
+				CfgRuntimeConfig: map[string]interface{}{
+					id1.String(): map[string]interface{}{runtimeConfigProvisionerKey: "bogus"},
+				},
+			},
+			[]string{"unsupported runtime provisioner: bogus"},
+		},
+		{
+			"BadRuntimes",
+			map[string]interface{}{
+				CfgRuntimeMode: string(RuntimeModeCompute),
+				CfgRuntimePaths: map[string]string{
+					"bogus":      "/path/to/runtime",
+					id1.String(): "http://example.invalid/runtime",
+					id2.String(): "https://example.invalid/runtime",
+				},
+			},
+			// Runtimes are validated in a deterministic order.
+			[]string{
+				"unsupported runtime URL scheme 'http'",
+				"runtime URL is missing a '#sha256=<hex>' checksum",
+				"bad runtime identifier 'bogus'",
+			},
+		},
+		{
+			"CPUQuotaTooSmall",
+			map[string]interface{}{
+				CfgRuntimeMode:     string(RuntimeModeCompute),
+				CfgRuntimePaths:    map[string]string{id1.String(): "/path/to/runtime"},
+				CfgSandboxCPUQuota: 0.000001,
+			},
+			[]string{"CPU quota must be at least"},
+		},
+		{
+			"ContainerWithLimits",
+			map[string]interface{}{
+				CfgRuntimeMode:        string(RuntimeModeCompute),
+				CfgRuntimeProvisioner: RuntimeProvisionerContainer,
+				CfgRuntimePaths:       map[string]string{id1.String(): "/path/to/runtime"},
+				CfgSandboxMemoryLimit: "1GiB",
+			},
+			[]string{"container provisioner does not support resource limits"},
+		},
+		{
+			"BadHistoryPruner",
+			map[string]interface{}{
+				CfgRuntimeMode:           string(RuntimeModeCompute),
+				CfgRuntimePaths:          map[string]string{id1.String(): "/path/to/runtime"},
+				CfgHistoryPrunerStrategy: "bogus",
+			},
+			[]string{"unknown history pruner strategy"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			for k, v := range tc.cfg {
+				viper.Set(k, v)
+			}
+
+			dataDir := t.TempDir()
+			errs := ValidateConfig(dataDir)
+			require.Len(errs, len(tc.errs), "ValidateConfig should report all problems: %v", errs)
+			for i, err := range errs {
+				require.Contains(err.Error(), tc.errs[i])
+			}
+
+			// Validation must not have any side effects on the data directory.
+			entries, err := os.ReadDir(dataDir)
+			require.NoError(err, "ReadDir")
+			require.Empty(entries, "validation should not write to the data directory")
+		})
+	}
+}
+
+func TestRuntimeAllowlist(t *testing.T) {
+	var id1, id2 common.Namespace
+	id2[31] = 1
+
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		runtime common.Namespace
+		err     string
+	}{
+		{"AllowAll", nil, id2, ""},
+		{"Allowed", []string{id1.String(), id2.String()}, id2, ""},
+		{"Disallowed", []string{id1.String()}, id2, "is not in the allowed runtime identifiers"},
+		{"BadAllowlist", []string{"bogus"}, id1, "bad allowed runtime identifier 'bogus'"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			viper.Set(CfgRuntimeAllowedIDs, tc.allowed)
+			viper.Set(CfgRuntimePaths, map[string]string{tc.runtime.String(): "/path/to/runtime"})
+
+			runtimes, _, err := loadRuntimes(t.TempDir())
+			switch tc.err {
+			case "":
+				require.NoError(err, "loadRuntimes")
+				require.Contains(runtimes, tc.runtime, "allowed runtime should be loaded")
+			default:
+				require.Error(err, "loadRuntimes")
+				require.Contains(err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestRuntimeModeUnmarshalText(t *testing.T) {
+	for _, tc := range []struct {
+		text     string
+		expected RuntimeMode
+		ok       bool
+	}{
+		{"none", RuntimeModeNone, true},
+		{"compute", RuntimeModeCompute, true},
+		{"keymanager", RuntimeModeKeymanager, true},
+		{"client", RuntimeModeClient, true},
+		{"client-stateless", RuntimeModeClientStateless, true},
+		{"maintenance", RuntimeModeMaintenance, true},
+		{"Maintenance", "", false},
+		{"", "", false},
+	} {
+		var mode RuntimeMode
+		err := mode.UnmarshalText([]byte(tc.text))
+		if !tc.ok {
+			require.Error(t, err, "UnmarshalText(%s)", tc.text)
+			continue
+		}
+		require.NoError(t, err, "UnmarshalText(%s)", tc.text)
+		require.Equal(t, tc.expected, mode)
+	}
+}
+
+func TestMaintenanceModeRuntimes(t *testing.T) {
+	require := require.New(t)
+
+	var id common.Namespace
+	cfg := &RuntimeConfig{
+		Mode: RuntimeModeMaintenance,
+		Host: newTestHostConfig(id),
+	}
+	require.Equal([]common.Namespace{id}, cfg.Runtimes(), "runtimes should be hosted in maintenance mode")
+}
+
+func TestRestartPolicy(t *testing.T) {
+	var id common.Namespace
+
+	for _, tc := range []struct {
+		name     string
+		cfg      map[string]interface{}
+		expected runtimeHost.RestartPolicy
+		err      string
+	}{
+		{"Default", nil, runtimeHost.RestartPolicy{}, ""},
+		{
+			"Limited",
+			map[string]interface{}{
+				"max_restarts":    5,
+				"initial_backoff": "1s",
+				"max_backoff":     "10s",
+				"window":          "5m",
+			},
+			runtimeHost.RestartPolicy{
+				MaxRestarts:    5,
+				InitialBackoff: time.Second,
+				MaxBackoff:     10 * time.Second,
+				Window:         5 * time.Minute,
+			},
+			"",
+		},
+		{
+			"BackoffOrder",
+			map[string]interface{}{"initial_backoff": "10s", "max_backoff": "1s"},
+			runtimeHost.RestartPolicy{},
+			"must not be smaller than initial backoff",
+		},
+		{
+			"NegativeBackoff",
+			map[string]interface{}{"initial_backoff": "-1s"},
+			runtimeHost.RestartPolicy{},
+			"initial backoff must not be negative",
+		},
+		{
+			"MissingWindow",
+			map[string]interface{}{"max_restarts": 5},
+			runtimeHost.RestartPolicy{},
+			"restart window must be set",
+		},
+		{
+			"MissingMaxRestarts",
+			map[string]interface{}{"window": "5m"},
+			runtimeHost.RestartPolicy{},
+			"restart window requires maximum restarts",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			if tc.cfg != nil {
+				viper.Set(CfgRuntimeRestart, map[string]interface{}{id.String(): tc.cfg})
+			}
+			viper.Set(CfgRuntimePaths, map[string]string{id.String(): "/path/to/runtime"})
+
+			runtimes, _, err := loadRuntimes(t.TempDir())
+			switch tc.err {
+			case "":
+				require.NoError(err, "loadRuntimes")
+				require.Equal(tc.expected, runtimes[id].RestartPolicy)
+			default:
+				require.Error(err, "loadRuntimes")
+				require.Contains(err.Error(), "bad restart policy")
+				require.Contains(err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestSGXConfigWarning(t *testing.T) {
+	errNoDevice := fmt.Errorf("no SGX device found")
+
+	for _, tc := range []struct {
+		name            string
+		discoverErr     error
+		sgxLoader       string
+		haveSGXRuntimes bool
+		warning         string
+	}{
+		{"NoSGX", errNoDevice, "", true, ""},
+		{"SGXConfigured", nil, "/path/to/loader", true, ""},
+		{"SGXNoRuntimes", nil, "", false, ""},
+		{"SGXMissingLoader", nil, "", true, "no SGX loader is configured"},
+		{"LoaderWithoutSGX", errNoDevice, "/path/to/loader", false, "SGX does not seem to be available"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			msg, _ := sgxConfigWarning("/dev/sgx_enclave", tc.discoverErr, tc.sgxLoader, tc.haveSGXRuntimes)
+			switch tc.warning {
+			case "":
+				require.Empty(msg, "no warning should be emitted")
+			default:
+				require.Contains(msg, tc.warning)
+			}
+		})
+	}
+}
+
+func TestValidateRuntimeMode(t *testing.T) {
+	var id1, id2 common.Namespace
+	id2[31] = 1
+	one := map[string]string{id1.String(): "/path/to/runtime"}
+	two := map[string]string{id1.String(): "/path/to/runtime", id2.String(): "/path/to/other"}
+
+	for _, tc := range []struct {
+		name  string
+		mode  RuntimeMode
+		paths map[string]string
+		debug bool
+		err   string
+	}{
+		{"None", RuntimeModeNone, nil, false, ""},
+		{"NoneWithRuntimes", RuntimeModeNone, one, false, "no runtimes should be configured"},
+		{"NoneWithRuntimesDebug", RuntimeModeNone, one, true, ""},
+		{"Keymanager", RuntimeModeKeymanager, one, false, ""},
+		{"KeymanagerNoRuntimes", RuntimeModeKeymanager, nil, false, "exactly one runtime path"},
+		{"KeymanagerManyRuntimes", RuntimeModeKeymanager, two, false, "exactly one runtime path"},
+		{"Compute", RuntimeModeCompute, two, false, ""},
+		{"ComputeNoRuntimes", RuntimeModeCompute, nil, false, "at least one runtime must be configured"},
+		{"ComputeNoRuntimesDebug", RuntimeModeCompute, nil, true, ""},
+		{"ClientStateless", RuntimeModeClientStateless, one, false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			viper.Set(cmdFlags.CfgDebugDontBlameOasis, tc.debug)
+			if tc.paths != nil {
+				viper.Set(CfgRuntimePaths, tc.paths)
+			}
+
+			err := validateRuntimeMode(tc.mode)
+			switch tc.err {
+			case "":
+				require.NoError(err, "validateRuntimeMode")
+			default:
+				require.Error(err, "validateRuntimeMode")
+				require.Contains(err.Error(), tc.err)
+			}
+		})
+	}
+}
+
+func TestStatBinary(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		attempts uint
+		appear   bool
+		ok       bool
+	}{
+		{"MissingNoRetry", 0, false, false},
+		{"MissingRetriesExhausted", 2, false, false},
+		{"AppearsWhileRetrying", 100, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			viper.Set(CfgBinaryRetryAttempts, tc.attempts)
+			viper.Set(CfgBinaryRetryDelay, 10*time.Millisecond)
+
+			path := filepath.Join(t.TempDir(), "bwrap")
+			if tc.appear {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					_ = ioutil.WriteFile(path, nil, 0o700)
+				}()
+			}
+
+			err := statBinary(path)
+			if !tc.ok {
+				require.Error(err, "statBinary")
+				require.True(os.IsNotExist(err), "the original error should be returned after retries")
+				return
+			}
+			require.NoError(err, "statBinary")
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	hostSgx "github.com/oasisprotocol/oasis-core/go/runtime/host/sgx"
+)
+
+// redactedValue is the value that replaces redacted local configuration values.
+const redactedValue = "<redacted>"
+
+// RuntimeConfigDump is a serializable snapshot of the effective runtime configuration.
+type RuntimeConfigDump struct {
+	// Mode is the runtime mode for this node.
+	Mode RuntimeMode `json:"mode"`
+
+	// Provisioners maps TEE hardware to the name of the provisioner that handles it for runtimes
+	// that do not override the provisioner.
+	Provisioners map[string]string `json:"provisioners,omitempty"`
+
+	// Runtimes contains the configuration of all hosted runtimes, ordered by runtime identifier.
+	Runtimes []RuntimeHostConfigDump `json:"runtimes,omitempty"`
+}
+
+// RuntimeHostConfigDump is a serializable snapshot of the effective configuration of a hosted
+// runtime.
+type RuntimeHostConfigDump struct {
+	// ID is the runtime identifier.
+	ID common.Namespace `json:"id"`
+
+	// Path is the local path to the runtime resource.
+	Path string `json:"path"`
+
+	// Provisioner is the name of the provisioner overriding the configured one, if any.
+	Provisioner string `json:"provisioner,omitempty"`
+
+	// SGXSignature is true iff an SGX signature has been configured for the runtime.
+	SGXSignature bool `json:"sgx_signature"`
+
+	// LocalConfig is the node-local runtime configuration.
+	LocalConfig map[string]interface{} `json:"local_config,omitempty"`
+
+	// Env are the environment variables passed to the runtime process.
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Redacted returns a copy of the dump with all local configuration and environment values
+// redacted.
+func (d RuntimeConfigDump) Redacted() RuntimeConfigDump {
+	runtimes := make([]RuntimeHostConfigDump, 0, len(d.Runtimes))
+	for _, rt := range d.Runtimes {
+		if rt.LocalConfig != nil {
+			localConfig := make(map[string]interface{}, len(rt.LocalConfig))
+			for k := range rt.LocalConfig {
+				localConfig[k] = redactedValue
+			}
+			rt.LocalConfig = localConfig
+		}
+		if rt.Env != nil {
+			env := make(map[string]string, len(rt.Env))
+			for k := range rt.Env {
+				env[k] = redactedValue
+			}
+			rt.Env = env
+		}
+		runtimes = append(runtimes, rt)
+	}
+	d.Runtimes = runtimes
+	return d
+}
+
+// Describe returns a serializable snapshot of the effective runtime configuration.
+//
+// The snapshot includes node-local runtime configuration and environment which may contain secrets, use
+// RuntimeConfigDump.Redacted before exposing it.
+func (cfg *RuntimeConfig) Describe() RuntimeConfigDump {
+	dump := RuntimeConfigDump{
+		Mode: cfg.Mode,
+	}
+	if cfg.Host == nil {
+		return dump
+	}
+
+	rh := cfg.Host
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	dump.Provisioners = make(map[string]string)
+	for tee := range rh.Provisioners {
+		name, ok := rh.provisionerNames[tee]
+		if !ok {
+			name = rh.provisioner
+		}
+		dump.Provisioners[tee.String()] = name
+	}
+
+	for id, rtCfg := range rh.Runtimes {
+		rt := RuntimeHostConfigDump{
+			ID:          id,
+			Path:        rtCfg.Path,
+			Provisioner: rh.overrides[id],
+			LocalConfig: rtCfg.LocalConfig,
+			Env:         rtCfg.Env,
+		}
+		if extra, ok := rtCfg.Extra.(*hostSgx.RuntimeExtra); ok {
+			rt.SGXSignature = extra.SignaturePath != ""
+		}
+		dump.Runtimes = append(dump.Runtimes, rt)
+	}
+	sort.Slice(dump.Runtimes, func(i, j int) bool {
+		return bytes.Compare(dump.Runtimes[i].ID[:], dump.Runtimes[j].ID[:]) < 0
+	})
+	return dump
+}
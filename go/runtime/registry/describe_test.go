@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/node"
+	cmdFlags "github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/flags"
+	runtimeHost "github.com/oasisprotocol/oasis-core/go/runtime/host"
+	hostProtocol "github.com/oasisprotocol/oasis-core/go/runtime/host/protocol"
+)
+
+func TestDescribeProvisioners(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		provisioner string
+		sgxLoader   string
+		tdxLoader   string
+		expected    map[string]string
+	}{
+		{
+			"Mock",
+			RuntimeProvisionerMock,
+			"",
+			"",
+			map[string]string{
+				node.TEEHardwareInvalid.String(): RuntimeProvisionerMock,
+			},
+		},
+		{
+			"Unconfined",
+			RuntimeProvisionerUnconfined,
+			"",
+			"",
+			map[string]string{
+				node.TEEHardwareInvalid.String():  RuntimeProvisionerUnconfined,
+				node.TEEHardwareIntelSGX.String(): RuntimeProvisionerUnconfined,
+				node.TEEHardwareIntelTDX.String(): RuntimeProvisionerUnconfined,
+			},
+		},
+		{
+			"UnconfinedWithLoaders",
+			RuntimeProvisionerUnconfined,
+			"/path/to/sgx-loader",
+			"/path/to/tdx-loader",
+			map[string]string{
+				node.TEEHardwareInvalid.String():  RuntimeProvisionerUnconfined,
+				node.TEEHardwareIntelSGX.String(): provisionerNameSGX,
+				node.TEEHardwareIntelTDX.String(): provisionerNameTDX,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			viper.Set(cmdFlags.CfgDebugDontBlameOasis, true)
+			viper.Set(CfgRuntimeSGXLoader, tc.sgxLoader)
+			viper.Set(CfgRuntimeTDXLoader, tc.tdxLoader)
+
+			provisioners, names, err := newProvisioners(tc.provisioner, &hostProtocol.HostInfo{}, nil)
+			require.NoError(err, "newProvisioners")
+
+			var id common.Namespace
+			cfg := &RuntimeConfig{
+				Mode: RuntimeModeCompute,
+				Host: &RuntimeHostConfig{
+					Provisioners: provisioners,
+					Runtimes: map[common.Namespace]*runtimeHost.Config{
+						id: {RuntimeID: id, Path: "/path/to/runtime"},
+					},
+					provisioner:      tc.provisioner,
+					provisionerNames: names,
+				},
+			}
+
+			dump := cfg.Describe()
+			require.Equal(RuntimeModeCompute, dump.Mode)
+			require.Equal(tc.expected, dump.Provisioners, "provisioners should be reported per TEE hardware")
+			require.Len(dump.Runtimes, 1)
+			require.Equal("/path/to/runtime", dump.Runtimes[0].Path)
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	runtimeHost "github.com/oasisprotocol/oasis-core/go/runtime/host"
+)
+
+var (
+	// ErrRuntimeDraining is the error returned when new work is requested for a runtime that is
+	// being drained.
+	ErrRuntimeDraining = errors.New("runtime/registry: runtime is draining")
+
+	// ErrRuntimeDrainTimeout is the error returned when in-flight rounds did not complete before
+	// the drain timeout elapsed.
+	ErrRuntimeDrainTimeout = errors.New("runtime/registry: timed out while draining runtime")
+)
+
+// hostedRuntime is the drain state of a hosted runtime.
+type hostedRuntime struct {
+	hosts    []runtimeHost.Runtime
+	rounds   sync.WaitGroup
+	draining bool
+}
+
+func (rh *RuntimeHostConfig) getHostedRuntimeLocked(id common.Namespace) *hostedRuntime {
+	if rh.hosted == nil {
+		rh.hosted = make(map[common.Namespace]*hostedRuntime)
+	}
+	hr := rh.hosted[id]
+	if hr == nil {
+		hr = &hostedRuntime{}
+		rh.hosted[id] = hr
+	}
+	return hr
+}
+
+// IsDraining returns true iff the given runtime is being (or has been) drained.
+func (rh *RuntimeHostConfig) IsDraining(id common.Namespace) bool {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	return rh.getHostedRuntimeLocked(id).draining
+}
+
+// BeginRound marks the start of in-flight work (e.g., a round) for the given runtime.
+//
+// The returned function must be called once the work has completed. In case the runtime is being
+// drained, ErrRuntimeDraining is returned and no new work should be started.
+func (rh *RuntimeHostConfig) BeginRound(id common.Namespace) (func(), error) {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	hr := rh.getHostedRuntimeLocked(id)
+	if hr.draining {
+		return nil, ErrRuntimeDraining
+	}
+	hr.rounds.Add(1)
+
+	var once sync.Once
+	return func() { once.Do(hr.rounds.Done) }, nil
+}
+
+// DrainRuntime gracefully stops the given runtime.
+//
+// After this method is called, the runtime will no longer be provisioned and no new rounds can be
+// started for it. The method waits for in-flight rounds to complete and then stops all hosted
+// instances of the runtime.
+//
+// In case in-flight rounds do not complete before the timeout elapses, the runtime is stopped
+// anyway, aborting any in-flight rounds, and ErrRuntimeDrainTimeout is returned.
+func (rh *RuntimeHostConfig) DrainRuntime(id common.Namespace, timeout time.Duration) error {
+	rh.lock.Lock()
+	if _, ok := rh.Runtimes[id]; !ok {
+		rh.lock.Unlock()
+		return ErrRuntimeHostNotConfigured
+	}
+	hr := rh.getHostedRuntimeLocked(id)
+	hr.draining = true
+	rh.lock.Unlock()
+
+	// Wait for in-flight rounds to complete. In case of a timeout the waiting goroutine will exit
+	// once the aborted rounds are marked as completed.
+	var err error
+	doneCh := make(chan struct{})
+	go func() {
+		hr.rounds.Wait()
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(timeout):
+		err = fmt.Errorf("%w: aborting in-flight rounds", ErrRuntimeDrainTimeout)
+	}
+
+	rh.lock.Lock()
+	hosts := hr.hosts
+	hr.hosts = nil
+	rh.lock.Unlock()
+
+	for _, host := range hosts {
+		host.Stop()
+	}
+	return err
+}
+
+// trackingProvisioner is a runtime provisioner that keeps track of provisioned runtimes so that
+// they can be stopped when drained.
+type trackingProvisioner struct {
+	runtimeHost.Provisioner
+
+	rh *RuntimeHostConfig
+}
+
+// Implements runtimeHost.Provisioner.
+func (p *trackingProvisioner) NewRuntime(ctx context.Context, cfg runtimeHost.Config) (runtimeHost.Runtime, error) {
+	p.rh.lock.Lock()
+	defer p.rh.lock.Unlock()
+
+	hr := p.rh.getHostedRuntimeLocked(cfg.RuntimeID)
+	if hr.draining {
+		return nil, ErrRuntimeDraining
+	}
+
+	rt, err := p.Provisioner.NewRuntime(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	hr.hosts = append(hr.hosts, rt)
+	return rt, nil
+}
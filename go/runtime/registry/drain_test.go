@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	runtimeHost "github.com/oasisprotocol/oasis-core/go/runtime/host"
+)
+
+func newTestHostConfig(id common.Namespace) *RuntimeHostConfig {
+	return &RuntimeHostConfig{
+		Runtimes: map[common.Namespace]*runtimeHost.Config{
+			id: {RuntimeID: id},
+		},
+	}
+}
+
+func TestDrainRuntimeWaitsForRounds(t *testing.T) {
+	require := require.New(t)
+
+	var id common.Namespace
+	rh := newTestHostConfig(id)
+
+	endRound, err := rh.BeginRound(id)
+	require.NoError(err, "BeginRound")
+
+	drainCh := make(chan error, 1)
+	go func() {
+		drainCh <- rh.DrainRuntime(id, 10*time.Second)
+	}()
+
+	select {
+	case <-drainCh:
+		require.Fail("DrainRuntime should block while a round is in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.True(rh.IsDraining(id), "runtime should be draining")
+
+	_, err = rh.BeginRound(id)
+	require.ErrorIs(err, ErrRuntimeDraining, "new rounds should not start while draining")
+
+	endRound()
+	select {
+	case err = <-drainCh:
+		require.NoError(err, "DrainRuntime")
+	case <-time.After(time.Second):
+		require.Fail("DrainRuntime should return once the in-flight round completes")
+	}
+}
+
+func TestDrainRuntimeTimeout(t *testing.T) {
+	require := require.New(t)
+
+	var id common.Namespace
+	rh := newTestHostConfig(id)
+
+	endRound, err := rh.BeginRound(id)
+	require.NoError(err, "BeginRound")
+	defer endRound()
+
+	err = rh.DrainRuntime(id, 50*time.Millisecond)
+	require.ErrorIs(err, ErrRuntimeDrainTimeout, "DrainRuntime should time out")
+
+	err = rh.DrainRuntime(common.Namespace{1}, time.Second)
+	require.ErrorIs(err, ErrRuntimeHostNotConfigured, "draining an unknown runtime should fail")
+}
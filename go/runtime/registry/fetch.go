@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+)
+
+const (
+	// RuntimeCacheDir is the name of the directory located inside the per-runtime state directory
+	// which contains runtime resources fetched from remote URLs.
+	RuntimeCacheDir = "cache"
+
+	runtimeFetchTimeout = 10 * time.Minute
+
+	checksumFragmentPrefix = "sha256="
+)
+
+// resolveRuntimePath resolves the configured runtime resource path to a local filesystem path.
+//
+// Local paths are returned unchanged. Remote URLs are downloaded into the per-runtime cache
+// directory, verifying the checksum given in the URL fragment (e.g., https://...#sha256=<hex>).
+func resolveRuntimePath(dataDir string, runtimeID common.Namespace, path string) (string, error) {
+	u, checksum, err := parseRuntimeURL(path)
+	if err != nil {
+		return "", err
+	}
+	if u == nil {
+		// Not a URL, treat as a local path.
+		return path, nil
+	}
+
+	stateDir, err := EnsureRuntimeStateDir(dataDir, runtimeID)
+	if err != nil {
+		return "", err
+	}
+	cacheDir := filepath.Join(stateDir, RuntimeCacheDir)
+	if err = common.Mkdir(cacheDir); err != nil {
+		return "", err
+	}
+	localPath := filepath.Join(cacheDir, checksum)
+
+	// Reuse a previously fetched resource in case it is still intact.
+	if sum, err := fileChecksum(localPath); err == nil && sum == checksum {
+		return localPath, nil
+	}
+
+	if err = fetchRuntime(u.String(), cacheDir, localPath, checksum); err != nil {
+		return "", fmt.Errorf("failed to fetch runtime from '%s': %w", u.String(), err)
+	}
+	return localPath, nil
+}
+
+// parseRuntimeURL parses and validates a remote runtime resource URL, returning the URL without
+// the checksum fragment and the expected checksum. In case the path is not a URL, nil is returned.
+func parseRuntimeURL(path string) (*url.URL, string, error) {
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme == "" {
+		return nil, "", nil
+	}
+
+	if u.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported runtime URL scheme '%s': %s", u.Scheme, path)
+	}
+
+	if !strings.HasPrefix(u.Fragment, checksumFragmentPrefix) {
+		return nil, "", fmt.Errorf("runtime URL is missing a '#%s<hex>' checksum: %s", checksumFragmentPrefix, path)
+	}
+	checksum := strings.ToLower(strings.TrimPrefix(u.Fragment, checksumFragmentPrefix))
+	if raw, err := hex.DecodeString(checksum); err != nil || len(raw) != sha256.Size {
+		return nil, "", fmt.Errorf("runtime URL has a malformed checksum: %s", path)
+	}
+	u.Fragment = ""
+
+	return u, checksum, nil
+}
+
+func fetchRuntime(rawURL, cacheDir, localPath, checksum string) error {
+	client := http.Client{
+		Timeout: runtimeFetchTimeout,
+	}
+	resp, err := client.Get(rawURL) // nolint: noctx
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	// Download into a temporary file so that a partial download is never used.
+	tmpFile, err := ioutil.TempFile(cacheDir, "fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name()) // nolint: errcheck
+
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmpFile, h), resp.Body); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != checksum {
+		return fmt.Errorf("checksum mismatch (expected: %s got: %s)", checksum, sum)
+	}
+
+	if err = os.Chmod(tmpFile.Name(), 0o700); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), localPath)
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,131 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+)
+
+func TestParseRuntimeURL(t *testing.T) {
+	checksum := strings.Repeat("ab", sha256.Size)
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		url      string
+		checksum string
+		err      string
+	}{
+		{"LocalPath", "/path/to/runtime", "", "", ""},
+		{"Remote", "https://example.com/runtime#sha256=" + checksum, "https://example.com/runtime", checksum, ""},
+		{"RemoteUpperCase", "https://example.com/runtime#sha256=" + strings.ToUpper(checksum), "https://example.com/runtime", checksum, ""},
+		{"UnsupportedScheme", "oci://example.com/runtime#sha256=" + checksum, "", "", "unsupported runtime URL scheme 'oci'"},
+		{"MissingChecksum", "https://example.com/runtime", "", "", "missing a '#sha256=<hex>' checksum"},
+		{"MalformedChecksum", "https://example.com/runtime#sha256=abcd", "", "", "malformed checksum"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			u, checksum, err := parseRuntimeURL(tc.path)
+			if tc.err != "" {
+				require.Error(err, "parseRuntimeURL")
+				require.Contains(err.Error(), tc.err)
+				return
+			}
+			require.NoError(err, "parseRuntimeURL")
+			require.Equal(tc.checksum, checksum)
+			switch tc.url {
+			case "":
+				require.Nil(u, "local paths should not be parsed as URLs")
+			default:
+				require.Equal(tc.url, u.String(), "checksum fragment should be removed")
+			}
+		})
+	}
+}
+
+func TestFetchRuntime(t *testing.T) {
+	content := []byte("runtime")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/runtime" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		checksum string
+		err      string
+	}{
+		{"Valid", "/runtime", checksum, ""},
+		{"ChecksumMismatch", "/runtime", strings.Repeat("00", sha256.Size), "checksum mismatch"},
+		{"NotFound", "/missing", checksum, "unexpected status"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			cacheDir := t.TempDir()
+			localPath := filepath.Join(cacheDir, tc.checksum)
+			err := fetchRuntime(srv.URL+tc.path, cacheDir, localPath, tc.checksum)
+			if tc.err != "" {
+				require.Error(err, "fetchRuntime")
+				require.Contains(err.Error(), tc.err)
+
+				files, rerr := ioutil.ReadDir(cacheDir)
+				require.NoError(rerr, "ReadDir")
+				require.Empty(files, "partial downloads should be removed")
+				return
+			}
+			require.NoError(err, "fetchRuntime")
+
+			data, err := ioutil.ReadFile(localPath)
+			require.NoError(err, "ReadFile")
+			require.Equal(content, data, "fetched runtime should match")
+		})
+	}
+}
+
+func TestResolveRuntimePath(t *testing.T) {
+	require := require.New(t)
+
+	var id common.Namespace
+	dataDir := t.TempDir()
+
+	path, err := resolveRuntimePath(dataDir, id, "/path/to/runtime")
+	require.NoError(err, "resolveRuntimePath")
+	require.Equal("/path/to/runtime", path, "local paths should be used unchanged")
+
+	// A previously fetched runtime should be reused without fetching it again.
+	content := []byte("runtime")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	cacheDir := filepath.Join(GetRuntimeStateDir(dataDir, id), RuntimeCacheDir)
+	require.NoError(common.Mkdir(cacheDir), "Mkdir")
+	cachedPath := filepath.Join(cacheDir, checksum)
+	require.NoError(ioutil.WriteFile(cachedPath, content, 0o600), "WriteFile")
+
+	path, err = resolveRuntimePath(dataDir, id, "https://example.invalid/runtime#sha256="+checksum)
+	require.NoError(err, "resolveRuntimePath")
+	require.Equal(cachedPath, path, "cached runtime should be reused")
+
+	// Failures should name the URL.
+	_, err = resolveRuntimePath(dataDir, id, "https://example.invalid/runtime#sha256="+strings.Repeat("00", sha256.Size))
+	require.Error(err, "resolveRuntimePath")
+	require.Contains(err.Error(), "https://example.invalid/runtime")
+}
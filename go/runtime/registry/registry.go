@@ -69,6 +69,15 @@ type Registry interface {
 	// FinishInitialization finalizes setup for all runtimes and starts their
 	// tag indexers.
 	FinishInitialization(ctx context.Context) error
+
+	// Reload re-reads the configuration of the hosted runtimes (e.g., runtime
+	// paths, local configuration and provisioner overrides).
+	//
+	// Running runtimes are not restarted, but the updated configuration is
+	// used the next time they are provisioned. Newly configured runtimes are
+	// registered and runtimes that are no longer configured are drained and
+	// stopped.
+	Reload(ctx context.Context) error
 }
 
 // Runtime is the running node's supported runtime interface.
@@ -113,6 +122,13 @@ type Runtime interface {
 
 	// Host returns the runtime host configuration and provisioner if configured.
 	Host(ctx context.Context) (runtimeHost.Config, runtimeHost.Provisioner, error)
+
+	// BeginRound marks the start of a round processed by the hosted runtime so that draining the
+	// runtime waits for the round to complete. The returned function must be called once the round
+	// has completed.
+	//
+	// In case the runtime is being drained, ErrRuntimeDraining is returned.
+	BeginRound() (func(), error)
 }
 
 type runtime struct { // nolint: maligned
@@ -137,8 +153,7 @@ type runtime struct { // nolint: maligned
 	activeDescriptorCh         chan struct{}
 	activeDescriptorNotifier   *pubsub.Broker
 
-	hostProvisioners map[node.TEEHardware]runtimeHost.Provisioner
-	hostConfig       *runtimeHost.Config
+	host *RuntimeHostConfig
 
 	logger *logging.Logger
 }
@@ -233,26 +248,44 @@ func (r *runtime) LocalStorage() localstorage.LocalStorage {
 	return r.localStorage
 }
 
+func (r *runtime) hostConfig() *runtimeHost.Config {
+	if r.host == nil {
+		return nil
+	}
+	return r.host.RuntimeConfig(r.id)
+}
+
 func (r *runtime) HasHost() bool {
-	return r.hostProvisioners != nil && r.hostConfig != nil
+	return r.hostConfig() != nil
 }
 
 func (r *runtime) Host(ctx context.Context) (runtimeHost.Config, runtimeHost.Provisioner, error) {
-	if r.hostProvisioners == nil || r.hostConfig == nil {
+	hostConfig := r.hostConfig()
+	if hostConfig == nil {
 		return runtimeHost.Config{}, nil, ErrRuntimeHostNotConfigured
 	}
+	if r.host.IsDraining(r.id) {
+		return runtimeHost.Config{}, nil, ErrRuntimeDraining
+	}
 
 	rt, err := r.RegistryDescriptor(ctx)
 	if err != nil {
 		return runtimeHost.Config{}, nil, fmt.Errorf("failed to get runtime registry descriptor: %w", err)
 	}
 
-	provisioner, ok := r.hostProvisioners[rt.TEEHardware]
+	provisioner, ok := r.host.ProvisionersFor(r.id)[rt.TEEHardware]
 	if !ok {
 		return runtimeHost.Config{}, nil, fmt.Errorf("no provisioner suitable for TEE hardware '%s'", rt.TEEHardware)
 	}
 
-	return *r.hostConfig, provisioner, nil
+	return *hostConfig, &trackingProvisioner{provisioner, r.host}, nil
+}
+
+func (r *runtime) BeginRound() (func(), error) {
+	if r.host == nil {
+		return func() {}, nil
+	}
+	return r.host.BeginRound(r.id)
 }
 
 func (r *runtime) stop() {
@@ -402,7 +435,11 @@ type runtimeRegistry struct {
 	consensus consensus.Backend
 	identity  *identity.Identity
 
-	runtimes map[common.Namespace]*runtime
+	reloadLock  sync.Mutex
+	runtimes    map[common.Namespace]*runtime
+	initialized bool
+
+	addRuntime func(ctx context.Context, id common.Namespace) error
 }
 
 func (r *runtimeRegistry) Mode() RuntimeMode {
@@ -481,9 +518,10 @@ func (r *runtimeRegistry) Cleanup() {
 }
 
 func (r *runtimeRegistry) FinishInitialization(ctx context.Context) error {
-	r.RLock()
-	defer r.RUnlock()
+	r.Lock()
+	defer r.Unlock()
 
+	r.initialized = true
 	for _, rt := range r.runtimes {
 		if err := rt.finishInitialization(ctx, r.identity); err != nil {
 			return err
@@ -576,8 +614,7 @@ func newRuntime(
 
 	// Configure runtime host if needed.
 	if cfg.Host != nil {
-		rt.hostProvisioners = cfg.Host.Provisioners
-		rt.hostConfig = cfg.Host.Runtimes[id]
+		rt.host = cfg.Host
 	}
 
 	return rt, nil
@@ -585,7 +622,7 @@ func newRuntime(
 
 // New creates a new runtime registry.
 func New(ctx context.Context, dataDir string, consensus consensus.Backend, identity *identity.Identity, ias ias.Endpoint) (Registry, error) {
-	cfg, err := newConfig(consensus, ias)
+	cfg, err := newConfig(dataDir, consensus, ias)
 	if err != nil {
 		return nil, err
 	}
@@ -598,6 +635,7 @@ func New(ctx context.Context, dataDir string, consensus consensus.Backend, ident
 		identity:  identity,
 		runtimes:  make(map[common.Namespace]*runtime),
 	}
+	r.addRuntime = r.addSupportedRuntime
 
 	switch cfg.Mode {
 	case RuntimeModeNone:
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+)
+
+func (r *runtimeRegistry) Reload(ctx context.Context) error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	rh := r.cfg.Host
+	if rh == nil || r.cfg.Mode == RuntimeModeKeymanager {
+		return ErrRuntimeHostNotConfigured
+	}
+
+	// Re-read the configuration file in case one is being used.
+	if viper.ConfigFileUsed() != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("runtime/registry: failed to read configuration: %w", err)
+		}
+	}
+	runtimes, overrides, err := loadRuntimes(r.dataDir)
+	if err != nil {
+		return fmt.Errorf("runtime/registry: failed to load runtimes: %w", err)
+	}
+
+	current := make(map[common.Namespace]bool)
+	var removed []common.Namespace
+	for _, id := range r.cfg.Runtimes() {
+		current[id] = true
+		if _, ok := runtimes[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	var added []common.Namespace
+	for id := range runtimes {
+		if !current[id] {
+			added = append(added, id)
+		}
+	}
+
+	// Register newly configured runtimes before updating the host configuration so that a failure
+	// leaves the hosted runtimes unchanged.
+	for _, id := range added {
+		if err = r.registerRuntime(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	if err = rh.setRuntimeProvisioners(overrides); err != nil {
+		return fmt.Errorf("runtime/registry: %w", err)
+	}
+	for id, runtimeHostCfg := range runtimes {
+		if current[id] {
+			rh.setRuntimeConfig(id, runtimeHostCfg)
+			continue
+		}
+
+		r.logger.Info("adding supported runtime",
+			"id", id,
+		)
+		rh.addRuntimeConfig(id, runtimeHostCfg)
+	}
+
+	// Gracefully stop runtimes that are no longer configured.
+	drainTimeout := viper.GetDuration(CfgRuntimeDrainTimeout)
+	for _, id := range removed {
+		r.logger.Info("removing supported runtime",
+			"id", id,
+		)
+
+		if err = rh.DrainRuntime(id, drainTimeout); err != nil {
+			r.logger.Warn("failed to gracefully stop removed runtime",
+				"err", err,
+				"id", id,
+			)
+		}
+		rh.removeRuntimeConfig(id)
+	}
+
+	r.logger.Info("reloaded runtime configuration",
+		"num_runtimes", len(runtimes),
+		"num_added", len(added),
+		"num_removed", len(removed),
+	)
+
+	return nil
+}
+
+// registerRuntime registers a newly configured runtime with the registry unless it has already
+// been registered (e.g., in case it has been removed and is now being added back). In case the
+// registry has already been initialized, the runtime is initialized as well.
+func (r *runtimeRegistry) registerRuntime(ctx context.Context, id common.Namespace) error {
+	r.RLock()
+	_, registered := r.runtimes[id]
+	r.RUnlock()
+	if registered {
+		return nil
+	}
+
+	if err := r.addRuntime(ctx, id); err != nil {
+		return fmt.Errorf("runtime/registry: failed to add runtime %s: %w", id, err)
+	}
+
+	// In case the registry has not been initialized yet, the runtime is initialized together with
+	// the other runtimes.
+	r.RLock()
+	rt := r.runtimes[id]
+	initialized := r.initialized
+	r.RUnlock()
+	if !initialized {
+		return nil
+	}
+	if err := rt.finishInitialization(ctx, r.identity); err != nil {
+		return fmt.Errorf("runtime/registry: failed to initialize runtime %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	runtimeHost "github.com/oasisprotocol/oasis-core/go/runtime/host"
+)
+
+// resetTestConfig restores the default configuration once the test completes.
+func resetTestConfig(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Reset()
+		_ = viper.BindPFlags(Flags)
+	})
+}
+
+func TestReload(t *testing.T) {
+	var id1, id2 common.Namespace
+	id2[31] = 1
+
+	for _, tc := range []struct {
+		name       string
+		mode       RuntimeMode
+		paths      map[string]string
+		registered bool
+		addErr     error
+		err        error
+		expected   map[common.Namespace]string
+		added      []common.Namespace
+	}{
+		{"UpdatePath", RuntimeModeCompute, map[string]string{id1.String(): "/path/new"}, false, nil, nil, map[common.Namespace]string{id1: "/path/new"}, nil},
+		{"AddRuntime", RuntimeModeCompute, map[string]string{id1.String(): "/path/new", id2.String(): "/path/b"}, false, nil, nil, map[common.Namespace]string{id1: "/path/new", id2: "/path/b"}, []common.Namespace{id2}},
+		{"AddRegisteredRuntime", RuntimeModeCompute, map[string]string{id1.String(): "/path/old", id2.String(): "/path/b"}, true, nil, nil, map[common.Namespace]string{id1: "/path/old", id2: "/path/b"}, nil},
+		{"AddRuntimeFails", RuntimeModeCompute, map[string]string{id1.String(): "/path/new", id2.String(): "/path/b"}, false, fmt.Errorf("too many runtimes"), fmt.Errorf("too many runtimes"), map[common.Namespace]string{id1: "/path/old"}, []common.Namespace{id2}},
+		{"RemoveRuntime", RuntimeModeCompute, map[string]string{id2.String(): "/path/b"}, false, nil, nil, map[common.Namespace]string{id2: "/path/b"}, []common.Namespace{id2}},
+		{"KeymanagerMode", RuntimeModeKeymanager, map[string]string{id1.String(): "/path/new"}, false, nil, ErrRuntimeHostNotConfigured, map[common.Namespace]string{id1: "/path/old"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			resetTestConfig(t)
+			viper.Set(CfgRuntimePaths, tc.paths)
+
+			rh := &RuntimeHostConfig{
+				Runtimes: map[common.Namespace]*runtimeHost.Config{
+					id1: {RuntimeID: id1, Path: "/path/old"},
+				},
+			}
+			// A runtime being removed should be drained.
+			endRound, err := rh.BeginRound(id1)
+			require.NoError(err, "BeginRound")
+			endRound()
+
+			r := &runtimeRegistry{
+				logger:  logging.GetLogger("runtime/registry/test"),
+				dataDir: t.TempDir(),
+				cfg: &RuntimeConfig{
+					Mode: tc.mode,
+					Host: rh,
+				},
+				runtimes: make(map[common.Namespace]*runtime),
+			}
+			if tc.registered {
+				r.runtimes[id2] = &runtime{id: id2}
+			}
+			var added []common.Namespace
+			r.addRuntime = func(ctx context.Context, id common.Namespace) error {
+				added = append(added, id)
+				return tc.addErr
+			}
+
+			err = r.Reload(context.Background())
+			switch tc.err {
+			case nil:
+				require.NoError(err, "Reload")
+			case ErrRuntimeHostNotConfigured:
+				require.ErrorIs(err, tc.err, "Reload")
+			default:
+				require.Error(err, "Reload")
+				require.Contains(err.Error(), tc.err.Error())
+			}
+			require.Equal(tc.added, added, "only new runtimes should be registered")
+
+			paths := make(map[common.Namespace]string)
+			for _, id := range r.cfg.Runtimes() {
+				paths[id] = rh.RuntimeConfig(id).Path
+			}
+			require.Equal(tc.expected, paths, "configured runtimes")
+			if _, ok := tc.expected[id1]; !ok {
+				require.True(rh.IsDraining(id1), "removed runtimes should be drained")
+			}
+		})
+	}
+}
+
+func TestReloadReAddRuntime(t *testing.T) {
+	require := require.New(t)
+
+	var id, other common.Namespace
+	other[31] = 1
+	resetTestConfig(t)
+
+	rh := newTestHostConfig(id)
+	rh.Runtimes[other] = &runtimeHost.Config{RuntimeID: other, Path: "/path/other"}
+	r := &runtimeRegistry{
+		logger:  logging.GetLogger("runtime/registry/test"),
+		dataDir: t.TempDir(),
+		cfg: &RuntimeConfig{
+			Mode: RuntimeModeCompute,
+			Host: rh,
+		},
+		runtimes: map[common.Namespace]*runtime{
+			id: {id: id},
+		},
+		addRuntime: func(ctx context.Context, id common.Namespace) error {
+			return fmt.Errorf("runtime already registered")
+		},
+	}
+
+	viper.Set(CfgRuntimePaths, map[string]string{other.String(): "/path/other"})
+	require.NoError(r.Reload(context.Background()), "Reload")
+	require.Nil(rh.RuntimeConfig(id), "removed runtime should not be configured")
+	_, err := rh.BeginRound(id)
+	require.ErrorIs(err, ErrRuntimeDraining, "removed runtime should be drained")
+
+	viper.Set(CfgRuntimePaths, map[string]string{id.String(): "/path/new", other.String(): "/path/other"})
+	require.NoError(r.Reload(context.Background()), "Reload")
+	require.Equal("/path/new", rh.RuntimeConfig(id).Path, "runtime should be configured again")
+	require.False(rh.IsDraining(id), "runtime should no longer be draining")
+}
@@ -2,10 +2,73 @@
 package api
 
 import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
 )
 
+// LifecycleObserver is an observer of transaction lifecycle events in the scheduler.
+//
+// Observer methods are always invoked without holding any scheduler locks, so it is safe for
+// them to call back into the scheduler.
+type LifecycleObserver interface {
+	// TxQueued is called after a transaction has been queued.
+	TxQueued(tx *transaction.CheckedTransaction)
+
+	// TxSelected is called after a set of transactions has been selected into a batch.
+	TxSelected(txs []*transaction.CheckedTransaction)
+
+	// TxRemoved is called after a transaction has been removed from the queue (e.g., after it has
+	// been included in a batch).
+	TxRemoved(tx *transaction.CheckedTransaction)
+
+	// TxEvicted is called after a transaction has been evicted from the queue, either to make
+	// room for a higher priority transaction or because it no longer fits the weight limits.
+	TxEvicted(tx *transaction.CheckedTransaction)
+
+	// TxExpired is called after a transaction has been removed from the queue due to expiry.
+	TxExpired(tx *transaction.CheckedTransaction)
+
+	// TxReplaced is called after a queued transaction has been replaced by another transaction.
+	TxReplaced(old, new *transaction.CheckedTransaction)
+}
+
+// MetricsRegisterer is an optional interface implemented by schedulers that can export their own
+// Prometheus metrics. Embedders which want metrics should check whether the scheduler implements
+// it.
+type MetricsRegisterer interface {
+	// RegisterMetrics registers the scheduler metrics (pool size, per-weight pool usage, evicted
+	// and dropped transactions, batch formation time and transaction pool statistics) with the
+	// given registerer. The given labels are attached to all metrics.
+	//
+	// Metrics should only be registered once per scheduler, unless they have been unregistered
+	// in the meantime.
+	RegisterMetrics(registerer prometheus.Registerer, labels prometheus.Labels) error
+
+	// UnregisterMetrics unregisters any previously registered scheduler metrics, removing all of
+	// their series. It should be called when the scheduler is torn down.
+	UnregisterMetrics()
+}
+
+// FeeMarketState describes the back pressure signals of the scheduler that can be used to adjust
+// transaction fees.
+type FeeMarketState struct {
+	// LastBatchMinPriority is the minimum priority of transactions that made it into the last
+	// batch. It is zero in case no batch has been produced yet.
+	LastBatchMinPriority uint64
+	// PoolFillRatio is the ratio (0-1) between the number of queued transactions and the
+	// maximum pool size.
+	PoolFillRatio float64
+	// LowestPriority is the lowest priority of any queued transaction. It is zero in case there
+	// are no queued transactions.
+	LowestPriority uint64
+	// MinPriority is the configured minimum priority below which transactions are rejected.
+	MinPriority uint64
+}
+
 // Scheduler defines an algorithm for scheduling incoming transactions.
 type Scheduler interface {
 	// Name is the scheduler algorithm name.
@@ -20,6 +83,30 @@ type Scheduler interface {
 	// GetBatch returns a batch of scheduled transactions (if any is available).
 	GetBatch(force bool) []*transaction.CheckedTransaction
 
+	// GetBatchWithLimits returns a batch of scheduled transactions (if any is available) like
+	// GetBatch, but limits the batch to the given weight budget (e.g., to leave room for other
+	// messages). The budget can only make batches smaller than the configured weight limits.
+	GetBatchWithLimits(force bool, limits map[transaction.Weight]uint64) []*transaction.CheckedTransaction
+
+	// PeekBatch returns the batch that GetBatch would currently return without any side effects
+	// on the queued transactions.
+	PeekBatch(force bool) []*transaction.CheckedTransaction
+
+	// EstimateBatchWeights returns the total weights of the batch that GetBatch would currently
+	// return without any side effects on the queued transactions.
+	EstimateBatchWeights(force bool) map[transaction.Weight]uint64
+
+	// BatchSeq returns the insertion sequence number at which the last batch was produced by
+	// GetBatch. It should be passed to BatchStale in order to check whether the batch is stale.
+	BatchSeq() uint64
+
+	// BatchStale returns true iff transactions with a higher priority than the minimum priority of
+	// the batch produced at the given insertion sequence number have been added since the batch was
+	// produced.
+	//
+	// In case the given batch is not the last batch produced by GetBatch, it is considered stale.
+	BatchStale(producedAtSeq uint64) bool
+
 	// GetPrioritizedBatch returns a batch of transactions ordered by priority but without taking
 	// any weight limits into account.
 	//
@@ -28,12 +115,26 @@ type Scheduler interface {
 	// and only following transactions will be returned.
 	GetPrioritizedBatch(offset *hash.Hash, limit uint32) []*transaction.CheckedTransaction
 
+	// IterateDescending invokes the given function for each unscheduled transaction in descending
+	// priority order until the function returns false, without taking any weight limits into
+	// account. Offset has the same meaning as in GetPrioritizedBatch.
+	//
+	// The function is called with the queue locked and must not call back into the scheduler.
+	IterateDescending(offset *hash.Hash, fn func(tx *transaction.CheckedTransaction) bool)
+
 	// GetKnownBatch gets a set of known transactions from the transaction pool.
 	//
 	// For any missing transactions nil will be returned in their place and the map of missing
 	// transactions will be populated accoordingly.
 	GetKnownBatch(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int)
 
+	// GetKnownBatchOrdered gets a set of known transactions from the transaction pool like
+	// GetKnownBatch, but only returns the found transactions in the order in which they would be
+	// scheduled.
+	//
+	// The map of missing transactions is populated with their indices in the given batch.
+	GetKnownBatchOrdered(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int)
+
 	// GetTransactions returns the given number of transactions from the transaction pool without
 	// taking any batch limits or priorities into account.
 	//
@@ -43,12 +144,80 @@ type Scheduler interface {
 	// UnscheduledSize returns number of unscheduled items.
 	UnscheduledSize() uint64
 
+	// Weights returns the total weights of all unscheduled transactions. Together with
+	// WeightLimits this can be used to determine how close the pool is to each weight limit.
+	//
+	// The returned map is a copy and may be freely modified by the caller.
+	Weights() map[transaction.Weight]uint64
+
+	// WeightLimits returns the current batch weight limits.
+	//
+	// The returned map is a copy and may be freely modified by the caller.
+	WeightLimits() map[transaction.Weight]uint64
+
+	// RemainingCapacity returns, for each weight with a configured limit, how much of the limit is
+	// not yet used by unscheduled transactions (floored at zero). Together with FreeSlots this can
+	// be used to reject transactions that obviously cannot be accepted without queueing them.
+	//
+	// The returned map is a copy and may be freely modified by the caller.
+	RemainingCapacity() map[transaction.Weight]uint64
+
+	// FreeSlots returns the number of transactions that can still be queued before the maximum
+	// pool size is reached.
+	FreeSlots() uint64
+
+	// EstimatePriorityPercentile returns an estimate of the given percentile (0-100) of the
+	// priorities of unscheduled transactions. This can be used to suggest a priority that a new
+	// transaction should have in order to be scheduled in a timely manner.
+	//
+	// If there are no unscheduled transactions, zero is returned.
+	EstimatePriorityPercentile(percentile float64) uint64
+
+	// FeeMarketState returns the current fee market state.
+	FeeMarketState() FeeMarketState
+
 	// IsQueued returns if a transaction is queued.
 	IsQueued(hash.Hash) bool
 
 	// UpdateParameters updates the scheduling parameters.
 	UpdateParameters(weightLimits map[transaction.Weight]uint64)
 
+	// UpdateMinPriority updates the minimum priority of transactions. Transactions with a lower
+	// priority are rejected regardless of pool occupancy.
+	UpdateMinPriority(min uint64)
+
+	// Transition atomically updates the scheduling parameters and migrates the queued transactions
+	// using the given migration function, which may drop or transform transactions.
+	//
+	// The migration function is called with the queue locked and must not call back into the
+	// scheduler. A nil migration function retains all transactions.
+	Transition(
+		weightLimits map[transaction.Weight]uint64,
+		migrate func(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction,
+	)
+
+	// RecomputeWeights recomputes the weights of all queued transactions using the given function.
+	//
+	// Transactions that no longer fit the weight limits are removed. This is an expensive operation
+	// as it processes all queued transactions.
+	RecomputeWeights(fn func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64)
+
+	// Pin pins a queued transaction as an operator override so that it is never evicted, survives
+	// Clear and is scheduled before other transactions, subject to the weight limits.
+	Pin(h hash.Hash)
+
+	// Unpin releases the pin of the given transaction (if any).
+	Unpin(h hash.Hash)
+
+	// ExpireOldTransactions removes transactions that have been queued for longer than the given
+	// maximum age and returns their hashes. It is safe to call periodically from a background
+	// goroutine.
+	ExpireOldTransactions(maxAge time.Duration) []hash.Hash
+
 	// Clear clears the transaction queue.
 	Clear()
+
+	// SetLifecycleObserver configures the transaction lifecycle observer. Passing nil removes any
+	// previously configured observer.
+	SetLifecycleObserver(obs LifecycleObserver)
 }
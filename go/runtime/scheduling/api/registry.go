@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+var registeredSchedulers sync.Map
+
+// Params are the parameters used to construct a scheduler.
+type Params struct {
+	// RuntimeID is the identifier of the runtime the scheduler is for.
+	RuntimeID common.Namespace
+	// MaxTxPoolSize is the maximum number of queued transactions.
+	MaxTxPoolSize uint64
+	// WeightLimits are the batch weight limits.
+	WeightLimits map[transaction.Weight]uint64
+
+	// MaxOverflowSize is the maximum number of transactions held in the overflow queue. Zero
+	// disables the overflow queue. Schedulers without an overflow queue ignore it.
+	MaxOverflowSize uint64
+	// MaxSenderTxs is the maximum number of queued transactions per sender. Zero means that the
+	// number of transactions per sender is not limited. Schedulers without per-sender limits
+	// ignore it.
+	MaxSenderTxs uint64
+	// ReplaceByFee enables replacing queued transactions with higher priority transactions that
+	// have the same replacement key. Schedulers without replace-by-fee support ignore it.
+	ReplaceByFee bool
+}
+
+// Factory creates a new scheduler with the given parameters.
+type Factory func(params *Params) (Scheduler, error)
+
+// Register registers a new scheduler algorithm under the given name.
+func Register(name string, factory Factory) {
+	if _, isRegistered := registeredSchedulers.LoadOrStore(name, factory); isRegistered {
+		panic(fmt.Errorf("scheduling: scheduler algorithm already registered: %s", name))
+	}
+}
+
+// New creates a new scheduler using the scheduler algorithm registered under the given name.
+func New(name string, params *Params) (Scheduler, error) {
+	factory, ok := registeredSchedulers.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("invalid transaction scheduler algorithm: %s", name)
+	}
+	return factory.(Factory)(params)
+}
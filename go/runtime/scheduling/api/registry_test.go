@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+type fakeScheduler struct {
+	Scheduler
+
+	params *Params
+}
+
+func (s *fakeScheduler) Name() string {
+	return "fake"
+}
+
+func TestRegistry(t *testing.T) {
+	require := require.New(t)
+
+	Register("fake", func(params *Params) (Scheduler, error) {
+		return &fakeScheduler{params: params}, nil
+	})
+	require.Panics(func() {
+		Register("fake", func(params *Params) (Scheduler, error) {
+			return nil, nil
+		})
+	}, "registering an algorithm twice should panic")
+
+	params := &Params{
+		MaxTxPoolSize: 10,
+		WeightLimits:  map[transaction.Weight]uint64{transaction.WeightCount: 5},
+	}
+	sched, err := New("fake", params)
+	require.NoError(err, "New")
+	require.Equal("fake", sched.Name())
+	require.Equal(params, sched.(*fakeScheduler).params, "parameters should be passed to the factory")
+
+	_, err = New("unknown", params)
+	require.Error(err, "unknown algorithms should fail")
+}
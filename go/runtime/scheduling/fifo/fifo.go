@@ -0,0 +1,737 @@
+// Package fifo implements a transaction scheduler which schedules transactions strictly in the
+// order of their arrival, regardless of their priority.
+package fifo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
+	txpool "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/batching"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
+)
+
+// Name of the scheduler.
+const Name = "fifo"
+
+// OrderFunc reorders the given queued transactions, which are passed in arrival order, into the
+// order in which they should be scheduled. It must return a permutation of the given transactions.
+type OrderFunc func(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction
+
+type item struct {
+	tx  *transaction.CheckedTransaction
+	seq uint64
+	// addedAt is the time at which the transaction was queued.
+	addedAt time.Time
+}
+
+type scheduler struct {
+	sync.Mutex
+
+	logger *logging.Logger
+
+	name  string
+	order OrderFunc
+
+	// queue are the queued transactions in arrival order.
+	queue        []*item
+	transactions map[hash.Hash]*item
+	pinned       map[hash.Hash]bool
+	poolWeights  map[transaction.Weight]uint64
+
+	maxTxPoolSize uint64
+	weightLimits  batching.Limits
+	minPriority   uint64
+
+	seq              uint64
+	batchSeq         uint64
+	batchMinPriority uint64
+
+	observer api.LifecycleObserver
+	// notifications are observer notifications deferred until the lock is released.
+	notifications []func(obs api.LifecycleObserver)
+}
+
+// notifyLocked defers the given observer notification until the lock is released.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) notifyLocked(fn func(obs api.LifecycleObserver)) {
+	if s.observer == nil {
+		return
+	}
+	s.notifications = append(s.notifications, fn)
+}
+
+// unlockAndNotify releases the lock and invokes any deferred observer notifications.
+func (s *scheduler) unlockAndNotify() {
+	obs := s.observer
+	notifications := s.notifications
+	s.notifications = nil
+	s.Unlock()
+
+	for _, fn := range notifications {
+		fn(obs)
+	}
+}
+
+func (s *scheduler) Name() string {
+	return s.name
+}
+
+func (s *scheduler) QueueTx(tx *transaction.CheckedTransaction) error {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	if _, ok := s.transactions[tx.Hash()]; ok {
+		// Return success in case of duplicate calls to avoid the client
+		// mistaking this for an actual error.
+		s.logger.Warn("ignoring duplicate call",
+			"batch", tx,
+		)
+		return nil
+	}
+	if w, ok := s.weightLimits.Exceeded(tx); ok {
+		return p2pError.Permanent(fmt.Errorf("transaction doesn't fit batch weight limit '%s': %w", w, txpool.ErrTxTooLarge))
+	}
+	if tx.Priority() < s.minPriority {
+		return fmt.Errorf("%w: priority %d is below minimum %d", txpool.ErrTxTooCheap, tx.Priority(), s.minPriority)
+	}
+	if uint64(len(s.queue)) >= s.maxTxPoolSize {
+		// Arrival order takes precedence, so queued transactions are never evicted.
+		return txpool.ErrPoolFull
+	}
+
+	s.seq++
+	s.insertLocked(&item{tx: tx, seq: s.seq, addedAt: time.Now()})
+	s.notifyLocked(func(obs api.LifecycleObserver) {
+		obs.TxQueued(tx)
+	})
+
+	return nil
+}
+
+func (s *scheduler) RemoveTxBatch(batch []hash.Hash) {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	toRemove := make(map[hash.Hash]bool, len(batch))
+	for _, h := range batch {
+		toRemove[h] = true
+	}
+	removed := s.removeLocked(toRemove)
+	s.notifyLocked(func(obs api.LifecycleObserver) {
+		for _, tx := range removed {
+			obs.TxRemoved(tx)
+		}
+	})
+}
+
+func (s *scheduler) GetBatch(force bool) []*transaction.CheckedTransaction {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	return s.getBatchLocked(force, s.weightLimits.Get())
+}
+
+func (s *scheduler) GetBatchWithLimits(force bool, limits map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	return s.getBatchLocked(force, s.weightLimits.Budget(limits))
+}
+
+// getBatchLocked selects the next batch using the given batch weight budget and records it as
+// the last produced batch.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) getBatchLocked(force bool, budget map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
+	batch := s.selectBatchLocked(force, true, budget)
+	if len(batch) > 0 {
+		s.batchSeq = s.seq
+		s.batchMinPriority = batching.MinPriority(batch, func(h hash.Hash) bool {
+			return s.pinned[h]
+		})
+
+		s.notifyLocked(func(obs api.LifecycleObserver) {
+			obs.TxSelected(batch)
+		})
+	}
+	return batch
+}
+
+func (s *scheduler) PeekBatch(force bool) []*transaction.CheckedTransaction {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.selectBatchLocked(force, false, s.weightLimits.Get())
+}
+
+func (s *scheduler) EstimateBatchWeights(force bool) map[transaction.Weight]uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return batching.SumWeights(s.selectBatchLocked(force, false, s.weightLimits.Get()))
+}
+
+// selectBatchLocked selects the transactions for the next batch within the given batch weight
+// budget. Pinned transactions are selected first, followed by the remaining transactions in
+// schedule order. Selection stops at the first transaction that does not fit the batch, so that a
+// transaction is never scheduled before one preceding it.
+//
+// In case evictOversized is true, any transactions not fitting the configured weight limits are
+// removed, otherwise they are skipped.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) selectBatchLocked(force, evictOversized bool, budget map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
+	// Check if a batch is ready.
+	if !s.batchReadyLocked() && !force {
+		return nil
+	}
+
+	var (
+		batch   []*transaction.CheckedTransaction
+		evicted []*transaction.CheckedTransaction
+	)
+	batchWeights := batching.NewWeights(budget)
+	oversized := make(map[hash.Hash]bool)
+	for _, item := range s.scheduleOrderLocked() {
+		if _, ok := s.weightLimits.Exceeded(item.tx); ok {
+			// Transaction weight greater than the limit. Drop the tx from the queue.
+			oversized[item.tx.Hash()] = true
+			continue
+		}
+		if check, _ := batchWeights.Check(item.tx); check != batching.CheckFits {
+			break
+		}
+
+		batch = append(batch, item.tx)
+		batchWeights.Add(item.tx)
+	}
+
+	if evictOversized && len(oversized) > 0 {
+		evicted = s.removeLocked(oversized)
+		s.notifyLocked(func(obs api.LifecycleObserver) {
+			for _, tx := range evicted {
+				obs.TxEvicted(tx)
+			}
+		})
+	}
+
+	return batch
+}
+
+// scheduleOrderLocked returns the queued transactions in the order in which they are scheduled.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) scheduleOrderLocked() []*item {
+	items := make([]*item, 0, len(s.queue))
+	unpinned := make([]*item, 0, len(s.queue))
+	for _, item := range s.queue {
+		if s.pinned[item.tx.Hash()] {
+			items = append(items, item)
+		} else {
+			unpinned = append(unpinned, item)
+		}
+	}
+	return append(items, s.orderLocked(unpinned)...)
+}
+
+// orderLocked reorders the given items, which must be in arrival order, using the configured
+// order function (if any).
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) orderLocked(items []*item) []*item {
+	if s.order == nil {
+		return items
+	}
+
+	txs := make([]*transaction.CheckedTransaction, 0, len(items))
+	for _, item := range items {
+		txs = append(txs, item.tx)
+	}
+	ordered := make([]*item, 0, len(items))
+	for _, tx := range s.order(txs) {
+		ordered = append(ordered, s.transactions[tx.Hash()])
+	}
+	return ordered
+}
+
+// batchReadyLocked returns true iff any of the pool weights has reached its batch weight limit.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) batchReadyLocked() bool {
+	return s.weightLimits.Reached(s.poolWeights)
+}
+
+func (s *scheduler) BatchSeq() uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.batchSeq
+}
+
+func (s *scheduler) BatchStale(producedAtSeq uint64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if producedAtSeq != s.batchSeq {
+		return true
+	}
+	if s.order == nil {
+		// Transactions queued later never take precedence over earlier ones.
+		return false
+	}
+
+	// Only transactions with a priority higher than the batch minimum can take precedence.
+	for _, item := range s.queue {
+		if item.seq > producedAtSeq && item.tx.Priority() > s.batchMinPriority {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPrioritizedBatch returns a batch of transactions in schedule order, which is the priority
+// order of this scheduler.
+func (s *scheduler) GetPrioritizedBatch(offset *hash.Hash, limit uint32) []*transaction.CheckedTransaction {
+	var batch []*transaction.CheckedTransaction
+	s.IterateDescending(offset, func(tx *transaction.CheckedTransaction) bool {
+		batch = append(batch, tx)
+		return limit == 0 || uint32(len(batch)) < limit
+	})
+	return batch
+}
+
+// IterateDescending iterates over the queued transactions in schedule order, which is the priority
+// order of this scheduler.
+func (s *scheduler) IterateDescending(offset *hash.Hash, fn func(tx *transaction.CheckedTransaction) bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	items := s.orderLocked(s.queue)
+	if offset != nil {
+		idx := -1
+		for i, item := range items {
+			if h := item.tx.Hash(); h.Equal(offset) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return
+		}
+		items = items[idx+1:]
+	}
+
+	for _, item := range items {
+		if !fn(item.tx) {
+			return
+		}
+	}
+}
+
+func (s *scheduler) GetKnownBatch(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int) {
+	s.Lock()
+	defer s.Unlock()
+
+	result := make([]*transaction.CheckedTransaction, 0, len(batch))
+	missing := make(map[hash.Hash]int)
+	for index, h := range batch {
+		if item, ok := s.transactions[h]; ok {
+			result = append(result, item.tx)
+		} else {
+			result = append(result, nil)
+			missing[h] = index
+		}
+	}
+	return result, missing
+}
+
+func (s *scheduler) GetKnownBatchOrdered(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int) {
+	s.Lock()
+	defer s.Unlock()
+
+	known := make(map[hash.Hash]bool, len(batch))
+	missing := make(map[hash.Hash]int)
+	for index, h := range batch {
+		if _, ok := s.transactions[h]; ok {
+			known[h] = true
+		} else {
+			missing[h] = index
+		}
+	}
+
+	result := make([]*transaction.CheckedTransaction, 0, len(known))
+	if len(known) == 0 {
+		return result, missing
+	}
+	for _, item := range s.scheduleOrderLocked() {
+		if known[item.tx.Hash()] {
+			result = append(result, item.tx)
+		}
+	}
+	return result, missing
+}
+
+func (s *scheduler) GetTransactions(limit int) []*transaction.CheckedTransaction {
+	s.Lock()
+	defer s.Unlock()
+
+	n := len(s.queue)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	txs := make([]*transaction.CheckedTransaction, 0, n)
+	for _, item := range s.queue[:n] {
+		txs = append(txs, item.tx)
+	}
+	return txs
+}
+
+func (s *scheduler) UnscheduledSize() uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return uint64(len(s.queue))
+}
+
+func (s *scheduler) Weights() map[transaction.Weight]uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return batching.CopyWeights(s.poolWeights)
+}
+
+func (s *scheduler) WeightLimits() map[transaction.Weight]uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.weightLimits.Copy()
+}
+
+func (s *scheduler) RemainingCapacity() map[transaction.Weight]uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.weightLimits.Remaining(s.poolWeights)
+}
+
+func (s *scheduler) FreeSlots() uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	if size := uint64(len(s.queue)); size < s.maxTxPoolSize {
+		return s.maxTxPoolSize - size
+	}
+	return 0
+}
+
+func (s *scheduler) EstimatePriorityPercentile(percentile float64) uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.queue) == 0 {
+		return 0
+	}
+
+	priorities := make([]uint64, 0, len(s.queue))
+	for _, item := range s.queue {
+		priorities = append(priorities, item.tx.Priority())
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+
+	// Determine the (one-based) rank of the transaction at the given percentile.
+	percentile = math.Max(0, math.Min(100, percentile))
+	rank := int(math.Ceil(percentile / 100 * float64(len(priorities))))
+	if rank == 0 {
+		rank = 1
+	}
+	return priorities[rank-1]
+}
+
+func (s *scheduler) FeeMarketState() api.FeeMarketState {
+	s.Lock()
+	defer s.Unlock()
+
+	state := api.FeeMarketState{
+		LastBatchMinPriority: s.batchMinPriority,
+		MinPriority:          s.minPriority,
+	}
+	if s.maxTxPoolSize > 0 {
+		state.PoolFillRatio = float64(len(s.queue)) / float64(s.maxTxPoolSize)
+	}
+	for i, item := range s.queue {
+		if i == 0 || item.tx.Priority() < state.LowestPriority {
+			state.LowestPriority = item.tx.Priority()
+		}
+	}
+	return state
+}
+
+func (s *scheduler) IsQueued(h hash.Hash) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	_, ok := s.transactions[h]
+	return ok
+}
+
+func (s *scheduler) UpdateParameters(weightLimits map[transaction.Weight]uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.weightLimits = batching.NewLimits((&txpool.Config{WeightLimits: weightLimits}).GetWeightLimits())
+
+	// Any transaction not within the new limits will get removed during GetBatch iteration.
+}
+
+func (s *scheduler) UpdateMinPriority(min uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.minPriority = min
+}
+
+// Transition updates the scheduling parameters and migrates the queued transactions, which are
+// passed to the migration function in arrival order.
+func (s *scheduler) Transition(
+	weightLimits map[transaction.Weight]uint64,
+	migrate func(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction,
+) {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	s.weightLimits = batching.NewLimits((&txpool.Config{WeightLimits: weightLimits}).GetWeightLimits())
+
+	txs := make([]*transaction.CheckedTransaction, 0, len(s.queue))
+	for _, item := range s.queue {
+		txs = append(txs, item.tx)
+	}
+	if migrate != nil {
+		txs = migrate(txs)
+	}
+
+	old := s.transactions
+	s.queue = nil
+	s.transactions = make(map[hash.Hash]*item)
+	s.poolWeights = make(map[transaction.Weight]uint64)
+	for _, tx := range txs {
+		if _, exists := s.transactions[tx.Hash()]; exists {
+			continue
+		}
+		if _, ok := s.weightLimits.Exceeded(tx); ok || uint64(len(s.queue)) >= s.maxTxPoolSize {
+			continue
+		}
+
+		it := &item{tx: tx, addedAt: time.Now()}
+		if prev, ok := old[tx.Hash()]; ok {
+			it.seq, it.addedAt = prev.seq, prev.addedAt
+		} else {
+			s.seq++
+			it.seq = s.seq
+		}
+		s.insertLocked(it)
+	}
+
+	// Pinned transactions stay pinned in case they are retained.
+	for h := range s.pinned {
+		if _, ok := s.transactions[h]; !ok {
+			delete(s.pinned, h)
+		}
+	}
+
+	var dropped []*transaction.CheckedTransaction
+	for h, item := range old {
+		if _, ok := s.transactions[h]; !ok {
+			dropped = append(dropped, item.tx)
+		}
+	}
+	s.notifyLocked(func(obs api.LifecycleObserver) {
+		for _, tx := range dropped {
+			obs.TxEvicted(tx)
+		}
+	})
+}
+
+func (s *scheduler) RecomputeWeights(fn func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64) {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	poolWeights := make(map[transaction.Weight]uint64)
+	oversized := make(map[hash.Hash]bool)
+	for _, item := range s.queue {
+		weights := make(map[transaction.Weight]uint64)
+		for w, v := range fn(item.tx) {
+			weights[w] = v
+		}
+
+		// The intrinsic count and size weights are preserved by the constructor.
+		tx := transaction.NewCheckedTransactionWithSender(item.tx.Raw(), item.tx.Priority(), weights, item.tx.Sender(), item.tx.SenderSeq())
+		tx.SetFirstSeen(item.tx.FirstSeen(), item.tx.Source())
+		item.tx = tx
+		for w, v := range item.tx.Weights() {
+			poolWeights[w] += v
+		}
+		if _, ok := s.weightLimits.Exceeded(item.tx); ok {
+			oversized[item.tx.Hash()] = true
+		}
+	}
+	s.poolWeights = poolWeights
+
+	// Remove transactions that no longer fit the weight limits.
+	evicted := s.removeLocked(oversized)
+	s.notifyLocked(func(obs api.LifecycleObserver) {
+		for _, tx := range evicted {
+			obs.TxEvicted(tx)
+		}
+	})
+}
+
+func (s *scheduler) Pin(h hash.Hash) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.transactions[h]; ok {
+		s.pinned[h] = true
+	}
+}
+
+func (s *scheduler) Unpin(h hash.Hash) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.pinned, h)
+}
+
+func (s *scheduler) ExpireOldTransactions(maxAge time.Duration) []hash.Hash {
+	s.Lock()
+	defer s.unlockAndNotify()
+
+	cutoff := time.Now().Add(-maxAge)
+	toRemove := make(map[hash.Hash]bool)
+	for _, item := range s.queue {
+		if !s.pinned[item.tx.Hash()] && item.addedAt.Before(cutoff) {
+			toRemove[item.tx.Hash()] = true
+		}
+	}
+	expired := s.removeLocked(toRemove)
+	if len(expired) == 0 {
+		return nil
+	}
+
+	hashes := make([]hash.Hash, 0, len(expired))
+	for _, tx := range expired {
+		hashes = append(hashes, tx.Hash())
+	}
+	s.notifyLocked(func(obs api.LifecycleObserver) {
+		for _, tx := range expired {
+			obs.TxExpired(tx)
+		}
+	})
+	return hashes
+}
+
+func (s *scheduler) Clear() {
+	s.Lock()
+	defer s.Unlock()
+
+	// Pinned transactions survive clearing.
+	toRemove := make(map[hash.Hash]bool)
+	for _, item := range s.queue {
+		if !s.pinned[item.tx.Hash()] {
+			toRemove[item.tx.Hash()] = true
+		}
+	}
+	s.removeLocked(toRemove)
+	s.batchSeq = 0
+	s.batchMinPriority = 0
+}
+
+func (s *scheduler) SetLifecycleObserver(obs api.LifecycleObserver) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.observer = obs
+}
+
+// insertLocked appends the given item to the queue.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) insertLocked(item *item) {
+	s.queue = append(s.queue, item)
+	s.transactions[item.tx.Hash()] = item
+	for w, v := range item.tx.Weights() {
+		s.poolWeights[w] += v
+	}
+}
+
+// removeLocked removes the given transactions from the queue, preserving the order of the
+// remaining transactions, and returns the removed transactions.
+//
+// NOTE: Assumes lock is held.
+func (s *scheduler) removeLocked(toRemove map[hash.Hash]bool) []*transaction.CheckedTransaction {
+	if len(toRemove) == 0 {
+		return nil
+	}
+
+	var removed []*transaction.CheckedTransaction
+	queue := s.queue[:0]
+	for _, item := range s.queue {
+		h := item.tx.Hash()
+		if !toRemove[h] {
+			queue = append(queue, item)
+			continue
+		}
+
+		removed = append(removed, item.tx)
+		delete(s.transactions, h)
+		delete(s.pinned, h)
+		for w, v := range item.tx.Weights() {
+			s.poolWeights[w] -= v
+		}
+	}
+	for i := len(queue); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+	s.queue = queue
+	return removed
+}
+
+func init() {
+	api.Register(Name, func(params *api.Params) (api.Scheduler, error) {
+		return New(params.MaxTxPoolSize, params.WeightLimits), nil
+	})
+}
+
+// New creates a new FIFO scheduler.
+func New(maxTxPoolSize uint64, weightLimits map[transaction.Weight]uint64) api.Scheduler {
+	return NewOrdered(Name, nil, maxTxPoolSize, weightLimits)
+}
+
+// NewOrdered creates a new scheduler with the given name which queues transactions like the FIFO
+// scheduler, but schedules them in the order determined by the given order function. A nil order
+// function schedules transactions in arrival order.
+func NewOrdered(
+	name string,
+	order OrderFunc,
+	maxTxPoolSize uint64,
+	weightLimits map[transaction.Weight]uint64,
+) api.Scheduler {
+	return &scheduler{
+		logger:        logging.GetLogger("runtime/scheduling").With("scheduler", name),
+		name:          name,
+		order:         order,
+		transactions:  make(map[hash.Hash]*item),
+		pinned:        make(map[hash.Hash]bool),
+		poolWeights:   make(map[transaction.Weight]uint64),
+		maxTxPoolSize: maxTxPoolSize,
+		weightLimits:  batching.NewLimits((&txpool.Config{WeightLimits: weightLimits}).GetWeightLimits()),
+	}
+}
@@ -0,0 +1,57 @@
+package fifo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+func TestFIFOSchedulerOrder(t *testing.T) {
+	require := require.New(t)
+
+	algo, err := api.New(Name, &api.Params{
+		RuntimeID:     common.Namespace{},
+		MaxTxPoolSize: 5,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     3,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+	require.NoError(err, "New")
+	require.Equal(Name, algo.Name())
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 5; i++ {
+		// Later transactions have higher priorities, which should be ignored.
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("transaction %04d", i)), uint64(10+i), nil)
+		txs = append(txs, tx)
+		require.NoError(algo.QueueTx(tx), "QueueTx")
+	}
+	err = algo.QueueTx(transaction.NewCheckedTransaction([]byte("high priority"), 1000, nil))
+	require.Error(err, "QueueTx should fail when the queue is full")
+
+	batch := algo.GetBatch(false)
+	require.Equal(txs[:3], batch, "batch should be in arrival order")
+	require.False(algo.BatchStale(algo.BatchSeq()), "last batch should not be stale")
+	algo.RemoveTxBatch([]hash.Hash{txs[0].Hash(), txs[1].Hash(), txs[2].Hash()})
+
+	require.Empty(algo.GetBatch(false), "batch should not be produced below the limits unless forced")
+	require.Equal(txs[3:], algo.GetBatch(true), "forced batch should include remaining transactions")
+
+	// Weight limits should be honored without reordering transactions.
+	algo.UpdateParameters(map[transaction.Weight]uint64{
+		transaction.WeightCount:     3,
+		transaction.WeightSizeBytes: txs[3].Size() + txs[4].Size() - 1,
+	})
+	require.Equal(txs[3:4], algo.GetBatch(true), "batch should stop at the first transaction not fitting")
+
+	// Pinned transactions should be scheduled first.
+	algo.Pin(txs[4].Hash())
+	require.Equal([]*transaction.CheckedTransaction{txs[4]}, algo.GetBatch(true), "pinned transactions should be first")
+}
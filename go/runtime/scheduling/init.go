@@ -1,20 +1,14 @@
 package scheduling
 
 import (
-	"fmt"
-
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
-	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple"
-	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/priorityqueue"
-	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+	// Register the available schedulers.
+	_ "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/fifo"
+	_ "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/roundrobin"
+	_ "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple"
 )
 
-// New creates a new scheduler.
-func New(maxTxPoolSize uint64, algo string, weightLimits map[transaction.Weight]uint64) (api.Scheduler, error) {
-	switch algo {
-	case simple.Name:
-		return simple.New(priorityqueue.Name, maxTxPoolSize, weightLimits)
-	default:
-		return nil, fmt.Errorf("invalid transaction scheduler algorithm: %s", algo)
-	}
+// New creates a new scheduler using the given scheduler algorithm and parameters.
+func New(algo string, params *api.Params) (api.Scheduler, error) {
+	return api.New(algo, params)
 }
@@ -0,0 +1,90 @@
+// Package roundrobin implements a transaction scheduler which schedules transactions in priority
+// order, interleaving transactions of distinct senders with equal priority so that no single
+// sender can monopolize the batches.
+package roundrobin
+
+import (
+	"sort"
+
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/fifo"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+// Name of the scheduler.
+const Name = "round-robin"
+
+// tier is a set of queued transactions with equal priority.
+type tier struct {
+	priority uint64
+	// senders are the sender identifiers in the order of their first transaction.
+	senders []string
+	// txs are the transactions of each sender in arrival order.
+	txs map[string][]*transaction.CheckedTransaction
+}
+
+// senderKey returns the key used to group the transactions of the same sender. Transactions with
+// an unknown sender are each treated as a distinct sender.
+func senderKey(tx *transaction.CheckedTransaction) string {
+	if sender := tx.Sender(); sender != "" {
+		return "s:" + sender
+	}
+	return "h:" + tx.Hash().String()
+}
+
+// Order orders the given transactions, which must be in arrival order, by descending priority and
+// interleaves the transactions of distinct senders within each priority tier in a round-robin
+// fashion. Each sender's transactions stay in arrival order.
+func Order(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction {
+	tiers := make(map[uint64]*tier)
+	for _, tx := range txs {
+		t, ok := tiers[tx.Priority()]
+		if !ok {
+			t = &tier{
+				priority: tx.Priority(),
+				txs:      make(map[string][]*transaction.CheckedTransaction),
+			}
+			tiers[tx.Priority()] = t
+		}
+
+		key := senderKey(tx)
+		if _, ok = t.txs[key]; !ok {
+			t.senders = append(t.senders, key)
+		}
+		t.txs[key] = append(t.txs[key], tx)
+	}
+
+	sorted := make([]*tier, 0, len(tiers))
+	for _, t := range tiers {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].priority > sorted[j].priority })
+
+	ordered := make([]*transaction.CheckedTransaction, 0, len(txs))
+	for _, t := range sorted {
+		for round := 0; ; round++ {
+			var added bool
+			for _, sender := range t.senders {
+				if senderTxs := t.txs[sender]; round < len(senderTxs) {
+					ordered = append(ordered, senderTxs[round])
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+func init() {
+	api.Register(Name, func(params *api.Params) (api.Scheduler, error) {
+		return New(params.MaxTxPoolSize, params.WeightLimits), nil
+	})
+}
+
+// New creates a new round-robin scheduler.
+func New(maxTxPoolSize uint64, weightLimits map[transaction.Weight]uint64) api.Scheduler {
+	return fifo.NewOrdered(Name, Order, maxTxPoolSize, weightLimits)
+}
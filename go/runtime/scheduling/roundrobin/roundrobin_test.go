@@ -0,0 +1,123 @@
+package roundrobin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/tests"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+func newTx(sender string, seq int, priority uint64) *transaction.CheckedTransaction {
+	return transaction.NewCheckedTransactionWithSender(
+		[]byte(fmt.Sprintf("%s %d", sender, seq)),
+		priority,
+		nil,
+		sender,
+		uint64(seq),
+	)
+}
+
+func TestRoundRobinScheduler(t *testing.T) {
+	weightLimits := map[transaction.Weight]uint64{
+		transaction.WeightCount:     10,
+		transaction.WeightSizeBytes: 16 * 1024 * 1024,
+	}
+
+	algo := New(100, weightLimits)
+	tests.SchedulerImplementationTests(t, algo)
+}
+
+func TestRoundRobinSchedulerAlternatesSenders(t *testing.T) {
+	require := require.New(t)
+
+	algo, err := api.New(Name, &api.Params{
+		MaxTxPoolSize: 100,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     6,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+	require.NoError(err, "New")
+	require.Equal(Name, algo.Name())
+
+	// Sender A submits all of its transactions first.
+	for i := 0; i < 10; i++ {
+		require.NoError(algo.QueueTx(newTx("a", i, 10)), "QueueTx")
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(algo.QueueTx(newTx("b", i, 10)), "QueueTx")
+	}
+
+	for round := 0; round < 3; round++ {
+		batch := algo.GetBatch(false)
+		require.Len(batch, 6, "GetBatch")
+		for i, tx := range batch {
+			sender := []string{"a", "b"}[i%2]
+			require.Equal(sender, tx.Sender(), "batch should alternate between senders")
+			require.EqualValues(round*3+i/2, tx.SenderSeq(), "sender transactions should stay in order")
+		}
+
+		var hashes []hash.Hash
+		for _, tx := range batch {
+			hashes = append(hashes, tx.Hash())
+		}
+		algo.RemoveTxBatch(hashes)
+	}
+
+	// Higher priority tiers should still be scheduled first.
+	require.NoError(algo.QueueTx(newTx("c", 0, 20)), "QueueTx")
+	require.True(algo.BatchStale(algo.BatchSeq()), "batch should be stale after a higher priority transaction")
+	batch := algo.GetBatch(true)
+	require.Equal("c", batch[0].Sender(), "higher priority transactions should be scheduled first")
+}
+
+func TestRoundRobinSchedulerPinned(t *testing.T) {
+	require := require.New(t)
+
+	algo := New(100, map[transaction.Weight]uint64{
+		transaction.WeightCount:     3,
+		transaction.WeightSizeBytes: 1000,
+	})
+
+	pinned := newTx("p", 0, 1)
+	require.NoError(algo.QueueTx(pinned), "QueueTx")
+	algo.Pin(pinned.Hash())
+	for i := 0; i < 3; i++ {
+		require.NoError(algo.QueueTx(newTx("a", i, 10)), "QueueTx")
+	}
+
+	batch := algo.GetBatch(true)
+	require.Len(batch, 3, "GetBatch")
+	require.Equal(pinned.Hash(), batch[0].Hash(), "pinned transactions should be scheduled first")
+	require.Equal(uint64(10), algo.FeeMarketState().LastBatchMinPriority, "pinned transactions should not lower the batch minimum priority")
+
+	// Transactions below the minimum priority of unpinned transactions should not make the batch stale.
+	require.NoError(algo.QueueTx(newTx("b", 0, 5)), "QueueTx")
+	require.False(algo.BatchStale(algo.BatchSeq()), "batch should not be stale after a lower priority transaction")
+	require.NoError(algo.QueueTx(newTx("c", 0, 20)), "QueueTx")
+	require.True(algo.BatchStale(algo.BatchSeq()), "batch should be stale after a higher priority transaction")
+}
+
+func TestOrder(t *testing.T) {
+	require := require.New(t)
+
+	txs := []*transaction.CheckedTransaction{
+		newTx("a", 0, 1),
+		newTx("a", 1, 1),
+		newTx("b", 0, 1),
+		newTx("a", 2, 5),
+		newTx("", 0, 1),
+		newTx("", 1, 1),
+	}
+	ordered := Order(txs)
+	require.Equal([]*transaction.CheckedTransaction{
+		txs[3],
+		txs[0], txs[2], txs[4], txs[5],
+		txs[1],
+	}, ordered, "transactions should be ordered by priority and interleaved by sender")
+}
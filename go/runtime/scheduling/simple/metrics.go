@@ -0,0 +1,254 @@
+package simple
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
+	txpool "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+var _ api.MetricsRegisterer = (*scheduler)(nil)
+
+type metrics struct {
+	registerer prometheus.Registerer
+
+	poolSize           prometheus.GaugeFunc
+	poolWeights        *poolWeightsCollector
+	evicted            prometheus.Counter
+	dropped            prometheus.Counter
+	batchFormationTime prometheus.Summary
+
+	queueWeights        *poolWeightsCollector
+	queueLowestPriority prometheus.GaugeFunc
+	queueAccepted       prometheus.CounterFunc
+	queueRejected       prometheus.CounterFunc
+	queueEvicted        prometheus.CounterFunc
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.poolSize,
+		m.poolWeights,
+		m.evicted,
+		m.dropped,
+		m.batchFormationTime,
+		m.queueWeights,
+		m.queueLowestPriority,
+		m.queueAccepted,
+		m.queueRejected,
+		m.queueEvicted,
+	}
+}
+
+func newMetrics(pool txpool.TxPool, labels prometheus.Labels) *metrics {
+	return &metrics{
+		poolSize: prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "oasis_scheduler_pool_size",
+				Help:        "Number of transactions in the scheduler pool.",
+				ConstLabels: labels,
+			},
+			func() float64 {
+				return float64(pool.Size())
+			},
+		),
+		poolWeights: &poolWeightsCollector{
+			pool: pool,
+			desc: prometheus.NewDesc(
+				"oasis_scheduler_pool_weight",
+				"Total weight of transactions in the scheduler pool.",
+				[]string{"weight"},
+				labels,
+			),
+		},
+		evicted: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        "oasis_scheduler_evicted_count",
+				Help:        "Number of transactions evicted from the scheduler pool.",
+				ConstLabels: labels,
+			},
+		),
+		dropped: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        "oasis_scheduler_dropped_count",
+				Help:        "Number of transactions rejected by the scheduler pool.",
+				ConstLabels: labels,
+			},
+		),
+		batchFormationTime: prometheus.NewSummary(
+			prometheus.SummaryOpts{
+				Name:        "oasis_scheduler_batch_formation_time",
+				Help:        "Time it takes to form a batch (seconds).",
+				ConstLabels: labels,
+			},
+		),
+		queueWeights: &poolWeightsCollector{
+			pool: pool,
+			desc: prometheus.NewDesc(
+				"oasis_txpool_queue_weight",
+				"Total weight of transactions in the priority queue.",
+				[]string{"weight"},
+				labels,
+			),
+		},
+		queueLowestPriority: prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "oasis_txpool_queue_lowest_priority",
+				Help:        "Lowest priority of transactions in the priority queue.",
+				ConstLabels: labels,
+			},
+			func() float64 {
+				return float64(pool.FeeMarketState().LowestPriority)
+			},
+		),
+		queueAccepted: prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name:        "oasis_txpool_queue_accepted_count",
+				Help:        "Number of transactions accepted by the priority queue.",
+				ConstLabels: labels,
+			},
+			func() float64 {
+				return float64(pool.Stats().Accepted)
+			},
+		),
+		queueRejected: prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name:        "oasis_txpool_queue_rejected_count",
+				Help:        "Number of transactions rejected by the priority queue.",
+				ConstLabels: labels,
+			},
+			func() float64 {
+				return float64(pool.Stats().Rejected)
+			},
+		),
+		queueEvicted: prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Name:        "oasis_txpool_queue_evicted_count",
+				Help:        "Number of transactions evicted from the priority queue.",
+				ConstLabels: labels,
+			},
+			func() float64 {
+				return float64(pool.Stats().Evicted)
+			},
+		),
+	}
+}
+
+// poolWeightsCollector is a collector exporting the per-weight pool usage.
+//
+// The weights are read from the pool on each scrape, so weights that are no longer present in the
+// pool (e.g., after Clear) are not reported.
+type poolWeightsCollector struct {
+	pool txpool.TxPool
+	desc *prometheus.Desc
+}
+
+// Implements prometheus.Collector.
+func (c *poolWeightsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Implements prometheus.Collector.
+func (c *poolWeightsCollector) Collect(ch chan<- prometheus.Metric) {
+	for w, v := range c.pool.Weights() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(v), string(w))
+	}
+}
+
+// metricsObserver is a lifecycle observer that updates the scheduler metrics and forwards all
+// notifications to the next observer (if any).
+type metricsObserver struct {
+	next    api.LifecycleObserver
+	metrics *metrics
+}
+
+func (o *metricsObserver) TxQueued(tx *transaction.CheckedTransaction) {
+	if o.next != nil {
+		o.next.TxQueued(tx)
+	}
+}
+
+func (o *metricsObserver) TxSelected(txs []*transaction.CheckedTransaction) {
+	if o.next != nil {
+		o.next.TxSelected(txs)
+	}
+}
+
+func (o *metricsObserver) TxRemoved(tx *transaction.CheckedTransaction) {
+	if o.next != nil {
+		o.next.TxRemoved(tx)
+	}
+}
+
+func (o *metricsObserver) TxEvicted(tx *transaction.CheckedTransaction) {
+	o.metrics.evicted.Inc()
+	if o.next != nil {
+		o.next.TxEvicted(tx)
+	}
+}
+
+func (o *metricsObserver) TxExpired(tx *transaction.CheckedTransaction) {
+	if o.next != nil {
+		o.next.TxExpired(tx)
+	}
+}
+
+func (o *metricsObserver) TxReplaced(old, new *transaction.CheckedTransaction) {
+	if o.next != nil {
+		o.next.TxReplaced(old, new)
+	}
+}
+
+// Implements api.MetricsRegisterer.
+func (s *scheduler) RegisterMetrics(registerer prometheus.Registerer, labels prometheus.Labels) error {
+	s.observerLock.Lock()
+	defer s.observerLock.Unlock()
+
+	if s.metrics != nil {
+		return fmt.Errorf("scheduler: metrics already registered")
+	}
+
+	m := newMetrics(s.txPool, labels)
+	collectors := m.collectors()
+	for i, c := range collectors {
+		if err := registerer.Register(c); err != nil {
+			// Unregister any already registered collectors.
+			for _, rc := range collectors[:i] {
+				registerer.Unregister(rc)
+			}
+			return fmt.Errorf("scheduler: failed to register metrics: %w", err)
+		}
+	}
+
+	m.registerer = registerer
+	s.metrics = m
+	s.updateObserverLocked()
+
+	return nil
+}
+
+// Implements api.MetricsRegisterer.
+func (s *scheduler) UnregisterMetrics() {
+	s.observerLock.Lock()
+	defer s.observerLock.Unlock()
+
+	if s.metrics == nil {
+		return
+	}
+	for _, c := range s.metrics.collectors() {
+		s.metrics.registerer.Unregister(c)
+	}
+
+	s.metrics = nil
+	s.updateObserverLocked()
+}
+
+func (s *scheduler) getMetrics() *metrics {
+	s.observerLock.Lock()
+	defer s.observerLock.Unlock()
+
+	return s.metrics
+}
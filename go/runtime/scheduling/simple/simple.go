@@ -2,7 +2,10 @@
 package simple
 
 import (
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
@@ -21,15 +24,23 @@ const (
 type scheduler struct {
 	logger *logging.Logger
 
-	txPool        txpool.TxPool
-	maxTxPoolSize uint64
+	txPool txpool.TxPool
+
+	// cfgLock serializes transaction pool config updates.
+	cfgLock sync.Mutex
+	// cfg is the transaction pool config. Only the weight limits change after creation.
+	cfg txpool.Config
+
+	observerLock sync.Mutex
+	observer     api.LifecycleObserver
+	metrics      *metrics
 }
 
 func (s *scheduler) QueueTx(tx *transaction.CheckedTransaction) error {
-	switch err := s.txPool.Add(tx); err {
-	case nil:
+	switch err := s.txPool.Add(tx); {
+	case err == nil:
 		return nil
-	case txpool.ErrCallAlreadyExists:
+	case errors.Is(err, txpool.ErrTxExists):
 		// Return success in case of duplicate calls to avoid the client
 		// mistaking this for an actual error.
 		s.logger.Warn("ignoring duplicate call",
@@ -37,6 +48,9 @@ func (s *scheduler) QueueTx(tx *transaction.CheckedTransaction) error {
 		)
 		return nil
 	default:
+		if m := s.getMetrics(); m != nil {
+			m.dropped.Inc()
+		}
 		return err
 	}
 }
@@ -46,17 +60,63 @@ func (s *scheduler) RemoveTxBatch(tx []hash.Hash) {
 }
 
 func (s *scheduler) GetBatch(force bool) []*transaction.CheckedTransaction {
-	return s.txPool.GetBatch(force)
+	return s.observeBatchFormation(func() []*transaction.CheckedTransaction {
+		return s.txPool.GetBatch(force)
+	})
+}
+
+func (s *scheduler) GetBatchWithLimits(force bool, limits map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
+	return s.observeBatchFormation(func() []*transaction.CheckedTransaction {
+		return s.txPool.GetBatchWithLimits(force, limits)
+	})
+}
+
+// observeBatchFormation forms a batch using the given function, recording the batch formation
+// time in case metrics are enabled.
+func (s *scheduler) observeBatchFormation(fn func() []*transaction.CheckedTransaction) []*transaction.CheckedTransaction {
+	m := s.getMetrics()
+	if m == nil {
+		return fn()
+	}
+
+	start := time.Now()
+	batch := fn()
+	m.batchFormationTime.Observe(time.Since(start).Seconds())
+	return batch
+}
+
+func (s *scheduler) PeekBatch(force bool) []*transaction.CheckedTransaction {
+	return s.txPool.PeekBatch(force)
+}
+
+func (s *scheduler) EstimateBatchWeights(force bool) map[transaction.Weight]uint64 {
+	return s.txPool.EstimateBatchWeights(force)
+}
+
+func (s *scheduler) BatchSeq() uint64 {
+	return s.txPool.BatchSeq()
+}
+
+func (s *scheduler) BatchStale(producedAtSeq uint64) bool {
+	return s.txPool.BatchStale(producedAtSeq)
 }
 
 func (s *scheduler) GetPrioritizedBatch(offset *hash.Hash, limit uint32) []*transaction.CheckedTransaction {
 	return s.txPool.GetPrioritizedBatch(offset, limit)
 }
 
+func (s *scheduler) IterateDescending(offset *hash.Hash, fn func(tx *transaction.CheckedTransaction) bool) {
+	s.txPool.IterateDescending(offset, fn)
+}
+
 func (s *scheduler) GetKnownBatch(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int) {
 	return s.txPool.GetKnownBatch(batch)
 }
 
+func (s *scheduler) GetKnownBatchOrdered(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int) {
+	return s.txPool.GetKnownBatchOrdered(batch)
+}
+
 func (s *scheduler) GetTransactions(limit int) []*transaction.CheckedTransaction {
 	return s.txPool.GetTransactions(limit)
 }
@@ -65,6 +125,30 @@ func (s *scheduler) UnscheduledSize() uint64 {
 	return s.txPool.Size()
 }
 
+func (s *scheduler) Weights() map[transaction.Weight]uint64 {
+	return s.txPool.Weights()
+}
+
+func (s *scheduler) WeightLimits() map[transaction.Weight]uint64 {
+	return s.txPool.WeightLimits()
+}
+
+func (s *scheduler) RemainingCapacity() map[transaction.Weight]uint64 {
+	return s.txPool.RemainingCapacity()
+}
+
+func (s *scheduler) FreeSlots() uint64 {
+	return s.txPool.FreeSlots()
+}
+
+func (s *scheduler) EstimatePriorityPercentile(percentile float64) uint64 {
+	return s.txPool.EstimatePriorityPercentile(percentile)
+}
+
+func (s *scheduler) FeeMarketState() api.FeeMarketState {
+	return s.txPool.FeeMarketState()
+}
+
 func (s *scheduler) IsQueued(id hash.Hash) bool {
 	return s.txPool.IsQueued(id)
 }
@@ -74,9 +158,64 @@ func (s *scheduler) Clear() {
 }
 
 func (s *scheduler) UpdateParameters(weightLimits map[transaction.Weight]uint64) {
-	s.txPool.UpdateConfig(txpool.Config{
-		MaxPoolSize:  s.maxTxPoolSize,
-		WeightLimits: weightLimits,
+	s.cfgLock.Lock()
+	defer s.cfgLock.Unlock()
+
+	s.cfg.WeightLimits = weightLimits
+	s.txPool.UpdateConfig(s.cfg)
+}
+
+func (s *scheduler) UpdateMinPriority(min uint64) {
+	s.txPool.UpdateMinPriority(min)
+}
+
+func (s *scheduler) Transition(
+	weightLimits map[transaction.Weight]uint64,
+	migrate func(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction,
+) {
+	s.cfgLock.Lock()
+	defer s.cfgLock.Unlock()
+
+	s.cfg.WeightLimits = weightLimits
+	s.txPool.Transition(s.cfg, migrate)
+}
+
+func (s *scheduler) Pin(h hash.Hash) {
+	s.txPool.Pin(h)
+}
+
+func (s *scheduler) Unpin(h hash.Hash) {
+	s.txPool.Unpin(h)
+}
+
+func (s *scheduler) ExpireOldTransactions(maxAge time.Duration) []hash.Hash {
+	return s.txPool.ExpireOldTransactions(maxAge)
+}
+
+func (s *scheduler) RecomputeWeights(fn func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64) {
+	s.txPool.RecomputeWeights(fn)
+}
+
+func (s *scheduler) SetLifecycleObserver(obs api.LifecycleObserver) {
+	s.observerLock.Lock()
+	defer s.observerLock.Unlock()
+
+	s.observer = obs
+	s.updateObserverLocked()
+}
+
+// updateObserverLocked configures the transaction pool lifecycle observer, interposing the
+// metrics observer in case metrics are enabled.
+//
+// NOTE: Assumes observer lock is held.
+func (s *scheduler) updateObserverLocked() {
+	if s.metrics == nil {
+		s.txPool.SetLifecycleObserver(s.observer)
+		return
+	}
+	s.txPool.SetLifecycleObserver(&metricsObserver{
+		next:    s.observer,
+		metrics: s.metrics,
 	})
 }
 
@@ -84,24 +223,43 @@ func (s *scheduler) Name() string {
 	return Name
 }
 
+func init() {
+	api.Register(Name, func(params *api.Params) (api.Scheduler, error) {
+		return NewWithConfig(priorityqueue.Name, txpool.Config{
+			MaxPoolSize:     params.MaxTxPoolSize,
+			MaxOverflowSize: params.MaxOverflowSize,
+			MaxSenderTxs:    params.MaxSenderTxs,
+			ReplaceByFee:    params.ReplaceByFee,
+			WeightLimits:    params.WeightLimits,
+		})
+	})
+}
+
 // New creates a new simple scheduler.
 func New(txPoolImpl string, maxTxPoolSize uint64, weightLimits map[transaction.Weight]uint64) (api.Scheduler, error) {
-	poolCfg := txpool.Config{
+	return NewWithConfig(txPoolImpl, txpool.Config{
 		MaxPoolSize:  maxTxPoolSize,
 		WeightLimits: weightLimits,
-	}
+	})
+}
+
+// NewWithConfig creates a new simple scheduler using the given transaction pool config.
+//
+// The config is retained for the lifetime of the scheduler and only its weight limits are changed
+// by UpdateParameters and Transition.
+func NewWithConfig(txPoolImpl string, cfg txpool.Config) (api.Scheduler, error) {
 	var pool txpool.TxPool
 	switch txPoolImpl {
 	case priorityqueue.Name:
-		pool = priorityqueue.New(poolCfg)
+		pool = priorityqueue.New(cfg)
 	default:
 		return nil, fmt.Errorf("invalid transaction pool: %s", txPoolImpl)
 	}
 
 	scheduler := &scheduler{
-		maxTxPoolSize: maxTxPoolSize,
-		txPool:        pool,
-		logger:        logging.GetLogger("runtime/scheduling").With("scheduler", "simple"),
+		cfg:    cfg,
+		txPool: pool,
+		logger: logging.GetLogger("runtime/scheduling").With("scheduler", "simple"),
 	}
 
 	return scheduler, nil
@@ -1,10 +1,15 @@
 package simple
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
+	txpool "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/priorityqueue"
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/tests"
 	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
@@ -21,6 +26,115 @@ func TestSimpleSchedulerPriorityQueue(t *testing.T) {
 	tests.SchedulerImplementationTests(t, algo)
 }
 
+func TestSimpleSchedulerMetrics(t *testing.T) {
+	require := require.New(t)
+
+	weightLimits := map[transaction.Weight]uint64{
+		transaction.WeightCount:     2,
+		transaction.WeightSizeBytes: 1000,
+	}
+	algo, err := New(priorityqueue.Name, 3, weightLimits)
+	require.NoError(err, "New()")
+
+	mr, ok := algo.(api.MetricsRegisterer)
+	require.True(ok, "scheduler should support metrics")
+
+	registry := prometheus.NewRegistry()
+	err = mr.RegisterMetrics(registry, prometheus.Labels{"runtime": "test"})
+	require.NoError(err, "RegisterMetrics")
+	err = mr.RegisterMetrics(registry, prometheus.Labels{"runtime": "test"})
+	require.Error(err, "RegisterMetrics should fail when called twice")
+
+	// Fill the pool, evicting a transaction and having one dropped.
+	for i := 0; i < 4; i++ {
+		err = algo.QueueTx(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil))
+		require.NoError(err, "QueueTx")
+	}
+	err = algo.QueueTx(transaction.NewCheckedTransaction([]byte("low priority"), 1, nil))
+	require.Error(err, "QueueTx should fail when the pool is full")
+
+	batch := algo.GetBatch(false)
+	require.Len(batch, 2, "GetBatch")
+
+	m := algo.(*scheduler).metrics
+	require.EqualValues(3, testutil.ToFloat64(m.poolSize), "pool size")
+	require.EqualValues(1, testutil.ToFloat64(m.evicted), "evicted count")
+	require.EqualValues(1, testutil.ToFloat64(m.dropped), "dropped count")
+
+	families, err := registry.Gather()
+	require.NoError(err, "Gather")
+	found := make(map[string]bool)
+	for _, mf := range families {
+		found[mf.GetName()] = true
+		if mf.GetName() != "oasis_scheduler_pool_weight" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "weight" && label.GetValue() == string(transaction.WeightCount) {
+					require.EqualValues(3, metric.GetGauge().GetValue(), "pool count weight")
+				}
+			}
+		}
+	}
+	for _, name := range []string{
+		"oasis_scheduler_pool_size",
+		"oasis_scheduler_pool_weight",
+		"oasis_scheduler_evicted_count",
+		"oasis_scheduler_dropped_count",
+		"oasis_scheduler_batch_formation_time",
+		"oasis_txpool_queue_weight",
+		"oasis_txpool_queue_lowest_priority",
+		"oasis_txpool_queue_accepted_count",
+		"oasis_txpool_queue_rejected_count",
+		"oasis_txpool_queue_evicted_count",
+	} {
+		require.True(found[name], "metric %s should be exported", name)
+	}
+	require.EqualValues(4, testutil.ToFloat64(m.queueAccepted), "queue accepted count")
+	require.EqualValues(1, testutil.ToFloat64(m.queueRejected), "queue rejected count")
+	require.EqualValues(1, testutil.ToFloat64(m.queueEvicted), "queue evicted count")
+	require.EqualValues(11, testutil.ToFloat64(m.queueLowestPriority), "queue lowest priority")
+
+	// Weights should no longer be reported once the pool has been cleared.
+	algo.Clear()
+	require.Zero(testutil.CollectAndCount(m.poolWeights), "pool weights after Clear")
+	require.Zero(testutil.CollectAndCount(m.queueWeights), "queue weights after Clear")
+}
+
+func TestSimpleSchedulerUnregisterMetrics(t *testing.T) {
+	require := require.New(t)
+
+	weightLimits := map[transaction.Weight]uint64{
+		transaction.WeightCount:     10,
+		transaction.WeightSizeBytes: 1000,
+	}
+	algo, err := New(priorityqueue.Name, 10, weightLimits)
+	require.NoError(err, "New()")
+	mr := algo.(api.MetricsRegisterer)
+
+	registry := prometheus.NewRegistry()
+	err = mr.RegisterMetrics(registry, prometheus.Labels{"runtime": "test"})
+	require.NoError(err, "RegisterMetrics")
+	err = algo.QueueTx(transaction.NewCheckedTransaction([]byte("hello world"), 10, nil))
+	require.NoError(err, "QueueTx")
+
+	families, err := registry.Gather()
+	require.NoError(err, "Gather")
+	require.NotEmpty(families, "metrics should be exported")
+
+	mr.UnregisterMetrics()
+	families, err = registry.Gather()
+	require.NoError(err, "Gather")
+	require.Empty(families, "metrics should be removed after UnregisterMetrics")
+	require.Nil(algo.(*scheduler).getMetrics(), "metrics should be disabled after UnregisterMetrics")
+
+	// Unregistering again should be a no-op and metrics can be registered again.
+	mr.UnregisterMetrics()
+	err = mr.RegisterMetrics(registry, prometheus.Labels{"runtime": "test"})
+	require.NoError(err, "RegisterMetrics after UnregisterMetrics")
+}
+
 func BenchmarkSimpleSchedulerPriorityQueue(b *testing.B) {
 	weightLimits := map[transaction.Weight]uint64{
 		transaction.WeightCount:     1000,
@@ -31,3 +145,92 @@ func BenchmarkSimpleSchedulerPriorityQueue(b *testing.B) {
 	require.NoError(b, err, "New()")
 	tests.SchedulerImplementationBenchmarks(b, algo)
 }
+
+func TestSimpleSchedulerSenderLimitRetained(t *testing.T) {
+	require := require.New(t)
+
+	weightLimits := map[transaction.Weight]uint64{
+		transaction.WeightCount:     10,
+		transaction.WeightSizeBytes: 1000,
+	}
+	algo, err := api.New(Name, &api.Params{
+		MaxTxPoolSize: 10,
+		MaxSenderTxs:  1,
+		WeightLimits:  weightLimits,
+	})
+	require.NoError(err, "api.New")
+
+	newTx := func(seq int) *transaction.CheckedTransaction {
+		return transaction.NewCheckedTransactionWithSender([]byte(fmt.Sprintf("sender tx %d", seq)), 10, nil, "sender", uint64(seq))
+	}
+
+	// The sender limit should survive parameter updates and transitions.
+	algo.UpdateParameters(weightLimits)
+	require.NoError(algo.QueueTx(newTx(0)), "QueueTx")
+	require.ErrorIs(algo.QueueTx(newTx(1)), txpool.ErrSenderLimit, "sender limit should be enforced after UpdateParameters")
+
+	algo.Transition(weightLimits, nil)
+	require.ErrorIs(algo.QueueTx(newTx(2)), txpool.ErrSenderLimit, "sender limit should be enforced after Transition")
+	require.EqualValues(1, algo.UnscheduledSize(), "only one transaction should be queued")
+}
+
+func TestSimpleSchedulerOverflowRetained(t *testing.T) {
+	require := require.New(t)
+
+	weightLimits := map[transaction.Weight]uint64{
+		transaction.WeightCount:     10,
+		transaction.WeightSizeBytes: 1000,
+	}
+	algo, err := api.New(Name, &api.Params{
+		MaxTxPoolSize:   1,
+		MaxOverflowSize: 2,
+		WeightLimits:    weightLimits,
+	})
+	require.NoError(err, "api.New")
+
+	newTx := func(priority uint64) *transaction.CheckedTransaction {
+		return transaction.NewCheckedTransaction([]byte(fmt.Sprintf("overflow tx %d", priority)), priority, nil)
+	}
+
+	// The overflow queue should survive parameter updates and transitions.
+	algo.UpdateParameters(weightLimits)
+	require.NoError(algo.QueueTx(newTx(10)), "QueueTx")
+	require.NoError(algo.QueueTx(newTx(5)), "QueueTx should hold the transaction after UpdateParameters")
+
+	algo.Transition(weightLimits, nil)
+	require.NoError(algo.QueueTx(newTx(4)), "QueueTx should hold the transaction after Transition")
+	require.ErrorIs(algo.QueueTx(newTx(3)), txpool.ErrPoolFull, "overflow queue should be limited")
+	require.EqualValues(1, algo.UnscheduledSize(), "held transactions should not be in the pool")
+}
+
+func TestSimpleSchedulerReplaceByFeeRetained(t *testing.T) {
+	require := require.New(t)
+
+	weightLimits := map[transaction.Weight]uint64{
+		transaction.WeightCount:     10,
+		transaction.WeightSizeBytes: 1000,
+	}
+	algo, err := api.New(Name, &api.Params{
+		MaxTxPoolSize: 10,
+		ReplaceByFee:  true,
+		WeightLimits:  weightLimits,
+	})
+	require.NoError(err, "api.New")
+
+	newTx := func(priority uint64) *transaction.CheckedTransaction {
+		return transaction.NewCheckedTransactionWithSender([]byte(fmt.Sprintf("rbf tx %d", priority)), priority, nil, "sender", 0)
+	}
+
+	// Replace-by-fee should survive parameter updates and transitions.
+	algo.UpdateParameters(weightLimits)
+	tx1, tx2, tx3 := newTx(10), newTx(20), newTx(30)
+	require.NoError(algo.QueueTx(tx1), "QueueTx")
+	require.NoError(algo.QueueTx(tx2), "QueueTx should replace after UpdateParameters")
+	require.False(algo.IsQueued(tx1.Hash()), "replaced transaction should be removed")
+
+	algo.Transition(weightLimits, nil)
+	require.NoError(algo.QueueTx(tx3), "QueueTx should replace after Transition")
+	require.False(algo.IsQueued(tx2.Hash()), "replaced transaction should be removed")
+	require.ErrorIs(algo.QueueTx(newTx(5)), txpool.ErrReplacementUnderpriced, "underpriced replacement should be rejected")
+	require.EqualValues(1, algo.UnscheduledSize(), "only the replacement should be queued")
+}
@@ -3,25 +3,240 @@ package api
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+	schedulingAPI "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
 	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
-	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
 )
 
+// Transaction pool errors. Callers should test for them using errors.Is as they may be wrapped.
+//
+// Errors for which resubmitting the same transaction cannot succeed (ErrTxExists, ErrTxTooLarge
+// and ErrReplacementUnderpriced) are returned wrapped with p2pError.Permanent, while the remaining
+// errors are retryable. Note that the sentinels themselves are not wrapped, as any permanent error
+// would otherwise match any other permanent error.
 var (
-	ErrCallAlreadyExists = fmt.Errorf("call already exists in pool")
-	ErrFull              = fmt.Errorf("pool is full")
-	ErrCallTooLarge      = p2pError.Permanent(fmt.Errorf("call too large"))
+	// ErrTxExists is the error returned when the transaction is already in the pool.
+	ErrTxExists = fmt.Errorf("call already exists in pool")
+	// ErrPoolFull is the error returned when the pool is full and the transaction cannot evict any
+	// queued transactions.
+	ErrPoolFull = fmt.Errorf("pool is full")
+	// ErrTxTooLarge is the error returned when the transaction exceeds a batch weight limit.
+	ErrTxTooLarge = fmt.Errorf("call too large")
+	// ErrSenderLimit is the error returned when the sender transaction limit has been reached.
+	ErrSenderLimit = fmt.Errorf("sender transaction limit reached")
+	// ErrTxTooCheap is the error returned when the transaction priority is below the configured
+	// minimum priority.
+	ErrTxTooCheap = fmt.Errorf("transaction priority too low")
+	// ErrReplacementUnderpriced is the error returned when a replacement transaction does not
+	// have a higher priority than the transaction it would replace.
+	ErrReplacementUnderpriced = fmt.Errorf("replacement transaction underpriced")
 )
 
+var (
+	// ErrCallAlreadyExists is the error returned when the transaction is already in the pool.
+	//
+	// Deprecated: Use ErrTxExists instead.
+	ErrCallAlreadyExists = ErrTxExists
+	// ErrFull is the error returned when the pool is full.
+	//
+	// Deprecated: Use ErrPoolFull instead.
+	ErrFull = ErrPoolFull
+	// ErrCallTooLarge is the error returned when the transaction exceeds a batch weight limit.
+	//
+	// Deprecated: Use ErrTxTooLarge instead.
+	ErrCallTooLarge = ErrTxTooLarge
+)
+
+// TieBreak is the order of queued transactions with equal priority.
+type TieBreak uint8
+
+const (
+	// TieBreakHash orders transactions with equal priority by their hash. This is the default.
+	TieBreakHash TieBreak = iota
+	// TieBreakFIFO orders transactions with equal priority by insertion order, so that earlier
+	// transactions are scheduled first.
+	TieBreakFIFO
+)
+
+// EvictReason is the reason for a transaction being evicted from the pool.
+type EvictReason uint8
+
+const (
+	// EvictReasonCapacity means that the transaction was evicted because the pool (or the
+	// overflow queue) was at capacity, e.g. to make room for a higher priority transaction.
+	EvictReasonCapacity EvictReason = iota
+	// EvictReasonWeightLimit means that the transaction was evicted because it exceeds a batch
+	// weight limit.
+	EvictReasonWeightLimit
+	// EvictReasonMinPriority means that the transaction was evicted because its priority is
+	// below the configured minimum priority.
+	EvictReasonMinPriority
+)
+
+// String returns a string representation of the eviction reason.
+func (r EvictReason) String() string {
+	switch r {
+	case EvictReasonCapacity:
+		return "capacity"
+	case EvictReasonWeightLimit:
+		return "weight limit"
+	case EvictReasonMinPriority:
+		return "min priority"
+	default:
+		return fmt.Sprintf("[unknown: %d]", r)
+	}
+}
+
+// DefaultWeightCountLimit is the batch transaction count limit used in case no count limit is
+// configured, so that batches are never unbounded.
+const DefaultWeightCountLimit = 1000
+
 // Config is a transaction pool configuration.
 type Config struct {
 	MaxPoolSize uint64
 
+	// MaxOverflowSize is the maximum number of transactions held in the overflow queue. Zero
+	// disables the overflow queue.
+	//
+	// Transactions that are rejected by a full pool because they cannot evict anything are held
+	// in the overflow queue instead and are promoted to the pool (highest priority first) as room
+	// becomes available. Held transactions count towards memory usage in addition to the pool size
+	// but are never part of a batch until promoted. Since promotion only happens when room becomes
+	// available, a held transaction may be overtaken by later higher priority transactions and can
+	// wait indefinitely under sustained load.
+	MaxOverflowSize uint64
+
+	// MaxSenderTxs is the maximum number of queued transactions per sender. Zero means that the
+	// number of transactions per sender is not limited.
+	//
+	// Once a sender reaches the limit, a new transaction from the same sender is only accepted if
+	// it has a higher priority than the sender's lowest priority (unpinned) transaction, which is
+	// then evicted. Transactions with an unknown sender are not limited.
+	MaxSenderTxs uint64
+
+	// ReplaceByFee enables replacing a queued transaction with a new transaction that has the
+	// same replacement key (see transaction.CheckedTransaction.ReplacementKey) and a strictly
+	// higher priority. Transactions with the same replacement key and a lower or equal priority
+	// are rejected. Pinned transactions and transactions held in the overflow queue are never
+	// replaced.
+	ReplaceByFee bool
+
+	// TieBreak is the order of transactions with equal priority. It is only used when the pool
+	// is created and changing it via UpdateConfig or Transition has no effect.
+	TieBreak TieBreak
+
+	// OnEvict is an optional callback invoked for each transaction evicted from the pool. It is
+	// only used when the pool is created and is always invoked without holding any pool locks, so
+	// it is safe for it to call back into the pool.
+	OnEvict func(tx *transaction.CheckedTransaction, reason EvictReason)
+
+	// WeightLimits are the batch weight limits. In case no transaction.WeightCount limit is
+	// configured, DefaultWeightCountLimit is used.
 	WeightLimits map[transaction.Weight]uint64
 }
 
+// GetWeightLimits returns the configured batch weight limits, including the default count limit
+// in case no count limit is configured.
+func (cfg *Config) GetWeightLimits() map[transaction.Weight]uint64 {
+	limits := make(map[transaction.Weight]uint64, len(cfg.WeightLimits)+1)
+	for w, l := range cfg.WeightLimits {
+		limits[w] = l
+	}
+	if _, ok := limits[transaction.WeightCount]; !ok {
+		limits[transaction.WeightCount] = DefaultWeightCountLimit
+	}
+	return limits
+}
+
+// Cursor is a position in the priority-ordered transaction pool.
+//
+// Unlike an offset transaction hash, a cursor remains usable even if the transaction it was
+// derived from has since been removed from the pool as it encodes the (priority, hash) position
+// instead of referencing the transaction itself.
+type Cursor struct {
+	// Priority is the priority of the transaction at the cursor position.
+	Priority uint64
+	// Hash is the hash of the transaction at the cursor position.
+	Hash hash.Hash
+	// Seq is the insertion sequence number of the transaction at the cursor position. It is only
+	// set by pools that order transactions with equal priority by insertion order (see
+	// TieBreakFIFO). A zero sequence number positions the cursor before all transactions with the
+	// same priority.
+	Seq uint64 `json:",omitempty"`
+}
+
+// NewCursor creates a new cursor positioned at the given transaction.
+func NewCursor(tx *transaction.CheckedTransaction) *Cursor {
+	return &Cursor{
+		Priority: tx.Priority(),
+		Hash:     tx.Hash(),
+	}
+}
+
+// Stats are cumulative transaction pool admission statistics.
+type Stats struct {
+	// Accepted is the number of transactions accepted into the pool.
+	Accepted uint64
+	// Rejected is the number of transactions rejected by the pool.
+	Rejected uint64
+	// Evicted is the number of transactions evicted from the pool or the overflow queue.
+	Evicted uint64
+}
+
+// EligibilityBlocker is the constraint preventing a queued transaction from being selected for the
+// next batch.
+type EligibilityBlocker uint8
+
+const (
+	// EligibilityBlockerNone means that the transaction would be selected for the next batch.
+	EligibilityBlockerNone EligibilityBlocker = iota
+	// EligibilityBlockerTooLarge means that the transaction exceeds a batch weight limit and will
+	// be dropped from the pool.
+	EligibilityBlockerTooLarge
+	// EligibilityBlockerBelowThreshold means that the transaction would fit the batch, but the
+	// pool does not yet contain enough transactions for a batch to be produced unless forced.
+	EligibilityBlockerBelowThreshold
+	// EligibilityBlockerBatchFull means that higher priority transactions fill the batch.
+	EligibilityBlockerBatchFull
+)
+
+// String returns a string representation of the eligibility blocker.
+func (b EligibilityBlocker) String() string {
+	switch b {
+	case EligibilityBlockerNone:
+		return "none"
+	case EligibilityBlockerTooLarge:
+		return "too large"
+	case EligibilityBlockerBelowThreshold:
+		return "below threshold"
+	case EligibilityBlockerBatchFull:
+		return "batch full"
+	default:
+		return fmt.Sprintf("[unknown eligibility blocker: %d]", uint8(b))
+	}
+}
+
+// EligibilityReport describes the batch eligibility of a queued transaction.
+type EligibilityReport struct {
+	// Queued is true iff the transaction is in the pool. Other fields are only meaningful in case
+	// the transaction is queued.
+	Queued bool
+	// FitsLimits is true iff the transaction fits within all batch weight limits.
+	FitsLimits bool
+	// Rank is the (one-based) position of the transaction in priority order.
+	Rank uint64
+	// Selected is true iff the transaction would be selected by the next (non-forced) GetBatch.
+	Selected bool
+	// Blocker is the constraint preventing the transaction from being selected.
+	Blocker EligibilityBlocker
+	// BlockingWeight is the weight whose limit prevents the transaction from being selected in
+	// case the blocker is EligibilityBlockerTooLarge or EligibilityBlockerBatchFull.
+	BlockingWeight transaction.Weight
+}
+
 // TxPool is the transaction pool interface.
 type TxPool interface {
 	// Name is the transaction pool implementation name.
@@ -30,9 +245,55 @@ type TxPool interface {
 	// Add adds a single transaction into the transaction pool.
 	Add(tx *transaction.CheckedTransaction) error
 
+	// AddBatch adds multiple transactions into the transaction pool at once. Transactions are
+	// added in order, as if Add was called for each of them. It returns an error for each of the
+	// given transactions (nil in case the transaction was added).
+	AddBatch(txs []*transaction.CheckedTransaction) []error
+
 	// GetBatch gets a transaction batch from the transaction pool.
+	//
+	// The returned batch only depends on the current pool contents and the current weight limits.
+	// Any transactions that do not fit the current weight limits are removed from the pool.
 	GetBatch(force bool) []*transaction.CheckedTransaction
 
+	// GetBatchWithLimits gets a transaction batch from the transaction pool like GetBatch, but
+	// limits the batch to the given weight budget. The budget is applied on top of the configured
+	// weight limits, so it can only make batches smaller.
+	//
+	// Transactions are only removed from the pool when they exceed the configured weight limits,
+	// not when they merely exceed the given budget.
+	GetBatchWithLimits(force bool, limits map[transaction.Weight]uint64) []*transaction.CheckedTransaction
+
+	// PeekBatch returns the batch that GetBatch would currently return without modifying the
+	// transaction pool.
+	//
+	// Transactions that do not fit the current weight limits are skipped instead of removed and
+	// the batch is not recorded for the purpose of BatchSeq and BatchStale.
+	PeekBatch(force bool) []*transaction.CheckedTransaction
+
+	// EstimateBatchWeights returns the total weights of the batch that GetBatch would currently
+	// return without modifying the transaction pool.
+	//
+	// Like in PeekBatch, transactions that do not fit the current weight limits are skipped.
+	EstimateBatchWeights(force bool) map[transaction.Weight]uint64
+
+	// BatchSeq returns the insertion sequence number at which the last batch was produced by
+	// GetBatch.
+	BatchSeq() uint64
+
+	// BatchStale returns true iff transactions with a higher priority than the minimum priority of
+	// the batch produced at the given insertion sequence number have been added since the batch was
+	// produced.
+	//
+	// In case the given batch is not the last batch produced by GetBatch, it is considered stale.
+	BatchStale(producedAtSeq uint64) bool
+
+	// ExplainEligibility explains whether the given queued transaction would be selected by the
+	// next GetBatch and, if not, which constraint prevents it.
+	//
+	// This is a diagnostic method which does not modify the pool.
+	ExplainEligibility(h hash.Hash) EligibilityReport
+
 	// GetPrioritizedBatch returns a batch of transactions ordered by priority but without taking
 	// any weight limits into account.
 	//
@@ -41,18 +302,56 @@ type TxPool interface {
 	// and only following transactions will be returned.
 	GetPrioritizedBatch(offset *hash.Hash, limit uint32) []*transaction.CheckedTransaction
 
+	// IterateDescending invokes the given function for each queued transaction in descending
+	// priority order until the function returns false. Unlike GetPrioritizedBatch, weight limits
+	// are not taken into account and no transactions are removed from the pool.
+	//
+	// Offset specifies the transaction hash that should serve as an offset, in which case only the
+	// transactions following it are iterated over. If the offset transaction is not in the pool,
+	// nothing is iterated over.
+	//
+	// The function is called with the pool locked and must not call back into the pool.
+	IterateDescending(offset *hash.Hash, fn func(tx *transaction.CheckedTransaction) bool)
+
+	// GetPrioritizedBatchFrom returns a batch of transactions ordered by priority but without
+	// taking any weight limits into account, starting after the given cursor position.
+	//
+	// A nil cursor starts at the highest priority transaction. The returned cursor points at the
+	// last returned transaction and should be passed to the next call in order to continue
+	// iteration. It is nil when no transactions were returned.
+	GetPrioritizedBatchFrom(cursor *Cursor, limit uint32) ([]*transaction.CheckedTransaction, *Cursor)
+
 	// GetKnownBatch gets a set of known transactions from the transaction pool.
 	//
 	// For any missing transactions nil will be returned in their place and the map of missing
 	// transactions will be populated accoordingly.
 	GetKnownBatch(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int)
 
+	// GetKnownBatchOrdered gets a set of known transactions from the transaction pool like
+	// GetKnownBatch, but only returns the found transactions, in descending priority order with
+	// ties broken the same way as during batch selection.
+	//
+	// The map of missing transactions is populated with their indices in the given batch.
+	GetKnownBatchOrdered(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int)
+
 	// GetTransactions returns the given number of transactions from the transaction pool without
 	// taking any batch limits or priorities into account.
 	//
 	// Specifying a zero limit will return all transactions.
 	GetTransactions(limit int) []*transaction.CheckedTransaction
 
+	// GetTransactionsOrdered returns the given number of transactions from the transaction pool in
+	// descending priority order, with ties broken the same way as during batch selection. Weight
+	// limits are not taken into account and no transactions are removed from the pool.
+	//
+	// Offset specifies the transaction hash that should serve as an offset, in which case only the
+	// transactions following it are returned. This makes the result suitable for pagination as
+	// repeated calls with the same offset and limit return the same page while the pool does not
+	// change. If the offset transaction is not in the pool, nothing is returned.
+	//
+	// Specifying a zero limit will return all (remaining) transactions.
+	GetTransactionsOrdered(offset *hash.Hash, limit int) []*transaction.CheckedTransaction
+
 	// RemoveBatch removes a batch from the transaction pool.
 	RemoveBatch(batch []hash.Hash)
 
@@ -62,9 +361,98 @@ type TxPool interface {
 	// Size returns the number of transactions in the transaction pool.
 	Size() uint64
 
+	// Weights returns the total weights of all transactions in the transaction pool.
+	Weights() map[transaction.Weight]uint64
+
+	// WeightLimits returns the current batch weight limits, including any default limits.
+	WeightLimits() map[transaction.Weight]uint64
+
+	// RemainingCapacity returns, for each weight with a batch weight limit, the difference between
+	// the limit and the total weight of all transactions in the transaction pool, floored at zero.
+	RemainingCapacity() map[transaction.Weight]uint64
+
+	// FreeSlots returns the number of transactions that can still be added to the transaction pool
+	// before it is full, i.e. the difference between the maximum pool size and the pool size
+	// floored at zero.
+	FreeSlots() uint64
+
+	// EstimatePriorityPercentile returns an estimate of the given percentile (0-100) of the
+	// priorities of transactions currently in the transaction pool.
+	//
+	// If the pool is empty, zero is returned.
+	EstimatePriorityPercentile(percentile float64) uint64
+
+	// FeeMarketState returns the current fee market state.
+	FeeMarketState() schedulingAPI.FeeMarketState
+
+	// Stats returns the cumulative admission statistics of the transaction pool.
+	Stats() Stats
+
 	// UpdateConfig updates the transaction pool config.
 	UpdateConfig(cfg Config)
 
+	// UpdateMinPriority updates the minimum priority of transactions. Transactions with a lower
+	// priority are rejected with ErrTxTooCheap regardless of pool occupancy. Already queued
+	// transactions are not affected, but transactions held in the overflow queue with a lower
+	// priority are evicted.
+	UpdateMinPriority(min uint64)
+
+	// Transition atomically updates the transaction pool config and migrates the queued
+	// transactions using the given migration function, rebuilding the pool.
+	//
+	// The migration function is called with all queued transactions in descending priority order
+	// and returns the transactions that should remain in the pool. It may drop transactions or
+	// replace them with transformed ones. Returned transactions are subject to the new config, so
+	// any that do not fit the new weight limits or pool size are dropped. Pinned transactions stay
+	// pinned in case they are retained.
+	//
+	// The migration function is called with the pool locked and must not call back into the pool.
+	// A nil migration function retains all transactions.
+	Transition(cfg Config, migrate func(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction)
+
+	// RecomputeWeights re-derives the weights of all queued transactions using the given function
+	// and removes any transactions that no longer fit the weight limits.
+	//
+	// The intrinsic count and size weights are always preserved. This is an expensive operation as
+	// it processes all queued transactions while holding the pool lock, so it should only be used
+	// when weight accounting rules change.
+	RecomputeWeights(fn func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64)
+
+	// Pin pins the given queued transaction as an operator override, guaranteeing that it stays
+	// in the pool and is scheduled regardless of its priority.
+	//
+	// Pinned transactions are never evicted to make room for other transactions, are placed
+	// first when forming batches and survive Clear. They still count against (and are subject to)
+	// the batch weight limits. Pinning a transaction that is not queued has no effect and the pin
+	// is released once the transaction is removed.
+	Pin(h hash.Hash)
+
+	// Unpin releases the pin of the given transaction (if any).
+	Unpin(h hash.Hash)
+
+	// ExpireOldTransactions removes all transactions that have been in the pool for longer than
+	// the given maximum age and returns their hashes. Pinned transactions never expire.
+	//
+	// It is safe to call concurrently with other pool methods, so it can be invoked periodically
+	// from a background goroutine. Each call holds the pool lock while iterating over all queued
+	// transactions, so it should not be called too frequently.
+	ExpireOldTransactions(maxAge time.Duration) []hash.Hash
+
 	// Clear clears the transaction pool.
 	Clear()
+
+	// WatchAdded subscribes to transactions being added to the transaction pool.
+	//
+	// In case the subscriber is too slow, the oldest events are dropped.
+	WatchAdded() (<-chan *transaction.CheckedTransaction, pubsub.ClosableSubscription)
+
+	// WatchRemoved subscribes to hashes of transactions being removed from the transaction pool
+	// for any reason (e.g., scheduling, eviction, expiry or replacement).
+	//
+	// In case the subscriber is too slow, the oldest events are dropped.
+	WatchRemoved() (<-chan hash.Hash, pubsub.ClosableSubscription)
+
+	// SetLifecycleObserver configures the transaction lifecycle observer. Passing nil removes any
+	// previously configured observer.
+	SetLifecycleObserver(obs schedulingAPI.LifecycleObserver)
 }
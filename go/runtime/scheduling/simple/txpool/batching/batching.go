@@ -0,0 +1,214 @@
+// Package batching implements the batch formation and weight accounting helpers shared by the
+// transaction schedulers.
+package batching
+
+import (
+	"math"
+	"sort"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+// MinWeights are the minimum weights of any transaction. Batch formation stops once there is no
+// room left for a transaction with these weights.
+var MinWeights = map[transaction.Weight]uint64{
+	transaction.WeightCount:             1,
+	transaction.WeightSizeBytes:         10,
+	transaction.WeightConsensusMessages: 0,
+}
+
+// Check is the outcome of checking whether a transaction can be added to a batch.
+type Check uint8
+
+const (
+	// CheckFits means that the transaction can be added to the batch.
+	CheckFits Check = iota
+	// CheckTooLarge means that the transaction exceeds a weight limit.
+	CheckTooLarge
+	// CheckFull means that no transaction can be added to the batch.
+	CheckFull
+	// CheckOverflow means that the transaction would overflow the batch.
+	CheckOverflow
+)
+
+// Limits are the configured weight limits of a transaction pool.
+type Limits struct {
+	limits map[transaction.Weight]uint64
+	// order are the limited weights sorted by name. It is used to check weight limits in a
+	// deterministic order.
+	order []transaction.Weight
+}
+
+// NewLimits creates new weight limits.
+func NewLimits(limits map[transaction.Weight]uint64) Limits {
+	return Limits{
+		limits: limits,
+		order:  SortedWeights(limits),
+	}
+}
+
+// Get returns the configured weight limits. The returned map must not be modified.
+func (l Limits) Get() map[transaction.Weight]uint64 {
+	return l.limits
+}
+
+// Copy returns a copy of the configured weight limits.
+func (l Limits) Copy() map[transaction.Weight]uint64 {
+	return CopyWeights(l.limits)
+}
+
+// Exceeded returns the first weight limit exceeded by the given transaction (if any). Weights are
+// checked in the order of their names.
+func (l Limits) Exceeded(tx *transaction.CheckedTransaction) (transaction.Weight, bool) {
+	for _, w := range l.order {
+		if tx.Weight(w) > l.limits[w] {
+			return w, true
+		}
+	}
+	return "", false
+}
+
+// Reached returns true iff any of the given pool weights has reached its limit, meaning that a
+// batch is ready.
+func (l Limits) Reached(poolWeights map[transaction.Weight]uint64) bool {
+	for w, limit := range l.limits {
+		if poolWeights[w] >= limit {
+			return true
+		}
+	}
+	return false
+}
+
+// Remaining returns the remaining capacity for each limited weight given the pool weights.
+func (l Limits) Remaining(poolWeights map[transaction.Weight]uint64) map[transaction.Weight]uint64 {
+	remaining := make(map[transaction.Weight]uint64, len(l.limits))
+	for w, limit := range l.limits {
+		if used := poolWeights[w]; used < limit {
+			remaining[w] = limit - used
+		} else {
+			remaining[w] = 0
+		}
+	}
+	return remaining
+}
+
+// Budget returns the batch weight budget resulting from applying the given limits on top of the
+// configured weight limits. The budget never exceeds the configured limits.
+func (l Limits) Budget(limits map[transaction.Weight]uint64) map[transaction.Weight]uint64 {
+	budget := CopyWeights(l.limits)
+	for w, limit := range limits {
+		if cur, ok := budget[w]; !ok || limit < cur {
+			budget[w] = limit
+		}
+	}
+	return budget
+}
+
+// Weights tracks the weights of a batch that is being formed within a weight budget.
+type Weights struct {
+	budget  map[transaction.Weight]uint64
+	order   []transaction.Weight
+	weights map[transaction.Weight]uint64
+}
+
+// NewWeights creates zero batch weights for all weights limited by the given budget.
+func NewWeights(budget map[transaction.Weight]uint64) *Weights {
+	weights := make(map[transaction.Weight]uint64, len(budget))
+	for w := range budget {
+		weights[w] = 0
+	}
+	return &Weights{
+		budget:  budget,
+		order:   SortedWeights(budget),
+		weights: weights,
+	}
+}
+
+// Check checks whether the given transaction can be added to the batch and returns the outcome
+// together with the weight responsible for it (if any).
+//
+// Each check is performed for all weights before moving on to the next one and weights are checked
+// in the order of their names, so that neither the outcome nor the reported weight depend on the
+// (random) map iteration order.
+func (b *Weights) Check(tx *transaction.CheckedTransaction) (Check, transaction.Weight) {
+	for _, w := range b.order {
+		if b.budget[w]-b.weights[w] < MinWeights[w] {
+			return CheckFull, w
+		}
+	}
+	for _, w := range b.order {
+		if b.weights[w]+tx.Weight(w) > b.budget[w] {
+			return CheckOverflow, w
+		}
+	}
+	return CheckFits, ""
+}
+
+// Add adds the weights of the given transaction to the batch weights.
+func (b *Weights) Add(tx *transaction.CheckedTransaction) {
+	for w, v := range tx.Weights() {
+		if _, ok := b.weights[w]; ok {
+			b.weights[w] += v
+		}
+	}
+}
+
+// MinPriority returns the minimum priority of transactions in the given batch that were selected
+// based on their priority (i.e. that are not pinned). In case the batch only contains pinned
+// transactions, the minimum priority of all transactions is returned.
+func MinPriority(batch []*transaction.CheckedTransaction, pinned func(h hash.Hash) bool) uint64 {
+	var (
+		minPriority         uint64 = math.MaxUint64
+		minUnpinnedPriority uint64 = math.MaxUint64
+		haveUnpinned        bool
+	)
+	for _, tx := range batch {
+		if tx.Priority() < minPriority {
+			minPriority = tx.Priority()
+		}
+		if pinned(tx.Hash()) {
+			continue
+		}
+		haveUnpinned = true
+		if tx.Priority() < minUnpinnedPriority {
+			minUnpinnedPriority = tx.Priority()
+		}
+	}
+	if !haveUnpinned {
+		return minPriority
+	}
+	return minUnpinnedPriority
+}
+
+// SumWeights returns the total weights of the given transactions.
+func SumWeights(txs []*transaction.CheckedTransaction) map[transaction.Weight]uint64 {
+	weights := make(map[transaction.Weight]uint64)
+	for _, tx := range txs {
+		for w, v := range tx.Weights() {
+			weights[w] += v
+		}
+	}
+	return weights
+}
+
+// CopyWeights returns a copy of the given weights.
+func CopyWeights(weights map[transaction.Weight]uint64) map[transaction.Weight]uint64 {
+	cp := make(map[transaction.Weight]uint64, len(weights))
+	for w, v := range weights {
+		cp[w] = v
+	}
+	return cp
+}
+
+// SortedWeights returns the weights of the given map sorted by name.
+func SortedWeights(weights map[transaction.Weight]uint64) []transaction.Weight {
+	sorted := make([]transaction.Weight, 0, len(weights))
+	for w := range weights {
+		sorted = append(sorted, w)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
@@ -0,0 +1,104 @@
+package batching
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+)
+
+func TestLimits(t *testing.T) {
+	require := require.New(t)
+
+	limits := NewLimits(map[transaction.Weight]uint64{
+		transaction.WeightCount:     10,
+		transaction.WeightSizeBytes: 100,
+	})
+
+	tx := transaction.NewCheckedTransaction([]byte("transaction"), 0, nil)
+	_, ok := limits.Exceeded(tx)
+	require.False(ok, "transaction should not exceed the limits")
+
+	big := transaction.NewCheckedTransaction(make([]byte, 101), 0, nil)
+	w, ok := limits.Exceeded(big)
+	require.True(ok, "transaction should exceed the limits")
+	require.Equal(transaction.WeightSizeBytes, w)
+
+	poolWeights := map[transaction.Weight]uint64{
+		transaction.WeightCount:     4,
+		transaction.WeightSizeBytes: 120,
+	}
+	require.True(limits.Reached(poolWeights), "size limit should be reached")
+	require.Equal(map[transaction.Weight]uint64{
+		transaction.WeightCount:     6,
+		transaction.WeightSizeBytes: 0,
+	}, limits.Remaining(poolWeights))
+
+	budget := limits.Budget(map[transaction.Weight]uint64{
+		transaction.WeightCount:             20,
+		transaction.WeightSizeBytes:         50,
+		transaction.WeightConsensusMessages: 1,
+	})
+	require.Equal(map[transaction.Weight]uint64{
+		transaction.WeightCount:             10,
+		transaction.WeightSizeBytes:         50,
+		transaction.WeightConsensusMessages: 1,
+	}, budget, "budget should not exceed the configured limits")
+	require.Len(limits.Get(), 2, "configured limits should not be modified")
+}
+
+func TestWeights(t *testing.T) {
+	require := require.New(t)
+
+	weights := NewWeights(map[transaction.Weight]uint64{
+		transaction.WeightCount:     2,
+		transaction.WeightSizeBytes: 30,
+	})
+
+	tx1 := transaction.NewCheckedTransaction([]byte("transaction 1"), 0, nil)
+	check, _ := weights.Check(tx1)
+	require.Equal(CheckFits, check)
+	weights.Add(tx1)
+
+	big := transaction.NewCheckedTransaction([]byte("a much larger transaction"), 0, nil)
+	check, w := weights.Check(big)
+	require.Equal(CheckOverflow, check)
+	require.Equal(transaction.WeightSizeBytes, w)
+
+	tx2 := transaction.NewCheckedTransaction([]byte("tx 2"), 0, nil)
+	check, _ = weights.Check(tx2)
+	require.Equal(CheckFits, check)
+	weights.Add(tx2)
+
+	check, w = weights.Check(tx2)
+	require.Equal(CheckFull, check, "batch should be full once the count limit is reached")
+	require.Equal(transaction.WeightCount, w)
+
+	require.Equal(map[transaction.Weight]uint64{
+		transaction.WeightCount:     2,
+		transaction.WeightSizeBytes: tx1.Size() + tx2.Size(),
+	}, SumWeights([]*transaction.CheckedTransaction{tx1, tx2}))
+}
+
+func TestMinPriority(t *testing.T) {
+	require := require.New(t)
+
+	pinnedTx := transaction.NewCheckedTransaction([]byte("pinned"), 1, nil)
+	batch := []*transaction.CheckedTransaction{
+		pinnedTx,
+		transaction.NewCheckedTransaction([]byte("transaction 1"), 20, nil),
+		transaction.NewCheckedTransaction([]byte("transaction 2"), 10, nil),
+	}
+	pinned := func(h hash.Hash) bool {
+		return h == pinnedTx.Hash()
+	}
+	none := func(hash.Hash) bool {
+		return false
+	}
+
+	require.EqualValues(1, MinPriority(batch, none))
+	require.EqualValues(10, MinPriority(batch, pinned), "pinned transactions should be ignored")
+	require.EqualValues(1, MinPriority(batch[:1], pinned), "batches of pinned transactions should use all transactions")
+}
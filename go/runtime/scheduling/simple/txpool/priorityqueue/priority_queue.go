@@ -3,31 +3,85 @@ package priorityqueue
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"math"
+	"math/bits"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/btree"
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
+	schedulingAPI "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/batching"
 	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
 )
 
 // Name is the name of the tx pool implementation.
 const Name = "priority-queue"
 
+// watchBufferSize is the number of events buffered for each pool event subscriber. In case a
+// subscriber is too slow, the oldest events are dropped so that the pool is never blocked.
+const watchBufferSize = 1024
+
+// priorityHistogramBuckets is the number of buckets in the priority histogram. Bucket zero holds
+// transactions with zero priority while bucket b > 0 holds transactions with priorities in the
+// range [2^(b-1), 2^b).
+const priorityHistogramBuckets = 65
+
 type item struct {
-	tx *transaction.CheckedTransaction
+	tx  *transaction.CheckedTransaction
+	seq uint64
+	// addedAt is the time at which the transaction was added to the pool.
+	addedAt time.Time
+	// tieBreak is the tie-breaking mode of the queue the item belongs to.
+	tieBreak api.TieBreak
 }
 
 func (i item) Less(other btree.Item) bool {
-	i2 := other.(*item)
-	if p1, p2 := i.tx.Priority(), i2.tx.Priority(); p1 != p2 {
+	return lessItems(&i, other)
+}
+
+// cursorItem is an index pivot positioned at a cursor. It is only used for iteration and is never
+// inserted into the index.
+type cursorItem struct {
+	api.Cursor
+
+	tieBreak api.TieBreak
+}
+
+func (c *cursorItem) Less(other btree.Item) bool {
+	return lessItems(c, other)
+}
+
+func itemKey(i btree.Item) (uint64, uint64, hash.Hash, api.TieBreak) {
+	switch v := i.(type) {
+	case *item:
+		return v.tx.Priority(), v.seq, v.tx.Hash(), v.tieBreak
+	case *cursorItem:
+		return v.Priority, v.Seq, v.Hash, v.tieBreak
+	default:
+		panic(fmt.Errorf("unsupported index item type: %T", i))
+	}
+}
+
+func lessItems(a, b btree.Item) bool {
+	p1, s1, h1, tieBreak := itemKey(a)
+	p2, s2, h2, _ := itemKey(b)
+	if p1 != p2 {
 		return p1 < p2
 	}
-	// If transactions have same priority, sort arbitrary.
-	h1 := i.tx.Hash()
-	h2 := i2.tx.Hash()
+	// If transactions have same priority and FIFO order is requested, earlier transactions are
+	// ordered higher so that they are scheduled first.
+	if tieBreak == api.TieBreakFIFO && s1 != s2 {
+		return s1 > s2
+	}
+	// Otherwise sort arbitrary.
 	return bytes.Compare(h1[:], h2[:]) < 0
 }
 
@@ -36,13 +90,55 @@ type priorityQueue struct {
 
 	priorityIndex *btree.BTree
 	transactions  map[hash.Hash]*item
-
-	maxTxPoolSize uint64
+	// pinned are the queued transactions pinned by the operator.
+	pinned map[hash.Hash]*item
+
+	// senders are the queued transactions indexed by their sender. Transactions with an unknown
+	// sender are not included.
+	senders map[string][]*item
+	// replaceable are the queued transactions indexed by their replacement key. Transactions
+	// without a replacement key are not included.
+	replaceable map[string]*item
+
+	// overflowIndex and overflow hold transactions that were rejected by the full pool and are
+	// waiting to be promoted once room becomes available.
+	overflowIndex *btree.BTree
+	overflow      map[hash.Hash]*item
+
+	maxTxPoolSize   uint64
+	maxOverflowSize uint64
+	maxSenderTxs    uint64
+	replaceByFee    bool
+	// tieBreak is the order of transactions with equal priority. It is fixed at creation.
+	tieBreak api.TieBreak
 
 	poolWeights  map[transaction.Weight]uint64
-	weightLimits map[transaction.Weight]uint64
+	weightLimits batching.Limits
 
 	lowestPriority uint64
+	// minPriority is the minimum priority of newly added transactions.
+	minPriority uint64
+
+	// seq is the insertion sequence number of the most recently added transaction.
+	seq uint64
+	// batchSeq is the insertion sequence number at which the last batch was produced.
+	batchSeq uint64
+	// batchMinPriority is the minimum priority of transactions in the last produced batch which
+	// serves as the cutoff priority for entering a batch.
+	batchMinPriority uint64
+
+	// priorityHistogram is a histogram of priorities of queued transactions with exponentially
+	// sized buckets, used for cheap percentile estimation.
+	priorityHistogram [priorityHistogramBuckets]uint64
+
+	observer      schedulingAPI.LifecycleObserver
+	onEvict       func(tx *transaction.CheckedTransaction, reason api.EvictReason)
+	notifications []func()
+
+	addedNotifier   *pubsub.Broker
+	removedNotifier *pubsub.Broker
+
+	stats api.Stats
 }
 
 // Implements api.TxPool.
@@ -53,111 +149,215 @@ func (q *priorityQueue) Name() string {
 // Implements api.TxPool.
 func (q *priorityQueue) Add(tx *transaction.CheckedTransaction) error {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlockAndNotify()
 
-	// Check if there is room in the queue.
-	var needsPop bool
-	if q.poolWeights[transaction.WeightCount] >= q.maxTxPoolSize {
-		needsPop = true
+	if err := q.addLocked(tx); err != nil {
+		return err
+	}
+	q.checkConsistencyLocked("Add")
 
-		if tx.Priority() <= q.lowestPriority {
-			return api.ErrFull
+	return nil
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) AddBatch(txs []*transaction.CheckedTransaction) []error {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	errs := make([]error, len(txs))
+	for i, tx := range txs {
+		errs[i] = q.addLocked(tx)
+	}
+	q.checkConsistencyLocked("AddBatch")
+
+	return errs
+}
+
+// addLocked adds a single transaction into the queue, evicting lower priority transactions as
+// needed.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) addLocked(tx *transaction.CheckedTransaction) (err error) {
+	defer func() {
+		if err != nil {
+			q.stats.Rejected++
+			return
 		}
+		q.stats.Accepted++
+	}()
+
+	// Reject duplicate and too large transactions first so that they are reported consistently
+	// regardless of the pool state.
+	if err = q.checkTxLocked(tx); err != nil {
+		return err
 	}
 
-	if err := q.checkTxLocked(tx); err != nil {
+	// Check if the transaction replaces a queued transaction.
+	toReplace, err := q.replacedTxLocked(tx)
+	if err != nil {
 		return err
 	}
 
-	// Remove the lowest priority transaction when queue is full.
-	if needsPop {
-		lpi := q.priorityIndex.Min()
-		if lpi != nil {
-			q.removeTxsLocked([]*item{lpi.(*item)})
+	// Check if the sender has reached its limit, in which case the sender's own lowest priority
+	// transaction is evicted instead.
+	var toPop *item
+	if toReplace == nil && q.senderFullLocked(tx.Sender()) {
+		toPop = q.lowestUnpinnedFromSenderLocked(tx.Sender())
+		if toPop == nil || tx.Priority() <= toPop.tx.Priority() {
+			return api.ErrSenderLimit
 		}
 	}
 
-	item := &item{tx: tx}
-	q.priorityIndex.ReplaceOrInsert(item)
-	q.transactions[tx.Hash()] = item
-	for k, v := range tx.Weights() {
-		q.poolWeights[k] += v
+	// Check if there is room in the queue. Pinned transactions are never evicted.
+	var full bool
+	if toReplace == nil && toPop == nil && q.poolWeights[transaction.WeightCount] >= q.maxTxPoolSize {
+		if len(q.pinned) == 0 {
+			if tx.Priority() <= q.lowestPriority {
+				full = true
+			} else if lpi := q.priorityIndex.Min(); lpi != nil {
+				toPop = lpi.(*item)
+			}
+		} else {
+			toPop = q.lowestUnpinnedLocked()
+			if toPop == nil || tx.Priority() <= toPop.tx.Priority() {
+				full = true
+			}
+		}
 	}
-	if tx.Priority() < q.lowestPriority {
-		q.lowestPriority = tx.Priority()
+	if full && q.maxOverflowSize == 0 {
+		return api.ErrPoolFull
 	}
 
-	if mlen, qlen := len(q.transactions), q.priorityIndex.Len(); mlen != qlen {
-		panic(fmt.Errorf("inconsistent sizes of the underlying index (%v) and map (%v) after Add", mlen, qlen))
+	if full {
+		return q.addOverflowLocked(tx)
 	}
-	if mlen, plen := uint64(len(q.transactions)), q.poolWeights[transaction.WeightCount]; mlen != plen {
-		panic(fmt.Errorf("inconsistent sizes of the map (%v) and pool weight count (%v) after Add", mlen, plen))
+
+	// Replace the queued transaction, inheriting its pool slot.
+	if toReplace != nil {
+		replaced := q.removeTxsLocked([]*item{toReplace})
+		q.insertLocked(q.newItemLocked(tx, time.Now()))
+		q.publishAddedLocked(tx)
+
+		q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+			for _, old := range replaced {
+				obs.TxReplaced(old, tx)
+			}
+		})
+		return nil
 	}
 
+	// Remove the lowest priority transaction when queue is full.
+	if toPop != nil {
+		evicted := q.removeTxsLocked([]*item{toPop})
+		q.notifyEvictedLocked(evicted, api.EvictReasonCapacity)
+	}
+
+	q.insertLocked(q.newItemLocked(tx, time.Now()))
+	q.publishAddedLocked(tx)
+
+	q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+		obs.TxQueued(tx)
+	})
+
 	return nil
 }
 
+// checkConsistencyLocked panics in case the internal indices are inconsistent after the given
+// operation.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) checkConsistencyLocked(op string) {
+	if mlen, qlen := len(q.transactions), q.priorityIndex.Len(); mlen != qlen {
+		panic(fmt.Errorf("inconsistent sizes of the underlying index (%v) and map (%v) after %s", mlen, qlen, op))
+	}
+	if mlen, plen := uint64(len(q.transactions)), q.poolWeights[transaction.WeightCount]; mlen != plen {
+		panic(fmt.Errorf("inconsistent sizes of the map (%v) and pool weight count (%v) after %s", mlen, plen, op))
+	}
+}
+
 // Implements api.TxPool.
 func (q *priorityQueue) GetBatch(force bool) []*transaction.CheckedTransaction {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	return q.getBatchLocked(force, q.weightLimits.Get())
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) GetBatchWithLimits(force bool, limits map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	return q.getBatchLocked(force, q.weightLimits.Budget(limits))
+}
+
+// getBatchLocked selects the next batch using the given batch weight budget and records it as
+// the last produced batch.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) getBatchLocked(force bool, budget map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
+	batch := q.selectBatchLocked(force, true, budget)
+	if len(batch) > 0 {
+		q.batchSeq = q.seq
+		q.batchMinPriority = q.batchMinPriorityLocked(batch)
+
+		q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+			obs.TxSelected(batch)
+		})
+	}
+
+	return batch
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) PeekBatch(force bool) []*transaction.CheckedTransaction {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.selectBatchLocked(force, false, q.weightLimits.Get())
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) EstimateBatchWeights(force bool) map[transaction.Weight]uint64 {
 	q.Lock()
 	defer q.Unlock()
 
+	return batching.SumWeights(q.selectBatchLocked(force, false, q.weightLimits.Get()))
+}
+
+// selectBatchLocked selects the transactions for the next batch within the given batch weight
+// budget. In case evictOversized is true, any transactions not fitting the configured weight
+// limits are removed from the pool, otherwise they are skipped.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) selectBatchLocked(force, evictOversized bool, budget map[transaction.Weight]uint64) []*transaction.CheckedTransaction {
 	// Check if a batch is ready.
-	var weightLimitReached bool
-	for k, v := range q.weightLimits {
-		if q.poolWeights[k] >= v {
-			weightLimitReached = true
-			break
-		}
-	}
-	if !weightLimitReached && !force {
+	if !q.batchReadyLocked() && !force {
 		return nil
 	}
 
-	minWeights := map[transaction.Weight]uint64{
-		transaction.WeightCount:             1,
-		transaction.WeightSizeBytes:         10,
-		transaction.WeightConsensusMessages: 0,
-	}
-
 	var batch []*transaction.CheckedTransaction
-	batchWeights := make(map[transaction.Weight]uint64)
-	for w := range q.weightLimits {
-		batchWeights[w] = 0
-	}
+	batchWeights := batching.NewWeights(budget)
 	toRemove := []*item{}
-	q.priorityIndex.Descend(func(i btree.Item) bool {
-		item := i.(*item)
-
-		// Check if the call fits into the batch.
-		for w, limit := range q.weightLimits {
-			batchWeight := batchWeights[w]
-
-			txW := item.tx.Weight(w)
+	q.descendBatchCandidatesLocked(func(item *item) bool {
+		switch check, _ := q.checkBatchLocked(item, batchWeights); check {
+		case batching.CheckTooLarge:
 			// Transaction weight greater than the limit. Drop the tx from the pool.
-			if txW > limit {
+			if evictOversized {
 				toRemove = append(toRemove, item)
-				return true
 			}
-
+			return true
+		case batching.CheckFull:
 			// Stop if we can't actually fit anything in the batch.
-			if limit-batchWeight < minWeights[w] {
-				return false
-			}
-
+			return false
+		case batching.CheckOverflow:
 			// This transaction would overflow the batch.
-			if batchWeight+txW > limit {
-				return true
-			}
+			return true
 		}
 
 		// Add the tx to the batch.
 		batch = append(batch, item.tx)
-		for w, val := range item.tx.Weights() {
-			if _, ok := batchWeights[w]; ok {
-				batchWeights[w] += val
-			}
-		}
+		batchWeights.Add(item.tx)
 
 		return true
 	})
@@ -165,23 +365,394 @@ func (q *priorityQueue) GetBatch(force bool) []*transaction.CheckedTransaction {
 	// Remove transactions discovered to be too big to even fit the batch.
 	// This can happen if weight limits changed after the transaction was
 	// already set to be scheduled.
-	q.removeTxsLocked(toRemove)
+	q.evictTxsLocked(toRemove)
 
 	return batch
 }
 
-func (q *priorityQueue) removeTxsLocked(items []*item) {
+// Implements api.TxPool.
+func (q *priorityQueue) ExplainEligibility(h hash.Hash) api.EligibilityReport {
+	q.Lock()
+	defer q.Unlock()
+
+	target, ok := q.transactions[h]
+	if !ok {
+		return api.EligibilityReport{}
+	}
+
+	// Simulate batch formation as done by GetBatch up to the target transaction.
+	report := api.EligibilityReport{
+		Queued:     true,
+		FitsLimits: true,
+	}
+	var (
+		full       bool
+		fullWeight transaction.Weight
+	)
+	batchWeights := batching.NewWeights(q.weightLimits.Get())
+	q.descendBatchCandidatesLocked(func(item *item) bool {
+		report.Rank++
+
+		check, w := q.checkBatchLocked(item, batchWeights)
+		if full && check != batching.CheckTooLarge {
+			// Once the batch is full, no further transactions are selected.
+			check, w = batching.CheckFull, fullWeight
+		}
+
+		if item != target {
+			switch check {
+			case batching.CheckFits:
+				batchWeights.Add(item.tx)
+			case batching.CheckFull:
+				// Continue iterating in order to determine the rank of the target transaction.
+				full, fullWeight = true, w
+			}
+			return true
+		}
+
+		switch check {
+		case batching.CheckFits:
+			report.Selected = true
+		case batching.CheckTooLarge:
+			report.FitsLimits = false
+			report.Blocker = api.EligibilityBlockerTooLarge
+			report.BlockingWeight = w
+		case batching.CheckFull, batching.CheckOverflow:
+			report.Blocker = api.EligibilityBlockerBatchFull
+			report.BlockingWeight = w
+		}
+		return false
+	})
+
+	if report.Selected && !q.batchReadyLocked() {
+		report.Selected = false
+		report.Blocker = api.EligibilityBlockerBelowThreshold
+	}
+	return report
+}
+
+// replacedTxLocked returns the queued transaction that the given transaction replaces (if any) in
+// case replace-by-fee is enabled.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) replacedTxLocked(tx *transaction.CheckedTransaction) (*item, error) {
+	if !q.replaceByFee {
+		return nil, nil
+	}
+	key := tx.ReplacementKey()
+	if key == "" {
+		return nil, nil
+	}
+	existing, ok := q.replaceable[key]
+	if !ok || existing.tx.Hash() == tx.Hash() {
+		return nil, nil
+	}
+
+	if _, pinned := q.pinned[existing.tx.Hash()]; pinned {
+		return nil, p2pError.Permanent(fmt.Errorf("%w: queued transaction is pinned", api.ErrReplacementUnderpriced))
+	}
+	if tx.Priority() <= existing.tx.Priority() {
+		return nil, p2pError.Permanent(api.ErrReplacementUnderpriced)
+	}
+	return existing, nil
+}
+
+// senderFullLocked returns true iff the given sender has reached its transaction limit.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) senderFullLocked(sender string) bool {
+	if sender == "" || q.maxSenderTxs == 0 {
+		return false
+	}
+	return uint64(len(q.senders[sender])) >= q.maxSenderTxs
+}
+
+// lowestUnpinnedFromSenderLocked returns the lowest priority transaction from the given sender that
+// is not pinned (if any).
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) lowestUnpinnedFromSenderLocked(sender string) *item {
+	var lowest *item
+	for _, item := range q.senders[sender] {
+		if _, pinned := q.pinned[item.tx.Hash()]; pinned {
+			continue
+		}
+		if lowest == nil || lessItems(item, lowest) {
+			lowest = item
+		}
+	}
+	return lowest
+}
+
+// addOverflowLocked adds the given transaction to the overflow queue, evicting the lowest priority
+// held transaction in case the overflow queue is full.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) addOverflowLocked(tx *transaction.CheckedTransaction) error {
+	if uint64(len(q.overflow)) >= q.maxOverflowSize {
+		lpi := q.overflowIndex.Min()
+		if lpi == nil || tx.Priority() <= lpi.(*item).tx.Priority() {
+			return api.ErrPoolFull
+		}
+		q.evictOverflowLocked(1)
+	}
+
+	item := q.newItemLocked(tx, time.Now())
+	q.overflowIndex.ReplaceOrInsert(item)
+	q.overflow[tx.Hash()] = item
+
+	q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+		obs.TxQueued(tx)
+	})
+
+	return nil
+}
+
+// evictOverflowLocked evicts up to n lowest priority transactions from the overflow queue.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) evictOverflowLocked(n int) {
+	var evicted []*transaction.CheckedTransaction
+	for ; n > 0; n-- {
+		lpi := q.overflowIndex.DeleteMin()
+		if lpi == nil {
+			break
+		}
+		tx := lpi.(*item).tx
+		delete(q.overflow, tx.Hash())
+		evicted = append(evicted, tx)
+	}
+	q.notifyEvictedLocked(evicted, api.EvictReasonCapacity)
+}
+
+// trimOverflowLocked evicts the lowest priority transactions from the overflow queue until it is
+// within its size limit.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) trimOverflowLocked() {
+	if size := uint64(len(q.overflow)); size > q.maxOverflowSize {
+		q.evictOverflowLocked(int(size - q.maxOverflowSize))
+	}
+}
+
+// promoteOverflowLocked moves the highest priority transactions from the overflow queue to the
+// pool while there is room. Transactions that no longer fit the batch weight limits or are below
+// the minimum priority are evicted with the corresponding reason, while transactions that are
+// already queued are dropped from the overflow queue.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) promoteOverflowLocked() {
+	var tooLarge, tooCheap, evicted []*transaction.CheckedTransaction
+	for q.poolWeights[transaction.WeightCount] < q.maxTxPoolSize {
+		hpi := q.overflowIndex.DeleteMax()
+		if hpi == nil {
+			break
+		}
+		oi := hpi.(*item)
+		tx := oi.tx
+		delete(q.overflow, tx.Hash())
+
+		if err := q.checkTxLocked(tx); err != nil {
+			switch {
+			case errors.Is(err, api.ErrTxTooLarge):
+				tooLarge = append(tooLarge, tx)
+			case errors.Is(err, api.ErrTxTooCheap):
+				tooCheap = append(tooCheap, tx)
+			default:
+				// The transaction is already queued so it must not be reported as evicted.
+			}
+			continue
+		}
+		if q.senderFullLocked(tx.Sender()) {
+			evicted = append(evicted, tx)
+			continue
+		}
+
+		// Promoted transactions are treated as newly added so that batches become stale.
+		q.insertLocked(q.newItemLocked(tx, oi.addedAt))
+		q.publishAddedLocked(tx)
+	}
+	q.notifyEvictedLocked(tooLarge, api.EvictReasonWeightLimit)
+	q.notifyEvictedLocked(tooCheap, api.EvictReasonMinPriority)
+	q.notifyEvictedLocked(evicted, api.EvictReasonCapacity)
+}
+
+// descendBatchCandidatesLocked iterates over batch candidates in the order in which they are
+// considered for inclusion in a batch. Pinned transactions are considered first, followed by all
+// other transactions, each in descending priority order.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) descendBatchCandidatesLocked(fn func(item *item) bool) {
+	pinned := make([]*item, 0, len(q.pinned))
+	for _, item := range q.pinned {
+		pinned = append(pinned, item)
+	}
+	sort.Slice(pinned, func(i, j int) bool {
+		return lessItems(pinned[j], pinned[i])
+	})
+	for _, item := range pinned {
+		if !fn(item) {
+			return
+		}
+	}
+
+	q.priorityIndex.Descend(func(i btree.Item) bool {
+		item := i.(*item)
+		if _, pinned := q.pinned[item.tx.Hash()]; pinned {
+			return true
+		}
+		return fn(item)
+	})
+}
+
+// batchMinPriorityLocked returns the minimum priority of transactions in the given batch that
+// were selected based on their priority (i.e. that are not pinned).
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) batchMinPriorityLocked(batch []*transaction.CheckedTransaction) uint64 {
+	return batching.MinPriority(batch, func(h hash.Hash) bool {
+		_, pinned := q.pinned[h]
+		return pinned
+	})
+}
+
+// lowestUnpinnedLocked returns the lowest priority transaction that is not pinned (if any).
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) lowestUnpinnedLocked() *item {
+	var lowest *item
+	q.priorityIndex.Ascend(func(i btree.Item) bool {
+		item := i.(*item)
+		if _, pinned := q.pinned[item.tx.Hash()]; pinned {
+			return true
+		}
+		lowest = item
+		return false
+	})
+	return lowest
+}
+
+// batchReadyLocked returns true iff any of the pool weights has reached its batch weight limit.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) batchReadyLocked() bool {
+	return q.weightLimits.Reached(q.poolWeights)
+}
+
+// checkBatchLocked checks whether the given item can be added to a batch with the given weights
+// and returns the outcome together with the weight responsible for it (if any). Whether the item
+// is too large is always determined using the configured weight limits.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) checkBatchLocked(item *item, batchWeights *batching.Weights) (batching.Check, transaction.Weight) {
+	if w, ok := q.weightLimits.Exceeded(item.tx); ok {
+		return batching.CheckTooLarge, w
+	}
+	return batchWeights.Check(item.tx)
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) BatchSeq() uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.batchSeq
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) BatchStale(producedAtSeq uint64) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	if producedAtSeq != q.batchSeq {
+		return true
+	}
+
+	// Only transactions with a priority higher than the batch minimum need to be considered.
+	var stale bool
+	pivot := &cursorItem{Cursor: api.Cursor{Priority: q.batchMinPriority}, tieBreak: q.tieBreak}
+	for i := range pivot.Hash {
+		pivot.Hash[i] = 0xff
+	}
+	q.priorityIndex.DescendGreaterThan(pivot, func(i btree.Item) bool {
+		if i.(*item).seq > producedAtSeq {
+			stale = true
+			return false
+		}
+		return true
+	})
+	return stale
+}
+
+// newItemLocked creates a new queue item for the given transaction and assigns it the next
+// insertion sequence number.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) newItemLocked(tx *transaction.CheckedTransaction, addedAt time.Time) *item {
+	q.seq++
+	return &item{tx: tx, seq: q.seq, addedAt: addedAt, tieBreak: q.tieBreak}
+}
+
+// insertLocked inserts the given item into the queue.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) insertLocked(item *item) {
+	q.priorityIndex.ReplaceOrInsert(item)
+	q.transactions[item.tx.Hash()] = item
+	for k, v := range item.tx.Weights() {
+		q.poolWeights[k] += v
+	}
+	q.priorityHistogram[bits.Len64(item.tx.Priority())]++
+	if sender := item.tx.Sender(); sender != "" {
+		q.senders[sender] = append(q.senders[sender], item)
+	}
+	if key := item.tx.ReplacementKey(); key != "" {
+		q.replaceable[key] = item
+	}
+	if q.priorityIndex.Len() == 1 || item.tx.Priority() < q.lowestPriority {
+		q.lowestPriority = item.tx.Priority()
+	}
+}
+
+// evictTxsLocked removes the given items that exceed the batch weight limits from the queue and
+// notifies the observer about the evicted transactions.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) evictTxsLocked(items []*item) {
+	evicted := q.removeTxsLocked(items)
+	if len(evicted) == 0 {
+		return
+	}
+
+	q.notifyEvictedLocked(evicted, api.EvictReasonWeightLimit)
+
+	q.promoteOverflowLocked()
+}
+
+// removeTxsLocked removes the given items from the queue and returns the transactions that were
+// actually removed.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) removeTxsLocked(items []*item) []*transaction.CheckedTransaction {
+	var removed []*transaction.CheckedTransaction
 	for _, item := range items {
 		// Skip already removed items to avoid corrupting the list in case of duplicates.
 		if _, exists := q.transactions[item.tx.Hash()]; !exists {
 			continue
 		}
+		removed = append(removed, item.tx)
 
 		delete(q.transactions, item.tx.Hash())
+		delete(q.pinned, item.tx.Hash())
 		q.priorityIndex.Delete(item)
 		for k, v := range item.tx.Weights() {
 			q.poolWeights[k] -= v
 		}
+		q.priorityHistogram[bits.Len64(item.tx.Priority())]--
+		q.removeFromSenderLocked(item)
+		if key := item.tx.ReplacementKey(); key != "" && q.replaceable[key] == item {
+			delete(q.replaceable, key)
+		}
 	}
 
 	// Update lowest priority.
@@ -199,57 +770,258 @@ func (q *priorityQueue) removeTxsLocked(items []*item) {
 	if mlen, plen := uint64(len(q.transactions)), q.poolWeights[transaction.WeightCount]; mlen != plen {
 		panic(fmt.Errorf("inconsistent sizes of the map (%v) and pool weight count (%v) after removal", mlen, plen))
 	}
+
+	q.publishRemovedLocked(removed)
+
+	return removed
+}
+
+// removeFromSenderLocked removes the given item from the sender index.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) removeFromSenderLocked(item *item) {
+	sender := item.tx.Sender()
+	if sender == "" {
+		return
+	}
+
+	items := q.senders[sender]
+	for i, si := range items {
+		if si.tx.Hash() != item.tx.Hash() {
+			continue
+		}
+		items = append(items[:i], items[i+1:]...)
+		break
+	}
+	if len(items) == 0 {
+		delete(q.senders, sender)
+		return
+	}
+	q.senders[sender] = items
+}
+
+// notifyEvictedLocked accounts for the given evicted transactions and queues the corresponding
+// eviction callback and lifecycle observer notifications.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) notifyEvictedLocked(evicted []*transaction.CheckedTransaction, reason api.EvictReason) {
+	if len(evicted) == 0 {
+		return
+	}
+	q.stats.Evicted += uint64(len(evicted))
+
+	if onEvict := q.onEvict; onEvict != nil {
+		q.deferLocked(func() {
+			for _, tx := range evicted {
+				onEvict(tx, reason)
+			}
+		})
+	}
+
+	q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+		for _, tx := range evicted {
+			obs.TxEvicted(tx)
+		}
+	})
+}
+
+// notifyLocked queues a lifecycle observer notification to be emitted after the lock is released.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) notifyLocked(fn func(obs schedulingAPI.LifecycleObserver)) {
+	obs := q.observer
+	if obs == nil {
+		return
+	}
+	q.deferLocked(func() {
+		fn(obs)
+	})
+}
+
+// publishAddedLocked queues notifications to WatchAdded subscribers about the given transactions
+// that have been added to the pool.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) publishAddedLocked(txs ...*transaction.CheckedTransaction) {
+	if len(txs) == 0 {
+		return
+	}
+	q.deferLocked(func() {
+		for _, tx := range txs {
+			q.addedNotifier.Broadcast(tx)
+		}
+	})
+}
+
+// publishRemovedLocked queues notifications to WatchRemoved subscribers about the given
+// transactions that have been removed from the pool.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) publishRemovedLocked(txs []*transaction.CheckedTransaction) {
+	if len(txs) == 0 {
+		return
+	}
+	q.deferLocked(func() {
+		for _, tx := range txs {
+			q.removedNotifier.Broadcast(tx.Hash())
+		}
+	})
+}
+
+// deferLocked queues the given function to be called after the lock is released.
+//
+// NOTE: Assumes lock is held.
+func (q *priorityQueue) deferLocked(fn func()) {
+	q.notifications = append(q.notifications, fn)
+}
+
+// unlockAndNotify releases the lock and emits any queued notifications.
+func (q *priorityQueue) unlockAndNotify() {
+	notifications := q.notifications
+	q.notifications = nil
+	q.Unlock()
+
+	for _, fn := range notifications {
+		fn()
+	}
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) WatchAdded() (<-chan *transaction.CheckedTransaction, pubsub.ClosableSubscription) {
+	sub := q.addedNotifier.SubscribeBuffered(watchBufferSize)
+	ch := make(chan *transaction.CheckedTransaction)
+	sub.Unwrap(ch)
+	return ch, sub
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) WatchRemoved() (<-chan hash.Hash, pubsub.ClosableSubscription) {
+	sub := q.removedNotifier.SubscribeBuffered(watchBufferSize)
+	ch := make(chan hash.Hash)
+	sub.Unwrap(ch)
+	return ch, sub
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) GetPrioritizedBatch(offset *hash.Hash, limit uint32) []*transaction.CheckedTransaction {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	var (
+		batch      []*transaction.CheckedTransaction
+		toRemove   []*item
+		offsetItem btree.Item
+	)
+	if offset != nil {
+		var exists bool
+		offsetItem, exists = q.transactions[*offset]
+		if !exists {
+			// Offset does not exist so no items will be matched anyway.
+			return nil
+		}
+	}
+	q.priorityIndex.DescendLessOrEqual(offsetItem, func(i btree.Item) bool {
+		item := i.(*item)
+
+		// Transaction weight greater than the limit. Drop the tx from the pool.
+		if _, ok := q.weightLimits.Exceeded(item.tx); ok {
+			toRemove = append(toRemove, item)
+			return true
+		}
+
+		// Skip the offset item itself (if specified).
+		if txHash := item.tx.Hash(); txHash.Equal(offset) {
+			return true
+		}
+
+		// Add the tx to the batch.
+		batch = append(batch, item.tx)
+		if uint32(len(batch)) >= limit { //nolint: gosimple
+			return false
+		}
+		return true
+	})
+
+	// Remove transactions discovered to be too big to even fit the batch.
+	// This can happen if weight limits changed after the transaction was
+	// already set to be scheduled.
+	q.evictTxsLocked(toRemove)
+
+	return batch
 }
 
 // Implements api.TxPool.
-func (q *priorityQueue) GetPrioritizedBatch(offset *hash.Hash, limit uint32) []*transaction.CheckedTransaction {
+func (q *priorityQueue) IterateDescending(offset *hash.Hash, fn func(tx *transaction.CheckedTransaction) bool) {
 	q.Lock()
 	defer q.Unlock()
 
-	var (
-		batch      []*transaction.CheckedTransaction
-		toRemove   []*item
-		offsetItem btree.Item
-	)
+	var offsetItem btree.Item
 	if offset != nil {
 		var exists bool
 		offsetItem, exists = q.transactions[*offset]
 		if !exists {
 			// Offset does not exist so no items will be matched anyway.
-			return nil
+			return
 		}
 	}
 	q.priorityIndex.DescendLessOrEqual(offsetItem, func(i btree.Item) bool {
 		item := i.(*item)
 
-		for w, l := range q.weightLimits {
-			txW := item.tx.Weight(w)
-			// Transaction weight greater than the limit. Drop the tx from the pool.
-			if txW > l {
-				toRemove = append(toRemove, item)
-				return true
-			}
+		// Skip the offset item itself (if specified).
+		if item == offsetItem {
+			return true
 		}
+		return fn(item.tx)
+	})
+}
 
-		// Skip the offset item itself (if specified).
-		if txHash := item.tx.Hash(); txHash.Equal(offset) {
+// Implements api.TxPool.
+func (q *priorityQueue) GetPrioritizedBatchFrom(cursor *api.Cursor, limit uint32) ([]*transaction.CheckedTransaction, *api.Cursor) {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	var (
+		batch    []*transaction.CheckedTransaction
+		toRemove []*item
+		pivot    btree.Item
+	)
+	if cursor != nil {
+		// Position the pivot at the cursor. This works even if the transaction the cursor was
+		// derived from is no longer in the pool.
+		pivot = &cursorItem{Cursor: *cursor, tieBreak: q.tieBreak}
+	}
+	q.priorityIndex.DescendLessOrEqual(pivot, func(i btree.Item) bool {
+		item := i.(*item)
+
+		// Transaction weight greater than the limit. Drop the tx from the pool.
+		if _, ok := q.weightLimits.Exceeded(item.tx); ok {
+			toRemove = append(toRemove, item)
+			return true
+		}
+
+		// Skip the item at the cursor position itself (if still in the pool).
+		if cursor != nil && !lessItems(item, pivot) {
 			return true
 		}
 
 		// Add the tx to the batch.
 		batch = append(batch, item.tx)
-		if uint32(len(batch)) >= limit { //nolint: gosimple
-			return false
-		}
-		return true
+		return uint32(len(batch)) < limit
 	})
 
 	// Remove transactions discovered to be too big to even fit the batch.
 	// This can happen if weight limits changed after the transaction was
 	// already set to be scheduled.
-	q.removeTxsLocked(toRemove)
+	q.evictTxsLocked(toRemove)
 
-	return batch
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	next := api.NewCursor(batch[len(batch)-1])
+	if q.tieBreak == api.TieBreakFIFO {
+		next.Seq = q.transactions[next.Hash].seq
+	}
+	return batch, next
 }
 
 // Implements api.TxPool.
@@ -270,6 +1042,33 @@ func (q *priorityQueue) GetKnownBatch(batch []hash.Hash) ([]*transaction.Checked
 	return result, missing
 }
 
+// Implements api.TxPool.
+func (q *priorityQueue) GetKnownBatchOrdered(batch []hash.Hash) ([]*transaction.CheckedTransaction, map[hash.Hash]int) {
+	q.Lock()
+	defer q.Unlock()
+
+	items := make([]*item, 0, len(batch))
+	missing := make(map[hash.Hash]int)
+	for index, txHash := range batch {
+		if item, ok := q.transactions[txHash]; ok {
+			items = append(items, item)
+		} else {
+			missing[txHash] = index
+		}
+	}
+
+	// Use the index order so that ties are broken the same way as during batch selection.
+	sort.SliceStable(items, func(i, j int) bool {
+		return lessItems(items[j], items[i])
+	})
+
+	result := make([]*transaction.CheckedTransaction, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.tx)
+	}
+	return result, missing
+}
+
 // Implements api.TxPool.
 func (q *priorityQueue) GetTransactions(limit int) []*transaction.CheckedTransaction {
 	q.Lock()
@@ -290,10 +1089,20 @@ func (q *priorityQueue) GetTransactions(limit int) []*transaction.CheckedTransac
 	return result
 }
 
+// Implements api.TxPool.
+func (q *priorityQueue) GetTransactionsOrdered(offset *hash.Hash, limit int) []*transaction.CheckedTransaction {
+	var result []*transaction.CheckedTransaction
+	q.IterateDescending(offset, func(tx *transaction.CheckedTransaction) bool {
+		result = append(result, tx)
+		return limit <= 0 || len(result) < limit
+	})
+	return result
+}
+
 // Implements api.TxPool.
 func (q *priorityQueue) RemoveBatch(batch []hash.Hash) {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlockAndNotify()
 
 	items := make([]*item, 0, len(batch))
 	for _, txHash := range batch {
@@ -301,14 +1110,30 @@ func (q *priorityQueue) RemoveBatch(batch []hash.Hash) {
 			items = append(items, item)
 		}
 	}
-	q.removeTxsLocked(items)
+	removed := q.removeTxsLocked(items)
+	if len(removed) == 0 {
+		return
+	}
+
+	q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+		for _, tx := range removed {
+			obs.TxRemoved(tx)
+		}
+	})
+
+	q.promoteOverflowLocked()
 }
 
 // Implements api.TxPool.
+//
+// Transactions held in the overflow queue are also considered queued.
 func (q *priorityQueue) IsQueued(txHash hash.Hash) bool {
 	q.Lock()
 	defer q.Unlock()
 
+	if _, ok := q.overflow[txHash]; ok {
+		return true
+	}
 	return q.isQueuedLocked(txHash)
 }
 
@@ -321,39 +1146,433 @@ func (q *priorityQueue) Size() uint64 {
 }
 
 // Implements api.TxPool.
-func (q *priorityQueue) UpdateConfig(cfg api.Config) {
+func (q *priorityQueue) Weights() map[transaction.Weight]uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	return batching.CopyWeights(q.poolWeights)
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) WeightLimits() map[transaction.Weight]uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.weightLimits.Copy()
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) RemainingCapacity() map[transaction.Weight]uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.weightLimits.Remaining(q.poolWeights)
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) FreeSlots() uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	if size := q.poolWeights[transaction.WeightCount]; size < q.maxTxPoolSize {
+		return q.maxTxPoolSize - size
+	}
+	return 0
+}
+
+// Implements api.TxPool.
+//
+// The estimate is computed from a histogram with exponentially sized buckets which is maintained
+// as transactions are added and removed. This makes the query cost constant and independent of
+// the pool size, at the expense of accuracy: the estimate is linearly interpolated within the
+// bucket containing the requested percentile, so the error is bounded by the bucket width (i.e.
+// the estimate is always within a factor of two of the actual priority). The estimate is further
+// clamped to the actual lowest and highest priorities in the pool.
+func (q *priorityQueue) EstimatePriorityPercentile(percentile float64) uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	total := uint64(len(q.transactions))
+	if total == 0 {
+		return 0
+	}
+
+	// Determine the (one-based) rank of the transaction at the given percentile.
+	percentile = math.Max(0, math.Min(100, percentile))
+	rank := uint64(math.Ceil(percentile / 100 * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var (
+		estimate uint64
+		seen     uint64
+	)
+	for bucket, count := range q.priorityHistogram {
+		if seen+count < rank {
+			seen += count
+			continue
+		}
+
+		// Linearly interpolate within the bucket.
+		var lo, width uint64
+		if bucket > 0 {
+			lo = 1 << (bucket - 1)
+			width = lo - 1
+		}
+		frac := float64(rank-seen) / float64(count)
+		delta := uint64(frac * float64(width))
+		if delta > width {
+			delta = width
+		}
+		estimate = lo + delta
+		break
+	}
+
+	// Clamp the estimate to the actual priority range.
+	if lpi := q.priorityIndex.Min(); lpi != nil {
+		if lowest := lpi.(*item).tx.Priority(); estimate < lowest {
+			estimate = lowest
+		}
+	}
+	if hpi := q.priorityIndex.Max(); hpi != nil {
+		if highest := hpi.(*item).tx.Priority(); estimate > highest {
+			estimate = highest
+		}
+	}
+	return estimate
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) FeeMarketState() schedulingAPI.FeeMarketState {
+	q.Lock()
+	defer q.Unlock()
+
+	state := schedulingAPI.FeeMarketState{
+		LastBatchMinPriority: q.batchMinPriority,
+		MinPriority:          q.minPriority,
+	}
+	if q.maxTxPoolSize > 0 {
+		state.PoolFillRatio = float64(q.poolWeights[transaction.WeightCount]) / float64(q.maxTxPoolSize)
+	}
+	if lpi := q.priorityIndex.Min(); lpi != nil {
+		state.LowestPriority = lpi.(*item).tx.Priority()
+	}
+	return state
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) Stats() api.Stats {
 	q.Lock()
 	defer q.Unlock()
 
+	return q.stats
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) UpdateConfig(cfg api.Config) {
+	q.Lock()
+	defer q.unlockAndNotify()
+
 	q.maxTxPoolSize = cfg.MaxPoolSize
-	q.weightLimits = cfg.WeightLimits
+	q.maxOverflowSize = cfg.MaxOverflowSize
+	q.maxSenderTxs = cfg.MaxSenderTxs
+	q.replaceByFee = cfg.ReplaceByFee
+	q.weightLimits = batching.NewLimits(cfg.GetWeightLimits())
+
+	// Transactions of senders exceeding a lowered limit are not evicted, but no new transactions
+	// from such senders are accepted until they are back within the limit.
+	q.trimOverflowLocked()
+	q.promoteOverflowLocked()
 
 	// Any transaction not within the new limits will get removed during GetBatch iteration.
 }
 
 // Implements api.TxPool.
-func (q *priorityQueue) Clear() {
+func (q *priorityQueue) UpdateMinPriority(min uint64) {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	q.minPriority = min
+
+	// Evict transactions in the overflow queue that are below the new minimum.
+	var evicted []*transaction.CheckedTransaction
+	for {
+		lpi := q.overflowIndex.Min()
+		if lpi == nil || lpi.(*item).tx.Priority() >= min {
+			break
+		}
+		q.overflowIndex.DeleteMin()
+		tx := lpi.(*item).tx
+		delete(q.overflow, tx.Hash())
+		evicted = append(evicted, tx)
+	}
+	q.notifyEvictedLocked(evicted, api.EvictReasonMinPriority)
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) Transition(cfg api.Config, migrate func(txs []*transaction.CheckedTransaction) []*transaction.CheckedTransaction) {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	q.maxTxPoolSize = cfg.MaxPoolSize
+	q.maxOverflowSize = cfg.MaxOverflowSize
+	q.maxSenderTxs = cfg.MaxSenderTxs
+	q.replaceByFee = cfg.ReplaceByFee
+	q.weightLimits = batching.NewLimits(cfg.GetWeightLimits())
+
+	txs := make([]*transaction.CheckedTransaction, 0, len(q.transactions))
+	q.priorityIndex.Descend(func(i btree.Item) bool {
+		txs = append(txs, i.(*item).tx)
+		return true
+	})
+	if migrate != nil {
+		migrated := make([]*transaction.CheckedTransaction, 0, len(txs))
+		for _, tx := range migrate(txs) {
+			if tx != nil {
+				migrated = append(migrated, tx)
+			}
+		}
+		txs = migrated
+	}
+
+	// Insert pinned transactions first and then the remaining ones in descending priority order
+	// so that the lowest priority transactions are dropped in case the pool is over capacity.
+	oldItems, oldPinned := q.transactions, q.pinned
+	sortKey := func(tx *transaction.CheckedTransaction) *cursorItem {
+		// New transactions are ordered after existing ones with the same priority.
+		seq := uint64(math.MaxUint64)
+		if oldItem, ok := oldItems[tx.Hash()]; ok {
+			seq = oldItem.seq
+		}
+		return &cursorItem{
+			Cursor:   api.Cursor{Priority: tx.Priority(), Hash: tx.Hash(), Seq: seq},
+			tieBreak: q.tieBreak,
+		}
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		_, pi := oldPinned[txs[i].Hash()]
+		_, pj := oldPinned[txs[j].Hash()]
+		if pi != pj {
+			return pi
+		}
+		return lessItems(sortKey(txs[j]), sortKey(txs[i]))
+	})
+
+	// Rebuild the queue.
+	q.priorityIndex.Clear(true)
+	q.transactions = make(map[hash.Hash]*item)
+	q.pinned = make(map[hash.Hash]*item)
+	q.senders = make(map[string][]*item)
+	q.replaceable = make(map[string]*item)
+	q.poolWeights = make(map[transaction.Weight]uint64)
+	q.priorityHistogram = [priorityHistogramBuckets]uint64{}
+	q.lowestPriority = 0
+
+	var queued []*transaction.CheckedTransaction
+	for _, tx := range txs {
+		h := tx.Hash()
+		_, pinned := oldPinned[h]
+		if !pinned && q.poolWeights[transaction.WeightCount] >= q.maxTxPoolSize {
+			break
+		}
+		if q.checkTxLocked(tx) != nil {
+			// Transaction does not fit the new weight limits or is a duplicate.
+			continue
+		}
+		if !pinned && q.senderFullLocked(tx.Sender()) {
+			// Sender has reached its limit with higher priority transactions.
+			continue
+		}
+
+		var newItem *item
+		if oldItem, ok := oldItems[h]; ok {
+			newItem = &item{tx: tx, seq: oldItem.seq, addedAt: oldItem.addedAt, tieBreak: q.tieBreak}
+		} else {
+			newItem = q.newItemLocked(tx, time.Now())
+			queued = append(queued, tx)
+		}
+		q.insertLocked(newItem)
+		if pinned {
+			q.pinned[h] = newItem
+		}
+	}
+
+	var evicted []*transaction.CheckedTransaction
+	for h, oldItem := range oldItems {
+		if _, ok := q.transactions[h]; !ok {
+			evicted = append(evicted, oldItem.tx)
+		}
+	}
+	q.notifyEvictedLocked(evicted, api.EvictReasonCapacity)
+	q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+		for _, tx := range queued {
+			obs.TxQueued(tx)
+		}
+	})
+	q.publishRemovedLocked(evicted)
+	q.publishAddedLocked(queued...)
+
+	q.trimOverflowLocked()
+	q.promoteOverflowLocked()
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) RecomputeWeights(fn func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64) {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	poolWeights := make(map[transaction.Weight]uint64)
+	for _, item := range q.transactions {
+		weights := make(map[transaction.Weight]uint64)
+		for w, v := range fn(item.tx) {
+			weights[w] = v
+		}
+
+		// Neither the priority nor the hash change, so the item can be updated in place without
+		// affecting its position in the priority index.
+		tx := transaction.NewCheckedTransactionWithSender(item.tx.Raw(), item.tx.Priority(), weights, item.tx.Sender(), item.tx.SenderSeq())
+		tx.SetFirstSeen(item.tx.FirstSeen(), item.tx.Source())
+		item.tx = tx
+		for w, v := range item.tx.Weights() {
+			poolWeights[w] += v
+		}
+	}
+	q.poolWeights = poolWeights
+
+	// Remove transactions that no longer fit the weight limits.
+	var toRemove []*item
+	for _, item := range q.transactions {
+		if _, ok := q.weightLimits.Exceeded(item.tx); ok {
+			toRemove = append(toRemove, item)
+		}
+	}
+	q.evictTxsLocked(toRemove)
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) Pin(h hash.Hash) {
+	q.Lock()
+	defer q.Unlock()
+
+	if item, ok := q.transactions[h]; ok {
+		q.pinned[h] = item
+	}
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) Unpin(h hash.Hash) {
 	q.Lock()
 	defer q.Unlock()
 
+	delete(q.pinned, h)
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) ExpireOldTransactions(maxAge time.Duration) []hash.Hash {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	cutoff := time.Now().Add(-maxAge)
+
+	var toRemove []*item
+	for h, item := range q.transactions {
+		if _, pinned := q.pinned[h]; pinned {
+			continue
+		}
+		if item.addedAt.Before(cutoff) {
+			toRemove = append(toRemove, item)
+		}
+	}
+	expired := q.removeTxsLocked(toRemove)
+
+	// Transactions waiting in the overflow queue expire as well.
+	for h, item := range q.overflow {
+		if !item.addedAt.Before(cutoff) {
+			continue
+		}
+		q.overflowIndex.Delete(item)
+		delete(q.overflow, h)
+		expired = append(expired, item.tx)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	hashes := make([]hash.Hash, 0, len(expired))
+	for _, tx := range expired {
+		hashes = append(hashes, tx.Hash())
+	}
+	q.notifyLocked(func(obs schedulingAPI.LifecycleObserver) {
+		for _, tx := range expired {
+			obs.TxExpired(tx)
+		}
+	})
+
+	q.promoteOverflowLocked()
+
+	return hashes
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) Clear() {
+	q.Lock()
+	defer q.unlockAndNotify()
+
+	var removed []*transaction.CheckedTransaction
+	for h, item := range q.transactions {
+		if _, pinned := q.pinned[h]; !pinned {
+			removed = append(removed, item.tx)
+		}
+	}
+	q.publishRemovedLocked(removed)
+
 	q.priorityIndex.Clear(true)
 	q.transactions = make(map[hash.Hash]*item)
+	q.senders = make(map[string][]*item)
+	q.replaceable = make(map[string]*item)
+	q.overflowIndex.Clear(true)
+	q.overflow = make(map[hash.Hash]*item)
 	q.poolWeights = make(map[transaction.Weight]uint64)
+	q.priorityHistogram = [priorityHistogramBuckets]uint64{}
 	q.lowestPriority = 0
+	q.batchSeq = 0
+	q.batchMinPriority = 0
+
+	// Pinned transactions survive clearing.
+	for _, item := range q.pinned {
+		q.insertLocked(item)
+	}
+}
+
+// Implements api.TxPool.
+func (q *priorityQueue) SetLifecycleObserver(obs schedulingAPI.LifecycleObserver) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.observer = obs
 }
 
 // NOTE: Assumes lock is held.
 func (q *priorityQueue) checkTxLocked(tx *transaction.CheckedTransaction) error {
 	// Check weights.
-	for w, l := range q.weightLimits {
-		txW := tx.Weight(w)
-		if txW > l {
-			return fmt.Errorf("transaction doesn't fit batch weight limit: %w", api.ErrCallTooLarge)
-		}
+	if _, ok := q.weightLimits.Exceeded(tx); ok {
+		return p2pError.Permanent(fmt.Errorf("transaction doesn't fit batch weight limit: %w", api.ErrTxTooLarge))
+	}
+
+	// Check minimum priority.
+	if tx.Priority() < q.minPriority {
+		return fmt.Errorf("%w: priority %d is below minimum %d", api.ErrTxTooCheap, tx.Priority(), q.minPriority)
 	}
 
-	if q.isQueuedLocked(tx.Hash()) {
-		return api.ErrCallAlreadyExists
+	// Preserve the earliest first-seen time of duplicate transactions.
+	if existing, ok := q.transactions[tx.Hash()]; ok {
+		existing.tx.MergeFirstSeen(tx)
+		return p2pError.Permanent(api.ErrTxExists)
+	}
+	if existing, ok := q.overflow[tx.Hash()]; ok {
+		existing.tx.MergeFirstSeen(tx)
+		return p2pError.Permanent(api.ErrTxExists)
 	}
 
 	return nil
@@ -368,10 +1587,22 @@ func (q *priorityQueue) isQueuedLocked(txHash hash.Hash) bool {
 // New returns a new TxPool.
 func New(cfg api.Config) api.TxPool {
 	return &priorityQueue{
-		transactions:  make(map[hash.Hash]*item),
-		poolWeights:   make(map[transaction.Weight]uint64),
-		priorityIndex: btree.New(2),
-		maxTxPoolSize: cfg.MaxPoolSize,
-		weightLimits:  cfg.WeightLimits,
+		transactions:    make(map[hash.Hash]*item),
+		pinned:          make(map[hash.Hash]*item),
+		senders:         make(map[string][]*item),
+		replaceable:     make(map[string]*item),
+		overflow:        make(map[hash.Hash]*item),
+		poolWeights:     make(map[transaction.Weight]uint64),
+		priorityIndex:   btree.New(2),
+		overflowIndex:   btree.New(2),
+		tieBreak:        cfg.TieBreak,
+		onEvict:         cfg.OnEvict,
+		maxTxPoolSize:   cfg.MaxPoolSize,
+		maxOverflowSize: cfg.MaxOverflowSize,
+		maxSenderTxs:    cfg.MaxSenderTxs,
+		replaceByFee:    cfg.ReplaceByFee,
+		weightLimits:    batching.NewLimits(cfg.GetWeightLimits()),
+		addedNotifier:   pubsub.NewBroker(false),
+		removedNotifier: pubsub.NewBroker(false),
 	}
 }
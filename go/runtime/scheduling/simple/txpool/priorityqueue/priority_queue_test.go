@@ -1,10 +1,17 @@
 package priorityqueue
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	tests "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool"
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
+	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/batching"
+	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
 )
 
 func TestPriorityQueue(t *testing.T) {
@@ -14,6 +21,283 @@ func TestPriorityQueue(t *testing.T) {
 	tests.TxPoolImplementationTests(t, queue)
 }
 
+func TestPriorityQueueTieBreakFIFO(t *testing.T) {
+	require := require.New(t)
+
+	queue := New(api.Config{
+		MaxPoolSize: 6,
+		TieBreak:    api.TieBreakFIFO,
+	})
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 5; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), 10, nil)
+		require.NoError(queue.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+	high := transaction.NewCheckedTransaction([]byte("high priority"), 20, nil)
+	require.NoError(queue.Add(high), "Add")
+
+	expected := append([]*transaction.CheckedTransaction{high}, txs...)
+	require.EqualValues(expected, queue.GetBatch(true), "equal priority transactions should be in insertion order")
+	require.EqualValues(expected, queue.GetPrioritizedBatch(nil, 10), "GetPrioritizedBatch")
+
+	// Paginating with cursors should follow the same order.
+	var (
+		paged  []*transaction.CheckedTransaction
+		cursor *api.Cursor
+	)
+	for {
+		var batch []*transaction.CheckedTransaction
+		batch, cursor = queue.GetPrioritizedBatchFrom(cursor, 2)
+		if len(batch) == 0 {
+			break
+		}
+		paged = append(paged, batch...)
+	}
+	require.EqualValues(expected, paged, "GetPrioritizedBatchFrom")
+
+	// Among equal priority transactions, the most recently added one should be evicted first.
+	require.NoError(queue.Add(transaction.NewCheckedTransaction([]byte("medium priority"), 15, nil)), "Add")
+	require.False(queue.IsQueued(txs[4].Hash()), "most recent equal priority transaction should be evicted")
+	require.True(queue.IsQueued(txs[0].Hash()), "earliest equal priority transaction should remain queued")
+}
+
+func TestPriorityQueueFirstSeen(t *testing.T) {
+	require := require.New(t)
+
+	queue := New(api.Config{
+		MaxPoolSize: 10,
+	})
+
+	now := time.Now()
+	tx := transaction.NewCheckedTransaction([]byte("hello world"), 10, nil)
+	tx.SetFirstSeen(now, transaction.TxSourceP2P)
+	require.NoError(queue.Add(tx), "Add")
+
+	// Re-checking a duplicate that was seen later should keep the original first-seen time.
+	dup := transaction.NewCheckedTransaction([]byte("hello world"), 10, nil)
+	dup.SetFirstSeen(now.Add(time.Minute), transaction.TxSourceLocal)
+	require.ErrorIs(queue.Add(dup), api.ErrTxExists, "Add should reject duplicates")
+	batch := queue.GetBatch(true)
+	require.Len(batch, 1)
+	require.Equal(now, batch[0].FirstSeen(), "first-seen time should be preserved")
+	require.Equal(transaction.TxSourceP2P, batch[0].Source(), "source should be preserved")
+
+	// Re-checking a duplicate that was seen earlier should update the first-seen time.
+	dup = transaction.NewCheckedTransaction([]byte("hello world"), 10, nil)
+	dup.SetFirstSeen(now.Add(-time.Minute), transaction.TxSourceLocal)
+	require.ErrorIs(queue.Add(dup), api.ErrTxExists, "Add should reject duplicates")
+	batch = queue.GetBatch(true)
+	require.Equal(now.Add(-time.Minute), batch[0].FirstSeen(), "earliest first-seen time should be kept")
+	require.Equal(transaction.TxSourceLocal, batch[0].Source(), "source of the earliest observation should be kept")
+
+	// Recomputing weights should not lose the first-seen time.
+	queue.RecomputeWeights(func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64 {
+		return nil
+	})
+	batch = queue.GetBatch(true)
+	require.Equal(now.Add(-time.Minute), batch[0].FirstSeen(), "first-seen time should survive weight recomputation")
+}
+
+func TestPriorityQueueDeterministicWeightOrder(t *testing.T) {
+	require := require.New(t)
+
+	cfg := api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+			"weight_a":                  5,
+			"weight_b":                  5,
+			"weight_c":                  5,
+		},
+	}
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 10; i++ {
+		txs = append(txs, transaction.NewCheckedTransaction(
+			[]byte(fmt.Sprintf("hello world %d", i)),
+			uint64(10-i),
+			map[transaction.Weight]uint64{
+				"weight_a": uint64(i % 3),
+				"weight_b": uint64((i + 1) % 3),
+				"weight_c": uint64((i + 2) % 3),
+			},
+		))
+	}
+	// A transaction exceeding multiple weight limits at once.
+	tooLarge := transaction.NewCheckedTransaction([]byte("too large"), 100, map[transaction.Weight]uint64{
+		"weight_a": 6,
+		"weight_b": 6,
+		"weight_c": 6,
+	})
+
+	build := func() api.TxPool {
+		queue := New(api.Config{
+			MaxPoolSize: 50,
+			WeightLimits: map[transaction.Weight]uint64{
+				"weight_a": 10,
+				"weight_b": 10,
+				"weight_c": 10,
+			},
+		})
+		for _, tx := range append([]*transaction.CheckedTransaction{tooLarge}, txs...) {
+			require.NoError(queue.Add(tx), "Add")
+		}
+		queue.UpdateConfig(cfg)
+		return queue
+	}
+
+	var expected []*transaction.CheckedTransaction
+	for i := 0; i < 20; i++ {
+		queue := build()
+
+		report := queue.ExplainEligibility(tooLarge.Hash())
+		require.False(report.FitsLimits, "transaction should not fit limits")
+		require.Equal(transaction.Weight("weight_a"), report.BlockingWeight, "blocking weight should be the first weight by name")
+
+		batch := queue.GetBatch(true)
+		require.NotEmpty(batch, "batch should not be empty")
+		require.NotContains(batch, tooLarge, "too large transaction should not be selected")
+		if expected == nil {
+			expected = batch
+			continue
+		}
+		require.EqualValues(expected, batch, "batches should be identical across constructions")
+	}
+}
+
+func TestPriorityQueueOnEvict(t *testing.T) {
+	require := require.New(t)
+
+	type eviction struct {
+		tx     *transaction.CheckedTransaction
+		reason api.EvictReason
+	}
+	var (
+		queue     api.TxPool
+		evictions []eviction
+	)
+	cfg := api.Config{
+		MaxPoolSize: 2,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightSizeBytes: 100,
+		},
+		OnEvict: func(tx *transaction.CheckedTransaction, reason api.EvictReason) {
+			// Re-entering the queue must not deadlock.
+			require.False(queue.IsQueued(tx.Hash()), "evicted transaction should not be queued")
+			evictions = append(evictions, eviction{tx, reason})
+		},
+	}
+	queue = New(cfg)
+
+	low := transaction.NewCheckedTransaction([]byte("low"), 1, nil)
+	large := transaction.NewCheckedTransaction([]byte("large transaction"), 5, nil)
+	high := transaction.NewCheckedTransaction([]byte("high"), 10, nil)
+	require.NoError(queue.Add(low), "Add")
+	require.NoError(queue.Add(large), "Add")
+	require.Empty(evictions, "no transactions should be evicted")
+
+	// Adding a higher priority transaction to a full pool should evict the lowest priority one.
+	require.NoError(queue.Add(high), "Add")
+	require.Equal([]eviction{{low, api.EvictReasonCapacity}}, evictions, "capacity eviction")
+
+	// Transactions exceeding lowered weight limits should be evicted during batch formation.
+	evictions = nil
+	cfg.WeightLimits[transaction.WeightSizeBytes] = 10
+	queue.UpdateConfig(cfg)
+	require.EqualValues([]*transaction.CheckedTransaction{high}, queue.GetPrioritizedBatch(nil, 10), "GetPrioritizedBatch")
+	require.Equal([]eviction{{large, api.EvictReasonWeightLimit}}, evictions, "weight limit eviction")
+}
+
+func TestPriorityQueuePromoteOverflowEvictions(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		minPriority uint64
+		sizeLimit   uint64
+		reason      api.EvictReason
+	}{
+		{"MinPriority", 5, 100, api.EvictReasonMinPriority},
+		{"WeightLimit", 0, 5, api.EvictReasonWeightLimit},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var reasons []api.EvictReason
+			queue := New(api.Config{
+				MaxPoolSize:     1,
+				MaxOverflowSize: 1,
+				WeightLimits: map[transaction.Weight]uint64{
+					transaction.WeightSizeBytes: 100,
+				},
+				OnEvict: func(tx *transaction.CheckedTransaction, reason api.EvictReason) {
+					reasons = append(reasons, reason)
+				},
+			})
+
+			high := transaction.NewCheckedTransaction([]byte("high"), 10, nil)
+			held := transaction.NewCheckedTransaction([]byte("held transaction"), 1, nil)
+			require.NoError(queue.Add(high), "Add")
+			require.NoError(queue.Add(held), "Add should hold the transaction in the overflow queue")
+
+			// Change the limits without evicting the held transaction so that it is only checked
+			// once it is promoted.
+			pq := queue.(*priorityQueue)
+			pq.minPriority = tc.minPriority
+			pq.weightLimits = batching.NewLimits(map[transaction.Weight]uint64{
+				transaction.WeightSizeBytes: tc.sizeLimit,
+			})
+
+			queue.RemoveBatch([]hash.Hash{high.Hash()})
+			require.False(queue.IsQueued(held.Hash()), "held transaction should not be promoted")
+			require.Equal([]api.EvictReason{tc.reason}, reasons, "eviction reason should match the failed check")
+		})
+	}
+}
+
+func TestPriorityQueueStats(t *testing.T) {
+	require := require.New(t)
+
+	queue := New(api.Config{
+		MaxPoolSize: 4,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: 20,
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		err := queue.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil))
+		require.NoError(err, "Add")
+	}
+	require.NoError(queue.Add(transaction.NewCheckedTransaction([]byte("hi"), 13, nil)), "Add")
+	require.NoError(queue.Add(transaction.NewCheckedTransaction([]byte("hello world 3"), 14, nil)), "Add")
+	err := queue.Add(transaction.NewCheckedTransaction([]byte("low priority"), 1, nil))
+	require.ErrorIs(err, api.ErrPoolFull, "Add should fail when the pool is full")
+	err = queue.Add(transaction.NewCheckedTransaction([]byte("transaction that is too large"), 100, nil))
+	require.ErrorIs(err, api.ErrTxTooLarge, "Add should fail for too large transactions")
+
+	// Lower the size limit so that transactions are evicted during batch formation.
+	queue.UpdateConfig(api.Config{
+		MaxPoolSize: 4,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: 12,
+		},
+	})
+	batch := queue.GetBatch(true)
+	require.Len(batch, 1, "GetBatch")
+
+	require.Equal(api.Stats{Accepted: 5, Rejected: 2, Evicted: 4}, queue.Stats(), "Stats")
+	require.EqualValues(1, queue.Weights()[transaction.WeightCount], "pool count weight")
+	require.EqualValues(2, queue.Weights()[transaction.WeightSizeBytes], "pool size weight")
+	require.EqualValues(13, queue.FeeMarketState().LowestPriority, "lowest priority")
+
+	queue.Clear()
+	require.Equal(api.Stats{Accepted: 5, Rejected: 2, Evicted: 4}, queue.Stats(), "Clear should not reset stats")
+}
+
 func BenchmarkPriorityQueue(b *testing.B) {
 	queue := New(api.Config{
 		MaxPoolSize: 10,
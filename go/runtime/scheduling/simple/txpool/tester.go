@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -14,8 +15,12 @@ import (
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/mathrand"
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
 	"github.com/oasisprotocol/oasis-core/go/runtime/transaction"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
 )
 
+// recvTimeout is the timeout for receiving pool events.
+const recvTimeout = 5 * time.Second
+
 // TxPoolImplementationTests runs the tx pool implementation tests.
 func TxPoolImplementationTests(
 	t *testing.T,
@@ -45,6 +50,110 @@ func TxPoolImplementationTests(
 	t.Run("TestPriority", func(t *testing.T) {
 		testPriority(t, pool)
 	})
+
+	t.Run("TestPrioritizedBatchCursor", func(t *testing.T) {
+		testPrioritizedBatchCursor(t, pool)
+	})
+
+	t.Run("TestLifecycleObserver", func(t *testing.T) {
+		testLifecycleObserver(t, pool)
+	})
+
+	t.Run("TestPriorityPercentile", func(t *testing.T) {
+		testPriorityPercentile(t, pool)
+	})
+
+	t.Run("TestRecomputeWeights", func(t *testing.T) {
+		testRecomputeWeights(t, pool)
+	})
+
+	t.Run("TestBatchStale", func(t *testing.T) {
+		testBatchStale(t, pool)
+	})
+
+	t.Run("TestDeterministicBatch", func(t *testing.T) {
+		testDeterministicBatch(t, pool)
+	})
+
+	t.Run("TestExplainEligibility", func(t *testing.T) {
+		testExplainEligibility(t, pool)
+	})
+
+	t.Run("TestFeeMarketState", func(t *testing.T) {
+		testFeeMarketState(t, pool)
+	})
+
+	t.Run("TestPinning", func(t *testing.T) {
+		testPinning(t, pool)
+	})
+
+	t.Run("TestTransition", func(t *testing.T) {
+		testTransition(t, pool)
+	})
+
+	t.Run("TestEmptyWeightLimits", func(t *testing.T) {
+		testEmptyWeightLimits(t, pool)
+	})
+
+	t.Run("TestOverflow", func(t *testing.T) {
+		testOverflow(t, pool)
+	})
+
+	t.Run("TestSenderLimit", func(t *testing.T) {
+		testSenderLimit(t, pool)
+	})
+
+	t.Run("TestExpireOldTransactions", func(t *testing.T) {
+		testExpireOldTransactions(t, pool)
+	})
+
+	t.Run("TestReplaceByFee", func(t *testing.T) {
+		testReplaceByFee(t, pool)
+	})
+
+	t.Run("TestPeekBatch", func(t *testing.T) {
+		testPeekBatch(t, pool)
+	})
+
+	t.Run("TestEstimateBatchWeights", func(t *testing.T) {
+		testEstimateBatchWeights(t, pool)
+	})
+
+	t.Run("TestAddErrors", func(t *testing.T) {
+		testAddErrors(t, pool)
+	})
+
+	t.Run("TestAddBatch", func(t *testing.T) {
+		testAddBatch(t, pool)
+	})
+
+	t.Run("TestMinPriority", func(t *testing.T) {
+		testMinPriority(t, pool)
+	})
+
+	t.Run("TestGetBatchWithLimits", func(t *testing.T) {
+		testGetBatchWithLimits(t, pool)
+	})
+
+	t.Run("TestWatch", func(t *testing.T) {
+		testWatch(t, pool)
+	})
+
+	t.Run("TestIterateDescending", func(t *testing.T) {
+		testIterateDescending(t, pool)
+	})
+
+	t.Run("TestGetTransactionsOrdered", func(t *testing.T) {
+		testGetTransactionsOrdered(t, pool)
+	})
+
+	t.Run("TestRemainingCapacity", func(t *testing.T) {
+		testRemainingCapacity(t, pool)
+	})
+
+	t.Run("TestGetKnownBatchOrdered", func(t *testing.T) {
+		testGetKnownBatchOrdered(t, pool)
+	})
 }
 
 func testBasic(t *testing.T, pool api.TxPool) {
@@ -408,39 +517,1408 @@ func testPriority(t *testing.T, pool api.TxPool) {
 	)
 	err = pool.Add(lowTx)
 	require.Error(t, err, "lower priority transaction should not get queued")
-	require.ErrorIs(t, err, api.ErrFull)
+	require.ErrorIs(t, err, api.ErrPoolFull)
 }
 
-// TxPoolImplementationBenchmarks runs the tx pool implementation benchmarks.
-func TxPoolImplementationBenchmarks(
-	b *testing.B,
-	pool api.TxPool,
-) {
-	b.Run("BenchmarkTxPool", func(b *testing.B) {
-		benchmarkIncommingQueue(b, pool)
+func testPrioritizedBatchCursor(t *testing.T, pool api.TxPool) {
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 100,
+		},
 	})
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 6; i++ {
+		tx := transaction.NewCheckedTransaction(
+			[]byte(fmt.Sprintf("hello world %d", i)),
+			uint64(60-i*10),
+			nil,
+		)
+		require.NoError(t, pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+
+	batch, cursor := pool.GetPrioritizedBatchFrom(nil, 2)
+	require.EqualValues(t, txs[0:2], batch, "first page should be returned by priority")
+	require.NotNil(t, cursor, "cursor should be returned")
+	require.EqualValues(t, api.NewCursor(txs[1]), cursor, "cursor should point at the last returned transaction")
+
+	// Evict the transaction at the cursor position before fetching the next page.
+	pool.RemoveBatch([]hash.Hash{txs[1].Hash()})
+	require.False(t, pool.IsQueued(txs[1].Hash()), "transaction at cursor should be removed")
+
+	// An offset-based query loses its place after eviction.
+	offset := txs[1].Hash()
+	require.Empty(t, pool.GetPrioritizedBatch(&offset, 2), "offset-based query should fail after eviction")
+
+	// The cursor-based query should continue where it left off.
+	batch, cursor = pool.GetPrioritizedBatchFrom(cursor, 2)
+	require.EqualValues(t, txs[2:4], batch, "second page should continue after evicted cursor")
+
+	// Evict a transaction on the next page as well.
+	pool.RemoveBatch([]hash.Hash{txs[4].Hash()})
+
+	batch, cursor = pool.GetPrioritizedBatchFrom(cursor, 2)
+	require.EqualValues(t, txs[5:6], batch, "last page should skip evicted transactions")
+	require.EqualValues(t, api.NewCursor(txs[5]), cursor, "cursor should point at the last returned transaction")
+
+	batch, cursor = pool.GetPrioritizedBatchFrom(cursor, 2)
+	require.Empty(t, batch, "no transactions should remain after the last page")
+	require.Nil(t, cursor, "no cursor should be returned when iteration is done")
 }
 
-func benchmarkIncommingQueue(b *testing.B, pool api.TxPool) {
-	values := prepareValues(b)
+type recordingObserver struct {
+	pool api.TxPool
 
-	batchSize := 10000
+	queued   []*transaction.CheckedTransaction
+	selected [][]*transaction.CheckedTransaction
+	removed  []*transaction.CheckedTransaction
+	evicted  []*transaction.CheckedTransaction
+	expired  []*transaction.CheckedTransaction
+	replaced [][2]*transaction.CheckedTransaction
+}
 
-	b.Run(fmt.Sprintf("Add:%d", batchSize), func(b *testing.B) {
-		// Exclude preparation.
-		pool.Clear()
-		pool.UpdateConfig(api.Config{
-			MaxPoolSize: 10000000,
-			WeightLimits: map[transaction.Weight]uint64{
-				transaction.WeightCount:     10000000,
-				transaction.WeightSizeBytes: 10000000,
+func (o *recordingObserver) TxQueued(tx *transaction.CheckedTransaction) {
+	// Re-enter the pool to make sure no locks are held while notifying.
+	_ = o.pool.IsQueued(tx.Hash())
+	o.queued = append(o.queued, tx)
+}
+
+func (o *recordingObserver) TxSelected(txs []*transaction.CheckedTransaction) {
+	o.selected = append(o.selected, txs)
+}
+
+func (o *recordingObserver) TxRemoved(tx *transaction.CheckedTransaction) {
+	o.removed = append(o.removed, tx)
+}
+
+func (o *recordingObserver) TxEvicted(tx *transaction.CheckedTransaction) {
+	_ = o.pool.Size()
+	o.evicted = append(o.evicted, tx)
+}
+
+func (o *recordingObserver) TxExpired(tx *transaction.CheckedTransaction) {
+	o.expired = append(o.expired, tx)
+}
+
+func (o *recordingObserver) TxReplaced(old, new *transaction.CheckedTransaction) {
+	o.replaced = append(o.replaced, [2]*transaction.CheckedTransaction{old, new})
+}
+
+func testLifecycleObserver(t *testing.T, pool api.TxPool) {
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 2,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	txs := []*transaction.CheckedTransaction{
+		transaction.NewCheckedTransaction([]byte("hello world 10"), 10, nil),
+		transaction.NewCheckedTransaction([]byte("hello world 5"), 5, nil),
+		transaction.NewCheckedTransaction([]byte("hello world 20"), 20, nil),
+	}
+	for _, tx := range txs {
+		require.NoError(t, pool.Add(tx), "Add")
+	}
+	require.EqualValues(t, txs, obs.queued, "all transactions should be reported as queued")
+	require.EqualValues(t, txs[1:2], obs.evicted, "lowest priority transaction should be reported as evicted")
+
+	// A rejected transaction should not be reported.
+	require.Error(t, pool.Add(txs[0]), "Add error on duplicates")
+	require.Len(t, obs.queued, 3, "rejected transactions should not be reported as queued")
+
+	batch := pool.GetBatch(true)
+	require.Len(t, batch, 2, "two transactions should be returned")
+	require.EqualValues(t, [][]*transaction.CheckedTransaction{batch}, obs.selected, "batch should be reported as selected")
+
+	pool.RemoveBatch([]hash.Hash{txs[0].Hash(), txs[1].Hash()})
+	require.EqualValues(t, txs[0:1], obs.removed, "only queued transactions should be reported as removed")
+
+	// Transactions exceeding the weight limits should be reported as evicted.
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 2,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1,
+		},
+	})
+	batch = pool.GetBatch(true)
+	require.Empty(t, batch, "no transactions should be returned")
+	require.EqualValues(t, []*transaction.CheckedTransaction{txs[1], txs[2]}, obs.evicted, "oversized transaction should be reported as evicted")
+	require.Len(t, obs.selected, 1, "empty batches should not be reported as selected")
+}
+
+func testPriorityPercentile(t *testing.T, pool api.TxPool) {
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 100,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+
+	require.EqualValues(t, 0, pool.EstimatePriorityPercentile(50), "empty pool should return zero")
+
+	for _, i := range rand.Perm(100) {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(i+1), nil)
+		require.NoError(t, pool.Add(tx), "Add")
+	}
+
+	require.EqualValues(t, 1, pool.EstimatePriorityPercentile(0), "lowest percentile should be the lowest priority")
+	require.EqualValues(t, 100, pool.EstimatePriorityPercentile(100), "highest percentile should be the highest priority")
+	require.InDelta(t, 50, pool.EstimatePriorityPercentile(50), 5, "median estimate should be close to the actual median")
+	p90 := pool.EstimatePriorityPercentile(90)
+	require.True(t, p90 >= 45 && p90 <= 100, "estimate should be within a factor of two of the actual percentile")
+
+	// Removing transactions should update the estimate.
+	batch := pool.GetPrioritizedBatch(nil, 50)
+	hashes := make([]hash.Hash, len(batch))
+	for i, tx := range batch {
+		hashes[i] = tx.Hash()
+	}
+	pool.RemoveBatch(hashes)
+	require.EqualValues(t, 50, pool.EstimatePriorityPercentile(100), "highest percentile should be the highest priority")
+	require.InDelta(t, 25, pool.EstimatePriorityPercentile(50), 5, "median estimate should be close to the actual median")
+
+	pool.Clear()
+	require.EqualValues(t, 0, pool.EstimatePriorityPercentile(50), "empty pool should return zero")
+}
+
+func testRecomputeWeights(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+			"custom_weight":             10,
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		err := pool.Add(transaction.NewCheckedTransaction(
+			[]byte(fmt.Sprintf("hello world %d", i)),
+			uint64(i),
+			map[transaction.Weight]uint64{
+				"custom_weight": 1,
 			},
-		})
+		))
+		require.NoError(err, "Add")
+	}
+	require.Nil(pool.GetBatch(false), "no weight limit should be reached")
+
+	// Recompute weights so that the custom weight of each transaction is three times its priority.
+	// This makes the transaction with the highest priority exceed the limit while the total custom
+	// weight of the remaining transactions reaches it.
+	pool.RecomputeWeights(func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64 {
+		return map[transaction.Weight]uint64{
+			"custom_weight": 3 * tx.Priority(),
+		}
+	})
+	require.EqualValues(4, pool.Size(), "transactions exceeding the limit should be removed")
+	require.False(pool.IsQueued(hash.NewFromBytes([]byte("hello world 4"))), "transaction exceeding the limit should be removed")
 
-		for i := 0; i < b.N; i++ {
-			for _, tx := range values {
-				_ = pool.Add(tx)
-			}
+	for _, tx := range pool.GetTransactions(0) {
+		require.EqualValues(3*tx.Priority(), tx.Weight("custom_weight"), "custom weight should be recomputed")
+		require.EqualValues(1, tx.Weight(transaction.WeightCount), "count weight should be preserved")
+		require.EqualValues(tx.Size(), tx.Weight(transaction.WeightSizeBytes), "size weight should be preserved")
+	}
+
+	// Total custom weight is now 0+3+6+9 = 18 which exceeds the limit of 10.
+	batch := pool.GetBatch(false)
+	require.NotNil(batch, "weight limit should be reached after recomputing weights")
+	var batchWeight uint64
+	for _, tx := range batch {
+		batchWeight += tx.Weight("custom_weight")
+	}
+	require.LessOrEqual(batchWeight, uint64(10), "batch should respect recomputed weights")
+
+	// Reverting the weights should restore the original totals.
+	pool.RecomputeWeights(func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64 {
+		return map[transaction.Weight]uint64{
+			"custom_weight": 1,
+		}
+	})
+	require.EqualValues(4, pool.Size(), "no transactions should be removed")
+	require.Nil(pool.GetBatch(false), "no weight limit should be reached")
+
+	pool.RemoveBatch([]hash.Hash{
+		hash.NewFromBytes([]byte("hello world 0")),
+		hash.NewFromBytes([]byte("hello world 1")),
+		hash.NewFromBytes([]byte("hello world 2")),
+		hash.NewFromBytes([]byte("hello world 3")),
+	})
+	require.EqualValues(0, pool.Size(), "pool should be empty")
+}
+
+func testBatchStale(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     3,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		err := pool.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil))
+		require.NoError(err, "Add")
+	}
+
+	batch := pool.GetBatch(true)
+	require.Len(batch, 3, "batch should be limited by count")
+	seq := pool.BatchSeq()
+	require.False(pool.BatchStale(seq), "batch should not be stale")
+
+	// Adding a transaction with a priority lower than the batch minimum should not make the batch
+	// stale.
+	err := pool.Add(transaction.NewCheckedTransaction([]byte("low priority"), 5, nil))
+	require.NoError(err, "Add")
+	require.False(pool.BatchStale(seq), "batch should not be stale after adding a lower priority tx")
+
+	// Adding a transaction with a priority higher than the batch minimum should make it stale.
+	err = pool.Add(transaction.NewCheckedTransaction([]byte("high priority"), 13, nil))
+	require.NoError(err, "Add")
+	require.True(pool.BatchStale(seq), "batch should be stale after adding a higher priority tx")
+
+	// Removing the higher priority transaction should make the batch fresh again.
+	pool.RemoveBatch([]hash.Hash{hash.NewFromBytes([]byte("high priority"))})
+	require.False(pool.BatchStale(seq), "batch should not be stale after removing the higher priority tx")
+
+	// Producing a new batch should make the previous one stale.
+	_ = pool.GetBatch(true)
+	require.NotEqual(seq, pool.BatchSeq(), "batch sequence number should change")
+	require.True(pool.BatchStale(seq), "superseded batch should be stale")
+	require.False(pool.BatchStale(pool.BatchSeq()), "new batch should not be stale")
+}
+
+func testDeterministicBatch(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	initialCfg := api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:             20,
+			transaction.WeightSizeBytes:         1000,
+			transaction.WeightConsensusMessages: 20,
+			"custom_weight":                     20,
+		},
+	}
+	cfg := api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:             4,
+			transaction.WeightSizeBytes:         100,
+			transaction.WeightConsensusMessages: 5,
+			"custom_weight":                     5,
+		},
+	}
+
+	// Prepare a set of transactions with various weights, some of which do not fit the updated
+	// weight limits.
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 20; i++ {
+		txs = append(txs, transaction.NewCheckedTransaction(
+			[]byte(fmt.Sprintf("hello world %d", i)),
+			uint64(rng.Intn(5)),
+			map[transaction.Weight]uint64{
+				transaction.WeightConsensusMessages: uint64(rng.Intn(7)),
+				"custom_weight":                     uint64(rng.Intn(7)),
+			},
+		))
+	}
+
+	// Record the batch produced after the weight limits change.
+	pool.Clear()
+	pool.UpdateConfig(initialCfg)
+	for _, tx := range txs {
+		require.NoError(pool.Add(tx), "Add")
+	}
+	pool.UpdateConfig(cfg)
+	expected := pool.GetBatch(true)
+	require.NotEmpty(expected, "batch should not be empty")
+
+	// Restore the pool from the snapshot in different orders and make sure the batch is identical.
+	for i := 0; i < 10; i++ {
+		pool.Clear()
+		pool.UpdateConfig(cfg)
+		for _, idx := range rng.Perm(len(txs)) {
+			// Transactions that do not fit the weight limits are rejected.
+			_ = pool.Add(txs[idx])
+		}
+
+		batch := pool.GetBatch(true)
+		require.Len(batch, len(expected), "restored pool should produce a batch of the same size")
+		for j := range expected {
+			require.EqualValues(expected[j].Hash(), batch[j].Hash(), "restored pool should produce an identical batch")
+		}
+	}
+}
+
+func testExplainEligibility(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	report := pool.ExplainEligibility(hash.NewFromBytes([]byte("missing")))
+	require.False(report.Queued, "missing transaction should not be queued")
+
+	tx1 := transaction.NewCheckedTransaction([]byte("hello world 1 (a much larger transaction)"), 30, nil)
+	require.NoError(pool.Add(tx1), "Add")
+
+	// Pool does not contain enough transactions for a batch yet.
+	report = pool.ExplainEligibility(tx1.Hash())
+	require.True(report.Queued, "transaction should be queued")
+	require.True(report.FitsLimits, "transaction should fit limits")
+	require.EqualValues(1, report.Rank, "transaction rank")
+	require.False(report.Selected, "transaction should not be selected")
+	require.Equal(api.EligibilityBlockerBelowThreshold, report.Blocker, "transaction should be below threshold")
+
+	tx2 := transaction.NewCheckedTransaction([]byte("hello world 2"), 20, nil)
+	tx3 := transaction.NewCheckedTransaction([]byte("hello world 3"), 10, nil)
+	require.NoError(pool.Add(tx2), "Add")
+	require.NoError(pool.Add(tx3), "Add")
+
+	report = pool.ExplainEligibility(tx2.Hash())
+	require.EqualValues(2, report.Rank, "transaction rank")
+	require.True(report.Selected, "transaction should be selected")
+	require.Equal(api.EligibilityBlockerNone, report.Blocker, "transaction should not be blocked")
+
+	report = pool.ExplainEligibility(tx3.Hash())
+	require.EqualValues(3, report.Rank, "transaction rank")
+	require.True(report.FitsLimits, "transaction should fit limits")
+	require.False(report.Selected, "transaction should not be selected")
+	require.Equal(api.EligibilityBlockerBatchFull, report.Blocker, "transaction should be behind a full batch")
+	require.Equal(transaction.WeightCount, report.BlockingWeight, "blocking weight")
+
+	// Lowering the size limit makes the first transaction too large.
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 50,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: uint64(len(tx2.Raw()) + len(tx3.Raw())),
+		},
+	})
+	report = pool.ExplainEligibility(tx1.Hash())
+	require.False(report.FitsLimits, "transaction should not fit limits")
+	require.Equal(api.EligibilityBlockerTooLarge, report.Blocker, "transaction should be too large")
+	require.Equal(transaction.WeightSizeBytes, report.BlockingWeight, "blocking weight")
+	require.True(pool.IsQueued(tx1.Hash()), "ExplainEligibility should not modify the pool")
+
+	// Results should match GetBatch.
+	for _, tx := range []*transaction.CheckedTransaction{tx2, tx3} {
+		report = pool.ExplainEligibility(tx.Hash())
+		require.True(report.Selected, "transaction should be selected")
+	}
+	batch := pool.GetBatch(false)
+	require.EqualValues([]*transaction.CheckedTransaction{tx2, tx3}, batch, "batch should match eligibility reports")
+}
+
+func testFeeMarketState(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	state := pool.FeeMarketState()
+	require.EqualValues(0, state.LastBatchMinPriority, "last batch minimum priority of empty pool")
+	require.EqualValues(0, state.PoolFillRatio, "fill ratio of empty pool")
+	require.EqualValues(0, state.LowestPriority, "lowest priority of empty pool")
+
+	for i := 0; i < 5; i++ {
+		err := pool.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil))
+		require.NoError(err, "Add")
+	}
+
+	state = pool.FeeMarketState()
+	require.EqualValues(0, state.LastBatchMinPriority, "last batch minimum priority before any batch")
+	require.EqualValues(0.5, state.PoolFillRatio, "fill ratio")
+	require.EqualValues(10, state.LowestPriority, "lowest priority")
+
+	batch := pool.GetBatch(false)
+	require.Len(batch, 2, "batch should be limited by count")
+
+	state = pool.FeeMarketState()
+	require.EqualValues(13, state.LastBatchMinPriority, "last batch minimum priority")
+
+	hashes := make([]hash.Hash, 0, len(batch))
+	for _, tx := range batch {
+		hashes = append(hashes, tx.Hash())
+	}
+	pool.RemoveBatch(hashes)
+
+	state = pool.FeeMarketState()
+	require.EqualValues(13, state.LastBatchMinPriority, "last batch minimum priority after removal")
+	require.EqualValues(0.3, state.PoolFillRatio, "fill ratio after removal")
+	require.EqualValues(10, state.LowestPriority, "lowest priority after removal")
+}
+
+func testPinning(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 3,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 3; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil)
+		require.NoError(pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+
+	// Pinning a transaction that is not queued should have no effect.
+	pool.Pin(hash.NewFromBytes([]byte("missing")))
+
+	// Pin the lowest priority transaction.
+	pool.Pin(txs[0].Hash())
+
+	// Adding a higher priority transaction to a full pool should evict the lowest priority
+	// transaction that is not pinned.
+	tx := transaction.NewCheckedTransaction([]byte("high priority"), 20, nil)
+	require.NoError(pool.Add(tx), "Add")
+	require.True(pool.IsQueued(txs[0].Hash()), "pinned transaction should not be evicted")
+	require.False(pool.IsQueued(txs[1].Hash()), "lowest priority unpinned transaction should be evicted")
+	require.True(pool.IsQueued(txs[2].Hash()), "higher priority transaction should remain queued")
+
+	// Pinned transactions should be placed first in the batch and count against weight limits.
+	batch := pool.GetBatch(true)
+	require.EqualValues([]*transaction.CheckedTransaction{txs[0], tx}, batch, "pinned transaction should be placed first")
+
+	// Pinned transactions should survive clearing.
+	pool.Clear()
+	require.EqualValues(1, pool.Size(), "pinned transaction should survive Clear")
+	require.True(pool.IsQueued(txs[0].Hash()), "pinned transaction should survive Clear")
+
+	// Unpinned transactions should no longer survive clearing.
+	pool.Unpin(txs[0].Hash())
+	pool.Clear()
+	require.EqualValues(0, pool.Size(), "unpinned transaction should not survive Clear")
+
+	// Removing a pinned transaction should release the pin.
+	require.NoError(pool.Add(txs[0]), "Add")
+	pool.Pin(txs[0].Hash())
+	pool.RemoveBatch([]hash.Hash{txs[0].Hash()})
+	pool.Clear()
+	require.EqualValues(0, pool.Size(), "removed transaction should not be pinned")
+}
+
+func testTransition(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 5; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil)
+		require.NoError(pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+	pool.Pin(txs[0].Hash())
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	large := transaction.NewCheckedTransaction([]byte("transformed transaction that is too large"), 30, nil)
+	transformed := transaction.NewCheckedTransaction([]byte("transformed"), 20, nil)
+	pool.Transition(api.Config{
+		MaxPoolSize: 3,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 20,
+		},
+	}, func(current []*transaction.CheckedTransaction) []*transaction.CheckedTransaction {
+		require.Len(current, 5, "migration should see all transactions")
+		for i, tx := range current {
+			require.EqualValues(14-i, tx.Priority(), "migration should see transactions in priority order")
+		}
+
+		// Drop the highest priority transaction and add transformed ones.
+		return append(current[1:], transformed, large)
+	})
+
+	require.EqualValues(3, pool.Size(), "pool should be limited to the new size")
+	require.True(pool.IsQueued(txs[0].Hash()), "pinned transaction should be retained")
+	require.True(pool.IsQueued(transformed.Hash()), "transformed transaction should be queued")
+	require.True(pool.IsQueued(txs[3].Hash()), "highest priority transaction should be retained")
+	require.False(pool.IsQueued(txs[4].Hash()), "dropped transaction should not be queued")
+	require.False(pool.IsQueued(large.Hash()), "transaction exceeding new limits should not be queued")
+	require.EqualValues([]*transaction.CheckedTransaction{transformed}, obs.queued, "new transactions should be reported as queued")
+	require.Len(obs.evicted, 3, "removed transactions should be reported as evicted")
+
+	// Pin should survive the transition.
+	pool.Clear()
+	require.EqualValues(1, pool.Size(), "pinned transaction should survive Clear after transition")
+
+	pool.Unpin(txs[0].Hash())
+	pool.Clear()
+}
+
+func testEmptyWeightLimits(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 2 * api.DefaultWeightCountLimit,
+	})
+
+	for i := 0; i < api.DefaultWeightCountLimit-1; i++ {
+		err := pool.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), 10, nil))
+		require.NoError(err, "Add")
+	}
+	require.Empty(pool.GetBatch(false), "batch should not be ready below the default count limit")
+
+	for i := api.DefaultWeightCountLimit - 1; i < api.DefaultWeightCountLimit+10; i++ {
+		err := pool.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), 10, nil))
+		require.NoError(err, "Add")
+	}
+	batch := pool.GetBatch(false)
+	require.Len(batch, api.DefaultWeightCountLimit, "batch should be limited by the default count limit")
+
+	// Explicitly configured count limits should be respected.
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 2 * api.DefaultWeightCountLimit,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightSizeBytes: 1_000_000,
+			transaction.WeightCount:     5,
+		},
+	})
+	require.Len(pool.GetBatch(false), 5, "batch should be limited by the configured count limit")
+
+	pool.Clear()
+}
+
+func testOverflow(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	cfg := api.Config{
+		MaxPoolSize:     2,
+		MaxOverflowSize: 2,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+		},
+	}
+	pool.UpdateConfig(cfg)
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 4; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10-2*i), nil)
+		require.NoError(pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+	require.EqualValues(2, pool.Size(), "overflow transactions should not count towards pool size")
+	for _, tx := range txs {
+		require.True(pool.IsQueued(tx.Hash()), "transaction should be queued or held")
+	}
+	require.ErrorIs(pool.Add(txs[3]), api.ErrTxExists, "held transaction should be a duplicate")
+
+	// A full overflow queue should only accept transactions evicting lower priority ones.
+	err := pool.Add(transaction.NewCheckedTransaction([]byte("low priority"), 1, nil))
+	require.ErrorIs(err, api.ErrPoolFull, "Add should fail when overflow queue is full")
+	held := transaction.NewCheckedTransaction([]byte("held"), 7, nil)
+	require.NoError(pool.Add(held), "Add")
+	require.False(pool.IsQueued(txs[3].Hash()), "lowest priority held transaction should be evicted")
+
+	// Held transactions should never be part of a batch.
+	batch := pool.GetBatch(true)
+	require.EqualValues(txs[:2], batch, "only pooled transactions should be in the batch")
+
+	// Removing transactions should promote held transactions in priority order.
+	pool.RemoveBatch([]hash.Hash{txs[0].Hash()})
+	require.EqualValues(2, pool.Size(), "held transaction should be promoted")
+	batch = pool.GetBatch(true)
+	require.EqualValues([]*transaction.CheckedTransaction{txs[1], held}, batch, "highest priority held transaction should be promoted")
+
+	// Disabling the overflow queue should drop held transactions.
+	cfg.MaxOverflowSize = 0
+	pool.UpdateConfig(cfg)
+	require.False(pool.IsQueued(txs[2].Hash()), "held transaction should be dropped")
+	err = pool.Add(transaction.NewCheckedTransaction([]byte("low priority"), 1, nil))
+	require.ErrorIs(err, api.ErrPoolFull, "Add should fail when overflow queue is disabled")
+
+	pool.Clear()
+}
+
+func testSenderLimit(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	cfg := api.Config{
+		MaxPoolSize:  10,
+		MaxSenderTxs: 2,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+		},
+	}
+	pool.UpdateConfig(cfg)
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 2; i++ {
+		tx := transaction.NewCheckedTransactionWithSender([]byte(fmt.Sprintf("hello world %d", i)), uint64(10+i), nil, "alice", uint64(i))
+		require.NoError(pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+
+	// Other senders and transactions without a sender should not be affected.
+	require.NoError(pool.Add(transaction.NewCheckedTransactionWithSender([]byte("bob"), 1, nil, "bob", 0)), "Add")
+	for i := 0; i < 3; i++ {
+		require.NoError(pool.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("anonymous %d", i)), 1, nil)), "Add")
+	}
+
+	// A lower priority transaction from a sender at its limit should be rejected.
+	err := pool.Add(transaction.NewCheckedTransactionWithSender([]byte("low priority"), 5, nil, "alice", 2))
+	require.ErrorIs(err, api.ErrSenderLimit, "Add should fail when sender limit is reached")
+
+	// A higher priority transaction should evict the sender's lowest priority transaction.
+	tx := transaction.NewCheckedTransactionWithSender([]byte("high priority"), 20, nil, "alice", 3)
+	require.NoError(pool.Add(tx), "Add")
+	require.False(pool.IsQueued(txs[0].Hash()), "sender's lowest priority transaction should be evicted")
+	require.True(pool.IsQueued(txs[1].Hash()), "sender's other transaction should remain queued")
+	require.EqualValues(6, pool.Size(), "pool size")
+
+	// Pinned transactions should not be evicted.
+	pool.Pin(txs[1].Hash())
+	pool.Pin(tx.Hash())
+	err = pool.Add(transaction.NewCheckedTransactionWithSender([]byte("even higher priority"), 30, nil, "alice", 4))
+	require.ErrorIs(err, api.ErrSenderLimit, "Add should fail when all sender transactions are pinned")
+	pool.Unpin(txs[1].Hash())
+	pool.Unpin(tx.Hash())
+
+	// Removing a transaction should make room for the sender.
+	pool.RemoveBatch([]hash.Hash{txs[1].Hash()})
+	require.NoError(pool.Add(transaction.NewCheckedTransactionWithSender([]byte("low priority"), 5, nil, "alice", 5)), "Add")
+
+	// Weight recomputation should preserve the sender.
+	pool.RecomputeWeights(func(tx *transaction.CheckedTransaction) map[transaction.Weight]uint64 {
+		return nil
+	})
+	err = pool.Add(transaction.NewCheckedTransactionWithSender([]byte("another low priority"), 5, nil, "alice", 6))
+	require.ErrorIs(err, api.ErrSenderLimit, "sender limit should be enforced after weight recomputation")
+
+	// Disabling the limit should accept further transactions.
+	cfg.MaxSenderTxs = 0
+	pool.UpdateConfig(cfg)
+	require.NoError(pool.Add(transaction.NewCheckedTransactionWithSender([]byte("another low priority"), 5, nil, "alice", 7)), "Add")
+
+	pool.Clear()
+}
+
+func testExpireOldTransactions(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize:     3,
+		MaxOverflowSize: 1,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	var txs []*transaction.CheckedTransaction
+	for i := 0; i < 4; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello world %d", i)), uint64(10-i), nil)
+		require.NoError(pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+	pool.Pin(txs[0].Hash())
+
+	require.Empty(pool.ExpireOldTransactions(time.Hour), "no transactions should expire")
+
+	time.Sleep(50 * time.Millisecond)
+	pool.RemoveBatch([]hash.Hash{txs[2].Hash()})
+	fresh := transaction.NewCheckedTransaction([]byte("fresh"), 1, nil)
+	require.NoError(pool.Add(fresh), "Add")
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	// The promoted overflow transaction should retain its original age.
+	expired := pool.ExpireOldTransactions(25 * time.Millisecond)
+	require.ElementsMatch([]hash.Hash{txs[1].Hash(), txs[3].Hash()}, expired, "old unpinned transactions should expire")
+	require.ElementsMatch([]*transaction.CheckedTransaction{txs[1], txs[3]}, obs.expired, "expired transactions should be reported")
+	require.True(pool.IsQueued(txs[0].Hash()), "pinned transaction should not expire")
+	require.True(pool.IsQueued(fresh.Hash()), "fresh transaction should not expire")
+	require.EqualValues(2, pool.Size(), "pool size")
+
+	pool.Unpin(txs[0].Hash())
+	pool.Clear()
+}
+
+func testReplaceByFee(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	cfg := api.Config{
+		MaxPoolSize:  2,
+		ReplaceByFee: true,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+		},
+	}
+	pool.UpdateConfig(cfg)
+
+	txA := transaction.NewCheckedTransactionWithSender([]byte("alice 1"), 10, nil, "alice", 1)
+	txB := transaction.NewCheckedTransactionWithSender([]byte("bob 1"), 5, nil, "bob", 1)
+	require.NoError(pool.Add(txA), "Add")
+	require.NoError(pool.Add(txB), "Add")
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	// Replacements need a strictly higher priority.
+	err := pool.Add(transaction.NewCheckedTransactionWithSender([]byte("alice 1 again"), 10, nil, "alice", 1))
+	require.ErrorIs(err, api.ErrReplacementUnderpriced, "replacement with equal priority should fail")
+
+	// Replacements should succeed even when the pool is full.
+	txA2 := transaction.NewCheckedTransactionWithSender([]byte("alice 1 replacement"), 20, nil, "alice", 1)
+	require.NoError(pool.Add(txA2), "Add")
+	require.False(pool.IsQueued(txA.Hash()), "replaced transaction should be removed")
+	require.True(pool.IsQueued(txA2.Hash()), "replacement transaction should be queued")
+	require.EqualValues(2, pool.Size(), "pool size")
+	require.EqualValues([][2]*transaction.CheckedTransaction{{txA, txA2}}, obs.replaced, "replacement should be reported")
+	require.Empty(obs.evicted, "no transactions should be evicted")
+	require.EqualValues([]*transaction.CheckedTransaction{txA2, txB}, pool.GetBatch(true), "batch should contain the replacement")
+
+	// Pinned transactions should not be replaced.
+	pool.Pin(txB.Hash())
+	err = pool.Add(transaction.NewCheckedTransactionWithSender([]byte("bob 1 replacement"), 50, nil, "bob", 1))
+	require.ErrorIs(err, api.ErrReplacementUnderpriced, "pinned transaction should not be replaced")
+	pool.Unpin(txB.Hash())
+
+	// Without replace-by-fee, transactions with the same replacement key should coexist.
+	cfg.MaxPoolSize = 10
+	cfg.ReplaceByFee = false
+	pool.UpdateConfig(cfg)
+	txB2 := transaction.NewCheckedTransactionWithSender([]byte("bob 1 replacement"), 50, nil, "bob", 1)
+	require.NoError(pool.Add(txB2), "Add")
+	require.True(pool.IsQueued(txB.Hash()), "original transaction should remain queued")
+	require.True(pool.IsQueued(txB2.Hash()), "new transaction should be queued")
+
+	pool.Clear()
+}
+
+func testPeekBatch(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	cfg := api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     3,
+			transaction.WeightSizeBytes: 100,
+		},
+	}
+	pool.UpdateConfig(cfg)
+
+	small := transaction.NewCheckedTransaction([]byte("small"), 10, nil)
+	large := transaction.NewCheckedTransaction([]byte("larger transaction"), 20, nil)
+	require.NoError(pool.Add(small), "Add")
+	require.NoError(pool.Add(large), "Add")
+
+	require.Empty(pool.PeekBatch(false), "PeekBatch should be empty if no batch is available")
+	require.EqualValues([]*transaction.CheckedTransaction{large, small}, pool.PeekBatch(true), "PeekBatch")
+
+	// Lower the size limit so that the large transaction no longer fits.
+	cfg.WeightLimits[transaction.WeightSizeBytes] = 10
+	pool.UpdateConfig(cfg)
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	batchSeq := pool.BatchSeq()
+	peeked := pool.PeekBatch(true)
+	require.EqualValues([]*transaction.CheckedTransaction{small}, peeked, "PeekBatch should skip oversized transactions")
+	require.EqualValues(2, pool.Size(), "PeekBatch should not remove oversized transactions")
+	require.EqualValues(batchSeq, pool.BatchSeq(), "PeekBatch should not update the batch sequence number")
+	require.Empty(obs.selected, "PeekBatch should not notify the observer")
+	require.Empty(obs.evicted, "PeekBatch should not notify the observer")
+
+	// GetBatch should return the same selection and remove oversized transactions.
+	require.EqualValues(peeked, pool.GetBatch(true), "GetBatch should match PeekBatch")
+	require.EqualValues(1, pool.Size(), "GetBatch should remove oversized transactions")
+	require.EqualValues([]*transaction.CheckedTransaction{large}, obs.evicted, "evicted transactions")
+
+	pool.Clear()
+}
+
+func testEstimateBatchWeights(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	cfg := api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     3,
+			transaction.WeightSizeBytes: 100,
+		},
+	}
+	pool.UpdateConfig(cfg)
+
+	small := transaction.NewCheckedTransaction([]byte("small"), 10, map[transaction.Weight]uint64{"custom": 2})
+	large := transaction.NewCheckedTransaction([]byte("larger transaction"), 20, map[transaction.Weight]uint64{"custom": 3})
+	require.NoError(pool.Add(small), "Add")
+	require.NoError(pool.Add(large), "Add")
+
+	require.Empty(pool.EstimateBatchWeights(false), "EstimateBatchWeights should be empty if no batch is available")
+	require.EqualValues(map[transaction.Weight]uint64{
+		transaction.WeightCount:     2,
+		transaction.WeightSizeBytes: small.Size() + large.Size(),
+		"custom":                    5,
+	}, pool.EstimateBatchWeights(true), "EstimateBatchWeights")
+
+	// Lower the size limit so that the large transaction no longer fits.
+	cfg.WeightLimits[transaction.WeightSizeBytes] = 10
+	pool.UpdateConfig(cfg)
+
+	batchSeq := pool.BatchSeq()
+	require.EqualValues(map[transaction.Weight]uint64{
+		transaction.WeightCount:     1,
+		transaction.WeightSizeBytes: small.Size(),
+		"custom":                    2,
+	}, pool.EstimateBatchWeights(true), "EstimateBatchWeights should skip oversized transactions")
+	require.EqualValues(2, pool.Size(), "EstimateBatchWeights should not remove oversized transactions")
+	require.EqualValues(batchSeq, pool.BatchSeq(), "EstimateBatchWeights should not update the batch sequence number")
+
+	pool.Clear()
+}
+
+func testAddErrors(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 1,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightSizeBytes: 10,
+		},
+	})
+
+	tx := transaction.NewCheckedTransaction([]byte("hello"), 10, nil)
+	require.NoError(pool.Add(tx), "Add")
+
+	// Duplicate transactions.
+	err := pool.Add(tx)
+	require.ErrorIs(err, api.ErrTxExists, "Add should fail for duplicate transactions")
+	require.NotErrorIs(err, api.ErrTxTooLarge, "duplicate transaction error should not match other errors")
+	require.NotErrorIs(err, api.ErrPoolFull, "duplicate transaction error should not match other errors")
+	require.True(p2pError.IsPermanent(err), "duplicate transaction error should be permanent")
+
+	// Too large transactions.
+	err = pool.Add(transaction.NewCheckedTransaction([]byte("transaction that is too large"), 20, nil))
+	require.ErrorIs(err, api.ErrTxTooLarge, "Add should fail for too large transactions")
+	require.NotErrorIs(err, api.ErrTxExists, "too large transaction error should not match other errors")
+	require.True(p2pError.IsPermanent(err), "too large transaction error should be permanent")
+
+	// Full pool.
+	err = pool.Add(transaction.NewCheckedTransaction([]byte("world"), 1, nil))
+	require.ErrorIs(err, api.ErrPoolFull, "Add should fail when the pool is full")
+	require.NotErrorIs(err, api.ErrTxExists, "full pool error should not match other errors")
+	require.False(p2pError.IsPermanent(err), "full pool error should be retryable")
+
+	pool.Clear()
+}
+
+func testAddBatch(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 3,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightSizeBytes: 10,
+		},
+	})
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	tx1 := transaction.NewCheckedTransaction([]byte("hello 1"), 1, nil)
+	tx2 := transaction.NewCheckedTransaction([]byte("hello 2"), 2, nil)
+	tx3 := transaction.NewCheckedTransaction([]byte("hello 3"), 3, nil)
+	tx4 := transaction.NewCheckedTransaction([]byte("hello 4"), 4, nil)
+	tooLarge := transaction.NewCheckedTransaction([]byte("transaction that is too large"), 5, nil)
+
+	errs := pool.AddBatch([]*transaction.CheckedTransaction{tx1, tx2, tx2, tooLarge, tx3, tx4})
+	require.Len(errs, 6, "AddBatch should return an error for each transaction")
+	require.NoError(errs[0], "AddBatch")
+	require.NoError(errs[1], "AddBatch")
+	require.ErrorIs(errs[2], api.ErrTxExists, "AddBatch should fail for duplicate transactions")
+	require.ErrorIs(errs[3], api.ErrTxTooLarge, "AddBatch should fail for too large transactions")
+	require.NoError(errs[4], "AddBatch")
+	require.NoError(errs[5], "AddBatch should evict lower priority transactions")
+
+	require.EqualValues(3, pool.Size(), "pool size")
+	require.False(pool.IsQueued(tx1.Hash()), "lowest priority transaction should be evicted")
+	require.EqualValues([]*transaction.CheckedTransaction{tx1, tx2, tx3, tx4}, obs.queued, "queued transactions")
+	require.EqualValues([]*transaction.CheckedTransaction{tx1}, obs.evicted, "evicted transactions")
+	require.EqualValues([]*transaction.CheckedTransaction{tx4, tx3, tx2}, pool.GetPrioritizedBatch(nil, 10), "GetPrioritizedBatch")
+
+	require.Empty(pool.AddBatch(nil), "AddBatch with no transactions")
+
+	pool.Clear()
+}
+
+func testMinPriority(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+	defer pool.UpdateMinPriority(0)
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize:     2,
+		MaxOverflowSize: 2,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+
+	obs := &recordingObserver{pool: pool}
+	pool.SetLifecycleObserver(obs)
+	defer pool.SetLifecycleObserver(nil)
+
+	tx1 := transaction.NewCheckedTransaction([]byte("hello 1"), 1, nil)
+	tx2 := transaction.NewCheckedTransaction([]byte("hello 2"), 2, nil)
+	tx3 := transaction.NewCheckedTransaction([]byte("hello 3"), 3, nil)
+	require.NoError(pool.Add(tx2), "Add")
+	require.NoError(pool.Add(tx3), "Add")
+	require.NoError(pool.Add(tx1), "Add should hold the transaction in the overflow queue")
+
+	// Raising the minimum priority should evict held transactions below it, but keep queued ones.
+	pool.UpdateMinPriority(5)
+	require.EqualValues([]*transaction.CheckedTransaction{tx1}, obs.evicted, "held transactions below the minimum should be evicted")
+	require.True(pool.IsQueued(tx2.Hash()), "queued transactions should not be affected")
+	require.True(pool.IsQueued(tx3.Hash()), "queued transactions should not be affected")
+	require.EqualValues(5, pool.FeeMarketState().MinPriority, "FeeMarketState should report the minimum priority")
+
+	// Transactions below the minimum should be rejected even if they could evict a queued one.
+	err := pool.Add(transaction.NewCheckedTransaction([]byte("hello 4"), 4, nil))
+	require.ErrorIs(err, api.ErrTxTooCheap, "Add should fail for transactions below the minimum priority")
+	require.False(p2pError.IsPermanent(err), "too cheap transaction error should be retryable")
+	require.EqualValues(2, pool.Size(), "no transactions should be evicted")
+	require.Len(obs.evicted, 1, "no transactions should be evicted")
+
+	// Transactions at the minimum should go through the regular eviction path.
+	tx5 := transaction.NewCheckedTransaction([]byte("hello 5"), 5, nil)
+	require.NoError(pool.Add(tx5), "Add")
+	require.EqualValues([]*transaction.CheckedTransaction{tx1, tx2}, obs.evicted, "lowest priority transaction should be evicted")
+
+	// Lowering the minimum priority should accept cheaper transactions again.
+	pool.UpdateMinPriority(0)
+	require.NoError(pool.Add(tx1), "Add should succeed after lowering the minimum priority")
+
+	pool.Clear()
+}
+
+func testGetBatchWithLimits(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+	limits := pool.WeightLimits()
+
+	tx1 := transaction.NewCheckedTransaction([]byte("hello 1"), 1, nil)
+	tx2 := transaction.NewCheckedTransaction([]byte("hello 2"), 2, nil)
+	tx3 := transaction.NewCheckedTransaction([]byte("hello world 3"), 3, nil)
+	for _, tx := range []*transaction.CheckedTransaction{tx1, tx2, tx3} {
+		require.NoError(pool.Add(tx), "Add")
+	}
+
+	batch := pool.GetBatchWithLimits(true, map[transaction.Weight]uint64{
+		transaction.WeightCount: 2,
+	})
+	require.EqualValues([]*transaction.CheckedTransaction{tx3, tx2}, batch, "batch should respect the count budget")
+
+	// Transactions exceeding the budget but not the configured limits should not be removed.
+	batch = pool.GetBatchWithLimits(true, map[transaction.Weight]uint64{
+		transaction.WeightSizeBytes: 10,
+	})
+	require.EqualValues([]*transaction.CheckedTransaction{tx2}, batch, "batch should respect the size budget")
+	require.EqualValues(3, pool.Size(), "transactions exceeding the budget should remain queued")
+
+	// The budget should never exceed the configured limits.
+	batch = pool.GetBatchWithLimits(true, map[transaction.Weight]uint64{
+		transaction.WeightCount: 100,
+	})
+	require.Len(batch, 3, "batch should contain all transactions")
+	require.EqualValues(limits, pool.WeightLimits(), "configured weight limits should not change")
+
+	pool.Clear()
+}
+
+func testWatch(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 1,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightSizeBytes: 10,
+		},
+	})
+
+	addedCh, addedSub := pool.WatchAdded()
+	defer addedSub.Close()
+	removedCh, removedSub := pool.WatchRemoved()
+	defer removedSub.Close()
+
+	// Events of earlier tests may still be delivered to new subscribers, so events about other
+	// transactions are skipped.
+	requireAdded := func(expected *transaction.CheckedTransaction) {
+		for {
+			select {
+			case tx := <-addedCh:
+				if tx.Hash() == expected.Hash() {
+					return
+				}
+			case <-time.After(recvTimeout):
+				require.FailNow("failed to receive added transaction")
+			}
+		}
+	}
+	requireRemoved := func(expected *transaction.CheckedTransaction) {
+		for {
+			select {
+			case h := <-removedCh:
+				if h == expected.Hash() {
+					return
+				}
+			case <-time.After(recvTimeout):
+				require.FailNow("failed to receive removed transaction")
+			}
+		}
+	}
+
+	tx1 := transaction.NewCheckedTransaction([]byte("watch 1"), 1, nil)
+	tx2 := transaction.NewCheckedTransaction([]byte("watch 2"), 2, nil)
+
+	require.NoError(pool.Add(tx1), "Add")
+	requireAdded(tx1)
+
+	// Evictions should be reported as removals.
+	require.NoError(pool.Add(tx2), "Add")
+	requireRemoved(tx1)
+	requireAdded(tx2)
+
+	pool.RemoveBatch([]hash.Hash{tx2.Hash()})
+	requireRemoved(tx2)
+
+	// Rejected transactions should not be reported.
+	tooLarge := transaction.NewCheckedTransaction([]byte("transaction that is too large"), 3, nil)
+	require.Error(pool.Add(tooLarge), "Add")
+	tx3 := transaction.NewCheckedTransaction([]byte("watch 3"), 3, nil)
+	require.NoError(pool.Add(tx3), "Add")
+	select {
+	case tx := <-addedCh:
+		require.EqualValues(tx3, tx, "rejected transactions should not be reported")
+	case <-time.After(recvTimeout):
+		require.FailNow("failed to receive added transaction")
+	}
+
+	pool.Clear()
+}
+
+func testIterateDescending(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 10,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     1,
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+
+	var txs []*transaction.CheckedTransaction
+	for i := 5; i > 0; i-- {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello %d", i)), uint64(i), nil)
+		require.NoError(pool.Add(tx), "Add")
+		txs = append(txs, tx)
+	}
+
+	iterate := func(offset *hash.Hash, limit int) []*transaction.CheckedTransaction {
+		var result []*transaction.CheckedTransaction
+		pool.IterateDescending(offset, func(tx *transaction.CheckedTransaction) bool {
+			result = append(result, tx)
+			return len(result) < limit
+		})
+		return result
+	}
+
+	require.EqualValues(txs, iterate(nil, 10), "all transactions should be iterated over in descending priority order")
+	require.EqualValues(txs[:2], iterate(nil, 2), "iteration should stop when the callback returns false")
+
+	offset := txs[1].Hash()
+	require.EqualValues(txs[2:], iterate(&offset, 10), "iteration should start after the offset")
+	require.EqualValues(txs[2:4], iterate(&offset, 2), "iteration should start after the offset")
+
+	offset = txs[4].Hash()
+	require.Empty(iterate(&offset, 10), "nothing should follow the last transaction")
+
+	offset = hash.NewFromBytes([]byte("missing"))
+	require.Empty(iterate(&offset, 10), "nothing should be iterated over for a missing offset")
+
+	require.EqualValues(5, pool.Size(), "iteration should not remove transactions")
+
+	pool.Clear()
+}
+
+func testGetTransactionsOrdered(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 20,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     1,
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+
+	// Use some equal priorities so that tie-breaking is exercised as well.
+	for i := 0; i < 10; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello %d", i)), uint64(i%3), nil)
+		require.NoError(pool.Add(tx), "Add")
+	}
+
+	all := pool.GetTransactionsOrdered(nil, 0)
+	require.Len(all, 10, "all transactions should be returned")
+	for i := 1; i < len(all); i++ {
+		require.GreaterOrEqual(all[i-1].Priority(), all[i].Priority(), "transactions should be ordered by priority")
+	}
+	require.EqualValues(all, pool.GetTransactionsOrdered(nil, 0), "repeated calls should return the same order")
+
+	// Paginating should cover every transaction exactly once.
+	var (
+		paged  []*transaction.CheckedTransaction
+		offset *hash.Hash
+	)
+	for {
+		page := pool.GetTransactionsOrdered(offset, 3)
+		require.EqualValues(page, pool.GetTransactionsOrdered(offset, 3), "repeated calls should return the same page")
+		if len(page) == 0 {
+			break
+		}
+		require.LessOrEqual(len(page), 3, "page size should be limited")
+		paged = append(paged, page...)
+		h := page[len(page)-1].Hash()
+		offset = &h
+	}
+	require.EqualValues(all, paged, "pages should cover all transactions in order")
+
+	missing := hash.NewFromBytes([]byte("missing"))
+	require.Empty(pool.GetTransactionsOrdered(&missing, 3), "nothing should be returned for a missing offset")
+	require.EqualValues(10, pool.Size(), "listing should not remove transactions")
+
+	pool.Clear()
+}
+
+func testRemainingCapacity(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 3,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     2,
+			transaction.WeightSizeBytes: 100,
+		},
+	})
+
+	require.EqualValues(3, pool.FreeSlots(), "empty pool should have all slots free")
+	require.EqualValues(map[transaction.Weight]uint64{
+		transaction.WeightCount:     2,
+		transaction.WeightSizeBytes: 100,
+	}, pool.RemainingCapacity(), "empty pool should have full capacity")
+
+	tx := transaction.NewCheckedTransaction([]byte("hello world"), 10, nil)
+	require.NoError(pool.Add(tx), "Add")
+	require.EqualValues(2, pool.FreeSlots(), "FreeSlots should account for the added transaction")
+	remaining := pool.RemainingCapacity()
+	require.EqualValues(1, remaining[transaction.WeightCount], "remaining count capacity")
+	require.EqualValues(100-len(tx.Raw()), remaining[transaction.WeightSizeBytes], "remaining size capacity")
+
+	// Pool weights exceeding the batch weight limits should not underflow.
+	for i := 0; i < 2; i++ {
+		require.NoError(pool.Add(transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello %d", i)), 10, nil)), "Add")
+	}
+	require.EqualValues(0, pool.FreeSlots(), "full pool should have no free slots")
+	require.EqualValues(0, pool.RemainingCapacity()[transaction.WeightCount], "remaining count capacity should be floored at zero")
+
+	pool.Clear()
+}
+
+func testGetKnownBatchOrdered(t *testing.T, pool api.TxPool) {
+	require := require.New(t)
+
+	pool.Clear()
+
+	pool.UpdateConfig(api.Config{
+		MaxPoolSize: 20,
+		WeightLimits: map[transaction.Weight]uint64{
+			transaction.WeightCount:     10,
+			transaction.WeightSizeBytes: 1000,
+		},
+	})
+
+	// Use some equal priorities so that tie-breaking is exercised as well.
+	var batch []hash.Hash
+	for i := 0; i < 6; i++ {
+		tx := transaction.NewCheckedTransaction([]byte(fmt.Sprintf("hello %d", i)), uint64(i%3), nil)
+		require.NoError(pool.Add(tx), "Add")
+		batch = append(batch, tx.Hash())
+	}
+	missingHash := hash.NewFromBytes([]byte("missing"))
+	batch = append(batch[:2], append([]hash.Hash{missingHash}, batch[2:]...)...)
+
+	txs, missing := pool.GetKnownBatchOrdered(batch)
+	require.EqualValues(map[hash.Hash]int{missingHash: 2}, missing, "missing transactions should be reported with their batch index")
+	require.EqualValues(pool.GetTransactionsOrdered(nil, 0), txs, "known transactions should be returned in scheduling order")
+
+	// The caller-supplied order should not matter.
+	for i, j := 0, len(batch)-1; i < j; i, j = i+1, j-1 {
+		batch[i], batch[j] = batch[j], batch[i]
+	}
+	reversed, _ := pool.GetKnownBatchOrdered(batch)
+	require.EqualValues(txs, reversed, "order should not depend on the given batch order")
+
+	pool.Clear()
+}
+
+// TxPoolImplementationBenchmarks runs the tx pool implementation benchmarks.
+func TxPoolImplementationBenchmarks(
+	b *testing.B,
+	pool api.TxPool,
+) {
+	b.Run("BenchmarkTxPool", func(b *testing.B) {
+		benchmarkIncommingQueue(b, pool)
+	})
+}
+
+func benchmarkIncommingQueue(b *testing.B, pool api.TxPool) {
+	values := prepareValues(b)
+
+	batchSize := 10000
+
+	b.Run(fmt.Sprintf("Add:%d", batchSize), func(b *testing.B) {
+		// Exclude preparation.
+		pool.Clear()
+		pool.UpdateConfig(api.Config{
+			MaxPoolSize: 10000000,
+			WeightLimits: map[transaction.Weight]uint64{
+				transaction.WeightCount:     10000000,
+				transaction.WeightSizeBytes: 10000000,
+			},
+		})
+
+		for i := 0; i < b.N; i++ {
+			for _, tx := range values {
+				_ = pool.Add(tx)
+			}
+		}
+	})
+
+	b.Run(fmt.Sprintf("AddBatch:%d", batchSize), func(b *testing.B) {
+		// Exclude preparation.
+		pool.Clear()
+		pool.UpdateConfig(api.Config{
+			MaxPoolSize: 10000000,
+			WeightLimits: map[transaction.Weight]uint64{
+				transaction.WeightCount:     10000000,
+				transaction.WeightSizeBytes: 10000000,
+			},
+		})
+
+		for i := 0; i < b.N; i++ {
+			// Start each iteration with an empty pool as otherwise only duplicate rejection would
+			// be measured after the first iteration.
+			b.StopTimer()
+			pool.Clear()
+			b.StartTimer()
+
+			_ = pool.AddBatch(values)
 		}
 	})
 
@@ -37,10 +37,27 @@ func testScheduleTransactions(t *testing.T, scheduler api.Scheduler) {
 	require.EqualValues(t, 0, scheduler.UnscheduledSize(), "no transactions should be scheduled")
 
 	// Test QueueTx.
+	freeSlots := scheduler.FreeSlots()
 	testTx := transaction.NewCheckedTransaction([]byte("hello world"), 10, make(map[transaction.Weight]uint64))
 	err := scheduler.QueueTx(testTx)
 	require.NoError(t, err, "QueueTx(testTx)")
 	require.True(t, scheduler.IsQueued(testTx.Hash()), "IsQueued(tx)")
+	require.EqualValues(t, freeSlots-1, scheduler.FreeSlots(), "FreeSlots should account for the queued transaction")
+
+	// Test Weights and WeightLimits.
+	weights := scheduler.Weights()
+	require.EqualValues(t, 1, weights[transaction.WeightCount], "pool count weight")
+	require.EqualValues(t, len(testTx.Raw()), weights[transaction.WeightSizeBytes], "pool size weight")
+	weights[transaction.WeightCount] = 42
+	require.EqualValues(t, 1, scheduler.Weights()[transaction.WeightCount], "Weights should return a copy")
+	limits := scheduler.WeightLimits()
+	require.EqualValues(t, 100, limits[transaction.WeightCount], "count weight limit")
+	require.EqualValues(t, 1000, limits[transaction.WeightSizeBytes], "size weight limit")
+	limits[transaction.WeightCount] = 42
+	require.EqualValues(t, 100, scheduler.WeightLimits()[transaction.WeightCount], "WeightLimits should return a copy")
+	remaining := scheduler.RemainingCapacity()
+	require.EqualValues(t, 99, remaining[transaction.WeightCount], "remaining count capacity")
+	require.EqualValues(t, 1000-len(testTx.Raw()), remaining[transaction.WeightSizeBytes], "remaining size capacity")
 
 	// Test GetBatch.
 	batch := scheduler.GetBatch(false)
@@ -4,9 +4,11 @@ package transaction
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
@@ -171,6 +173,32 @@ func (w Weight) IsCustom() bool {
 	}
 }
 
+// TxSource is the source from which a transaction was first obtained.
+type TxSource uint8
+
+const (
+	// TxSourceUnknown is used when the transaction source is not known.
+	TxSourceUnknown TxSource = iota
+	// TxSourceLocal is used for transactions submitted by local clients (e.g., via RPC).
+	TxSourceLocal
+	// TxSourceP2P is used for transactions received via P2P gossip.
+	TxSourceP2P
+)
+
+// String returns a string representation of the transaction source.
+func (s TxSource) String() string {
+	switch s {
+	case TxSourceUnknown:
+		return "unknown"
+	case TxSourceLocal:
+		return "local"
+	case TxSourceP2P:
+		return "p2p"
+	default:
+		return fmt.Sprintf("[unknown transaction source: %d]", uint8(s))
+	}
+}
+
 // CheckedTransaction is a checked transaction to be scheduled.
 type CheckedTransaction struct {
 	// tx represents the raw binary transaction data.
@@ -182,6 +210,17 @@ type CheckedTransaction struct {
 	// weights defines the transaction's runtime specific weights as specified
 	// in the CheckTx response.
 	weights map[Weight]uint64
+	// sender is an opaque identifier of the transaction sender as specified
+	// by the runtime in the CheckTx response.
+	sender string
+	// senderSeq is the per-sender sequence number of the transaction as
+	// specified by the runtime in the CheckTx response.
+	senderSeq uint64
+
+	// firstSeen is the time at which the transaction was first observed.
+	firstSeen time.Time
+	// source is the source from which the transaction was first obtained.
+	source TxSource
 
 	hash hash.Hash
 }
@@ -214,6 +253,21 @@ func NewCheckedTransaction(tx []byte, priority uint64, weights map[Weight]uint64
 	return checkedTx
 }
 
+// NewCheckedTransactionWithSender creates a new CheckedTransactions from the
+// provided bytes, priority, weights, sender identifier and sender sequence number.
+func NewCheckedTransactionWithSender(
+	tx []byte,
+	priority uint64,
+	weights map[Weight]uint64,
+	sender string,
+	senderSeq uint64,
+) *CheckedTransaction {
+	checkedTx := NewCheckedTransaction(tx, priority, weights)
+	checkedTx.sender = sender
+	checkedTx.senderSeq = senderSeq
+	return checkedTx
+}
+
 // Priority returns the transaction priority.
 func (t *CheckedTransaction) Priority() uint64 {
 	return t.priority
@@ -232,6 +286,64 @@ func (t *CheckedTransaction) Weights() map[Weight]uint64 {
 	return t.weights
 }
 
+// Sender returns the opaque identifier of the transaction sender.
+//
+// An empty identifier means that the sender is unknown.
+func (t *CheckedTransaction) Sender() string {
+	return t.sender
+}
+
+// SenderSeq returns the per-sender sequence number of the transaction.
+func (t *CheckedTransaction) SenderSeq() uint64 {
+	return t.senderSeq
+}
+
+// ReplacementKey returns the key identifying transactions that can replace
+// each other, derived from the sender and the sender sequence number.
+//
+// An empty key is returned in case the sender is unknown.
+func (t *CheckedTransaction) ReplacementKey() string {
+	if t.sender == "" {
+		return ""
+	}
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], t.senderSeq)
+	return t.sender + string(seq[:])
+}
+
+// FirstSeen returns the time at which the transaction was first observed.
+//
+// A zero time means that the time is unknown.
+func (t *CheckedTransaction) FirstSeen() time.Time {
+	return t.firstSeen
+}
+
+// Source returns the source from which the transaction was first obtained.
+func (t *CheckedTransaction) Source() TxSource {
+	return t.source
+}
+
+// SetFirstSeen sets the time at which the transaction was first observed and
+// the source from which it was obtained.
+//
+// This should be called when the transaction is checked, before it is shared.
+func (t *CheckedTransaction) SetFirstSeen(firstSeen time.Time, source TxSource) {
+	t.firstSeen = firstSeen
+	t.source = source
+}
+
+// MergeFirstSeen updates the first-seen time and source to the ones of the
+// other transaction in case the other transaction was observed earlier.
+func (t *CheckedTransaction) MergeFirstSeen(other *CheckedTransaction) {
+	if other.firstSeen.IsZero() {
+		return
+	}
+	if t.firstSeen.IsZero() || other.firstSeen.Before(t.firstSeen) {
+		t.firstSeen = other.firstSeen
+		t.source = other.source
+	}
+}
+
 // Hash returns the hash of the transaction binary data.
 func (t *CheckedTransaction) Hash() hash.Hash {
 	return t.hash
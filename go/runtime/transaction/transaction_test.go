@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -264,3 +265,34 @@ func TestIOWriteLogValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckedTransactionFirstSeen(t *testing.T) {
+	require := require.New(t)
+
+	tx := NewCheckedTransaction([]byte("hello world"), 10, nil)
+	require.True(tx.FirstSeen().IsZero(), "first-seen time should be unknown by default")
+	require.Equal(TxSourceUnknown, tx.Source(), "source should be unknown by default")
+
+	now := time.Now()
+	tx.SetFirstSeen(now, TxSourceP2P)
+	require.Equal(now, tx.FirstSeen(), "FirstSeen")
+	require.Equal(TxSourceP2P, tx.Source(), "Source")
+
+	// A later observation should not change the first-seen time.
+	later := NewCheckedTransaction([]byte("hello world"), 10, nil)
+	later.SetFirstSeen(now.Add(time.Minute), TxSourceLocal)
+	tx.MergeFirstSeen(later)
+	require.Equal(now, tx.FirstSeen(), "later observation should be ignored")
+	require.Equal(TxSourceP2P, tx.Source(), "later observation should be ignored")
+
+	// An unknown observation should not change the first-seen time.
+	tx.MergeFirstSeen(NewCheckedTransaction([]byte("hello world"), 10, nil))
+	require.Equal(now, tx.FirstSeen(), "unknown observation should be ignored")
+
+	// An earlier observation should replace the first-seen time.
+	earlier := NewCheckedTransaction([]byte("hello world"), 10, nil)
+	earlier.SetFirstSeen(now.Add(-time.Minute), TxSourceLocal)
+	tx.MergeFirstSeen(earlier)
+	require.Equal(now.Add(-time.Minute), tx.FirstSeen(), "earlier observation should be preserved")
+	require.Equal(TxSourceLocal, tx.Source(), "earlier observation source should be preserved")
+}
@@ -4,10 +4,12 @@ import (
 	"container/list"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
 	"github.com/oasisprotocol/oasis-core/go/runtime/host/protocol"
 	"github.com/oasisprotocol/oasis-core/go/runtime/scheduling/simple/txpool/api"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
 )
 
 type pendingTx struct {
@@ -15,6 +17,8 @@ type pendingTx struct {
 	TxHash   hash.Hash
 	Meta     *TransactionMeta
 	NotifyCh chan *protocol.CheckTxResult
+	// FirstSeen is the time at which the transaction was submitted.
+	FirstSeen time.Time
 
 	element *list.Element
 }
@@ -37,7 +41,7 @@ func (q *checkTxQueue) Add(tx *pendingTx) error {
 
 	// Check if there is room in the queue.
 	if uint64(q.queue.Len()) >= q.maxTxPoolSize {
-		return api.ErrFull
+		return api.ErrPoolFull
 	}
 
 	if err := q.checkTxLocked(tx.Tx, tx.TxHash); err != nil {
@@ -123,7 +127,7 @@ func (q *checkTxQueue) isQueuedLocked(txHash hash.Hash) bool {
 // NOTE: Assumes lock is held.
 func (q *checkTxQueue) checkTxLocked(tx []byte, txHash hash.Hash) error {
 	if q.isQueuedLocked(txHash) {
-		return api.ErrCallAlreadyExists
+		return p2pError.Permanent(api.ErrTxExists)
 	}
 
 	return nil
@@ -4,6 +4,8 @@ import (
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
+
+	schedulingAPI "github.com/oasisprotocol/oasis-core/go/runtime/scheduling/api"
 )
 
 var (
@@ -35,6 +37,33 @@ func (t *txPool) getMetricLabels() prometheus.Labels {
 	}
 }
 
+// registerSchedulerMetrics registers the metrics of the given scheduler in case it supports them.
+func (t *txPool) registerSchedulerMetrics(sched schedulingAPI.Scheduler) {
+	mr, ok := sched.(schedulingAPI.MetricsRegisterer)
+	if !ok {
+		return
+	}
+	if err := mr.RegisterMetrics(prometheus.DefaultRegisterer, t.getMetricLabels()); err != nil {
+		t.logger.Warn("failed to register transaction scheduler metrics",
+			"err", err,
+		)
+	}
+}
+
+// unregisterMetrics removes all metric series of the transaction pool, including the scheduler
+// metrics.
+//
+// NOTE: Assumes scheduler lock is held.
+func (t *txPool) unregisterMetrics() {
+	if mr, ok := t.scheduler.(schedulingAPI.MetricsRegisterer); ok {
+		mr.UnregisterMetrics()
+	}
+
+	labels := t.getMetricLabels()
+	pendingCheckSize.Delete(labels)
+	pendingScheduleSize.Delete(labels)
+}
+
 func initMetrics() {
 	metricsOnce.Do(func() {
 		prometheus.MustRegister(txpoolCollectors...)
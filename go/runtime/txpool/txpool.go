@@ -26,7 +26,14 @@ import (
 
 // Config is the transaction pool configuration.
 type Config struct {
-	MaxPoolSize          uint64
+	MaxPoolSize uint64
+	// MaxOverflowSize is the maximum number of transactions held in the scheduler overflow queue.
+	MaxOverflowSize uint64
+	// MaxSenderTxs is the maximum number of scheduled transactions per sender (zero for no limit).
+	MaxSenderTxs uint64
+	// ReplaceByFee enables replace-by-fee in the scheduler.
+	ReplaceByFee bool
+
 	MaxCheckTxBatchSize  uint64
 	MaxLastSeenCacheSize uint64
 	MaxStaleCacheSize    uint64
@@ -198,6 +205,11 @@ func (t *txPool) Start() error {
 
 func (t *txPool) Stop() {
 	close(t.stopCh)
+
+	t.schedulerLock.Lock()
+	defer t.schedulerLock.Unlock()
+
+	t.unregisterMetrics()
 }
 
 func (t *txPool) Quit() <-chan struct{} {
@@ -236,10 +248,11 @@ func (t *txPool) submitTx(ctx context.Context, rawTx []byte, meta *TransactionMe
 	}
 
 	tx := &pendingTx{
-		Tx:       rawTx,
-		TxHash:   txHash,
-		Meta:     meta,
-		NotifyCh: notifyCh,
+		Tx:        rawTx,
+		TxHash:    txHash,
+		Meta:      meta,
+		NotifyCh:  notifyCh,
+		FirstSeen: time.Now(),
 	}
 
 	// Queue transaction for checks.
@@ -351,11 +364,19 @@ func (t *txPool) updateScheduler(bi *BlockInfo) error {
 			"algorithm", bi.ActiveDescriptor.TxnScheduler.Algorithm,
 		)
 
-		sched, err := scheduling.New(t.cfg.MaxPoolSize, bi.ActiveDescriptor.TxnScheduler.Algorithm, t.roundWeightLimits)
+		sched, err := scheduling.New(bi.ActiveDescriptor.TxnScheduler.Algorithm, &schedulingAPI.Params{
+			RuntimeID:       t.runtimeID,
+			MaxTxPoolSize:   t.cfg.MaxPoolSize,
+			MaxOverflowSize: t.cfg.MaxOverflowSize,
+			MaxSenderTxs:    t.cfg.MaxSenderTxs,
+			ReplaceByFee:    t.cfg.ReplaceByFee,
+			WeightLimits:    t.roundWeightLimits,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create transaction scheduler: %w", err)
 		}
 
+		t.registerSchedulerMetrics(sched)
 		t.scheduler = sched
 		close(t.initCh)
 	default:
@@ -534,7 +555,14 @@ func (t *txPool) checkTxBatch(ctx context.Context, rr host.RichRuntime) {
 			continue
 		}
 
-		txs = append(txs, res.ToCheckedTransaction(rawTxBatch[i]))
+		tx := res.ToCheckedTransaction(rawTxBatch[i])
+		source := transaction.TxSourceP2P
+		if batch[i].Meta.Local {
+			source = transaction.TxSourceLocal
+		}
+		tx.SetFirstSeen(batch[i].FirstSeen, source)
+
+		txs = append(txs, tx)
 		isLocal = append(isLocal, batch[i].Meta.Local)
 	}
 
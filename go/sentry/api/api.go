@@ -3,6 +3,7 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
 	"github.com/oasisprotocol/oasis-core/go/common/accessctl"
@@ -10,6 +11,7 @@ import (
 	"github.com/oasisprotocol/oasis-core/go/common/grpc"
 	"github.com/oasisprotocol/oasis-core/go/common/grpc/policy"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
 )
 
 // SentryAddresses contains sentry node consensus and TLS addresses.
@@ -18,17 +20,88 @@ type SentryAddresses struct {
 	TLS       []node.TLSAddress       `json:"tls"`
 }
 
+// ConsensusAddressEvent is the event that is returned via WatchConsensusAddresses to signify
+// changes of the sentry node's consensus addresses.
+type ConsensusAddressEvent struct {
+	// Added are the consensus addresses that have been added. The first event contains the whole
+	// set of consensus addresses at the time of subscription.
+	Added []node.ConsensusAddress `json:"added,omitempty"`
+	// Removed are the consensus addresses that have been removed.
+	Removed []node.ConsensusAddress `json:"removed,omitempty"`
+}
+
+// TLSCertificates contains the sentry node's TLS certificates.
+type TLSCertificates struct {
+	// Current is the DER-encoded TLS certificate currently used by the sentry node.
+	Current []byte `json:"current"`
+	// Next is the DER-encoded TLS certificate that the sentry node will switch to on the next
+	// rotation. In case there is no pending certificate, it will be nil.
+	Next []byte `json:"next,omitempty"`
+}
+
 // ServicePolicies contains policies for a GRPC service.
 type ServicePolicies struct {
 	Service        grpc.ServiceName                      `json:"service"`
 	AccessPolicies map[common.Namespace]accessctl.Policy `json:"access_policies"`
 }
 
+// UpstreamConnectionState is the state of the sentry node's connection to its upstream node.
+type UpstreamConnectionState uint8
+
+const (
+	// UpstreamConnectionUnknown means that no connection to the upstream node has been attempted.
+	UpstreamConnectionUnknown UpstreamConnectionState = 0
+	// UpstreamConnectionConnected means that the upstream node is reachable.
+	UpstreamConnectionConnected UpstreamConnectionState = 1
+	// UpstreamConnectionFailed means that the last attempt to connect to the upstream node failed.
+	UpstreamConnectionFailed UpstreamConnectionState = 2
+)
+
+// String returns a string representation of the upstream connection state.
+func (s UpstreamConnectionState) String() string {
+	switch s {
+	case UpstreamConnectionUnknown:
+		return "unknown"
+	case UpstreamConnectionConnected:
+		return "connected"
+	case UpstreamConnectionFailed:
+		return "failed"
+	default:
+		return "[invalid upstream connection state]"
+	}
+}
+
+// UpstreamStatus is the status of the sentry node's upstream node as seen by the sentry node.
+type UpstreamStatus struct {
+	// LastSeen is the time the upstream node last contacted the sentry node. In case the upstream
+	// node did not contact the sentry node yet, it will be the zero timestamp.
+	LastSeen time.Time `json:"last_seen"`
+
+	// ConnectionState is the state of the sentry node's connection to the upstream node.
+	ConnectionState UpstreamConnectionState `json:"connection_state"`
+
+	// ConsensusHeight is the latest consensus height reported by the upstream node.
+	ConsensusHeight int64 `json:"consensus_height"`
+}
+
 // Backend is a sentry backend implementation.
 type Backend interface {
 	// Get addresses returns the list of consensus and TLS addresses of the sentry node.
 	GetAddresses(context.Context) (*SentryAddresses, error)
 
+	// WatchConsensusAddresses returns a channel that produces a stream of changes of the sentry
+	// node's consensus addresses. Upon subscription, the current set of addresses is sent
+	// immediately.
+	WatchConsensusAddresses(context.Context) (<-chan *ConsensusAddressEvent, pubsub.ClosableSubscription, error)
+
+	// GetTLSCertificates returns the current and the pending TLS certificates of the sentry node.
+	GetTLSCertificates(context.Context) (*TLSCertificates, error)
+
+	// WatchTLSCertificates returns a channel that produces a stream of the sentry node's TLS
+	// certificates, updated on each certificate rotation. Upon subscription, the current
+	// certificates are sent immediately.
+	WatchTLSCertificates(context.Context) (<-chan *TLSCertificates, pubsub.ClosableSubscription, error)
+
 	// SetUpstreamTLSPubKeys notifies the sentry node of the new TLS public keys used by its
 	// upstream node.
 	SetUpstreamTLSPubKeys(context.Context, []signature.PublicKey) error
@@ -38,6 +111,13 @@ type Backend interface {
 
 	// UpdatePolicies notifies the sentry node of policy changes.
 	UpdatePolicies(context.Context, ServicePolicies) error
+
+	// ReportUpstreamHeight notifies the sentry node of the latest consensus height of its
+	// upstream node.
+	ReportUpstreamHeight(context.Context, int64) error
+
+	// GetUpstreamStatus returns the status of the sentry node's upstream node.
+	GetUpstreamStatus(context.Context) (*UpstreamStatus, error)
 }
 
 // LocalBackend is a local sentry backend implementation.
@@ -46,4 +126,7 @@ type LocalBackend interface {
 
 	// GetPolicyChecker returns the current access policy checker for the given service.
 	GetPolicyChecker(context.Context, grpc.ServiceName) (*policy.DynamicRuntimePolicyChecker, error)
+
+	// SetUpstreamConnectionState records the state of the connection to the upstream node.
+	SetUpstreamConnectionState(UpstreamConnectionState)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	cmnGrpc "github.com/oasisprotocol/oasis-core/go/common/grpc"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
 )
 
 var (
@@ -16,6 +17,15 @@ var (
 	// methodGetAddresses is the GetAddresses method.
 	methodGetAddresses = serviceName.NewMethod("GetAddresses", nil)
 
+	// methodWatchConsensusAddresses is the WatchConsensusAddresses method.
+	methodWatchConsensusAddresses = serviceName.NewMethod("WatchConsensusAddresses", nil)
+
+	// methodGetTLSCertificates is the GetTLSCertificates method.
+	methodGetTLSCertificates = serviceName.NewMethod("GetTLSCertificates", nil)
+
+	// methodWatchTLSCertificates is the WatchTLSCertificates method.
+	methodWatchTLSCertificates = serviceName.NewMethod("WatchTLSCertificates", nil)
+
 	// methodSetUpstreamTLSPubKeys is the SetUpstreamTLSPubKeys method.
 	methodSetUpstreamTLSPubKeys = serviceName.NewMethod("SetUpstreamTLSPubKeys", []signature.PublicKey{})
 
@@ -25,6 +35,12 @@ var (
 	// methodUpdatePolicies is the UpdatePolicies method.
 	methodUpdatePolicies = serviceName.NewMethod("UpdatePolicies", ServicePolicies{})
 
+	// methodReportUpstreamHeight is the ReportUpstreamHeight method.
+	methodReportUpstreamHeight = serviceName.NewMethod("ReportUpstreamHeight", int64(0))
+
+	// methodGetUpstreamStatus is the GetUpstreamStatus method.
+	methodGetUpstreamStatus = serviceName.NewMethod("GetUpstreamStatus", nil)
+
 	// serviceDesc is the gRPC service descriptor.
 	serviceDesc = grpc.ServiceDesc{
 		ServiceName: string(serviceName),
@@ -34,6 +50,10 @@ var (
 				MethodName: methodGetAddresses.ShortName(),
 				Handler:    handlerGetAddresses,
 			},
+			{
+				MethodName: methodGetTLSCertificates.ShortName(),
+				Handler:    handlerGetTLSCertificates,
+			},
 			{
 				MethodName: methodSetUpstreamTLSPubKeys.ShortName(),
 				Handler:    handlerSetUpstreamTLSPubKeys,
@@ -46,8 +66,27 @@ var (
 				MethodName: methodUpdatePolicies.ShortName(),
 				Handler:    handlerUpdatePolicies,
 			},
+			{
+				MethodName: methodReportUpstreamHeight.ShortName(),
+				Handler:    handlerReportUpstreamHeight,
+			},
+			{
+				MethodName: methodGetUpstreamStatus.ShortName(),
+				Handler:    handlerGetUpstreamStatus,
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    methodWatchConsensusAddresses.ShortName(),
+				Handler:       handlerWatchConsensusAddresses,
+				ServerStreams: true,
+			},
+			{
+				StreamName:    methodWatchTLSCertificates.ShortName(),
+				Handler:       handlerWatchTLSCertificates,
+				ServerStreams: true,
+			},
 		},
-		Streams: []grpc.StreamDesc{},
 	}
 )
 
@@ -70,6 +109,81 @@ func handlerGetAddresses( // nolint: golint
 	return interceptor(ctx, nil, info, handler)
 }
 
+func handlerWatchConsensusAddresses(srv interface{}, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(nil); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	ch, sub, err := srv.(Backend).WatchConsensusAddresses(ctx)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			if err := stream.SendMsg(ev); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func handlerGetTLSCertificates( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	if interceptor == nil {
+		return srv.(Backend).GetTLSCertificates(ctx)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodGetTLSCertificates.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).GetTLSCertificates(ctx)
+	}
+	return interceptor(ctx, nil, info, handler)
+}
+
+func handlerWatchTLSCertificates(srv interface{}, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(nil); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	ch, sub, err := srv.(Backend).WatchTLSCertificates(ctx)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case certs, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			if err := stream.SendMsg(certs); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func handlerSetUpstreamTLSPubKeys( // nolint: golint
 	srv interface{},
 	ctx context.Context,
@@ -135,6 +249,48 @@ func handlerUpdatePolicies( // nolint: golint
 	return interceptor(ctx, &req, info, handler)
 }
 
+func handlerReportUpstreamHeight( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	var height int64
+	if err := dec(&height); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return nil, srv.(Backend).ReportUpstreamHeight(ctx, height)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodReportUpstreamHeight.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, srv.(Backend).ReportUpstreamHeight(ctx, *req.(*int64))
+	}
+	return interceptor(ctx, &height, info, handler)
+}
+
+func handlerGetUpstreamStatus( // nolint: golint
+	srv interface{},
+	ctx context.Context,
+	dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error) {
+	if interceptor == nil {
+		return srv.(Backend).GetUpstreamStatus(ctx)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: methodGetUpstreamStatus.FullName(),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Backend).GetUpstreamStatus(ctx)
+	}
+	return interceptor(ctx, nil, info, handler)
+}
+
 // RegisterService registers a new sentry service with the given gRPC server.
 func RegisterService(server *grpc.Server, service Backend) {
 	server.RegisterService(&serviceDesc, service)
@@ -152,6 +308,84 @@ func (c *sentryClient) GetAddresses(ctx context.Context) (*SentryAddresses, erro
 	return &rsp, nil
 }
 
+func (c *sentryClient) WatchConsensusAddresses(ctx context.Context) (<-chan *ConsensusAddressEvent, pubsub.ClosableSubscription, error) {
+	ctx, sub := pubsub.NewContextSubscription(ctx)
+
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], methodWatchConsensusAddresses.FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = stream.SendMsg(nil); err != nil {
+		return nil, nil, err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *ConsensusAddressEvent)
+	go func() {
+		defer close(ch)
+
+		for {
+			var ev ConsensusAddressEvent
+			if serr := stream.RecvMsg(&ev); serr != nil {
+				return
+			}
+
+			select {
+			case ch <- &ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, sub, nil
+}
+
+func (c *sentryClient) GetTLSCertificates(ctx context.Context) (*TLSCertificates, error) {
+	var rsp TLSCertificates
+	if err := c.conn.Invoke(ctx, methodGetTLSCertificates.FullName(), nil, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
+func (c *sentryClient) WatchTLSCertificates(ctx context.Context) (<-chan *TLSCertificates, pubsub.ClosableSubscription, error) {
+	ctx, sub := pubsub.NewContextSubscription(ctx)
+
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[1], methodWatchTLSCertificates.FullName())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = stream.SendMsg(nil); err != nil {
+		return nil, nil, err
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan *TLSCertificates)
+	go func() {
+		defer close(ch)
+
+		for {
+			var certs TLSCertificates
+			if serr := stream.RecvMsg(&certs); serr != nil {
+				return
+			}
+
+			select {
+			case ch <- &certs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, sub, nil
+}
+
 func (c *sentryClient) SetUpstreamTLSPubKeys(ctx context.Context, pubKeys []signature.PublicKey) error {
 	if err := c.conn.Invoke(ctx, methodSetUpstreamTLSPubKeys.FullName(), pubKeys, nil); err != nil {
 		return err
@@ -174,6 +408,21 @@ func (c *sentryClient) UpdatePolicies(ctx context.Context, pols ServicePolicies)
 	return nil
 }
 
+func (c *sentryClient) ReportUpstreamHeight(ctx context.Context, height int64) error {
+	if err := c.conn.Invoke(ctx, methodReportUpstreamHeight.FullName(), height, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *sentryClient) GetUpstreamStatus(ctx context.Context) (*UpstreamStatus, error) {
+	var rsp UpstreamStatus
+	if err := c.conn.Invoke(ctx, methodGetUpstreamStatus.FullName(), nil, &rsp); err != nil {
+		return nil, err
+	}
+	return &rsp, nil
+}
+
 // NewSentryClient creates a new gRPC sentry client service.
 func NewSentryClient(c *grpc.ClientConn) Backend {
 	return &sentryClient{c}
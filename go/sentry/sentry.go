@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/oasisprotocol/oasis-core/go/common/crypto/signature"
 	cmnGrpc "github.com/oasisprotocol/oasis-core/go/common/grpc"
@@ -12,11 +13,16 @@ import (
 	"github.com/oasisprotocol/oasis-core/go/common/identity"
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
 	"github.com/oasisprotocol/oasis-core/go/common/node"
+	"github.com/oasisprotocol/oasis-core/go/common/pubsub"
 	consensus "github.com/oasisprotocol/oasis-core/go/consensus/api"
 	"github.com/oasisprotocol/oasis-core/go/sentry/api"
 	grpcSentry "github.com/oasisprotocol/oasis-core/go/worker/sentry/grpc"
 )
 
+// consensusAddressPollInterval is the interval at which consensus addresses are checked for
+// changes while there are subscribers.
+const consensusAddressPollInterval = 10 * time.Second
+
 var _ api.Backend = (*backend)(nil)
 
 type backend struct {
@@ -28,6 +34,7 @@ type backend struct {
 	identity  *identity.Identity
 
 	upstreamTLSPubKeys []signature.PublicKey
+	upstreamStatus     api.UpstreamStatus
 
 	grpcPolicyCheckers map[cmnGrpc.ServiceName]*policy.DynamicRuntimePolicyChecker
 }
@@ -70,11 +77,126 @@ func (b *backend) GetAddresses(ctx context.Context) (*api.SentryAddresses, error
 	}, nil
 }
 
+func (b *backend) WatchConsensusAddresses(ctx context.Context) (<-chan *api.ConsensusAddressEvent, pubsub.ClosableSubscription, error) {
+	current, err := b.consensus.GetAddresses()
+	if err != nil {
+		return nil, nil, fmt.Errorf("sentry: error obtaining consensus addresses: %w", err)
+	}
+
+	ctx, sub := pubsub.NewContextSubscription(ctx)
+	ch := make(chan *api.ConsensusAddressEvent)
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(consensusAddressPollInterval)
+		defer ticker.Stop()
+
+		ev := &api.ConsensusAddressEvent{Added: current}
+		for {
+			if ev != nil {
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			addrs, err := b.consensus.GetAddresses()
+			if err != nil {
+				b.logger.Warn("failed to obtain consensus addresses",
+					"err", err,
+				)
+				ev = nil
+				continue
+			}
+			ev = diffConsensusAddresses(current, addrs)
+			current = addrs
+		}
+	}()
+
+	return ch, sub, nil
+}
+
+// diffConsensusAddresses returns the changes between the previous and the current set of
+// consensus addresses or nil in case there are none.
+func diffConsensusAddresses(prev, cur []node.ConsensusAddress) *api.ConsensusAddressEvent {
+	prevSet := make(map[string]bool)
+	for _, addr := range prev {
+		prevSet[addr.String()] = true
+	}
+	curSet := make(map[string]bool)
+	for _, addr := range cur {
+		curSet[addr.String()] = true
+	}
+
+	var ev api.ConsensusAddressEvent
+	for _, addr := range cur {
+		if !prevSet[addr.String()] {
+			ev.Added = append(ev.Added, addr)
+		}
+	}
+	for _, addr := range prev {
+		if !curSet[addr.String()] {
+			ev.Removed = append(ev.Removed, addr)
+		}
+	}
+	if len(ev.Added) == 0 && len(ev.Removed) == 0 {
+		return nil
+	}
+	return &ev
+}
+
+func (b *backend) GetTLSCertificates(ctx context.Context) (*api.TLSCertificates, error) {
+	var certs api.TLSCertificates
+	if cert := b.identity.GetTLSCertificate(); cert != nil && len(cert.Certificate) > 0 {
+		certs.Current = cert.Certificate[0]
+	}
+	if cert := b.identity.GetNextTLSCertificate(); cert != nil && len(cert.Certificate) > 0 {
+		certs.Next = cert.Certificate[0]
+	}
+	return &certs, nil
+}
+
+func (b *backend) WatchTLSCertificates(ctx context.Context) (<-chan *api.TLSCertificates, pubsub.ClosableSubscription, error) {
+	rotationCh, rotationSub := b.identity.WatchCertificateRotations()
+
+	ctx, sub := pubsub.NewContextSubscription(ctx)
+	ch := make(chan *api.TLSCertificates)
+	go func() {
+		defer close(ch)
+		defer rotationSub.Close()
+
+		for {
+			certs, _ := b.GetTLSCertificates(ctx)
+			select {
+			case ch <- certs:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case <-rotationCh:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, sub, nil
+}
+
 func (b *backend) SetUpstreamTLSPubKeys(ctx context.Context, pubKeys []signature.PublicKey) error {
 	b.Lock()
 	defer b.Unlock()
 
 	b.upstreamTLSPubKeys = pubKeys
+	b.upstreamStatus.LastSeen = time.Now()
 
 	return nil
 }
@@ -90,6 +212,8 @@ func (b *backend) UpdatePolicies(ctx context.Context, p api.ServicePolicies) err
 	b.Lock()
 	defer b.Unlock()
 
+	b.upstreamStatus.LastSeen = time.Now()
+
 	b.grpcPolicyCheckers[p.Service] = policy.NewDynamicRuntimePolicyChecker(p.Service, nil)
 	for namespace, policy := range p.AccessPolicies {
 		b.grpcPolicyCheckers[p.Service].SetAccessPolicy(policy, namespace)
@@ -98,6 +222,31 @@ func (b *backend) UpdatePolicies(ctx context.Context, p api.ServicePolicies) err
 	return nil
 }
 
+func (b *backend) ReportUpstreamHeight(ctx context.Context, height int64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.upstreamStatus.LastSeen = time.Now()
+	b.upstreamStatus.ConsensusHeight = height
+
+	return nil
+}
+
+func (b *backend) GetUpstreamStatus(ctx context.Context) (*api.UpstreamStatus, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	status := b.upstreamStatus
+	return &status, nil
+}
+
+func (b *backend) SetUpstreamConnectionState(state api.UpstreamConnectionState) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.upstreamStatus.ConnectionState = state
+}
+
 func (b *backend) GetPolicyChecker(ctx context.Context, service cmnGrpc.ServiceName) (*policy.DynamicRuntimePolicyChecker, error) {
 	b.RLock()
 	defer b.RUnlock()
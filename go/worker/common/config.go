@@ -25,6 +25,9 @@ var (
 	CfgSentryAddresses = "worker.sentry.address"
 
 	cfgMaxTxPoolSize       = "worker.tx_pool.schedule_max_tx_pool_size"
+	cfgMaxTxOverflowSize   = "worker.tx_pool.schedule_max_tx_overflow_size"
+	cfgMaxSenderTxs        = "worker.tx_pool.schedule_max_sender_txs"
+	cfgReplaceByFee        = "worker.tx_pool.schedule_replace_by_fee"
 	cfgScheduleTxCacheSize = "worker.tx_pool.schedule_tx_cache_size"
 	cfgStaleTxCacheSize    = "worker.tx_pool.stale_tx_cache_size"
 	cfgCheckTxMaxBatchSize = "worker.tx_pool.check_tx_max_batch_size"
@@ -94,6 +97,9 @@ func NewConfig() (*Config, error) {
 		SentryAddresses: sentryAddresses,
 		TxPool: txpool.Config{
 			MaxPoolSize:          viper.GetUint64(cfgMaxTxPoolSize),
+			MaxOverflowSize:      viper.GetUint64(cfgMaxTxOverflowSize),
+			MaxSenderTxs:         viper.GetUint64(cfgMaxSenderTxs),
+			ReplaceByFee:         viper.GetBool(cfgReplaceByFee),
 			MaxCheckTxBatchSize:  viper.GetUint64(cfgCheckTxMaxBatchSize),
 			MaxLastSeenCacheSize: viper.GetUint64(cfgScheduleTxCacheSize),
 			MaxStaleCacheSize:    viper.GetUint64(cfgStaleTxCacheSize),
@@ -115,6 +121,9 @@ func init() {
 	Flags.StringSlice(CfgSentryAddresses, []string{}, "Address(es) of sentry node(s) to connect to of the form [PubKey@]ip:port (where PubKey@ part represents base64 encoded node TLS public key)")
 
 	Flags.Uint64(cfgMaxTxPoolSize, 10_000, "Maximum size of the scheduling transaction pool")
+	Flags.Uint64(cfgMaxTxOverflowSize, 0, "Maximum number of transactions held while the scheduling transaction pool is full (0 disables the overflow queue)")
+	Flags.Uint64(cfgMaxSenderTxs, 0, "Maximum number of scheduled transactions per sender (0 means unlimited)")
+	Flags.Bool(cfgReplaceByFee, false, "Enable replacing scheduled transactions with higher priority transactions")
 	Flags.Uint64(cfgScheduleTxCacheSize, 10_000, "Maximum cache size of recently scheduled transactions to prevent re-scheduling")
 	Flags.Uint64(cfgStaleTxCacheSize, 64, "Maximum cache size of recently cleared transactions")
 	Flags.Uint64(cfgCheckTxMaxBatchSize, 10_000, "Maximum check tx batch size")
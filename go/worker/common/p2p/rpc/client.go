@@ -2,24 +2,50 @@ package rpc
 
 import (
 	"context"
+	cryptorand "crypto/rand"
 	"fmt"
+	"io"
+	"math/rand"
 	"reflect"
+	"sync"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
 	core "github.com/libp2p/go-libp2p-core"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/protocol"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cache/lru"
 	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/hash"
+	"github.com/oasisprotocol/oasis-core/go/common/crypto/mathrand"
 	"github.com/oasisprotocol/oasis-core/go/common/errors"
 	"github.com/oasisprotocol/oasis-core/go/common/logging"
 	"github.com/oasisprotocol/oasis-core/go/common/version"
 	"github.com/oasisprotocol/oasis-core/go/common/workerpool"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
 )
 
 const (
+	// RequestWriteDeadline is the default deadline for sending a request to a peer.
 	RequestWriteDeadline = 5 * time.Second
+
+	// DefaultMinResponseSpeed is the default minimum speed (in bytes per second) at which peers
+	// must transfer responses.
+	DefaultMinResponseSpeed = 16 * 1024
+
+	// DefaultMaxRequestSize is the default maximum size of an encoded request.
+	DefaultMaxRequestSize = 1024 * 1024 // 1 MiB
+	// DefaultMaxResponseSize is the default maximum size of an encoded or decompressed response.
+	DefaultMaxResponseSize = cbor.DefaultMaxMessageSize
+
+	// DefaultHeightCacheSize is the default maximum number of responses kept in the height cache.
+	DefaultHeightCacheSize = 1024
+
+	// minResponseSpeedWindow is the window over which the response transfer speed is measured.
+	minResponseSpeedWindow = 2 * time.Second
 )
 
 // PeerFeedback is an interface for providing deferred peer feedback after an outcome is known.
@@ -37,9 +63,11 @@ type PeerFeedback interface {
 }
 
 type peerFeedback struct {
-	mgr     PeerManager
-	peerID  core.PeerID
-	latency time.Duration
+	mgr        PeerManager
+	peerID     core.PeerID
+	latency    time.Duration
+	protocolID protocol.ID
+	method     string
 }
 
 func (pf *peerFeedback) RecordSuccess() {
@@ -52,6 +80,7 @@ func (pf *peerFeedback) RecordFailure() {
 
 func (pf *peerFeedback) RecordBadPeer() {
 	pf.mgr.RecordBadPeer(pf.peerID)
+	recordCallBadPeer(pf.protocolID, pf.method)
 }
 
 type nopPeerFeedback struct{}
@@ -85,19 +114,426 @@ type Client interface {
 		method string,
 		body, rsp interface{},
 		maxPeerResponseTime time.Duration,
+		opts ...CallOption,
 	) (PeerFeedback, error)
 
+	// CallExcluding is like Call but never contacts any of the given peers. This is equivalent to
+	// calling Call with the WithExcludePeers option.
+	//
+	// In case all peers are excluded, ErrAllPeersExcluded is returned.
+	CallExcluding(
+		ctx context.Context,
+		method string,
+		body, rsp interface{},
+		maxPeerResponseTime time.Duration,
+		exclude []core.PeerID,
+		opts ...CallOption,
+	) (PeerFeedback, error)
+
+	// CallStream routes the given RPC method call to a single peer that supports the protocol and
+	// returns its streaming response. The peer must negotiate the current protocol version.
+	//
+	// Each response chunk must be received within maxChunkTime. The caller must either read the
+	// response until an error (io.EOF on success) is returned or close it.
+	CallStream(
+		ctx context.Context,
+		method string,
+		body interface{},
+		maxChunkTime time.Duration,
+		opts ...CallOption,
+	) (*ResponseStream, error)
+
 	// CallMulti routes the given RPC method call to multiple peers that support the protocol based
 	// on past experience with the peers.
 	//
+	// At most maxPeers best peers are contacted (all peers in case it is zero) while at most
+	// maxParallelRequests requests are in flight at the same time.
+	//
 	// It returns all successfully retrieved results and their corresponding PeerFeedback instances.
+	// In case the context is cancelled, any in-flight requests are aborted and no failures are
+	// recorded for the peers being contacted.
 	CallMulti(
 		ctx context.Context,
 		method string,
 		body, rspTyp interface{},
 		maxPeerResponseTime time.Duration,
 		maxParallelRequests uint,
+		maxPeers uint,
+		opts ...CallOption,
 	) ([]interface{}, []PeerFeedback, error)
+
+	// CallMultiQuorum is like CallMulti but returns as soon as minResults successful results have
+	// been retrieved, cancelling any remaining requests. Peers whose requests were cancelled get
+	// neutral feedback. In case minResults is zero, it waits for all requests to complete.
+	//
+	// Results are ordered the same way as the contacted peers.
+	CallMultiQuorum(
+		ctx context.Context,
+		method string,
+		body, rspTyp interface{},
+		maxPeerResponseTime time.Duration,
+		maxParallelRequests uint,
+		minResults uint,
+		opts ...CallOption,
+	) ([]interface{}, []PeerFeedback, error)
+
+	// CallRaced routes the given RPC method call to multiple peers that support the protocol
+	// concurrently and returns the first successful response, cancelling the remaining calls.
+	//
+	// At most maxParallelRequests best peers are contacted. Only the PeerFeedback of the winning
+	// peer is returned. In case penalizeSlowPeers is true, failure is recorded for peers that did
+	// not respond before the winner, otherwise their feedback is left neutral.
+	CallRaced(
+		ctx context.Context,
+		method string,
+		body, rsp interface{},
+		maxPeerResponseTime time.Duration,
+		maxParallelRequests uint,
+		penalizeSlowPeers bool,
+		opts ...CallOption,
+	) (PeerFeedback, error)
+
+	// NewSession creates a new session whose calls are all routed to the same peer, failing over
+	// to another peer only in case the pinned peer fails.
+	NewSession() Session
+
+	// InvalidateCachedResponses removes all cached responses for the given method at the given
+	// height. See WithHeightCache for details.
+	InvalidateCachedResponses(method string, height uint64)
+
+	// UpdatePeerCapacities queries all known peers for their advertised serving capacity and
+	// records it for use in capacity-weighted peer selection.
+	//
+	// Peers that do not advertise their capacity are treated as having average capacity.
+	UpdatePeerCapacities(ctx context.Context, maxPeerResponseTime time.Duration)
+
+	// Shutdown stops accepting new calls and waits for any in-flight calls to complete. Once no
+	// calls are in flight, it releases all resources held by the client like Close.
+	//
+	// Any calls made after Shutdown has been invoked fail with ErrShuttingDown. In case the
+	// context is done before all in-flight calls complete, the remaining calls are aborted and
+	// waited for, after which the context error is returned.
+	Shutdown(ctx context.Context) error
+
+	// Close aborts any in-flight calls, waits for them to return and then releases all resources
+	// held by the client. It stops any background tasks, persists the peer reputation state (in
+	// case persistence is enabled) and closes any pooled streams. In contrast to Shutdown it does
+	// not give in-flight calls a chance to complete.
+	//
+	// Any calls made after Close has been invoked (including Call and CallMulti) fail with
+	// ErrClosed. Calling Close multiple times is safe.
+	Close() error
+}
+
+// ClientOption is an RPC client option.
+type ClientOption func(c *client)
+
+// WithMethodPeerWeighting configures the peer weighting used during peer selection when calling
+// the given method.
+//
+// By default all methods use PeerWeightingLatency.
+func WithMethodPeerWeighting(method string, weighting PeerWeighting) ClientOption {
+	return func(c *client) {
+		c.methodWeighting[method] = weighting
+	}
+}
+
+// PeerSelection is the strategy used to order peers when routing calls.
+type PeerSelection uint8
+
+const (
+	// PeerSelectionBestFirst contacts peers in order of their score, only randomizing the order
+	// of the few best peers.
+	PeerSelectionBestFirst PeerSelection = iota
+	// PeerSelectionWeightedRandom orders peers randomly with probability proportional to the
+	// inverse of their score. This spreads load across peers while still favoring good peers.
+	PeerSelectionWeightedRandom
+)
+
+// WithPeerSelection configures the strategy used to order peers when routing calls.
+//
+// By default PeerSelectionBestFirst is used.
+func WithPeerSelection(selection PeerSelection) ClientOption {
+	return func(c *client) {
+		c.peerSelection = selection
+	}
+}
+
+// WithReputationPersistence configures the client to persist peer reputation state across
+// restarts using the given configuration.
+//
+// By default peer reputation state is not persisted.
+func WithReputationPersistence(cfg ReputationPersistenceConfig) ClientOption {
+	return func(c *client) {
+		c.reputationPersistence = &cfg
+	}
+}
+
+// WithRequestWriteDeadline configures the deadline for sending a request to a peer. It can be
+// overridden for individual calls using WithCallWriteDeadline.
+//
+// By default RequestWriteDeadline is used.
+func WithRequestWriteDeadline(deadline time.Duration) ClientOption {
+	return func(c *client) {
+		c.writeDeadline = deadline
+	}
+}
+
+// WithRetry configures the client to retry failed calls to a peer up to the given number of
+// attempts in total before moving on to the next peer.
+//
+// Between attempts the client waits for the given base delay, doubling it after each attempt.
+// Retries stop early in case the call context would expire before the next attempt or in case
+// the failure is permanent. By default each peer is only attempted once.
+func WithRetry(maxAttempts uint, baseDelay time.Duration) ClientOption {
+	return func(c *client) {
+		c.retryMaxAttempts = maxAttempts
+		c.retryBaseDelay = baseDelay
+	}
+}
+
+// WithCompression configures the client to compress request bodies using the given codec and to
+// ask peers to compress response bodies the same way, trading CPU time for bandwidth.
+//
+// Compression is only used with peers that negotiated the client's current protocol version as
+// peers not supporting compression reject requests with unknown fields. Protocols enabling it
+// should therefore bump their version and register the previous one via WithLegacyVersion.
+func WithCompression(compression Compression) ClientOption {
+	return func(c *client) {
+		c.compression = compression
+	}
+}
+
+// WithCodec configures the wire format used to talk to peers. By default CBORCodec is used.
+func WithCodec(codec Codec) ClientOption {
+	return func(c *client) {
+		c.codec = codec
+	}
+}
+
+// WithStreamPool configures the client to keep up to the given number of idle streams per peer
+// open and reuse them across calls, instead of opening a new stream for each call.
+//
+// Idle streams are discarded after the given idle timeout, which should be shorter than the
+// server's StreamIdleTimeout. Streams are never reused after an error. Servers may close idle
+// streams early, in which case the call is retried once on a fresh stream without penalizing the
+// peer. By default stream pooling is disabled.
+func WithStreamPool(size int, idleTimeout time.Duration) ClientOption {
+	return func(c *client) {
+		if size <= 0 {
+			c.streamPool = nil
+			return
+		}
+		c.streamPool = newStreamPool(size, idleTimeout)
+	}
+}
+
+// WithMaxRequestSize configures the maximum size of an encoded request. Requests exceeding it
+// fail without being sent. By default DefaultMaxRequestSize is used.
+func WithMaxRequestSize(size uint32) ClientOption {
+	return func(c *client) {
+		c.maxRequestSize = size
+	}
+}
+
+// WithMaxResponseSize configures the maximum size of an encoded or decompressed response. Peers
+// sending larger responses are recorded as bad. By default DefaultMaxResponseSize is used.
+func WithMaxResponseSize(size uint32) ClientOption {
+	return func(c *client) {
+		c.maxResponseSize = size
+	}
+}
+
+// ProtocolCodec translates requests and responses between the current and a legacy protocol
+// version.
+type ProtocolCodec interface {
+	// EncodeRequest translates the given method request body into the legacy format.
+	EncodeRequest(method string, body cbor.RawMessage) (cbor.RawMessage, error)
+
+	// DecodeResponse translates the given legacy method response into the current format.
+	DecodeResponse(method string, rsp cbor.RawMessage) (cbor.RawMessage, error)
+}
+
+type legacyVersion struct {
+	version version.Version
+	codec   ProtocolCodec
+}
+
+// WithLegacyVersion registers an older protocol version that the client falls back to in case a
+// peer does not support the preferred protocol version. Legacy versions are preferred in the order
+// in which they were registered.
+//
+// The codec is used to translate requests and responses when communicating with peers using the
+// legacy protocol version. If nil, the request and response formats are assumed to be compatible.
+func WithLegacyVersion(version version.Version, codec ProtocolCodec) ClientOption {
+	return func(c *client) {
+		c.legacyVersions = append(c.legacyVersions, legacyVersion{version, codec})
+	}
+}
+
+// PeerVerifier performs application-level verification of a peer (e.g., a challenge-response
+// exchange) before calls to the peer are trusted.
+//
+// The given call function can be used to call methods on the peer being verified. In case the
+// peer is rejected, the verifier must return a *PeerVerificationError. Any other error is treated
+// as a transient failure to verify the peer (e.g., due to a transport error).
+type PeerVerifier func(
+	ctx context.Context,
+	peerID core.PeerID,
+	call func(method string, body, rsp interface{}) error,
+) error
+
+// PeerVerificationError is the error returned by a PeerVerifier in case the peer being verified
+// has been rejected.
+type PeerVerificationError struct {
+	Err error
+}
+
+func (e *PeerVerificationError) Error() string {
+	return fmt.Sprintf("peer verification failed: %s", e.Err)
+}
+
+func (e *PeerVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// WithFirstContactVerification configures the client to verify peers using the given verifier
+// before the first call to them is trusted. Peers rejected by the verifier are recorded as bad.
+//
+// Successfully verified peers are not verified again until the given duration elapses.
+func WithFirstContactVerification(verifier PeerVerifier, validFor time.Duration) ClientOption {
+	return func(c *client) {
+		c.peerVerifier = verifier
+		c.peerVerificationValidity = validFor
+	}
+}
+
+// HeightFunc extracts the block height that a method request refers to from the request body.
+//
+// It should return false in case the response for the given request must not be cached (e.g.,
+// because the height is not yet finalized).
+type HeightFunc func(body interface{}) (uint64, bool)
+
+// WithHeightCache enables caching of responses to calls of the given idempotent method, keyed by
+// the block height that the request refers to and the request body.
+//
+// The given function is used to determine the height from the request body. Responses are only
+// cached once the caller records success via the returned PeerFeedback, and subsequent calls for
+// the same request are then served locally. Since responses for finalized heights never change,
+// cached responses do not expire, but they can be explicitly removed via
+// InvalidateCachedResponses. The cache is shared by all cached methods and is bounded, see
+// WithHeightCacheSize.
+//
+// Only Call uses the cache, CallMulti always contacts peers.
+func WithHeightCache(method string, heightFn HeightFunc) ClientOption {
+	return func(c *client) {
+		c.cachedMethods[method] = heightFn
+	}
+}
+
+// WithHeightCacheSize configures the maximum number of responses kept in the height cache, after
+// which the least recently used responses are evicted. By default DefaultHeightCacheSize is used.
+func WithHeightCacheSize(size uint64) ClientOption {
+	return func(c *client) {
+		c.cache = newResponseCache(size)
+	}
+}
+
+// cacheKey is the key of a cached response.
+type cacheKey struct {
+	method   string
+	height   uint64
+	bodyHash hash.Hash
+}
+
+// cachingPeerFeedback is a peer feedback that caches the response once success is recorded.
+type cachingPeerFeedback struct {
+	PeerFeedback
+
+	c   *client
+	key cacheKey
+	rsp cbor.RawMessage
+}
+
+func (pf *cachingPeerFeedback) RecordSuccess() {
+	pf.PeerFeedback.RecordSuccess()
+	pf.c.cacheResponse(pf.key, pf.rsp)
+}
+
+// CallOptions are per-call options.
+type CallOptions struct {
+	excludePeers     map[core.PeerID]struct{}
+	maxPeers         uint
+	maxPeerStaleness time.Duration
+	minResponseSpeed uint64
+	writeDeadline    time.Duration
+}
+
+// CallOption is a per-call option setter.
+type CallOption func(opts *CallOptions)
+
+// WithExcludePeers configures a set of peers that should not be contacted during the call.
+//
+// In contrast to RecordBadPeer this only affects the given call and does not influence future
+// peer selection.
+func WithExcludePeers(peers ...core.PeerID) CallOption {
+	return func(opts *CallOptions) {
+		if opts.excludePeers == nil {
+			opts.excludePeers = make(map[core.PeerID]struct{}, len(peers))
+		}
+		for _, peer := range peers {
+			opts.excludePeers[peer] = struct{}{}
+		}
+	}
+}
+
+// WithMaxPeers configures the maximum number of best peers that are considered during the call.
+// Excluded peers do not count towards the limit. Zero means that the number of peers is not
+// limited, which is the default.
+func WithMaxPeers(count uint) CallOption {
+	return func(opts *CallOptions) {
+		opts.maxPeers = count
+	}
+}
+
+// WithMaxPeerStaleness configures the call to only consider peers that have been seen within the
+// given duration. Zero means that peers are not filtered by staleness, which is the default.
+func WithMaxPeerStaleness(staleness time.Duration) CallOption {
+	return func(opts *CallOptions) {
+		opts.maxPeerStaleness = staleness
+	}
+}
+
+// WithMinResponseSpeed configures the minimum speed (in bytes per second) at which peers must
+// transfer responses. Peers that transfer responses slower are recorded as bad.
+//
+// The speed is only measured once the response starts arriving so that the time the peer spends
+// processing the request does not count against it. Setting the speed to zero disables the check.
+// By default DefaultMinResponseSpeed is used.
+func WithMinResponseSpeed(bytesPerSecond uint64) CallOption {
+	return func(opts *CallOptions) {
+		opts.minResponseSpeed = bytesPerSecond
+	}
+}
+
+// WithCallWriteDeadline overrides the deadline for sending the request to a peer for this call,
+// e.g., to allow more time for sending large requests. Zero means that the client's configured
+// deadline is used, which is the default.
+func WithCallWriteDeadline(deadline time.Duration) CallOption {
+	return func(opts *CallOptions) {
+		opts.writeDeadline = deadline
+	}
+}
+
+// newCallOptions creates per-call options from the given option setters.
+func newCallOptions(opts ...CallOption) *CallOptions {
+	co := CallOptions{
+		minResponseSpeed: DefaultMinResponseSpeed,
+	}
+	for _, opt := range opts {
+		opt(&co)
+	}
+	return &co
 }
 
 type client struct {
@@ -107,43 +543,471 @@ type client struct {
 	protocolID protocol.ID
 	runtimeID  common.Namespace
 
+	methodWeighting map[string]PeerWeighting
+	peerSelection   PeerSelection
+
+	reputationPersistence *ReputationPersistenceConfig
+
+	legacyVersions  []legacyVersion
+	legacyProtocols []protocol.ID
+	legacyCodecs    map[protocol.ID]ProtocolCodec
+
+	peerProtocolsLock sync.Mutex
+	peerProtocols     map[core.PeerID]protocol.ID
+
+	peerVerifier             PeerVerifier
+	peerVerificationValidity time.Duration
+	verifiedPeersLock        sync.Mutex
+	verifiedPeers            map[core.PeerID]time.Time
+	// peerVerifications deduplicates concurrent verifications of the same peer.
+	peerVerifications singleflight.Group
+
+	codec           Codec
+	compression     Compression
+	streamPool      *streamPool
+	maxRequestSize  uint32
+	maxResponseSize uint32
+
+	retryMaxAttempts uint
+	retryBaseDelay   time.Duration
+
+	writeDeadline time.Duration
+
+	cachedMethods map[string]HeightFunc
+	cache         *lru.Cache
+
+	tracer Tracer
+
+	shutdownLock sync.Mutex
+	shuttingDown bool
+	closed       bool
+	inFlight     sync.WaitGroup
+	callCancels  map[uint64]context.CancelFunc
+	lastCallID   uint64
+
 	logger *logging.Logger
 }
 
+// beginCall registers a new in-flight call. It fails with ErrClosed in case the client has been
+// closed and with ErrShuttingDown in case the client is shutting down.
+//
+// The returned context is derived from the given context and is additionally cancelled in case
+// the client aborts in-flight calls. Each successful beginCall must be paired with a call to the
+// returned function once the call completes.
+func (c *client) beginCall(ctx context.Context) (context.Context, func(), error) {
+	c.shutdownLock.Lock()
+	defer c.shutdownLock.Unlock()
+
+	if c.closed {
+		return nil, nil, ErrClosed
+	}
+	if c.shuttingDown {
+		return nil, nil, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	if c.callCancels == nil {
+		c.callCancels = make(map[uint64]context.CancelFunc)
+	}
+	c.lastCallID++
+	id := c.lastCallID
+	c.callCancels[id] = cancel
+	c.inFlight.Add(1)
+
+	endCall := func() {
+		c.shutdownLock.Lock()
+		delete(c.callCancels, id)
+		c.shutdownLock.Unlock()
+
+		cancel()
+		c.inFlight.Done()
+	}
+	return ctx, endCall, nil
+}
+
+// abortCalls cancels all in-flight calls.
+func (c *client) abortCalls() {
+	c.shutdownLock.Lock()
+	defer c.shutdownLock.Unlock()
+
+	for _, cancel := range c.callCancels {
+		cancel()
+	}
+}
+
+// releaseResources closes any pooled streams and stops the peer manager.
+//
+// It must only be called once there are no more in-flight calls.
+func (c *client) releaseResources() error {
+	if c.streamPool != nil {
+		c.streamPool.close()
+	}
+	if err := c.PeerManager.Stop(); err != nil {
+		return fmt.Errorf("failed to stop peer manager: %w", err)
+	}
+	return nil
+}
+
+func (c *client) Shutdown(ctx context.Context) error {
+	c.shutdownLock.Lock()
+	c.shuttingDown = true
+	c.shutdownLock.Unlock()
+
+	c.logger.Debug("shutting down, waiting for in-flight calls to complete")
+
+	doneCh := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(doneCh)
+	}()
+
+	var err error
+	select {
+	case <-doneCh:
+	case <-ctx.Done():
+		c.logger.Warn("timed out waiting for in-flight calls to complete, aborting them",
+			"err", ctx.Err(),
+		)
+		err = ctx.Err()
+
+		c.abortCalls()
+		<-doneCh
+	}
+
+	if rerr := c.releaseResources(); rerr != nil {
+		c.logger.Error("failed to release resources",
+			"err", rerr,
+		)
+	}
+	return err
+}
+
+func (c *client) Close() error {
+	c.shutdownLock.Lock()
+	c.shuttingDown = true
+	c.closed = true
+	c.shutdownLock.Unlock()
+
+	c.logger.Debug("closing, aborting in-flight calls")
+
+	c.abortCalls()
+	c.inFlight.Wait()
+
+	return c.releaseResources()
+}
+
+// getWriteDeadline returns the deadline for sending a request to a peer, taking any per-call
+// override into account.
+func (c *client) getWriteDeadline(co *CallOptions) time.Duration {
+	switch {
+	case co.writeDeadline > 0:
+		return co.writeDeadline
+	case c.writeDeadline > 0:
+		return c.writeDeadline
+	default:
+		return RequestWriteDeadline
+	}
+}
+
+// getBestPeers returns the best peers for the given method, omitting any excluded peers.
+//
+// In case all peers have been excluded, ErrAllPeersExcluded is returned.
+func (c *client) getBestPeers(method string, opts *CallOptions) ([]core.PeerID, error) {
+	bpOpts := []BestPeersOption{WithBestPeersMaxStaleness(opts.maxPeerStaleness)}
+	if opts.maxPeers > 0 {
+		// Make sure that enough peers remain after excluded peers are omitted.
+		bpOpts = append(bpOpts, WithBestPeersLimit(opts.maxPeers+uint(len(opts.excludePeers))))
+	}
+
+	var peers []core.PeerID
+	switch c.peerSelection {
+	case PeerSelectionWeightedRandom:
+		rng := rand.New(mathrand.New(cryptorand.Reader))
+		peers = weightedRandomPeerOrder(c.ExplainPeerSelectionWeighted(c.methodWeighting[method], bpOpts...), rng)
+	default:
+		peers = c.GetBestPeersWeighted(c.methodWeighting[method], bpOpts...)
+	}
+	recordReachablePeers(c.protocolID, len(peers))
+
+	filtered := peers
+	if len(opts.excludePeers) > 0 {
+		filtered = make([]core.PeerID, 0, len(peers))
+		for _, peer := range peers {
+			if _, excluded := opts.excludePeers[peer]; excluded {
+				continue
+			}
+			filtered = append(filtered, peer)
+		}
+		if len(filtered) == 0 && len(peers) > 0 {
+			return nil, ErrAllPeersExcluded
+		}
+	}
+	if opts.maxPeers > 0 && uint(len(filtered)) > opts.maxPeers {
+		filtered = filtered[:opts.maxPeers]
+	}
+	return filtered, nil
+}
+
+// recordBadPeer records a malicious protocol interaction with the given peer during a call of the
+// given method.
+func (c *client) recordBadPeer(peerID core.PeerID, method string) {
+	c.RecordBadPeer(peerID)
+	recordCallBadPeer(c.protocolID, method)
+}
+
+// getProtocols returns the protocols that should be offered to the given peer in order of
+// preference.
+//
+// In case a protocol version has previously been negotiated with the peer, it is preferred.
+func (c *client) getProtocols(peerID core.PeerID) []protocol.ID {
+	protocols := make([]protocol.ID, 0, 1+len(c.legacyProtocols))
+	protocols = append(protocols, c.protocolID)
+	protocols = append(protocols, c.legacyProtocols...)
+
+	c.peerProtocolsLock.Lock()
+	pid, ok := c.peerProtocols[peerID]
+	c.peerProtocolsLock.Unlock()
+	if !ok {
+		return protocols
+	}
+
+	for i, p := range protocols {
+		if p == pid {
+			copy(protocols[1:i+1], protocols[:i])
+			protocols[0] = pid
+			break
+		}
+	}
+	return protocols
+}
+
+// recordPeerProtocol records the protocol version that was negotiated with the given peer.
+func (c *client) recordPeerProtocol(peerID core.PeerID, pid protocol.ID) {
+	c.peerProtocolsLock.Lock()
+	defer c.peerProtocolsLock.Unlock()
+
+	c.peerProtocols[peerID] = pid
+}
+
+// verifyPeer verifies the given peer using the configured peer verifier (if any) unless the peer
+// has been successfully verified recently.
+//
+// Concurrent verifications of the same peer are performed only once and share the outcome. The
+// shared verification is not cancelled in case any of the callers is cancelled.
+func (c *client) verifyPeer(ctx context.Context, peerID core.PeerID, method string, maxPeerResponseTime time.Duration) error {
+	if c.peerVerifier == nil {
+		return nil
+	}
+
+	c.verifiedPeersLock.Lock()
+	validUntil, verified := c.verifiedPeers[peerID]
+	c.verifiedPeersLock.Unlock()
+	if verified && time.Now().Before(validUntil) {
+		return nil
+	}
+
+	ch := c.peerVerifications.DoChan(peerID.String(), func() (interface{}, error) {
+		return nil, c.doVerifyPeer(peerID, method, maxPeerResponseTime)
+	})
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-ch:
+		return res.Err
+	}
+}
+
+// doVerifyPeer verifies the given peer using the configured peer verifier and records the peer as
+// verified in case verification succeeds.
+//
+// Only peers rejected by the verifier are recorded as bad. Any other verification failure is
+// returned as a retryable error.
+func (c *client) doVerifyPeer(peerID core.PeerID, method string, maxPeerResponseTime time.Duration) error {
+	ctx, endCall, err := c.beginCall(context.Background())
+	if err != nil {
+		return err
+	}
+	defer endCall()
+
+	ctx, cancel := context.WithTimeout(ctx, maxPeerResponseTime)
+	defer cancel()
+
+	call := func(method string, body, rsp interface{}) error {
+		request := Request{
+			Method: method,
+			Body:   c.codec.Marshal(body),
+		}
+		return c.sendRequestAndDecodeResponse(ctx, peerID, &request, rsp, maxPeerResponseTime, newCallOptions())
+	}
+	err = c.peerVerifier(ctx, peerID, call)
+	var verr *PeerVerificationError
+	switch {
+	case err == nil:
+	case errors.As(err, &verr):
+		c.logger.Warn("peer failed verification",
+			"err", err,
+			"peer_id", peerID,
+		)
+
+		c.recordBadPeer(peerID, method)
+		return p2pError.Permanent(err)
+	default:
+		c.logger.Debug("failed to verify peer",
+			"err", err,
+			"peer_id", peerID,
+		)
+
+		return fmt.Errorf("failed to verify peer: %w", err)
+	}
+
+	c.verifiedPeersLock.Lock()
+	c.verifiedPeers[peerID] = time.Now().Add(c.peerVerificationValidity)
+	c.verifiedPeersLock.Unlock()
+
+	return nil
+}
+
+// getCacheKey returns the cache key for the given request and true in case the response to the
+// request may be cached.
+func (c *client) getCacheKey(method string, body interface{}, request *Request) (cacheKey, bool) {
+	heightFn, ok := c.cachedMethods[method]
+	if !ok {
+		return cacheKey{}, false
+	}
+	height, ok := heightFn(body)
+	if !ok {
+		return cacheKey{}, false
+	}
+	return cacheKey{
+		method:   method,
+		height:   height,
+		bodyHash: hash.NewFromBytes(request.Body),
+	}, true
+}
+
+// cacheResponse caches the given response under the given key, evicting the least recently used
+// response in case the cache is full.
+func (c *client) cacheResponse(key cacheKey, rsp cbor.RawMessage) {
+	_ = c.cache.Put(key, rsp)
+}
+
+// getCachedResponse returns the cached response for the given key (if any).
+func (c *client) getCachedResponse(key cacheKey) (cbor.RawMessage, bool) {
+	rsp, ok := c.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return rsp.(cbor.RawMessage), true
+}
+
+func (c *client) InvalidateCachedResponses(method string, height uint64) {
+	for _, k := range c.cache.Keys() {
+		if key := k.(cacheKey); key.method == method && key.height == height {
+			c.cache.Remove(key)
+		}
+	}
+}
+
+// newResponseCache creates a new response cache holding up to the given number of responses.
+func newResponseCache(size uint64) *lru.Cache {
+	// Creating a cache with only a capacity option cannot fail.
+	cache, _ := lru.New(lru.Capacity(size, false))
+	return cache
+}
+
 func (c *client) Call(
 	ctx context.Context,
 	method string,
 	body, rsp interface{},
 	maxPeerResponseTime time.Duration,
-) (PeerFeedback, error) {
+	opts ...CallOption,
+) (pf PeerFeedback, err error) {
 	c.logger.Debug("call", "method", method)
 
+	ctx, endCall, err := c.beginCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endCall()
+
+	ctx, span := c.startSpan(ctx, "rpc.Call", method, "")
+	defer func() { endSpan(span, err) }()
+
+	co := newCallOptions(opts...)
+
 	// Prepare the request.
 	request := Request{
 		Method: method,
-		Body:   cbor.Marshal(body),
+		Body:   c.codec.Marshal(body),
+	}
+
+	// Serve the request locally in case the response has been cached.
+	key, cacheable := c.getCacheKey(method, body, &request)
+	if cacheable {
+		if cached, ok := c.getCachedResponse(key); ok {
+			c.logger.Debug("serving cached response",
+				"method", method,
+				"height", key.height,
+			)
+
+			if rsp != nil {
+				if err = c.codec.Unmarshal(cached, rsp); err != nil {
+					return nil, fmt.Errorf("failed to decode cached response: %w", err)
+				}
+			}
+			return NewNopPeerFeedback(), nil
+		}
+	}
+
+	peers, err := c.getBestPeers(method, co)
+	if err != nil {
+		return nil, err
 	}
 
 	// Iterate through the prioritized list of peers and attempt to execute the request.
-	for _, peer := range c.GetBestPeers() {
+	var peerErrs []error
+	for _, peer := range peers {
 		c.logger.Debug("trying peer",
 			"method", method,
 			"peer_id", peer,
 		)
 
-		pf, err := c.call(ctx, peer, &request, rsp, maxPeerResponseTime)
+		pf, err = c.callWithRetry(ctx, peer, &request, rsp, maxPeerResponseTime, co)
 		if err != nil {
+			peerErrs = append(peerErrs, &peerError{peerID: peer, err: err})
 			continue
 		}
+		if cacheable {
+			pf = &cachingPeerFeedback{
+				PeerFeedback: pf,
+				c:            c,
+				key:          key,
+				rsp:          c.codec.Marshal(rsp),
+			}
+		}
 		return pf, nil
 	}
 
 	// No peers could be reached to service this request.
+	err = aggregatePeerErrors(peerErrs)
 	c.logger.Debug("no peers could be reached to service request",
+		"err", err,
 		"method", method,
 	)
 
-	return nil, fmt.Errorf("call failed on all peers")
+	return nil, err
+}
+
+func (c *client) CallExcluding(
+	ctx context.Context,
+	method string,
+	body, rsp interface{},
+	maxPeerResponseTime time.Duration,
+	exclude []core.PeerID,
+	opts ...CallOption,
+) (PeerFeedback, error) {
+	opts = append([]CallOption{WithExcludePeers(exclude...)}, opts...)
+	return c.Call(ctx, method, body, rsp, maxPeerResponseTime, opts...)
 }
 
 func (c *client) CallMulti(
@@ -152,13 +1016,39 @@ func (c *client) CallMulti(
 	body, rspTyp interface{},
 	maxPeerResponseTime time.Duration,
 	maxParallelRequests uint,
+	maxPeers uint,
+	opts ...CallOption,
 ) ([]interface{}, []PeerFeedback, error) {
+	opts = append([]CallOption{WithMaxPeers(maxPeers)}, opts...)
+	return c.CallMultiQuorum(ctx, method, body, rspTyp, maxPeerResponseTime, maxParallelRequests, 0, opts...)
+}
+
+func (c *client) CallMultiQuorum(
+	ctx context.Context,
+	method string,
+	body, rspTyp interface{},
+	maxPeerResponseTime time.Duration,
+	maxParallelRequests uint,
+	minResults uint,
+	opts ...CallOption,
+) (rsps []interface{}, pfs []PeerFeedback, err error) {
 	c.logger.Debug("call multiple", "method", method)
 
+	ctx, endCall, err := c.beginCall(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer endCall()
+
+	ctx, span := c.startSpan(ctx, "rpc.CallMulti", method, "")
+	defer func() { endSpan(span, err) }()
+
+	co := newCallOptions(opts...)
+
 	// Prepare the request.
 	request := Request{
 		Method: method,
-		Body:   cbor.Marshal(body),
+		Body:   c.codec.Marshal(body),
 	}
 
 	// Create a worker pool.
@@ -166,63 +1056,297 @@ func (c *client) CallMulti(
 	pool.Resize(maxParallelRequests)
 	defer pool.Stop()
 
+	// Remaining requests are cancelled once enough results have been retrieved.
+	multiCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Requests results from peers.
 	type result struct {
-		rsp interface{}
-		pf  PeerFeedback
-		err error
+		index int
+		rsp   interface{}
+		pf    PeerFeedback
+		err   error
 	}
-	var resultCh []chan *result
-	for _, peer := range c.GetBestPeers() {
-		ch := make(chan *result, 1)
-		resultCh = append(resultCh, ch)
-
+	peers, err := c.getBestPeers(method, co)
+	if err != nil {
+		return nil, nil, err
+	}
+	resultCh := make(chan *result, len(peers))
+	for i, peer := range peers {
+		i, peer := i, peer
 		pool.Submit(func() {
+			// Requests may outlive CallMulti in case its context is done, so track them separately.
+			callCtx, endCall, err := c.beginCall(multiCtx)
+			if err != nil {
+				resultCh <- &result{index: i, err: err}
+				return
+			}
+			defer endCall()
+
 			rsp := reflect.New(reflect.TypeOf(rspTyp)).Interface()
-			pf, err := c.call(ctx, peer, &request, rsp, maxPeerResponseTime)
-			ch <- &result{rsp, pf, err}
-			close(ch)
+			pf, err := c.call(callCtx, peer, &request, rsp, maxPeerResponseTime, co)
+			resultCh <- &result{i, rsp, pf, err}
 		})
 	}
 
 	// Gather results.
-	var (
-		rsps []interface{}
-		pfs  []PeerFeedback
-	)
-	for _, ch := range resultCh {
+	results := make([]*result, len(peers))
+	var numResults uint
+GatherLoop:
+	for range peers {
 		select {
 		case <-ctx.Done():
 			return nil, nil, ctx.Err()
-		case result := <-ch:
+		case result := <-resultCh:
 			// Ignore failed results.
 			if result.err != nil {
 				continue
 			}
 
-			rsps = append(rsps, result.rsp)
-			pfs = append(pfs, result.pf)
+			results[result.index] = result
+			numResults++
+			if minResults > 0 && numResults >= minResults {
+				break GatherLoop
+			}
+		}
+	}
+
+	// Preserve peer ordering.
+	for _, result := range results {
+		if result == nil {
+			continue
 		}
+		rsps = append(rsps, result.rsp)
+		pfs = append(pfs, result.pf)
 	}
 	return rsps, pfs, nil
 }
 
-func (c *client) call(
+func (c *client) CallRaced(
+	ctx context.Context,
+	method string,
+	body, rsp interface{},
+	maxPeerResponseTime time.Duration,
+	maxParallelRequests uint,
+	penalizeSlowPeers bool,
+	opts ...CallOption,
+) (pf PeerFeedback, err error) {
+	c.logger.Debug("call raced", "method", method)
+
+	ctx, endCall, err := c.beginCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endCall()
+
+	ctx, span := c.startSpan(ctx, "rpc.CallRaced", method, "")
+	defer func() { endSpan(span, err) }()
+
+	co := newCallOptions(opts...)
+
+	// Prepare the request.
+	request := Request{
+		Method: method,
+		Body:   c.codec.Marshal(body),
+	}
+
+	peers, err := c.getBestPeers(method, co)
+	if err != nil {
+		return nil, err
+	}
+	if uint(len(peers)) > maxParallelRequests {
+		peers = peers[:maxParallelRequests]
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("call failed on all peers")
+	}
+
+	// Create a worker pool. The pool is stopped once all racing calls have completed.
+	pool := workerpool.New("p2p/rpc")
+	pool.Resize(uint(len(peers)))
+
+	raceCtx, cancel := context.WithCancel(ctx)
+
+	// Race requests to peers.
+	type result struct {
+		peerID    core.PeerID
+		startTime time.Time
+		rsp       interface{}
+		pf        PeerFeedback
+		err       error
+		cancelled bool
+	}
+	resultCh := make(chan *result, len(peers))
+	for _, peer := range peers {
+		peer := peer
+		pool.Submit(func() {
+			// Requests may outlive CallRaced, so track them separately.
+			callCtx, endCall, err := c.beginCall(raceCtx)
+			if err != nil {
+				resultCh <- &result{peerID: peer, err: err}
+				return
+			}
+			defer endCall()
+
+			var peerRsp interface{}
+			if rsp != nil {
+				peerRsp = reflect.New(reflect.TypeOf(rsp).Elem()).Interface()
+			}
+			startTime := time.Now()
+			pf, err := c.call(callCtx, peer, &request, peerRsp, maxPeerResponseTime, co)
+			resultCh <- &result{peer, startTime, peerRsp, pf, err, err != nil && raceCtx.Err() != nil}
+		})
+	}
+
+	// finish cancels the remaining calls and provides feedback for them once they complete.
+	finish := func(remaining int, penalize bool) {
+		cancel()
+		go func() {
+			defer pool.Stop()
+
+			for i := 0; i < remaining; i++ {
+				result := <-resultCh
+				if !penalize {
+					continue
+				}
+				switch {
+				case result.err == nil:
+					result.pf.RecordFailure()
+				case result.cancelled:
+					// Failures of cancelled calls are not recorded by call.
+					c.RecordFailure(result.peerID, time.Since(result.startTime))
+				}
+			}
+		}()
+	}
+
+	// Wait for the first successful result.
+	peerErrs := make([]error, 0, len(peers))
+	for i := range peers {
+		select {
+		case <-ctx.Done():
+			finish(len(peers)-i, false)
+			return nil, ctx.Err()
+		case result := <-resultCh:
+			if result.err != nil {
+				peerErrs = append(peerErrs, &peerError{peerID: result.peerID, err: result.err})
+				continue
+			}
+
+			finish(len(peers)-i-1, penalizeSlowPeers)
+			if rsp != nil {
+				reflect.ValueOf(rsp).Elem().Set(reflect.ValueOf(result.rsp).Elem())
+			}
+			return result.pf, nil
+		}
+	}
+	finish(0, false)
+
+	// No peers could be reached to service this request.
+	err = aggregatePeerErrors(peerErrs)
+	c.logger.Debug("no peers could be reached to service request",
+		"err", err,
+		"method", method,
+	)
+
+	return nil, err
+}
+
+func (c *client) UpdatePeerCapacities(ctx context.Context, maxPeerResponseTime time.Duration) {
+	ctx, endCall, err := c.beginCall(ctx)
+	if err != nil {
+		return
+	}
+	defer endCall()
+
+	request := Request{
+		Method: MethodGetCapacity,
+		Body:   c.codec.Marshal(nil),
+	}
+
+	for _, peer := range c.GetBestPeers() {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		var rsp CapacityResponse
+		if err = c.sendRequestAndDecodeResponse(ctx, peer, &request, &rsp, maxPeerResponseTime, newCallOptions()); err != nil {
+			// Peers that do not advertise their capacity are not penalized.
+			c.logger.Debug("failed to query peer capacity",
+				"err", err,
+				"peer_id", peer,
+			)
+			continue
+		}
+		c.RecordCapacity(peer, rsp.Capacity)
+	}
+}
+
+// callWithRetry calls the given peer, retrying failed calls according to the configured retry
+// policy.
+func (c *client) callWithRetry(
 	ctx context.Context,
 	peerID core.PeerID,
 	request *Request,
 	rsp interface{},
 	maxPeerResponseTime time.Duration,
+	co *CallOptions,
 ) (PeerFeedback, error) {
+	delay := c.retryBaseDelay
+	for attempt := uint(1); ; attempt++ {
+		pf, err := c.call(ctx, peerID, request, rsp, maxPeerResponseTime, co)
+		if err == nil || attempt >= c.retryMaxAttempts || p2pError.IsPermanent(err) {
+			return pf, err
+		}
+
+		// Do not retry in case the context would expire before the next attempt.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			return nil, err
+		}
+
+		c.logger.Debug("retrying call",
+			"err", err,
+			"method", request.Method,
+			"peer_id", peerID,
+			"attempt", attempt,
+			"delay", delay,
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *client) call(
+	ctx context.Context,
+	peerID core.PeerID,
+	request *Request,
+	rsp interface{},
+	maxPeerResponseTime time.Duration,
+	co *CallOptions,
+) (_ PeerFeedback, err error) {
+	ctx, span := c.startSpan(ctx, "rpc.call", request.Method, peerID)
+	defer func() { endSpan(span, err) }()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
+	if err = c.verifyPeer(ctx, peerID, request.Method, maxPeerResponseTime); err != nil {
+		return nil, err
+	}
+
 	startTime := time.Now()
 
-	err := c.sendRequestAndDecodeResponse(ctx, peerID, request, rsp, maxPeerResponseTime)
+	err = c.sendRequestAndDecodeResponse(ctx, peerID, request, rsp, maxPeerResponseTime, co)
 	if err != nil {
 		c.logger.Debug("failed to call method",
 			"err", err,
@@ -230,14 +1354,31 @@ func (c *client) call(
 			"peer_id", peerID,
 		)
 
-		c.RecordFailure(peerID, time.Since(startTime))
+		latency := time.Since(startTime)
+		if isTracing(span) {
+			span.SetAttributes(Attribute{AttributeLatency, latency.Seconds()})
+		}
+
+		// Calls cancelled by the caller are not the peer's fault.
+		if ctx.Err() != context.Canceled {
+			c.RecordFailure(peerID, latency)
+			recordCallFailure(c.protocolID, request.Method, latency)
+		}
 		return nil, err
 	}
 
+	latency := time.Since(startTime)
+	if isTracing(span) {
+		span.SetAttributes(Attribute{AttributeLatency, latency.Seconds()})
+	}
+	recordCallSuccess(c.protocolID, request.Method, latency)
+
 	pf := &peerFeedback{
-		mgr:     c.PeerManager,
-		peerID:  peerID,
-		latency: time.Since(startTime),
+		mgr:        c.PeerManager,
+		peerID:     peerID,
+		latency:    latency,
+		protocolID: c.protocolID,
+		method:     request.Method,
 	}
 	return pf, nil
 }
@@ -248,33 +1389,130 @@ func (c *client) sendRequestAndDecodeResponse(
 	request *Request,
 	rsp interface{},
 	maxPeerResponseTime time.Duration,
-) error {
-	// Attempt to open stream to the given peer.
+	co *CallOptions,
+) (err error) {
+	ctx, span := c.startSpan(ctx, "rpc.sendRequest", request.Method, peerID)
+	defer func() { endSpan(span, err) }()
+
+	// Attempt to reuse a pooled stream first. The peer may have closed the stream in the meantime
+	// in which case the request is retried on a fresh stream.
+	if stream := c.borrowStream(peerID); stream != nil {
+		var responded bool
+		responded, err = c.exchange(ctx, span, peerID, stream, request, rsp, maxPeerResponseTime, co)
+		if err == nil || responded || p2pError.IsPermanent(err) || ctx.Err() != nil {
+			return err
+		}
+
+		c.logger.Debug("pooled stream failed, retrying on a fresh stream",
+			"err", err,
+			"peer_id", peerID,
+		)
+	}
+
+	// Attempt to open stream to the given peer, negotiating the protocol version.
 	stream, err := c.host.NewStream(
 		network.WithNoDial(ctx, "should already have connection"),
 		peerID,
-		c.protocolID,
+		c.getProtocols(peerID)...,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to open stream: %w", err)
 	}
-	defer stream.Close()
+	span.AddEvent(EventStreamOpened)
+
+	_, err = c.exchange(ctx, span, peerID, stream, request, rsp, maxPeerResponseTime, co)
+	return err
+}
+
+// exchange sends the given request over the given stream and decodes the response. The stream is
+// returned to the pool in case it can be reused, otherwise it is closed.
+//
+// It also returns whether the peer has started sending a response.
+func (c *client) exchange(
+	ctx context.Context,
+	span Span,
+	peerID core.PeerID,
+	stream network.Stream,
+	request *Request,
+	rsp interface{},
+	maxPeerResponseTime time.Duration,
+	co *CallOptions,
+) (responded bool, err error) {
+	var reusable bool
+	defer func() { c.releaseStream(peerID, stream, reusable) }()
+
+	// Abort any blocked stream operations as soon as the context is done.
+	stopAbort := abortOnDone(ctx, stream)
+	defer func() {
+		if stopAbort() {
+			// The stream has been reset so it must not be reused.
+			reusable = false
+		}
+	}()
+
+	// Translate the request in case a legacy protocol version has been negotiated.
+	pid := stream.Protocol()
+	if isTracing(span) {
+		span.SetAttributes(Attribute{AttributeProtocol, string(pid)})
+	}
+	protoCodec := c.legacyCodecs[pid]
+	if protoCodec != nil {
+		body, err := protoCodec.EncodeRequest(request.Method, request.Body)
+		if err != nil {
+			return false, fmt.Errorf("failed to translate request for protocol '%s': %w", pid, err)
+		}
+		request = &Request{
+			Method: request.Method,
+			Body:   body,
+		}
+	}
+	if pid == c.protocolID && c.compression != CompressionNone {
+		body, err := compress(c.compression, request.Body)
+		if err != nil {
+			return false, fmt.Errorf("failed to compress request: %w", err)
+		}
+		request = &Request{
+			Method:      request.Method,
+			Body:        body,
+			Compression: c.compression,
+		}
+	}
+	if pid == c.protocolID {
+		if traceContext := c.injectTraceContext(ctx); traceContext != nil {
+			traced := *request
+			traced.TraceContext = traceContext
+			request = &traced
+		}
+	}
 
-	codec := cbor.NewMessageCodec(stream, codecModuleName)
+	speedReader := &minSpeedReader{
+		Reader:   stream,
+		minSpeed: co.minResponseSpeed,
+	}
+	codec := c.codec.NewMessageCodec(struct {
+		io.Reader
+		io.Writer
+	}{speedReader, stream}, codecModuleName, c.maxResponseSize, c.maxRequestSize)
 
 	// Send request.
-	_ = stream.SetWriteDeadline(time.Now().Add(RequestWriteDeadline))
+	_ = stream.SetWriteDeadline(time.Now().Add(c.getWriteDeadline(co)))
 	if err = codec.Write(request); err != nil {
 		c.logger.Debug("failed to send request",
 			"err", err,
 			"peer_id", peerID,
 		)
-		return fmt.Errorf("failed to send request: %w", err)
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		if err == ErrMessageTooLarge {
+			return false, p2pError.Permanent(ErrRequestTooLarge)
+		}
+		return false, fmt.Errorf("failed to send request: %w", err)
 	}
 	_ = stream.SetWriteDeadline(time.Time{})
+	span.AddEvent(EventRequestSent)
 
 	// Read response.
-	// TODO: Add required minimum speed.
 	var rawRsp Response
 	_ = stream.SetReadDeadline(time.Now().Add(maxPeerResponseTime))
 	if err = codec.Read(&rawRsp); err != nil {
@@ -282,33 +1520,245 @@ func (c *client) sendRequestAndDecodeResponse(
 			"err", err,
 			"peer_id", peerID,
 		)
-		return fmt.Errorf("failed to read response: %w", err)
+		responded = speedReader.bytesRead > 0
+		switch {
+		case ctx.Err() != nil:
+			// The call has been aborted.
+			return responded, ctx.Err()
+		case speedReader.tooSlow:
+			c.recordBadPeer(peerID, request.Method)
+			return responded, p2pError.Permanent(ErrResponseTooSlow)
+		case err == ErrMessageTooLarge:
+			c.recordBadPeer(peerID, request.Method)
+			return responded, p2pError.Permanent(ErrResponseTooLarge)
+		}
+		return responded, fmt.Errorf("failed to read response: %w", err)
 	}
-	_ = stream.SetWriteDeadline(time.Time{})
+	_ = stream.SetReadDeadline(time.Time{})
+	span.AddEvent(EventResponseRead)
+
+	// The whole response has been read so the stream can be reused.
+	responded = true
+	reusable = true
+
+	c.recordPeerProtocol(peerID, pid)
 
 	// Decode response.
 	if rawRsp.Error != nil {
-		return errors.FromCode(rawRsp.Error.Module, rawRsp.Error.Code, rawRsp.Error.Message)
+		return true, &remoteError{errors.FromCode(rawRsp.Error.Module, rawRsp.Error.Code, rawRsp.Error.Message)}
+	}
+
+	if rawRsp.Ok, err = decompress(rawRsp.Compression, rawRsp.Ok, c.maxResponseSize); err != nil {
+		c.recordBadPeer(peerID, request.Method)
+		return true, fmt.Errorf("failed to decompress response: %w", err)
+	}
+
+	if protoCodec != nil {
+		if rawRsp.Ok, err = protoCodec.DecodeResponse(request.Method, rawRsp.Ok); err != nil {
+			return true, fmt.Errorf("failed to translate response for protocol '%s': %w", pid, err)
+		}
 	}
 
 	if rsp != nil {
-		return cbor.Unmarshal(rawRsp.Ok, rsp)
+		return true, c.codec.Unmarshal(rawRsp.Ok, rsp)
 	}
-	return nil
+	return true, nil
+}
+
+// abortOnDone resets the given stream as soon as the context is done, aborting any blocked reads
+// or writes. The returned function must be called once the stream is no longer in use and returns
+// true iff the stream has been reset.
+func abortOnDone(ctx context.Context, stream network.Stream) func() bool {
+	if ctx.Done() == nil {
+		// Context can never be done.
+		return func() bool { return false }
+	}
+
+	var aborted bool
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+
+		select {
+		case <-ctx.Done():
+			_ = stream.Reset()
+			aborted = true
+		case <-stopCh:
+		}
+	}()
+
+	return func() bool {
+		close(stopCh)
+		<-doneCh
+		return aborted
+	}
+}
+
+// borrowStream returns a pooled stream to the given peer or nil in case stream pooling is disabled
+// or there are no usable pooled streams.
+func (c *client) borrowStream(peerID core.PeerID) network.Stream {
+	if c.streamPool == nil {
+		return nil
+	}
+	if c.host.Network().Connectedness(peerID) != network.Connected {
+		// Streams to disconnected peers are broken.
+		c.streamPool.remove(peerID)
+		return nil
+	}
+	return c.streamPool.get(peerID)
+}
+
+// releaseStream returns the given stream to the pool in case it is reusable and stream pooling is
+// enabled. Otherwise the stream is closed.
+func (c *client) releaseStream(peerID core.PeerID, stream network.Stream, reusable bool) {
+	if c.streamPool == nil || !reusable {
+		_ = stream.Close()
+		return
+	}
+	c.streamPool.put(peerID, stream)
+}
+
+// remoteError is an error returned by a peer in its response.
+type remoteError struct {
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
+
+// peerError is an error that occurred while calling a peer.
+type peerError struct {
+	peerID core.PeerID
+	err    error
+}
+
+func (e *peerError) Error() string {
+	return fmt.Sprintf("peer %s: %s", e.peerID, e.err)
+}
+
+func (e *peerError) Unwrap() error {
+	return e.err
+}
+
+// aggregatePeerErrors combines the errors that occurred while calling peers into a single error.
+//
+// In case all peers returned the same remote error, that error is returned directly.
+func aggregatePeerErrors(errs []error) error {
+	if len(errs) == 0 {
+		return fmt.Errorf("call failed on all peers")
+	}
+
+	if err, ok := sameRemoteError(errs); ok {
+		return err
+	}
+
+	return fmt.Errorf("call failed on all peers: %w", multierror.Append(nil, errs...))
+}
+
+// sameRemoteError returns the remote error in case all given errors are the same remote error.
+func sameRemoteError(errs []error) (error, bool) {
+	var first *remoteError
+	if !errors.As(errs[0], &first) {
+		return nil, false
+	}
+	module, code := errors.Code(first.err)
+	for _, err := range errs[1:] {
+		var re *remoteError
+		if !errors.As(err, &re) {
+			return nil, false
+		}
+		if m, c := errors.Code(re.err); m != module || c != code {
+			return nil, false
+		}
+	}
+	return first.err, true
+}
+
+// minSpeedReader is a reader that fails once data is being read slower than the given minimum
+// speed (in bytes per second), measured over consecutive windows.
+type minSpeedReader struct {
+	io.Reader
+
+	minSpeed    uint64
+	windowStart time.Time
+	windowBytes uint64
+	bytesRead   uint64
+	tooSlow     bool
+}
+
+func (r *minSpeedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.bytesRead += uint64(n)
+	if r.minSpeed == 0 || n == 0 {
+		return n, err
+	}
+
+	now := time.Now()
+	if r.windowStart.IsZero() {
+		// Start measuring once the first bytes arrive.
+		r.windowStart = now
+	}
+	r.windowBytes += uint64(n)
+
+	if elapsed := now.Sub(r.windowStart); elapsed >= minResponseSpeedWindow {
+		if float64(r.windowBytes) < float64(r.minSpeed)*elapsed.Seconds() {
+			r.tooSlow = true
+			return n, ErrResponseTooSlow
+		}
+		r.windowStart = now
+		r.windowBytes = 0
+	}
+	return n, err
 }
 
 // NewClient creates a new RPC client for the given protocol.
-func NewClient(p2p P2P, runtimeID common.Namespace, protocolID string, version version.Version) Client {
+func NewClient(p2p P2P, runtimeID common.Namespace, protocolID string, version version.Version, opts ...ClientOption) Client {
+	initMetrics()
+
 	pid := NewRuntimeProtocolID(runtimeID, protocolID, version)
 
-	return &client{
-		PeerManager: NewPeerManager(p2p, pid),
-		host:        p2p.GetHost(),
-		protocolID:  pid,
-		runtimeID:   runtimeID,
+	c := &client{
+		host:            p2p.GetHost(),
+		protocolID:      pid,
+		runtimeID:       runtimeID,
+		methodWeighting: make(map[string]PeerWeighting),
+		legacyCodecs:    make(map[protocol.ID]ProtocolCodec),
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		verifiedPeers:   make(map[core.PeerID]time.Time),
+		cachedMethods:   make(map[string]HeightFunc),
+		cache:           newResponseCache(DefaultHeightCacheSize),
+		codec:           CBORCodec,
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		writeDeadline:   RequestWriteDeadline,
 		logger: logging.GetLogger("worker/common/p2p/rpc/client").With(
 			"protocol", protocolID,
 			"runtime_id", runtimeID,
 		),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	seen := map[protocol.ID]bool{pid: true}
+	for _, lv := range c.legacyVersions {
+		legacyPid := NewRuntimeProtocolID(runtimeID, protocolID, lv.version)
+		if seen[legacyPid] {
+			continue
+		}
+		seen[legacyPid] = true
+		c.legacyProtocols = append(c.legacyProtocols, legacyPid)
+		if lv.codec != nil {
+			c.legacyCodecs[legacyPid] = lv.codec
+		}
+	}
+	c.PeerManager = NewPeerManager(p2p, pid, c.reputationPersistence, c.legacyProtocols...)
+
+	return c
 }
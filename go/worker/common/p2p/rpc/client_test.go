@@ -0,0 +1,1122 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/errors"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/common/version"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
+)
+
+// recordingHost is a host that records all peers it was asked to open a stream to.
+type recordingHost struct {
+	core.Host
+
+	sync.Mutex
+	contacted []core.PeerID
+}
+
+func (h *recordingHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.contacted = append(h.contacted, p)
+	return nil, fmt.Errorf("not connected")
+}
+
+// staticPeerManager is a peer manager that always returns the same set of peers.
+type staticPeerManager struct {
+	PeerManager
+
+	sync.Mutex
+	peers    []core.PeerID
+	badPeers []core.PeerID
+	failures []core.PeerID
+	stopped  int
+}
+
+func (mgr *staticPeerManager) RecordFailure(peerID core.PeerID, latency time.Duration) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	mgr.failures = append(mgr.failures, peerID)
+}
+
+func (mgr *staticPeerManager) RecordBadPeer(peerID core.PeerID) {
+	mgr.badPeers = append(mgr.badPeers, peerID)
+}
+
+func (mgr *staticPeerManager) GetBestPeersWeighted(weighting PeerWeighting, opts ...BestPeersOption) []core.PeerID {
+	return mgr.peers
+}
+
+func (mgr *staticPeerManager) Stop() error {
+	mgr.stopped++
+	return nil
+}
+
+func TestClientExcludePeers(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b", "peer-c"}
+	host := &recordingHost{}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: peers},
+		host:            host,
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	_, err := c.Call(context.Background(), "Test", nil, nil, time.Second, WithExcludePeers(peers[1]))
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.EqualValues([]core.PeerID{peers[0], peers[2]}, host.contacted, "Call should not contact excluded peers")
+
+	host.contacted = nil
+	_, _, err = c.CallMulti(context.Background(), "Test", nil, struct{}{}, time.Second, 2, 0, WithExcludePeers(peers[0], peers[2]))
+	require.NoError(err, "CallMulti")
+	require.EqualValues([]core.PeerID{peers[1]}, host.contacted, "CallMulti should not contact excluded peers")
+
+	host.contacted = nil
+	_, err = c.Call(context.Background(), "Test", nil, nil, time.Second, WithExcludePeers(peers...))
+	require.ErrorIs(err, ErrAllPeersExcluded, "Call should fail when all peers are excluded")
+	require.Empty(host.contacted, "Call should not contact any peers")
+
+	host.contacted = nil
+	_, err = c.CallExcluding(context.Background(), "Test", nil, nil, time.Second, peers[:2])
+	require.Error(err, "CallExcluding should fail as no peers are reachable")
+	require.NotErrorIs(err, ErrAllPeersExcluded)
+	require.EqualValues([]core.PeerID{peers[2]}, host.contacted, "CallExcluding should not contact excluded peers")
+
+	host.contacted = nil
+	_, err = c.CallExcluding(context.Background(), "Test", nil, nil, time.Second, peers[:1], WithExcludePeers(peers[1:]...))
+	require.ErrorIs(err, ErrAllPeersExcluded, "CallExcluding should fail when all peers are excluded")
+	require.Empty(host.contacted, "CallExcluding should not contact any peers")
+
+	_, _, err = c.CallMulti(context.Background(), "Test", nil, struct{}{}, time.Second, 2, 0, WithExcludePeers(peers...))
+	require.ErrorIs(err, ErrAllPeersExcluded, "CallMulti should fail when all peers are excluded")
+
+	host.contacted = nil
+	_, _, err = c.CallMulti(context.Background(), "Test", nil, struct{}{}, time.Second, 2, 1, WithExcludePeers(peers[0]))
+	require.NoError(err, "CallMulti")
+	require.EqualValues([]core.PeerID{peers[1]}, host.contacted, "CallMulti should only contact maxPeers non-excluded peers")
+}
+
+func TestAggregatePeerErrors(t *testing.T) {
+	require := require.New(t)
+
+	remote := func(err error) error {
+		module, code := errors.Code(err)
+		return &remoteError{errors.FromCode(module, code, err.Error())}
+	}
+	errTimeout := fmt.Errorf("timeout")
+
+	err := aggregatePeerErrors(nil)
+	require.EqualError(err, "call failed on all peers")
+
+	err = aggregatePeerErrors([]error{
+		&peerError{peerID: "peer-a", err: remote(ErrMethodNotSupported)},
+		&peerError{peerID: "peer-b", err: remote(ErrMethodNotSupported)},
+	})
+	require.Equal(ErrMethodNotSupported, err, "same remote errors should be returned directly")
+
+	err = aggregatePeerErrors([]error{
+		&peerError{peerID: "peer-a", err: remote(ErrMethodNotSupported)},
+		&peerError{peerID: "peer-b", err: remote(ErrBadRequest)},
+		&peerError{peerID: "peer-c", err: errTimeout},
+	})
+	require.ErrorIs(err, ErrMethodNotSupported, "aggregated errors should include all errors")
+	require.ErrorIs(err, ErrBadRequest, "aggregated errors should include all errors")
+	require.ErrorIs(err, errTimeout, "aggregated errors should include all errors")
+	require.Contains(err.Error(), core.PeerID("peer-c").String(), "aggregated errors should include peer identifiers")
+
+	err = aggregatePeerErrors([]error{
+		&peerError{peerID: "peer-a", err: ErrResponseTooSlow},
+		&peerError{peerID: "peer-b", err: ErrResponseTooSlow},
+	})
+	require.ErrorIs(err, ErrResponseTooSlow)
+	require.NotEqual(ErrResponseTooSlow, err, "local errors should not be returned directly")
+}
+
+func TestClientRetry(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b"}
+	host := &recordingHost{}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: peers},
+		host:            host,
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.EqualValues(peers, host.contacted, "Call should attempt each peer once by default")
+
+	WithRetry(3, time.Millisecond)(c)
+	host.contacted = nil
+	_, err = c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.EqualValues(
+		[]core.PeerID{peers[0], peers[0], peers[0], peers[1], peers[1], peers[1]},
+		host.contacted,
+		"Call should retry each peer",
+	)
+
+	WithRetry(3, time.Hour)(c)
+	host.contacted = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = c.Call(ctx, "Test", nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.EqualValues(peers, host.contacted, "Call should not retry past the context deadline")
+}
+
+func TestClientCallRaced(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b", "peer-c"}
+	host := &recordingHost{}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: peers},
+		host:            host,
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	var rsp struct{}
+	_, err := c.CallRaced(context.Background(), "Test", nil, &rsp, time.Second, 2, true)
+	require.Error(err, "CallRaced should fail as no peers are reachable")
+	require.ElementsMatch(peers[:2], host.contacted, "CallRaced should only contact the best peers")
+	require.Contains(err.Error(), "not connected", "CallRaced should return the peer errors")
+	for _, peer := range peers[:2] {
+		require.Contains(err.Error(), peer.String(), "CallRaced should return the error of each peer")
+	}
+
+	host.contacted = nil
+	_, err = c.CallRaced(context.Background(), "Test", nil, nil, time.Second, 2, false, WithExcludePeers(peers...))
+	require.Error(err, "CallRaced should fail when all peers are excluded")
+	require.Empty(host.contacted, "CallRaced should not contact any peers")
+}
+
+// tricklingReader is a reader that returns a single byte per read after the given delay.
+type tricklingReader struct {
+	delay time.Duration
+}
+
+func (r *tricklingReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	p[0] = 0
+	return 1, nil
+}
+
+func TestMinSpeedReader(t *testing.T) {
+	require := require.New(t)
+
+	buf := make([]byte, 1024)
+
+	r := &minSpeedReader{Reader: bytes.NewReader(make([]byte, 1024*1024)), minSpeed: DefaultMinResponseSpeed}
+	_, err := io.CopyBuffer(io.Discard, r, buf)
+	require.NoError(err, "fast reads should not fail")
+	require.False(r.tooSlow)
+
+	r = &minSpeedReader{Reader: &tricklingReader{delay: 100 * time.Millisecond}, minSpeed: DefaultMinResponseSpeed}
+	for err == nil {
+		_, err = r.Read(buf)
+	}
+	require.ErrorIs(err, ErrResponseTooSlow, "trickling reads should fail")
+	require.True(r.tooSlow)
+
+	r = &minSpeedReader{Reader: &tricklingReader{delay: time.Millisecond}}
+	for i := 0; i < 10; i++ {
+		_, err = r.Read(buf)
+		require.NoError(err, "reads should not fail when the check is disabled")
+	}
+}
+
+// scriptedStream is a stream that returns a pre-recorded response.
+type scriptedStream struct {
+	network.Stream
+
+	response io.Reader
+	request  bytes.Buffer
+}
+
+func (s *scriptedStream) Read(p []byte) (int, error) {
+	return s.response.Read(p)
+}
+
+func (s *scriptedStream) Write(p []byte) (int, error) {
+	return s.request.Write(p)
+}
+
+func (s *scriptedStream) Protocol() protocol.ID {
+	return "/test/1.0.0"
+}
+
+func (s *scriptedStream) Close() error {
+	return nil
+}
+
+func (s *scriptedStream) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (s *scriptedStream) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (s *scriptedStream) Reset() error {
+	return nil
+}
+
+// scriptedHost is a host that opens scripted streams.
+type scriptedHost struct {
+	core.Host
+
+	stream *scriptedStream
+}
+
+func (h *scriptedHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	return h.stream, nil
+}
+
+func TestClientSizeLimits(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a"}
+	mgr := &staticPeerManager{peers: peers}
+
+	var rsp bytes.Buffer
+	err := cbor.NewMessageCodec(&rsp, t.Name()).Write(&Response{Ok: cbor.Marshal(make([]byte, 1024))})
+	require.NoError(err, "Write")
+
+	stream := &scriptedStream{response: &rsp}
+	c := &client{
+		PeerManager:     mgr,
+		host:            &scriptedHost{stream: stream},
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: 512,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	err = c.sendRequestAndDecodeResponse(context.Background(), peers[0], &Request{Method: "Test"}, nil, time.Second, &CallOptions{})
+	require.ErrorIs(err, ErrResponseTooLarge, "request should fail with an oversized response")
+	require.EqualValues(peers, mgr.badPeers, "peers sending oversized responses should be recorded as bad")
+	require.NotZero(rsp.Len(), "oversized response should not be read")
+
+	WithMaxRequestSize(16)(c)
+	stream.request.Reset()
+	request := &Request{Method: "Test", Body: cbor.Marshal(make([]byte, 1024))}
+	err = c.sendRequestAndDecodeResponse(context.Background(), peers[0], request, nil, time.Second, &CallOptions{})
+	require.ErrorIs(err, ErrRequestTooLarge, "request should fail with an oversized request")
+	require.Zero(stream.request.Len(), "oversized request should not be sent")
+}
+
+// quorumHost is a host where peers respond with their own identifier once the stalled peer has
+// been contacted. The stalled peer never responds.
+type quorumHost struct {
+	core.Host
+
+	stalled   core.PeerID
+	started   chan struct{}
+	cancelled chan core.PeerID
+}
+
+func (h *quorumHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	if p == h.stalled {
+		close(h.started)
+		<-ctx.Done()
+		h.cancelled <- p
+		return nil, ctx.Err()
+	}
+	<-h.started
+
+	var rsp bytes.Buffer
+	if err := cbor.NewMessageCodec(&rsp, "test").Write(&Response{Ok: cbor.Marshal(string(p))}); err != nil {
+		return nil, err
+	}
+	return &scriptedStream{response: &rsp}, nil
+}
+
+func TestClientCallMultiQuorum(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b", "peer-c"}
+	mgr := &staticPeerManager{peers: peers}
+	host := &quorumHost{
+		stalled:   peers[1],
+		started:   make(chan struct{}),
+		cancelled: make(chan core.PeerID, len(peers)),
+	}
+	c := &client{
+		PeerManager:     mgr,
+		host:            host,
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	rsps, pfs, err := c.CallMultiQuorum(context.Background(), "Test", nil, "", time.Minute, 3, 2)
+	require.NoError(err, "CallMultiQuorum")
+	require.Len(pfs, 2, "CallMultiQuorum should return once enough results have been retrieved")
+	require.Len(rsps, 2)
+	require.EqualValues(peers[0], *rsps[0].(*string), "results should preserve peer ordering")
+	require.EqualValues(peers[2], *rsps[1].(*string), "results should preserve peer ordering")
+
+	select {
+	case peer := <-host.cancelled:
+		require.EqualValues(peers[1], peer, "remaining requests should be cancelled")
+	case <-time.After(10 * time.Second):
+		require.Fail("remaining requests should be cancelled")
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+	require.Empty(mgr.failures, "cancelled requests should not be recorded as failures")
+}
+
+func TestClientProtocolPreference(t *testing.T) {
+	require := require.New(t)
+
+	c := &client{
+		protocolID:      "/test/3.0.0",
+		legacyProtocols: []protocol.ID{"/test/2.0.0", "/test/1.0.0"},
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+	}
+
+	peer := core.PeerID("peer-a")
+	require.EqualValues(
+		[]protocol.ID{"/test/3.0.0", "/test/2.0.0", "/test/1.0.0"},
+		c.getProtocols(peer),
+		"preferred protocol version should be tried first",
+	)
+
+	c.recordPeerProtocol(peer, "/test/1.0.0")
+	require.EqualValues(
+		[]protocol.ID{"/test/1.0.0", "/test/3.0.0", "/test/2.0.0"},
+		c.getProtocols(peer),
+		"previously negotiated protocol version should be tried first",
+	)
+	require.EqualValues(
+		[]protocol.ID{"/test/3.0.0", "/test/2.0.0", "/test/1.0.0"},
+		c.getProtocols("peer-b"),
+		"negotiated protocol version should only affect the given peer",
+	)
+}
+
+func TestClientFirstContactVerification(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b"}
+	host := &recordingHost{}
+	mgr := &staticPeerManager{peers: peers}
+
+	verified := make(map[core.PeerID]int)
+	verifier := func(ctx context.Context, peerID core.PeerID, call func(method string, body, rsp interface{}) error) error {
+		verified[peerID]++
+		if peerID == peers[1] {
+			return &PeerVerificationError{Err: fmt.Errorf("bad response to challenge")}
+		}
+		return nil
+	}
+
+	c := &client{
+		PeerManager:     mgr,
+		host:            host,
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		verifiedPeers:   make(map[core.PeerID]time.Time),
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithFirstContactVerification(verifier, time.Hour)(c)
+
+	_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.EqualValues([]core.PeerID{peers[0]}, host.contacted, "peers failing verification should not be contacted")
+	require.EqualValues([]core.PeerID{peers[1]}, mgr.badPeers, "peers failing verification should be recorded as bad")
+	require.Equal(1, verified[peers[0]], "peer should be verified on first contact")
+
+	mgr.peers = peers[:1]
+	_, err = c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.Equal(1, verified[peers[0]], "verified peer should not be verified again")
+}
+
+func TestClientConcurrentVerification(t *testing.T) {
+	require := require.New(t)
+
+	peer := core.PeerID("peer-a")
+	mgr := &staticPeerManager{peers: []core.PeerID{peer}}
+
+	var (
+		verifyLock sync.Mutex
+		verified   int
+		startOnce  sync.Once
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	verifier := func(ctx context.Context, peerID core.PeerID, call func(method string, body, rsp interface{}) error) error {
+		verifyLock.Lock()
+		verified++
+		verifyLock.Unlock()
+
+		startOnce.Do(func() { close(started) })
+		<-release
+		return &PeerVerificationError{Err: fmt.Errorf("bad response to challenge")}
+	}
+
+	c := &client{
+		PeerManager:     mgr,
+		host:            &recordingHost{},
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		verifiedPeers:   make(map[core.PeerID]time.Time),
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithFirstContactVerification(verifier, time.Hour)(c)
+
+	// The first call is cancelled while the verification is in progress.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelledCh := make(chan error, 1)
+	go func() {
+		cancelledCh <- c.verifyPeer(ctx, peer, "Test", time.Minute)
+	}()
+	<-started
+
+	const numCalls = 10
+	errCh := make(chan error, numCalls)
+	for i := 0; i < numCalls; i++ {
+		go func() {
+			errCh <- c.verifyPeer(context.Background(), peer, "Test", time.Minute)
+		}()
+	}
+
+	cancel()
+	require.ErrorIs(<-cancelledCh, context.Canceled, "cancelled call should return immediately")
+
+	// Give the remaining calls a chance to wait for the verification in progress.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < numCalls; i++ {
+		err := <-errCh
+		var verr *PeerVerificationError
+		require.True(errors.As(err, &verr), "verifyPeer should fail for all concurrent calls")
+		require.True(p2pError.IsPermanent(err), "rejected peers should not be retried")
+	}
+	require.Equal(1, verified, "concurrent calls should share a single verification")
+	require.EqualValues([]core.PeerID{peer}, mgr.badPeers, "peer failing verification should be recorded once")
+}
+
+func TestClientVerificationFailure(t *testing.T) {
+	require := require.New(t)
+
+	peer := core.PeerID("peer-a")
+	mgr := &staticPeerManager{peers: []core.PeerID{peer}}
+
+	var verified int
+	verifier := func(ctx context.Context, peerID core.PeerID, call func(method string, body, rsp interface{}) error) error {
+		verified++
+		if _, ok := ctx.Deadline(); !ok {
+			return fmt.Errorf("verification without deadline")
+		}
+		return fmt.Errorf("stream reset")
+	}
+
+	c := &client{
+		PeerManager:     mgr,
+		host:            &recordingHost{},
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		verifiedPeers:   make(map[core.PeerID]time.Time),
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithFirstContactVerification(verifier, time.Hour)(c)
+
+	err := c.verifyPeer(context.Background(), peer, "Test", time.Second)
+	require.Error(err, "verifyPeer should fail")
+	require.Contains(err.Error(), "stream reset")
+	require.False(p2pError.IsPermanent(err), "failures to verify the peer should be retryable")
+	require.Empty(mgr.badPeers, "peers that could not be verified should not be recorded as bad")
+
+	err = c.verifyPeer(context.Background(), peer, "Test", time.Second)
+	require.Error(err, "verifyPeer should fail")
+	require.Equal(2, verified, "peers that could not be verified should be verified again")
+}
+
+func TestClientHeightCache(t *testing.T) {
+	require := require.New(t)
+
+	type request struct {
+		Height uint64 `json:"height"`
+	}
+
+	peers := []core.PeerID{"peer-a"}
+	host := &recordingHost{}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: peers},
+		host:            host,
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		cachedMethods:   make(map[string]HeightFunc),
+		cache:           newResponseCache(DefaultHeightCacheSize),
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithHeightCache("Cached", func(body interface{}) (uint64, bool) {
+		rq := body.(*request)
+		// Only heights up to 10 are considered finalized.
+		return rq.Height, rq.Height <= 10
+	})(c)
+
+	// Populate the cache as if a response was received and accepted by the caller.
+	body := &request{Height: 5}
+	key, ok := c.getCacheKey("Cached", body, &Request{Method: "Cached", Body: cbor.Marshal(body)})
+	require.True(ok, "request should be cacheable")
+	pf := &cachingPeerFeedback{PeerFeedback: NewNopPeerFeedback(), c: c, key: key, rsp: cbor.Marshal("response")}
+	pf.RecordSuccess()
+
+	var rsp string
+	_, err := c.Call(context.Background(), "Cached", body, &rsp, time.Second)
+	require.NoError(err, "Call should be served from the cache")
+	require.Equal("response", rsp, "cached response should be returned")
+	require.Empty(host.contacted, "no peers should be contacted for cached responses")
+
+	// Different heights or methods should not be served from the cache.
+	_, err = c.Call(context.Background(), "Cached", &request{Height: 6}, &rsp, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	_, err = c.Call(context.Background(), "Uncached", body, &rsp, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.Len(host.contacted, 2, "peers should be contacted for uncached responses")
+
+	// Non-finalized heights should not be cacheable.
+	_, ok = c.getCacheKey("Cached", &request{Height: 11}, &Request{Method: "Cached", Body: cbor.Marshal(&request{Height: 11})})
+	require.False(ok, "request for non-finalized height should not be cacheable")
+
+	// Invalidation should remove the cached response.
+	c.InvalidateCachedResponses("Cached", 5)
+	_, err = c.Call(context.Background(), "Cached", body, &rsp, time.Second)
+	require.Error(err, "Call should fail after invalidation as no peers are reachable")
+	require.Len(host.contacted, 3, "peers should be contacted after invalidation")
+}
+
+func TestClientHeightCacheEviction(t *testing.T) {
+	require := require.New(t)
+
+	c := &client{
+		cachedMethods: make(map[string]HeightFunc),
+		cache:         newResponseCache(DefaultHeightCacheSize),
+	}
+	WithHeightCacheSize(2)(c)
+	WithHeightCache("Cached", func(body interface{}) (uint64, bool) {
+		return body.(uint64), true
+	})(c)
+
+	keys := make([]cacheKey, 3)
+	for i := range keys {
+		height := uint64(i)
+		var ok bool
+		keys[i], ok = c.getCacheKey("Cached", height, &Request{Method: "Cached", Body: cbor.Marshal(height)})
+		require.True(ok, "request should be cacheable")
+	}
+
+	c.cacheResponse(keys[0], cbor.Marshal("a"))
+	c.cacheResponse(keys[1], cbor.Marshal("b"))
+	// Use the first response so that the second one is the least recently used.
+	_, ok := c.getCachedResponse(keys[0])
+	require.True(ok, "response should be cached")
+	c.cacheResponse(keys[2], cbor.Marshal("c"))
+
+	require.EqualValues(2, c.cache.Size(), "cache should be bounded")
+	_, ok = c.getCachedResponse(keys[1])
+	require.False(ok, "least recently used response should be evicted")
+	_, ok = c.getCachedResponse(keys[0])
+	require.True(ok, "recently used response should be retained")
+	_, ok = c.getCachedResponse(keys[2])
+	require.True(ok, "new response should be cached")
+}
+
+// recordedSpan is a span recorded by recordingTracer.
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	events []string
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) AddEvent(name string) {
+	s.events = append(s.events, name)
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+// recordingTracer is a tracer that records all started spans.
+type recordingTracer struct {
+	sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.Lock()
+	defer t.Unlock()
+
+	span := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestClientTracing(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a"}
+	tracer := &recordingTracer{}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: peers},
+		host:            &recordingHost{},
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithTracer(tracer)(c)
+
+	_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+
+	require.Len(tracer.spans, 3, "Call should create spans for the call, the peer call and the request")
+	for i, name := range []string{"rpc.Call", "rpc.call", "rpc.sendRequest"} {
+		span := tracer.spans[i]
+		require.Equal(name, span.name, "span name")
+		require.True(span.ended, "span should be ended")
+		require.Error(span.err, "span should record the error")
+		require.Equal("Test", span.attrs[AttributeMethod], "span method attribute")
+		require.Equal(c.runtimeID.String(), span.attrs[AttributeRuntimeID], "span runtime ID attribute")
+		require.Equal(OutcomeFailure, span.attrs[AttributeOutcome], "span outcome attribute")
+	}
+	require.Nil(tracer.spans[0].attrs[AttributePeerID], "call span should not have a peer ID")
+	require.Equal(peers[0].String(), tracer.spans[1].attrs[AttributePeerID], "peer call span peer ID attribute")
+	require.Empty(tracer.spans[2].events, "no stream should be opened")
+}
+
+type traceContextKey struct{}
+
+// propagatingTracer is a recording tracer that propagates span names as the trace context.
+type propagatingTracer struct {
+	recordingTracer
+}
+
+func (t *propagatingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	_, span := t.recordingTracer.Start(ctx, name, attrs...)
+	span.(*recordedSpan).parent, _ = ctx.Value(traceContextKey{}).(string)
+	return context.WithValue(ctx, traceContextKey{}, name), span
+}
+
+func (t *propagatingTracer) Inject(ctx context.Context) map[string]string {
+	name, ok := ctx.Value(traceContextKey{}).(string)
+	if !ok {
+		return nil
+	}
+	return map[string]string{"span": name}
+}
+
+func (t *propagatingTracer) Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, "remote:"+traceContext["span"])
+}
+
+type echoService struct{}
+
+func (echoService) HandleRequest(ctx context.Context, method string, body cbor.RawMessage) (interface{}, error) {
+	return body, nil
+}
+
+func TestTracePropagation(t *testing.T) {
+	require := require.New(t)
+
+	var rsp bytes.Buffer
+	err := cbor.NewMessageCodec(&rsp, t.Name()).Write(&Response{Ok: cbor.Marshal(42)})
+	require.NoError(err, "Write")
+
+	stream := &scriptedStream{response: &rsp}
+	clientTracer := &propagatingTracer{}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: []core.PeerID{"peer-a"}},
+		host:            &scriptedHost{stream: stream},
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		codec:           CBORCodec,
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithTracer(clientTracer)(c)
+
+	_, err = c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.NoError(err, "Call")
+	require.Len(clientTracer.spans, 3)
+	require.IsType(float64(0), clientTracer.spans[1].attrs[AttributeLatency], "peer call span should record latency")
+
+	var request Request
+	err = cbor.NewMessageCodec(&stream.request, t.Name()).Read(&request)
+	require.NoError(err, "Read")
+	require.Equal(map[string]string{"span": "rpc.sendRequest"}, request.TraceContext, "trace context should be propagated")
+
+	serverTracer := &propagatingTracer{}
+	srv := NewServer(c.runtimeID, "test", version.Version{}, echoService{}, WithServerTracer(serverTracer)).(*server)
+	_, err = srv.processRequest(&request, "peer-b")
+	require.NoError(err, "processRequest")
+	require.Len(serverTracer.spans, 1)
+	span := serverTracer.spans[0]
+	require.Equal("rpc.HandleRequest", span.name)
+	require.Equal("remote:rpc.sendRequest", span.parent, "server should continue the propagated trace")
+	require.Equal(core.PeerID("peer-b").String(), span.attrs[AttributePeerID])
+	require.Equal(OutcomeSuccess, span.attrs[AttributeOutcome])
+	require.True(span.ended, "span should be ended")
+
+	// The trace context should not be propagated without a propagating tracer.
+	stream.request.Reset()
+	err = cbor.NewMessageCodec(&rsp, t.Name()).Write(&Response{Ok: cbor.Marshal(42)})
+	require.NoError(err, "Write")
+	WithTracer(&recordingTracer{})(c)
+	_, err = c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.NoError(err, "Call")
+	var untraced Request
+	err = cbor.NewMessageCodec(&stream.request, t.Name()).Read(&untraced)
+	require.NoError(err, "Read")
+	require.Nil(untraced.TraceContext, "trace context should not be propagated")
+}
+
+func TestClientTracingDisabled(t *testing.T) {
+	require := require.New(t)
+
+	c := &client{}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, span := c.startSpan(context.Background(), "rpc.Call", "Test", "peer-a")
+		span.AddEvent(EventStreamOpened)
+		endSpan(span, nil)
+	})
+	require.Zero(allocs, "disabled tracing should not allocate")
+}
+
+// blockingHost is a host that blocks opening streams until released or until the context is done.
+type blockingHost struct {
+	core.Host
+
+	enteredCh chan struct{}
+	releaseCh chan struct{}
+}
+
+func (h *blockingHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	h.enteredCh <- struct{}{}
+	select {
+	case <-h.releaseCh:
+		return nil, fmt.Errorf("not connected")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newBlockingClient(mgr *staticPeerManager) (*client, *blockingHost) {
+	host := &blockingHost{
+		enteredCh: make(chan struct{}),
+		releaseCh: make(chan struct{}),
+	}
+	return &client{
+		PeerManager:     mgr,
+		host:            host,
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		streamPool:      newStreamPool(1, time.Minute),
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}, host
+}
+
+func TestClientShutdown(t *testing.T) {
+	require := require.New(t)
+
+	mgr := &staticPeerManager{peers: []core.PeerID{"peer-a"}}
+	c, host := newBlockingClient(mgr)
+
+	callErrCh := make(chan error)
+	go func() {
+		_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+		callErrCh <- err
+	}()
+	<-host.enteredCh
+
+	shutdownErrCh := make(chan error)
+	go func() {
+		shutdownErrCh <- c.Shutdown(context.Background())
+	}()
+
+	// New calls should be rejected while shutting down.
+	require.Eventually(func() bool {
+		c.shutdownLock.Lock()
+		defer c.shutdownLock.Unlock()
+		return c.shuttingDown
+	}, time.Second, 10*time.Millisecond, "client should be shutting down")
+	_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.ErrorIs(err, ErrShuttingDown, "Call should fail after Shutdown")
+	_, _, err = c.CallMulti(context.Background(), "Test", nil, struct{}{}, time.Second, 1, 0)
+	require.ErrorIs(err, ErrShuttingDown, "CallMulti should fail after Shutdown")
+
+	// Shutdown should wait for the in-flight call before releasing resources.
+	select {
+	case <-shutdownErrCh:
+		require.Fail("Shutdown should wait for in-flight calls")
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Zero(mgr.stopped, "peer manager should not be stopped while calls are in flight")
+	require.False(c.streamPool.closed, "stream pool should not be closed while calls are in flight")
+
+	close(host.releaseCh)
+	require.Error(<-callErrCh, "in-flight call should complete")
+	require.NoError(<-shutdownErrCh, "Shutdown")
+	require.Equal(1, mgr.stopped, "peer manager should be stopped")
+	require.True(c.streamPool.closed, "stream pool should be closed")
+}
+
+func TestClientShutdownTimeout(t *testing.T) {
+	require := require.New(t)
+
+	mgr := &staticPeerManager{peers: []core.PeerID{"peer-a"}}
+	c, host := newBlockingClient(mgr)
+
+	callErrCh := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+		callErrCh <- err
+	}()
+	<-host.enteredCh
+
+	// Once the context is done, in-flight calls should be aborted and waited for.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.Shutdown(ctx)
+	require.ErrorIs(err, context.DeadlineExceeded, "Shutdown should time out while a call is in flight")
+	select {
+	case err = <-callErrCh:
+		require.Error(err, "in-flight call should be aborted")
+	case <-time.After(time.Second):
+		require.Fail("in-flight call should be aborted by Shutdown")
+	}
+	require.Equal(1, mgr.stopped, "peer manager should be stopped")
+	require.True(c.streamPool.closed, "stream pool should be closed")
+}
+
+func TestClientClose(t *testing.T) {
+	require := require.New(t)
+
+	mgr := &staticPeerManager{peers: []core.PeerID{"peer-a"}}
+	c := &client{
+		PeerManager:     mgr,
+		host:            &recordingHost{},
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		streamPool:      newStreamPool(1, time.Minute),
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	err := c.Close()
+	require.NoError(err, "Close")
+	require.Equal(1, mgr.stopped, "peer manager should be stopped")
+	require.True(c.streamPool.closed, "stream pool should be closed")
+
+	_, err = c.Call(context.Background(), "Test", nil, nil, time.Second)
+	require.ErrorIs(err, ErrClosed, "Call should fail after Close")
+	_, _, err = c.CallMulti(context.Background(), "Test", nil, struct{}{}, time.Second, 1, 0)
+	require.ErrorIs(err, ErrClosed, "CallMulti should fail after Close")
+
+	err = c.Close()
+	require.NoError(err, "Close should be idempotent")
+}
+
+func TestClientCloseInFlight(t *testing.T) {
+	require := require.New(t)
+
+	mgr := &staticPeerManager{peers: []core.PeerID{"peer-a"}}
+	c, host := newBlockingClient(mgr)
+
+	callErrCh := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), "Test", nil, nil, time.Second)
+		callErrCh <- err
+	}()
+	<-host.enteredCh
+
+	// Close should abort the in-flight call and wait for it before releasing resources.
+	err := c.Close()
+	require.NoError(err, "Close")
+	select {
+	case err = <-callErrCh:
+		require.Error(err, "in-flight call should be aborted")
+	case <-time.After(time.Second):
+		require.Fail("in-flight call should be aborted by Close")
+	}
+	require.Equal(1, mgr.stopped, "peer manager should be stopped")
+	require.True(c.streamPool.closed, "stream pool should be closed")
+}
+
+func TestClientWriteDeadline(t *testing.T) {
+	require := require.New(t)
+
+	c := &client{}
+	require.Equal(RequestWriteDeadline, c.getWriteDeadline(newCallOptions()), "default deadline should be used")
+
+	WithRequestWriteDeadline(time.Minute)(c)
+	require.Equal(time.Minute, c.getWriteDeadline(newCallOptions()), "client deadline should be used")
+	require.Equal(time.Hour, c.getWriteDeadline(newCallOptions(WithCallWriteDeadline(time.Hour))), "per-call deadline should override the client deadline")
+	require.Equal(time.Minute, c.getWriteDeadline(newCallOptions(WithCallWriteDeadline(0))), "zero per-call deadline should be ignored")
+}
+
+// stallingStream is a stream that never responds until it is reset.
+type stallingStream struct {
+	network.Stream
+
+	resetOnce sync.Once
+	resetCh   chan struct{}
+}
+
+func (s *stallingStream) Read(p []byte) (int, error) {
+	<-s.resetCh
+	return 0, fmt.Errorf("stream reset")
+}
+
+func (s *stallingStream) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (s *stallingStream) Protocol() protocol.ID {
+	return "/test/1.0.0"
+}
+
+func (s *stallingStream) Close() error {
+	return nil
+}
+
+func (s *stallingStream) Reset() error {
+	s.resetOnce.Do(func() { close(s.resetCh) })
+	return nil
+}
+
+func (s *stallingStream) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (s *stallingStream) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// stallingHost is a host where all peers stall until their streams are reset.
+type stallingHost struct {
+	core.Host
+
+	sync.Mutex
+	streams []*stallingStream
+	openCh  chan struct{}
+}
+
+func (h *stallingHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	stream := &stallingStream{resetCh: make(chan struct{})}
+	h.streams = append(h.streams, stream)
+	h.openCh <- struct{}{}
+	return stream, nil
+}
+
+func TestClientCallMultiCancel(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b"}
+	mgr := &staticPeerManager{peers: peers}
+	host := &stallingHost{openCh: make(chan struct{}, len(peers))}
+	c := &client{
+		PeerManager:     mgr,
+		host:            host,
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		_, _, err := c.CallMulti(ctx, "Test", nil, struct{}{}, time.Hour, 2, 0)
+		errCh <- err
+	}()
+	for range peers {
+		<-host.openCh
+	}
+	cancel()
+	require.ErrorIs(<-errCh, context.Canceled, "CallMulti should fail once the context is cancelled")
+
+	// In-flight calls should be aborted promptly.
+	done := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		require.Fail("in-flight calls should be aborted")
+	}
+
+	host.Lock()
+	defer host.Unlock()
+	for _, stream := range host.streams {
+		select {
+		case <-stream.resetCh:
+		default:
+			require.Fail("streams of aborted calls should be reset")
+		}
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+	require.Empty(mgr.failures, "aborted calls should not be recorded as failures")
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"io"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+// ErrMessageTooLarge is the error that message codecs return when a message exceeds the
+// configured maximum size.
+var ErrMessageTooLarge = cbor.ErrMessageTooLarge
+
+// MessageCodec reads and writes length-prefixed messages from and to a stream.
+type MessageCodec interface {
+	// Read deserializes a single message from the underlying stream.
+	//
+	// It must fail with ErrMessageTooLarge before reading the message itself in case the message
+	// exceeds the maximum read size.
+	Read(msg interface{}) error
+
+	// Write serializes a single message to the underlying stream.
+	//
+	// It must fail with ErrMessageTooLarge without writing anything in case the message exceeds
+	// the maximum write size.
+	Write(msg interface{}) error
+}
+
+// Codec is the wire format used by the RPC client.
+//
+// The codec is used both for the Request and Response envelopes and for the method-specific
+// request and response bodies. The bodies are treated as opaque bytes within the envelopes.
+type Codec interface {
+	// Marshal serializes the given value.
+	Marshal(v interface{}) []byte
+
+	// Unmarshal deserializes the given data into the given value.
+	Unmarshal(data []byte, v interface{}) error
+
+	// NewMessageCodec creates a new message codec for the given stream that refuses to read and
+	// write messages larger than the given sizes.
+	NewMessageCodec(rw io.ReadWriter, module string, maxReadSize, maxWriteSize uint32) MessageCodec
+}
+
+type cborCodec struct{}
+
+func (cborCodec) Marshal(v interface{}) []byte {
+	return cbor.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
+
+func (cborCodec) NewMessageCodec(rw io.ReadWriter, module string, maxReadSize, maxWriteSize uint32) MessageCodec {
+	return cbor.NewMessageCodecWithLimits(rw, module, maxReadSize, maxWriteSize)
+}
+
+// CBORCodec is the default codec which uses CBOR as the wire format.
+var CBORCodec Codec = cborCodec{}
@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+)
+
+// jsonCodec is a codec which uses length-prefixed JSON as the wire format.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) NewMessageCodec(rw io.ReadWriter, module string, maxReadSize, maxWriteSize uint32) MessageCodec {
+	return &jsonMessageCodec{rw, maxReadSize, maxWriteSize}
+}
+
+type jsonMessageCodec struct {
+	rw           io.ReadWriter
+	maxReadSize  uint32
+	maxWriteSize uint32
+}
+
+func (c *jsonMessageCodec) Read(msg interface{}) error {
+	var length uint32
+	if err := binary.Read(c.rw, binary.BigEndian, &length); err != nil {
+		return err
+	}
+	if length > c.maxReadSize {
+		return ErrMessageTooLarge
+	}
+	return json.NewDecoder(io.LimitReader(c.rw, int64(length))).Decode(msg)
+}
+
+func (c *jsonMessageCodec) Write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if uint64(len(data)) > uint64(c.maxWriteSize) {
+		return ErrMessageTooLarge
+	}
+	if err = binary.Write(c.rw, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = c.rw.Write(data)
+	return err
+}
+
+func TestClientCodec(t *testing.T) {
+	require := require.New(t)
+
+	type request struct {
+		Name string `json:"name"`
+	}
+	type response struct {
+		Greeting string `json:"greeting"`
+	}
+
+	codec := jsonCodec{}
+
+	var rsp bytes.Buffer
+	err := codec.NewMessageCodec(&rsp, t.Name(), 0, DefaultMaxResponseSize).Write(&Response{
+		Ok: codec.Marshal(&response{Greeting: "hello"}),
+	})
+	require.NoError(err, "Write")
+
+	stream := &scriptedStream{response: &rsp}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: []core.PeerID{"peer-a"}},
+		host:            &scriptedHost{stream: stream},
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+	WithCodec(codec)(c)
+
+	var result response
+	_, err = c.Call(context.Background(), "Greet", &request{Name: "world"}, &result, time.Second)
+	require.NoError(err, "Call")
+	require.Equal("hello", result.Greeting, "response should be decoded using the configured codec")
+
+	var sent Request
+	err = codec.NewMessageCodec(&stream.request, t.Name(), DefaultMaxRequestSize, 0).Read(&sent)
+	require.NoError(err, "request should be encoded using the configured codec")
+	require.Equal("Greet", sent.Method)
+
+	var sentBody request
+	err = codec.Unmarshal(sent.Body, &sentBody)
+	require.NoError(err, "request body should be encoded using the configured codec")
+	require.Equal("world", sentBody.Name)
+}
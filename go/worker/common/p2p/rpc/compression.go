@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+// Compression is the compression codec used for request and response bodies.
+type Compression uint8
+
+const (
+	// CompressionNone means that bodies are not compressed.
+	CompressionNone Compression = 0
+	// CompressionSnappy means that bodies are compressed using snappy.
+	CompressionSnappy Compression = 1
+)
+
+// String returns a string representation of the compression codec.
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("[unknown: %d]", uint8(c))
+	}
+}
+
+// compress compresses the given data using the given compression codec.
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", c)
+	}
+}
+
+// decompress decompresses the given data using the given compression codec, refusing to produce
+// more than maxSize bytes.
+func decompress(c Compression, data []byte, maxSize uint32) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, fmt.Errorf("malformed compressed data: %w", err)
+		}
+		if uint64(n) > uint64(maxSize) {
+			return nil, fmt.Errorf("decompressed data too large (%d bytes)", n)
+		}
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", c)
+	}
+}
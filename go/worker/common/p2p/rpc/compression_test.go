@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+type testBatchResponse struct {
+	Round  uint64   `json:"round"`
+	Hashes []string `json:"hashes"`
+	Txs    [][]byte `json:"txs"`
+}
+
+func newTestBatchResponse(n int) *testBatchResponse {
+	rsp := &testBatchResponse{Round: 42}
+	for i := 0; i < n; i++ {
+		rsp.Hashes = append(rsp.Hashes, fmt.Sprintf("%064x", i))
+		rsp.Txs = append(rsp.Txs, []byte(fmt.Sprintf(`{"method":"transfer","nonce":%d,"to":"oasis1qzdc7","amount":1000}`, i)))
+	}
+	return rsp
+}
+
+func TestCompression(t *testing.T) {
+	require := require.New(t)
+
+	data := cbor.Marshal(newTestBatchResponse(100))
+	for _, c := range []Compression{CompressionNone, CompressionSnappy} {
+		compressed, err := compress(c, data)
+		require.NoError(err, "compress (%s)", c)
+		decompressed, err := decompress(c, compressed, cbor.DefaultMaxMessageSize)
+		require.NoError(err, "decompress (%s)", c)
+		require.EqualValues(data, decompressed, "round trip should preserve data (%s)", c)
+	}
+
+	_, err := compress(Compression(42), data)
+	require.Error(err, "compress should fail with an unsupported codec")
+	_, err = decompress(Compression(42), data, cbor.DefaultMaxMessageSize)
+	require.Error(err, "decompress should fail with an unsupported codec")
+
+	_, err = decompress(CompressionSnappy, []byte("garbage"), cbor.DefaultMaxMessageSize)
+	require.Error(err, "decompress should fail with malformed data")
+
+	compressed, err := compress(CompressionSnappy, data)
+	require.NoError(err, "compress")
+	_, err = decompress(CompressionSnappy, compressed, uint32(len(data)-1))
+	require.Error(err, "decompress should fail with too large data")
+}
+
+func BenchmarkCompression(b *testing.B) {
+	data := cbor.Marshal(newTestBatchResponse(1000))
+
+	b.Run("Compress", func(b *testing.B) {
+		var compressed []byte
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			compressed, _ = compress(CompressionSnappy, data)
+		}
+		b.ReportMetric(float64(len(data))/float64(len(compressed)), "ratio")
+	})
+
+	b.Run("Decompress", func(b *testing.B) {
+		compressed, _ := compress(CompressionSnappy, data)
+		b.SetBytes(int64(len(data)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_, _ = decompress(CompressionSnappy, compressed, cbor.DefaultMaxMessageSize)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/metrics"
+)
+
+var (
+	rpcCallLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "oasis_p2p_rpc_call_latency",
+			Help: "P2P RPC call latency (seconds).",
+		},
+		[]string{"protocol", "method"},
+	)
+	rpcCallSuccesses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oasis_p2p_rpc_call_successes",
+			Help: "Number of successful P2P RPC calls.",
+		},
+		[]string{"protocol", "method"},
+	)
+	rpcCallFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oasis_p2p_rpc_call_failures",
+			Help: "Number of failed P2P RPC calls.",
+		},
+		[]string{"protocol", "method"},
+	)
+	rpcCallBadPeers = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oasis_p2p_rpc_call_bad_peers",
+			Help: "Number of P2P RPC calls where the peer was recorded as bad.",
+		},
+		[]string{"protocol", "method"},
+	)
+	rpcReachablePeers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oasis_p2p_rpc_reachable_peers",
+			Help: "Number of peers considered reachable by the P2P RPC client.",
+		},
+		[]string{"protocol"},
+	)
+
+	rpcCollectors = []prometheus.Collector{
+		rpcCallLatency,
+		rpcCallSuccesses,
+		rpcCallFailures,
+		rpcCallBadPeers,
+		rpcReachablePeers,
+	}
+
+	metricsOnce sync.Once
+)
+
+func initMetrics() {
+	metricsOnce.Do(func() {
+		prometheus.MustRegister(rpcCollectors...)
+	})
+}
+
+func callLabels(pid protocol.ID, method string) prometheus.Labels {
+	return prometheus.Labels{"protocol": string(pid), "method": method}
+}
+
+func recordCallSuccess(pid protocol.ID, method string, latency time.Duration) {
+	if !metrics.Enabled() {
+		return
+	}
+	rpcCallLatency.With(callLabels(pid, method)).Observe(latency.Seconds())
+	rpcCallSuccesses.With(callLabels(pid, method)).Inc()
+}
+
+func recordCallFailure(pid protocol.ID, method string, latency time.Duration) {
+	if !metrics.Enabled() {
+		return
+	}
+	rpcCallLatency.With(callLabels(pid, method)).Observe(latency.Seconds())
+	rpcCallFailures.With(callLabels(pid, method)).Inc()
+}
+
+func recordCallBadPeer(pid protocol.ID, method string) {
+	if !metrics.Enabled() {
+		return
+	}
+	rpcCallBadPeers.With(callLabels(pid, method)).Inc()
+}
+
+func recordReachablePeers(pid protocol.ID, count int) {
+	if !metrics.Enabled() {
+		return
+	}
+	rpcReachablePeers.With(prometheus.Labels{"protocol": string(pid)}).Set(float64(count))
+}
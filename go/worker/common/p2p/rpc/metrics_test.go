@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/oasis-node/cmd/common/metrics"
+)
+
+func TestClientMetrics(t *testing.T) {
+	require := require.New(t)
+
+	viper.Set(metrics.CfgMetricsMode, metrics.MetricsModePull)
+	defer viper.Set(metrics.CfgMetricsMode, metrics.MetricsModeNone)
+
+	const (
+		pid    = protocol.ID("/test/metrics/1.0.0")
+		method = "Test"
+	)
+	labels := callLabels(pid, method)
+
+	peers := []core.PeerID{"peer-a", "peer-b"}
+	c := &client{
+		PeerManager:     &staticPeerManager{peers: peers},
+		host:            &recordingHost{},
+		protocolID:      pid,
+		methodWeighting: make(map[string]PeerWeighting),
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		codec:           CBORCodec,
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	// Unreachable peers.
+	_, err := c.Call(context.Background(), method, nil, nil, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.EqualValues(2, testutil.ToFloat64(rpcCallFailures.With(labels)), "failures should be counted")
+	require.EqualValues(0, testutil.ToFloat64(rpcCallSuccesses.With(labels)))
+	require.EqualValues(2, testutil.ToFloat64(rpcReachablePeers.WithLabelValues(string(pid))), "reachable peers should be tracked")
+
+	// Successful call.
+	var rsp bytes.Buffer
+	err = cbor.NewMessageCodec(&rsp, t.Name()).Write(&Response{Ok: cbor.Marshal(42)})
+	require.NoError(err, "Write")
+	c.host = &scriptedHost{stream: &scriptedStream{response: &rsp}}
+
+	var result int
+	pf, err := c.Call(context.Background(), method, nil, &result, time.Second)
+	require.NoError(err, "Call")
+	require.EqualValues(1, testutil.ToFloat64(rpcCallSuccesses.With(labels)), "successes should be counted")
+	require.EqualValues(2, testutil.ToFloat64(rpcCallFailures.With(labels)))
+	require.EqualValues(0, testutil.ToFloat64(rpcCallBadPeers.With(labels)))
+
+	// Bad peers reported by the caller.
+	pf.RecordBadPeer()
+	require.EqualValues(1, testutil.ToFloat64(rpcCallBadPeers.With(labels)), "bad peers should be counted")
+
+	// Bad peers detected by the client.
+	err = cbor.NewMessageCodec(&rsp, t.Name()).Write(&Response{Ok: cbor.Marshal(make([]byte, 1024))})
+	require.NoError(err, "Write")
+	WithMaxResponseSize(512)(c)
+	c.PeerManager = &staticPeerManager{peers: peers[:1]}
+	_, err = c.Call(context.Background(), method, nil, nil, time.Second)
+	require.Error(err, "Call should fail with an oversized response")
+	require.EqualValues(2, testutil.ToFloat64(rpcCallBadPeers.With(labels)), "bad peers should be counted")
+}
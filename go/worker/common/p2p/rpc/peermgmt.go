@@ -2,6 +2,7 @@ package rpc
 
 import (
 	cryptorand "crypto/rand"
+	"math"
 	"math/rand"
 	"sort"
 	"sync"
@@ -25,6 +26,10 @@ const (
 	newPeerScoreMultiplier = 0.9
 )
 
+// latencyWindowSize is the number of most recent successful request latencies kept for each peer
+// in order to estimate latency percentiles.
+const latencyWindowSize = 128
+
 // Inverse alpha (1/alpha) values for computing the exponential moving average of latencies used for
 // peer scoring. Split into peer-local and global EMAs.
 const (
@@ -32,6 +37,26 @@ const (
 	globalInvAlpha = 25
 )
 
+// PeerWeighting is the weighting used to rank peers during peer selection.
+type PeerWeighting uint8
+
+const (
+	// PeerWeightingLatency ranks peers based on their observed latency and success rate.
+	PeerWeightingLatency PeerWeighting = iota
+	// PeerWeightingCapacity ranks peers based on their observed latency and success rate, scaled
+	// by the serving capacity advertised by each peer relative to the average advertised capacity.
+	//
+	// This makes high-capacity peers receive proportionally more calls, which is useful for
+	// bandwidth-heavy methods.
+	PeerWeightingCapacity
+	// PeerWeightingTailLatency ranks peers based on their observed 95th percentile latency and
+	// success rate.
+	//
+	// This avoids peers that are fast on average but occasionally very slow. Peers without enough
+	// latency measurements are ranked based on their average latency.
+	PeerWeightingTailLatency
+)
+
 // PeerManager is an interface for keeping track of peer statistics in order to guide peer selection
 // when performing RPC requests.
 type PeerManager interface {
@@ -54,28 +79,208 @@ type PeerManager interface {
 	// The peer will be ignored during peer selection.
 	RecordBadPeer(peerID core.PeerID)
 
+	// RecordCapacity records the serving capacity advertised by the given peer.
+	RecordCapacity(peerID core.PeerID, capacity uint64)
+
+	// ResetPeerStats resets all recorded statistics for the given peer, e.g., so that a peer that
+	// was slow during a congestion event can recover its standing.
+	ResetPeerStats(peerID core.PeerID)
+
+	// PeerLatencyPercentile returns the given percentile (in the range [0, 100]) of the latencies
+	// of recent successful interactions with the given peer. The boolean is false in case there
+	// are no such measurements.
+	PeerLatencyPercentile(peerID core.PeerID, percentile float64) (time.Duration, bool)
+
+	// PeerLatencyP50 returns the median latency of recent successful interactions with the given
+	// peer. The boolean is false in case there are no such measurements.
+	PeerLatencyP50(peerID core.PeerID) (time.Duration, bool)
+
+	// PeerLatencyP95 returns the 95th percentile latency of recent successful interactions with
+	// the given peer. The boolean is false in case there are no such measurements.
+	PeerLatencyP95(peerID core.PeerID) (time.Duration, bool)
+
 	// GetBestPeers returns a set of peers sorted by the probability that they will be able to
 	// answer our requests the fastest with some randomization.
-	GetBestPeers() []core.PeerID
+	GetBestPeers(opts ...BestPeersOption) []core.PeerID
+
+	// GetBestPeersWeighted returns a set of peers sorted by the probability that they will be able
+	// to answer our requests the fastest with some randomization, using the given weighting.
+	GetBestPeersWeighted(weighting PeerWeighting, opts ...BestPeersOption) []core.PeerID
+
+	// ExplainPeerSelection returns the rationale behind the peer ranking used by GetBestPeers.
+	ExplainPeerSelection() []PeerRank
+
+	// ExplainPeerSelectionWeighted returns the rationale behind the peer ranking used by
+	// GetBestPeersWeighted with the given weighting and options.
+	ExplainPeerSelectionWeighted(weighting PeerWeighting, opts ...BestPeersOption) []PeerRank
+
+	// Stop stops any background tasks of the peer manager and persists the peer reputation state
+	// in case persistence is enabled. Calling Stop multiple times is safe.
+	Stop() error
+}
+
+// BestPeersOption is an option that restricts the set of peers considered during peer selection.
+type BestPeersOption func(opts *bestPeersOptions)
+
+type bestPeersOptions struct {
+	maxCount     uint
+	maxStaleness time.Duration
+}
+
+// WithBestPeersLimit limits peer selection to at most the given number of best peers. Zero means
+// that the number of peers is not limited.
+func WithBestPeersLimit(count uint) BestPeersOption {
+	return func(opts *bestPeersOptions) {
+		opts.maxCount = count
+	}
+}
+
+// WithBestPeersMaxStaleness limits peer selection to peers that have been seen within the given
+// duration. A peer is seen when it is added or when an interaction with it is recorded. Zero means
+// that peers are not filtered by staleness.
+func WithBestPeersMaxStaleness(staleness time.Duration) BestPeersOption {
+	return func(opts *bestPeersOptions) {
+		opts.maxStaleness = staleness
+	}
+}
+
+func newBestPeersOptions(opts ...BestPeersOption) *bestPeersOptions {
+	var bo bestPeersOptions
+	for _, opt := range opts {
+		opt(&bo)
+	}
+	return &bo
+}
+
+// PeerRank describes how a peer was ranked during peer selection.
+type PeerRank struct {
+	// PeerID is the peer identifier.
+	PeerID core.PeerID
+	// Rank is the (zero-based) position of the peer when ordered by score.
+	Rank int
+	// LastSeen is the time when the peer was last added or interacted with.
+	LastSeen time.Time
+	// Shuffled is true iff the peer is among the best peers whose order is randomized during peer
+	// selection in order to spread load.
+	Shuffled bool
+
+	// Successes is the number of successful interactions with the peer.
+	Successes int
+	// Failures is the number of failed interactions with the peer.
+	Failures int
+	// SuccessRate is the ratio of successful interactions. It is zero for new peers.
+	SuccessRate float64
+	// AvgLatency is the exponential moving average of the peer's request latency. Each new
+	// measurement contributes 1/LatencyDecay of its deviation from the current average.
+	AvgLatency time.Duration
+	// LatencyDecay is the inverse smoothing factor of the peer latency moving average.
+	LatencyDecay int
+	// NewPeer is true iff there are no historical measurements for the peer, in which case its
+	// score is derived from the global average latency.
+	NewPeer bool
+
+	// P50Latency is the median latency of recent successful interactions with the peer (zero if
+	// there are no measurements).
+	P50Latency time.Duration
+	// P95Latency is the 95th percentile latency of recent successful interactions with the peer
+	// (zero if there are no measurements).
+	P95Latency time.Duration
+
+	// Capacity is the serving capacity advertised by the peer (zero if not advertised).
+	Capacity uint64
+	// CapacityWeight is the capacity weight applied to the score. It is one unless capacity
+	// weighting is used.
+	CapacityWeight float64
+
+	// Score is the final peer score (lower is better).
+	Score float64
+}
+
+// latencyWindow is a fixed-size window of the most recent latency measurements.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// percentile returns the given percentile (in the range [0, 100]) of the latencies in the window
+// using the nearest-rank method.
+func (w *latencyWindow) percentile(percentile float64) (time.Duration, bool) {
+	if len(w.samples) == 0 {
+		return 0, false
+	}
+
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	switch {
+	case percentile <= 0:
+		return sorted[0], true
+	case percentile >= 100:
+		return sorted[len(sorted)-1], true
+	default:
+		idx := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return sorted[idx], true
+	}
 }
 
 type peerStats struct {
 	successes         int
 	failures          int
 	avgRequestLatency time.Duration
+	latencies         latencyWindow
+
+	capacity uint64
+	lastSeen time.Time
 }
 
 // getScore returns the peer score (lower is better).
 func (ps *peerStats) getScore(avgRequestLatency time.Duration) float64 {
+	return ps.getScoreWithLatency(ps.avgRequestLatency, avgRequestLatency)
+}
+
+// getTailLatencyScore returns the peer score based on tail latency (lower is better).
+func (ps *peerStats) getTailLatencyScore(avgRequestLatency time.Duration) float64 {
+	latency, ok := ps.latencies.percentile(95)
+	if !ok {
+		latency = ps.avgRequestLatency
+	}
+	return ps.getScoreWithLatency(latency, avgRequestLatency)
+}
+
+func (ps *peerStats) getScoreWithLatency(peerLatency, avgRequestLatency time.Duration) float64 {
 	if ps.successes+ps.failures > 0 {
 		// We have some history for this peer.
 		failRate := float64(ps.failures) / float64(ps.failures+ps.successes)
-		return float64(ps.avgRequestLatency) + failRate*float64(avgRequestLatency)
+		return float64(peerLatency) + failRate*float64(avgRequestLatency)
 	} else {
 		return float64(avgRequestLatency) * newPeerScoreMultiplier
 	}
 }
 
+// getCapacityWeight returns the peer capacity weight relative to the average advertised capacity
+// (higher is better). Peers which did not advertise their capacity are treated as average.
+func (ps *peerStats) getCapacityWeight(avgCapacity float64) float64 {
+	if ps.capacity == 0 || avgCapacity == 0 {
+		return 1
+	}
+	return float64(ps.capacity) / avgCapacity
+}
+
 func (ps *peerStats) recordLatency(latency time.Duration) {
 	if ps.avgRequestLatency == 0 {
 		ps.avgRequestLatency = latency
@@ -89,12 +294,21 @@ func (ps *peerStats) recordLatency(latency time.Duration) {
 type peerManager struct {
 	sync.RWMutex
 
-	p2p        P2P
-	host       core.Host
-	protocolID protocol.ID
+	p2p         P2P
+	host        core.Host
+	protocolID  protocol.ID
+	protocolIDs map[protocol.ID]bool
 
 	peers        map[core.PeerID]*peerStats
-	ignoredPeers map[core.PeerID]bool
+	ignoredPeers map[core.PeerID]time.Time
+
+	// savedPeers are the persisted statistics of peers that are not currently tracked.
+	savedPeers  map[core.PeerID]*peerStats
+	persistence *ReputationPersistenceConfig
+	saveLock    sync.Mutex
+	saverDoneCh chan struct{}
+	stopCh      chan struct{}
+	stopOnce    sync.Once
 
 	avgRequestLatency time.Duration
 
@@ -110,10 +324,18 @@ func (mgr *peerManager) AddPeer(peerID core.PeerID) {
 		return
 	}
 	// Do not re-add ignored peers.
-	if mgr.ignoredPeers[peerID] {
+	if _, ignored := mgr.ignoredPeers[peerID]; ignored {
 		return
 	}
-	mgr.peers[peerID] = &peerStats{}
+	// Restore any previously persisted statistics.
+	ps, saved := mgr.savedPeers[peerID]
+	if saved {
+		delete(mgr.savedPeers, peerID)
+	} else {
+		ps = &peerStats{}
+	}
+	ps.lastSeen = time.Now()
+	mgr.peers[peerID] = ps
 
 	mgr.logger.Debug("added new peer",
 		"peer_id", peerID,
@@ -124,11 +346,16 @@ func (mgr *peerManager) RemovePeer(peerID core.PeerID) {
 	mgr.Lock()
 	defer mgr.Unlock()
 
-	if _, exists := mgr.peers[peerID]; !exists {
+	ps, exists := mgr.peers[peerID]
+	if !exists {
 		return
 	}
 
 	delete(mgr.peers, peerID)
+	if mgr.persistence != nil && ps.successes+ps.failures > 0 {
+		// Retain statistics of known peers so that they survive reconnects and restarts.
+		mgr.saveStatsLocked(peerID, ps)
+	}
 
 	mgr.logger.Debug("removed peer",
 		"peer_id", peerID,
@@ -144,7 +371,9 @@ func (mgr *peerManager) RecordSuccess(peerID core.PeerID, latency time.Duration)
 		return
 	}
 	ps.successes++
+	ps.lastSeen = time.Now()
 	ps.recordLatency(latency)
+	ps.latencies.add(latency)
 
 	// Update global stats.
 	if mgr.avgRequestLatency == 0 {
@@ -167,6 +396,7 @@ func (mgr *peerManager) RecordFailure(peerID core.PeerID, latency time.Duration)
 		return
 	}
 	ps.failures++
+	ps.lastSeen = time.Now()
 	ps.recordLatency(latency)
 }
 
@@ -175,30 +405,68 @@ func (mgr *peerManager) RecordBadPeer(peerID core.PeerID) {
 	defer mgr.Unlock()
 
 	mgr.p2p.BlockPeer(peerID)
-	mgr.ignoredPeers[peerID] = true
+	mgr.ignoredPeers[peerID] = time.Now()
 	delete(mgr.peers, peerID)
+	delete(mgr.savedPeers, peerID)
 }
 
-func (mgr *peerManager) GetBestPeers() []core.PeerID {
+func (mgr *peerManager) RecordCapacity(peerID core.PeerID, capacity uint64) {
 	mgr.Lock()
 	defer mgr.Unlock()
 
-	// Start by including all peers.
-	peers := make([]core.PeerID, 0, len(mgr.peers))
-	for peer := range mgr.peers {
-		peers = append(peers, peer)
+	ps, exists := mgr.peers[peerID]
+	if !exists {
+		return
 	}
+	ps.capacity = capacity
+	ps.lastSeen = time.Now()
+}
 
-	// Sort peers by success rate and latency.
-	sort.Slice(peers, func(i, j int) bool {
-		pi := mgr.peers[peers[i]]
-		pj := mgr.peers[peers[j]]
+func (mgr *peerManager) ResetPeerStats(peerID core.PeerID) {
+	mgr.Lock()
+	defer mgr.Unlock()
 
-		scoreI := pi.getScore(mgr.avgRequestLatency)
-		scoreJ := pj.getScore(mgr.avgRequestLatency)
+	ps, exists := mgr.peers[peerID]
+	if !exists {
+		return
+	}
+	// Retain the advertised capacity and last seen time as they are not measurements.
+	mgr.peers[peerID] = &peerStats{capacity: ps.capacity, lastSeen: ps.lastSeen}
+}
 
-		return scoreI < scoreJ
-	})
+func (mgr *peerManager) PeerLatencyPercentile(peerID core.PeerID, percentile float64) (time.Duration, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	ps, exists := mgr.peers[peerID]
+	if !exists {
+		return 0, false
+	}
+	return ps.latencies.percentile(percentile)
+}
+
+func (mgr *peerManager) PeerLatencyP50(peerID core.PeerID) (time.Duration, bool) {
+	return mgr.PeerLatencyPercentile(peerID, 50)
+}
+
+func (mgr *peerManager) PeerLatencyP95(peerID core.PeerID) (time.Duration, bool) {
+	return mgr.PeerLatencyPercentile(peerID, 95)
+}
+
+func (mgr *peerManager) GetBestPeers(opts ...BestPeersOption) []core.PeerID {
+	return mgr.GetBestPeersWeighted(PeerWeightingLatency, opts...)
+}
+
+func (mgr *peerManager) GetBestPeersWeighted(weighting PeerWeighting, opts ...BestPeersOption) []core.PeerID {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	bo := newBestPeersOptions(opts...)
+	ranks := mgr.rankPeersLocked(weighting, bo.maxStaleness)
+	peers := make([]core.PeerID, 0, len(ranks))
+	for _, rank := range ranks {
+		peers = append(peers, rank.PeerID)
+	}
 
 	// Randomize the first few peers.
 	shufflePeerCount := ShuffledBestPeerCount
@@ -212,9 +480,149 @@ func (mgr *peerManager) GetBestPeers() []core.PeerID {
 		bestPeers[i], bestPeers[j] = bestPeers[j], bestPeers[i]
 	})
 
+	if bo.maxCount > 0 && uint(len(peers)) > bo.maxCount {
+		peers = peers[:bo.maxCount]
+	}
 	return peers
 }
 
+func (mgr *peerManager) ExplainPeerSelection() []PeerRank {
+	return mgr.ExplainPeerSelectionWeighted(PeerWeightingLatency)
+}
+
+func (mgr *peerManager) ExplainPeerSelectionWeighted(weighting PeerWeighting, opts ...BestPeersOption) []PeerRank {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	bo := newBestPeersOptions(opts...)
+	ranks := mgr.rankPeersLocked(weighting, bo.maxStaleness)
+	if bo.maxCount > 0 && uint(len(ranks)) > bo.maxCount {
+		ranks = ranks[:bo.maxCount]
+	}
+	return ranks
+}
+
+// rankPeersLocked scores all peers using the given weighting and returns them sorted by score.
+//
+// In case maxStaleness is non-zero, peers that have not been seen within it are omitted.
+func (mgr *peerManager) rankPeersLocked(weighting PeerWeighting, maxStaleness time.Duration) []PeerRank {
+	var avgCapacity float64
+	if weighting == PeerWeightingCapacity {
+		avgCapacity = mgr.getAvgCapacityLocked()
+	}
+
+	now := time.Now()
+	ranks := make([]PeerRank, 0, len(mgr.peers))
+	for peerID, ps := range mgr.peers {
+		if maxStaleness > 0 && now.Sub(ps.lastSeen) > maxStaleness {
+			continue
+		}
+
+		rank := PeerRank{
+			PeerID:         peerID,
+			LastSeen:       ps.lastSeen,
+			Successes:      ps.successes,
+			Failures:       ps.failures,
+			AvgLatency:     ps.avgRequestLatency,
+			LatencyDecay:   peerInvAlpha,
+			NewPeer:        ps.successes+ps.failures == 0,
+			Capacity:       ps.capacity,
+			CapacityWeight: 1,
+			Score:          ps.getScore(mgr.avgRequestLatency),
+		}
+		if !rank.NewPeer {
+			rank.SuccessRate = float64(ps.successes) / float64(ps.successes+ps.failures)
+		}
+		rank.P50Latency, _ = ps.latencies.percentile(50)
+		rank.P95Latency, _ = ps.latencies.percentile(95)
+		if weighting == PeerWeightingTailLatency {
+			rank.Score = ps.getTailLatencyScore(mgr.avgRequestLatency)
+		}
+		if weighting == PeerWeightingCapacity {
+			rank.CapacityWeight = ps.getCapacityWeight(avgCapacity)
+			rank.Score /= rank.CapacityWeight
+		}
+		ranks = append(ranks, rank)
+	}
+
+	// Sort peers by success rate and latency (and optionally capacity).
+	sort.Slice(ranks, func(i, j int) bool {
+		return ranks[i].Score < ranks[j].Score
+	})
+	for i := range ranks {
+		ranks[i].Rank = i
+		ranks[i].Shuffled = i < ShuffledBestPeerCount
+	}
+	return ranks
+}
+
+// weightedRandomPeerOrder orders the given ranked peers randomly with probability proportional to
+// the inverse of their score (lower scores are better).
+//
+// Peers with a zero score (e.g., when no latencies have been measured yet) are weighted the same
+// as the best scored peer.
+func weightedRandomPeerOrder(ranks []PeerRank, rng *rand.Rand) []core.PeerID {
+	minScore := math.Inf(1)
+	for _, rank := range ranks {
+		if rank.Score > 0 && rank.Score < minScore {
+			minScore = rank.Score
+		}
+	}
+	if math.IsInf(minScore, 1) {
+		minScore = 1
+	}
+
+	// Use weighted random sampling without replacement where each peer is assigned a random key
+	// drawn from an exponential distribution with a rate equal to its weight.
+	keys := make(map[core.PeerID]float64, len(ranks))
+	peers := make([]core.PeerID, 0, len(ranks))
+	for _, rank := range ranks {
+		score := math.Max(rank.Score, minScore)
+		weight := 1 / score
+		keys[rank.PeerID] = rng.ExpFloat64() / weight
+		peers = append(peers, rank.PeerID)
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return keys[peers[i]] < keys[peers[j]]
+	})
+	return peers
+}
+
+func (mgr *peerManager) Stop() (err error) {
+	mgr.stopOnce.Do(func() {
+		close(mgr.stopCh)
+
+		if mgr.persistence == nil {
+			return
+		}
+		// Wait for any in-progress periodic save to finish before the final save.
+		if mgr.saverDoneCh != nil {
+			<-mgr.saverDoneCh
+		}
+		err = mgr.saveReputation()
+	})
+	return
+}
+
+// getAvgCapacityLocked returns the average capacity advertised by peers that advertised it.
+func (mgr *peerManager) getAvgCapacityLocked() float64 {
+	var (
+		total uint64
+		count int
+	)
+	for _, ps := range mgr.peers {
+		if ps.capacity == 0 {
+			continue
+		}
+		total += ps.capacity
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count)
+}
+
 func (mgr *peerManager) peerProtocolWatcher() {
 	// Subscribe to peer protocol updates.
 	sub, err := mgr.host.EventBus().Subscribe([]interface{}{
@@ -230,7 +638,7 @@ func (mgr *peerManager) peerProtocolWatcher() {
 	defer sub.Close()
 
 	// Subscribe to peer disconnection events.
-	mgr.host.Network().Notify(&network.NotifyBundle{
+	notifiee := &network.NotifyBundle{
 		DisconnectedF: func(net network.Network, conn network.Conn) {
 			peer := conn.RemotePeer()
 			if len(net.ConnsToPeer(peer)) == 0 {
@@ -238,9 +646,22 @@ func (mgr *peerManager) peerProtocolWatcher() {
 				mgr.RemovePeer(peer)
 			}
 		},
-	})
+	}
+	mgr.host.Network().Notify(notifiee)
+	defer mgr.host.Network().StopNotify(notifiee)
+
+	for {
+		var ev interface{}
+		select {
+		case <-mgr.stopCh:
+			return
+		case ev = <-sub.Out():
+			if ev == nil {
+				// Subscription has been closed.
+				return
+			}
+		}
 
-	for ev := range sub.Out() {
 		switch evt := ev.(type) {
 		case event.EvtPeerIdentificationCompleted:
 			// New peer has completed the identification protocol handshake.
@@ -253,20 +674,20 @@ func (mgr *peerManager) peerProtocolWatcher() {
 			}
 
 			for _, p := range protocols {
-				if protocol.ID(p) == mgr.protocolID {
+				if mgr.protocolIDs[protocol.ID(p)] {
 					mgr.AddPeer(evt.Peer)
 				}
 			}
 		case event.EvtPeerProtocolsUpdated:
 			// Peer's protocols updated.
 			for _, p := range evt.Added {
-				if p == mgr.protocolID {
+				if mgr.protocolIDs[p] {
 					mgr.AddPeer(evt.Peer)
 				}
 			}
 
 			for _, p := range evt.Removed {
-				if p == mgr.protocolID {
+				if mgr.protocolIDs[p] && !mgr.supportsAnyProtocol(evt.Peer) {
 					mgr.RemovePeer(evt.Peer)
 				}
 			}
@@ -274,18 +695,60 @@ func (mgr *peerManager) peerProtocolWatcher() {
 	}
 }
 
+// supportsAnyProtocol checks whether the given peer still supports any of the tracked protocols.
+func (mgr *peerManager) supportsAnyProtocol(peerID core.PeerID) bool {
+	protocols := make([]string, 0, len(mgr.protocolIDs))
+	for p := range mgr.protocolIDs {
+		protocols = append(protocols, string(p))
+	}
+
+	supported, err := mgr.host.Peerstore().SupportsProtocols(peerID, protocols...)
+	if err != nil {
+		return false
+	}
+	return len(supported) > 0
+}
+
 // NewPeerManager creates a new peer manager for the given protocol.
-func NewPeerManager(p2p P2P, protocolID protocol.ID) PeerManager {
+//
+// Peers supporting any of the given legacy protocols are tracked as well. In case a persistence
+// configuration is given, previously persisted peer reputation state is reloaded and the state is
+// persisted periodically and when the peer manager is stopped.
+func NewPeerManager(
+	p2p P2P,
+	protocolID protocol.ID,
+	persistence *ReputationPersistenceConfig,
+	legacyProtocolIDs ...protocol.ID,
+) PeerManager {
+	protocolIDs := map[protocol.ID]bool{protocolID: true}
+	for _, pid := range legacyProtocolIDs {
+		protocolIDs[pid] = true
+	}
+
 	mgr := &peerManager{
 		p2p:          p2p,
 		host:         p2p.GetHost(),
 		protocolID:   protocolID,
+		protocolIDs:  protocolIDs,
 		peers:        make(map[core.PeerID]*peerStats),
-		ignoredPeers: make(map[core.PeerID]bool),
+		ignoredPeers: make(map[core.PeerID]time.Time),
+		savedPeers:   make(map[core.PeerID]*peerStats),
+		persistence:  persistence,
+		stopCh:       make(chan struct{}),
 		logger: logging.GetLogger("worker/common/p2p/rpc/peermgr").With(
 			"protocol_id", protocolID,
 		),
 	}
+	if persistence != nil {
+		if err := mgr.loadReputation(); err != nil {
+			mgr.logger.Warn("failed to load persisted peer reputation, starting from scratch",
+				"err", err,
+				"path", persistence.Path,
+			)
+		}
+		mgr.saverDoneCh = make(chan struct{})
+		go mgr.reputationSaver()
+	}
 	go mgr.peerProtocolWatcher()
 
 	return mgr
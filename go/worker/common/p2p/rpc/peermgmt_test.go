@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerManagerExplainPeerSelection(t *testing.T) {
+	require := require.New(t)
+
+	mgr := &peerManager{
+		peers: map[core.PeerID]*peerStats{
+			"peer-fast": {successes: 10, avgRequestLatency: 10 * time.Millisecond, capacity: 100},
+			"peer-slow": {successes: 5, failures: 5, avgRequestLatency: 50 * time.Millisecond, capacity: 900},
+			"peer-new":  {},
+		},
+		avgRequestLatency: 20 * time.Millisecond,
+	}
+
+	ranks := mgr.ExplainPeerSelection()
+	require.Len(ranks, 3, "all peers should be ranked")
+	for i, peerID := range []core.PeerID{"peer-fast", "peer-new", "peer-slow"} {
+		require.Equal(peerID, ranks[i].PeerID, "peers should be ordered by score")
+		require.Equal(i, ranks[i].Rank, "rank")
+		require.True(ranks[i].Shuffled, "peer should be among the shuffled best peers")
+		require.EqualValues(1, ranks[i].CapacityWeight, "capacity weight without capacity weighting")
+	}
+
+	fast := ranks[0]
+	require.EqualValues(1, fast.SuccessRate, "success rate")
+	require.False(fast.NewPeer, "peer with history should not be new")
+	require.EqualValues(10*time.Millisecond, fast.AvgLatency, "average latency")
+	require.Equal(float64(10*time.Millisecond), fast.Score, "score")
+
+	newPeer := ranks[1]
+	require.True(newPeer.NewPeer, "peer without history should be new")
+	require.Equal(float64(20*time.Millisecond)*newPeerScoreMultiplier, newPeer.Score, "score")
+
+	slow := ranks[2]
+	require.EqualValues(0.5, slow.SuccessRate, "success rate")
+	require.Equal(float64(60*time.Millisecond), slow.Score, "score")
+
+	// Capacity weighting should favor the high-capacity peer.
+	ranks = mgr.ExplainPeerSelectionWeighted(PeerWeightingCapacity)
+	for i, peerID := range []core.PeerID{"peer-new", "peer-slow", "peer-fast"} {
+		require.Equal(peerID, ranks[i].PeerID, "peers should be ordered by capacity-weighted score")
+	}
+	require.EqualValues(1.8, ranks[1].CapacityWeight, "capacity weight")
+	require.InDelta(float64(60*time.Millisecond)/1.8, ranks[1].Score, 1, "score")
+	require.EqualValues(0.2, ranks[2].CapacityWeight, "capacity weight")
+
+	// Selection should reflect the same ranking.
+	mgr.peers["peer-a"] = &peerStats{successes: 1, avgRequestLatency: 100 * time.Millisecond}
+	mgr.peers["peer-b"] = &peerStats{successes: 1, avgRequestLatency: 200 * time.Millisecond}
+	mgr.peers["peer-c"] = &peerStats{successes: 1, avgRequestLatency: 300 * time.Millisecond}
+	ranks = mgr.ExplainPeerSelection()
+	require.False(ranks[len(ranks)-1].Shuffled, "worst peer should not be shuffled")
+	peers := mgr.GetBestPeers()
+	require.Equal(ranks[len(ranks)-1].PeerID, peers[len(peers)-1], "worst peer should be selected last")
+}
+
+func TestPeerManagerLatencyPercentiles(t *testing.T) {
+	require := require.New(t)
+
+	mgr := &peerManager{
+		peers: map[core.PeerID]*peerStats{
+			"peer-steady": {},
+			"peer-spiky":  {},
+		},
+	}
+
+	_, ok := mgr.PeerLatencyP50("peer-steady")
+	require.False(ok, "there should be no measurements for a new peer")
+	_, ok = mgr.PeerLatencyP50("peer-unknown")
+	require.False(ok, "there should be no measurements for an unknown peer")
+
+	// Record measurements directly to avoid needing a host for connection manager tagging.
+	for i := 1; i <= 100; i++ {
+		mgr.peers["peer-steady"].successes++
+		mgr.peers["peer-steady"].recordLatency(20 * time.Millisecond)
+		mgr.peers["peer-steady"].latencies.add(20 * time.Millisecond)
+
+		latency := time.Duration(i) * time.Millisecond
+		if i > 90 {
+			latency = time.Second
+		}
+		mgr.peers["peer-spiky"].successes++
+		mgr.peers["peer-spiky"].recordLatency(latency)
+		mgr.peers["peer-spiky"].latencies.add(latency)
+	}
+	mgr.avgRequestLatency = 20 * time.Millisecond
+
+	p50, ok := mgr.PeerLatencyP50("peer-spiky")
+	require.True(ok)
+	require.Equal(50*time.Millisecond, p50, "median latency")
+	p95, ok := mgr.PeerLatencyP95("peer-spiky")
+	require.True(ok)
+	require.Equal(time.Second, p95, "95th percentile latency")
+	p100, ok := mgr.PeerLatencyPercentile("peer-spiky", 100)
+	require.True(ok)
+	require.Equal(time.Second, p100, "maximum latency")
+
+	// Tail latency weighting should penalize the spiky peer.
+	ranks := mgr.ExplainPeerSelectionWeighted(PeerWeightingTailLatency)
+	require.Equal(core.PeerID("peer-steady"), ranks[0].PeerID, "steady peer should be ranked first")
+	require.Equal(time.Second, ranks[1].P95Latency, "95th percentile latency")
+	require.Equal(float64(time.Second), ranks[1].Score, "score")
+
+	// The window should only keep the most recent measurements.
+	for i := 0; i < latencyWindowSize; i++ {
+		mgr.peers["peer-spiky"].latencies.add(10 * time.Millisecond)
+	}
+	p95, _ = mgr.PeerLatencyP95("peer-spiky")
+	require.Equal(10*time.Millisecond, p95, "old measurements should be forgotten")
+
+	// Resetting statistics should forget all measurements.
+	mgr.ResetPeerStats("peer-spiky")
+	_, ok = mgr.PeerLatencyP50("peer-spiky")
+	require.False(ok, "there should be no measurements after reset")
+	ranks = mgr.ExplainPeerSelection()
+	for _, rank := range ranks {
+		if rank.PeerID == "peer-spiky" {
+			require.True(rank.NewPeer, "peer should be treated as new after reset")
+		}
+	}
+}
+
+func TestWeightedRandomPeerOrder(t *testing.T) {
+	require := require.New(t)
+
+	ranks := []PeerRank{
+		{PeerID: "peer-fast", Score: 1},
+		{PeerID: "peer-new", Score: 0},
+		{PeerID: "peer-slow", Score: 100},
+	}
+
+	rng := rand.New(rand.NewSource(42)) // nolint: gosec
+	firsts := make(map[core.PeerID]int)
+	for i := 0; i < 1000; i++ {
+		peers := weightedRandomPeerOrder(ranks, rng)
+		require.ElementsMatch([]core.PeerID{"peer-fast", "peer-new", "peer-slow"}, peers, "all peers should be returned")
+		firsts[peers[0]]++
+	}
+	require.Greater(firsts["peer-fast"], 300, "fast peer should often be selected first")
+	require.Greater(firsts["peer-new"], 300, "new peer should be weighted as the best peer")
+	require.Less(firsts["peer-slow"], 50, "slow peer should rarely be selected first")
+
+	require.Empty(weightedRandomPeerOrder(nil, rng), "no peers")
+}
+
+func TestPeerManagerBestPeersOptions(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	mgr := &peerManager{
+		peers: map[core.PeerID]*peerStats{
+			"peer-fast":  {successes: 10, avgRequestLatency: 10 * time.Millisecond, lastSeen: now},
+			"peer-slow":  {successes: 10, avgRequestLatency: 50 * time.Millisecond, lastSeen: now},
+			"peer-stale": {successes: 10, avgRequestLatency: 5 * time.Millisecond, lastSeen: now.Add(-time.Hour)},
+		},
+		avgRequestLatency: 20 * time.Millisecond,
+	}
+
+	peers := mgr.GetBestPeers()
+	require.Len(peers, 3, "all peers should be returned by default")
+
+	peers = mgr.GetBestPeers(WithBestPeersMaxStaleness(time.Minute))
+	require.ElementsMatch([]core.PeerID{"peer-fast", "peer-slow"}, peers, "stale peers should be omitted")
+
+	ranks := mgr.ExplainPeerSelectionWeighted(PeerWeightingLatency, WithBestPeersLimit(2))
+	require.Len(ranks, 2, "number of ranked peers should be limited")
+	require.Equal(core.PeerID("peer-stale"), ranks[0].PeerID, "best peer should be ranked first")
+	require.Equal(core.PeerID("peer-fast"), ranks[1].PeerID, "second best peer should be ranked second")
+
+	peers = mgr.GetBestPeers(WithBestPeersLimit(1), WithBestPeersMaxStaleness(time.Minute))
+	require.Len(peers, 1, "number of peers should be limited")
+	require.Contains([]core.PeerID{"peer-fast", "peer-slow"}, peers[0], "only fresh peers should be returned")
+}
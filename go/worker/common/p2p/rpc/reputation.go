@@ -0,0 +1,240 @@
+package rpc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+)
+
+const (
+	// defaultReputationSaveInterval is the default interval at which peer reputation state is
+	// persisted in case persistence is enabled.
+	defaultReputationSaveInterval = 5 * time.Minute
+
+	// defaultMaxSavedPeers is the default maximum number of untracked peers whose reputation is
+	// retained in case persistence is enabled.
+	defaultMaxSavedPeers = 1024
+)
+
+// ReputationPersistenceConfig is the peer reputation persistence configuration.
+type ReputationPersistenceConfig struct {
+	// Path is the path of the file where peer reputation state is stored.
+	Path string
+
+	// SaveInterval is the interval at which the reputation state is periodically saved. If zero,
+	// a default interval is used.
+	SaveInterval time.Duration
+
+	// MaxBadPeerAge is the maximum age of bad peer entries that are retained when reloading the
+	// reputation state. If zero, bad peer entries never expire.
+	MaxBadPeerAge time.Duration
+
+	// MaxSavedPeers is the maximum number of peers that are not currently tracked whose
+	// reputation is retained. The least recently seen peers are forgotten first. If zero, a
+	// default limit is used.
+	MaxSavedPeers int
+}
+
+// reputationState is the serialized peer reputation state.
+type reputationState struct {
+	AvgRequestLatency time.Duration `json:"avg_request_latency"`
+
+	Peers    []reputationPeer    `json:"peers,omitempty"`
+	BadPeers []reputationBadPeer `json:"bad_peers,omitempty"`
+}
+
+// reputationPeer is the serialized reputation of a single peer.
+type reputationPeer struct {
+	PeerID            string        `json:"peer_id"`
+	Successes         int           `json:"successes,omitempty"`
+	Failures          int           `json:"failures,omitempty"`
+	AvgRequestLatency time.Duration `json:"avg_request_latency,omitempty"`
+	Capacity          uint64        `json:"capacity,omitempty"`
+}
+
+// reputationBadPeer is a serialized bad peer entry.
+type reputationBadPeer struct {
+	PeerID string `json:"peer_id"`
+	// Since is the UNIX timestamp at which the peer was recorded as bad.
+	Since int64 `json:"since"`
+}
+
+// snapshotReputationLocked returns the current peer reputation state.
+func (mgr *peerManager) snapshotReputationLocked() *reputationState {
+	state := &reputationState{
+		AvgRequestLatency: mgr.avgRequestLatency,
+	}
+	addPeer := func(peerID core.PeerID, ps *peerStats) {
+		state.Peers = append(state.Peers, reputationPeer{
+			PeerID:            peerID.String(),
+			Successes:         ps.successes,
+			Failures:          ps.failures,
+			AvgRequestLatency: ps.avgRequestLatency,
+			Capacity:          ps.capacity,
+		})
+	}
+	for peerID, ps := range mgr.peers {
+		addPeer(peerID, ps)
+	}
+	for peerID, ps := range mgr.savedPeers {
+		addPeer(peerID, ps)
+	}
+	for peerID, since := range mgr.ignoredPeers {
+		state.BadPeers = append(state.BadPeers, reputationBadPeer{
+			PeerID: peerID.String(),
+			Since:  since.Unix(),
+		})
+	}
+	return state
+}
+
+// saveStatsLocked retains the statistics of a peer that is not currently tracked, forgetting the
+// least recently seen saved peer in case the number of saved peers would exceed the limit.
+//
+// NOTE: Assumes lock is held.
+func (mgr *peerManager) saveStatsLocked(peerID core.PeerID, ps *peerStats) {
+	maxSavedPeers := mgr.persistence.MaxSavedPeers
+	if maxSavedPeers <= 0 {
+		maxSavedPeers = defaultMaxSavedPeers
+	}
+
+	mgr.savedPeers[peerID] = ps
+	for len(mgr.savedPeers) > maxSavedPeers {
+		var (
+			oldestPeer core.PeerID
+			oldest     *peerStats
+		)
+		for savedPeer, saved := range mgr.savedPeers {
+			if oldest == nil || saved.lastSeen.Before(oldest.lastSeen) {
+				oldestPeer, oldest = savedPeer, saved
+			}
+		}
+		delete(mgr.savedPeers, oldestPeer)
+	}
+}
+
+// saveReputation persists the current peer reputation state. Concurrent saves are serialized so
+// that they cannot interfere with each other.
+func (mgr *peerManager) saveReputation() error {
+	mgr.saveLock.Lock()
+	defer mgr.saveLock.Unlock()
+
+	mgr.RLock()
+	state := mgr.snapshotReputationLocked()
+	mgr.RUnlock()
+
+	// Write to a temporary file first so that a crash cannot leave a truncated state behind.
+	path := mgr.persistence.Path
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, cbor.Marshal(state), 0o600); err != nil {
+		return fmt.Errorf("failed to write peer reputation state: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace peer reputation state: %w", err)
+	}
+	return nil
+}
+
+// loadReputation loads the previously persisted peer reputation state.
+//
+// Loaded peer statistics are applied once the given peers are added to the peer manager. Bad
+// peers that are older than the configured maximum age are forgotten.
+func (mgr *peerManager) loadReputation() error {
+	raw, err := os.ReadFile(mgr.persistence.Path)
+	switch {
+	case err == nil:
+	case os.IsNotExist(err):
+		// Nothing has been persisted yet.
+		return nil
+	default:
+		return fmt.Errorf("failed to read peer reputation state: %w", err)
+	}
+
+	var state reputationState
+	if err = cbor.Unmarshal(raw, &state); err != nil {
+		return fmt.Errorf("malformed peer reputation state: %w", err)
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	mgr.avgRequestLatency = state.AvgRequestLatency
+	for _, rp := range state.Peers {
+		var peerID core.PeerID
+		if peerID, err = peer.Decode(rp.PeerID); err != nil {
+			mgr.logger.Warn("ignoring malformed persisted peer",
+				"err", err,
+				"peer_id", rp.PeerID,
+			)
+			continue
+		}
+		mgr.saveStatsLocked(peerID, &peerStats{
+			successes:         rp.Successes,
+			failures:          rp.Failures,
+			avgRequestLatency: rp.AvgRequestLatency,
+			capacity:          rp.Capacity,
+		})
+	}
+
+	now := time.Now()
+	for _, bp := range state.BadPeers {
+		var peerID core.PeerID
+		if peerID, err = peer.Decode(bp.PeerID); err != nil {
+			mgr.logger.Warn("ignoring malformed persisted bad peer",
+				"err", err,
+				"peer_id", bp.PeerID,
+			)
+			continue
+		}
+		since := time.Unix(bp.Since, 0)
+		if mgr.persistence.MaxBadPeerAge > 0 && now.Sub(since) > mgr.persistence.MaxBadPeerAge {
+			mgr.logger.Debug("forgetting expired bad peer",
+				"peer_id", peerID,
+				"since", since,
+			)
+			continue
+		}
+		mgr.p2p.BlockPeer(peerID)
+		mgr.ignoredPeers[peerID] = since
+		delete(mgr.savedPeers, peerID)
+	}
+
+	mgr.logger.Info("loaded persisted peer reputation",
+		"peers", len(mgr.savedPeers),
+		"bad_peers", len(mgr.ignoredPeers),
+	)
+
+	return nil
+}
+
+// reputationSaver periodically persists the peer reputation state until the peer manager is
+// stopped.
+func (mgr *peerManager) reputationSaver() {
+	defer close(mgr.saverDoneCh)
+
+	interval := mgr.persistence.SaveInterval
+	if interval <= 0 {
+		interval = defaultReputationSaveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mgr.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		if err := mgr.saveReputation(); err != nil {
+			mgr.logger.Error("failed to persist peer reputation",
+				"err", err,
+			)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package rpc
+
+import (
+	cryptorand "crypto/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+)
+
+// blockingP2P is a P2P implementation that only records blocked peers.
+type blockingP2P struct {
+	P2P
+
+	blocked []core.PeerID
+}
+
+func (p *blockingP2P) BlockPeer(peerID core.PeerID) {
+	p.blocked = append(p.blocked, peerID)
+}
+
+func newTestPeerID(t *testing.T) core.PeerID {
+	_, pk, err := crypto.GenerateEd25519Key(cryptorand.Reader)
+	require.NoError(t, err, "GenerateEd25519Key")
+	peerID, err := peer.IDFromPublicKey(pk)
+	require.NoError(t, err, "IDFromPublicKey")
+	return peerID
+}
+
+func newTestPersistentPeerManager(p2p P2P, persistence *ReputationPersistenceConfig) *peerManager {
+	return &peerManager{
+		p2p:          p2p,
+		peers:        make(map[core.PeerID]*peerStats),
+		ignoredPeers: make(map[core.PeerID]time.Time),
+		savedPeers:   make(map[core.PeerID]*peerStats),
+		persistence:  persistence,
+		stopCh:       make(chan struct{}),
+		logger:       logging.GetLogger("worker/common/p2p/rpc/peermgr/test"),
+	}
+}
+
+func TestPeerManagerReputationPersistence(t *testing.T) {
+	require := require.New(t)
+
+	persistence := &ReputationPersistenceConfig{
+		Path:          filepath.Join(t.TempDir(), "reputation"),
+		MaxBadPeerAge: time.Hour,
+	}
+	goodPeer, freshBadPeer, staleBadPeer := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+
+	mgr := newTestPersistentPeerManager(&blockingP2P{}, persistence)
+	mgr.avgRequestLatency = 20 * time.Millisecond
+	mgr.peers[goodPeer] = &peerStats{successes: 10, failures: 1, avgRequestLatency: 10 * time.Millisecond, capacity: 100}
+	mgr.ignoredPeers[freshBadPeer] = time.Now()
+	mgr.ignoredPeers[staleBadPeer] = time.Now().Add(-2 * time.Hour)
+	mgr.Stop()
+	mgr.Stop() // Stopping multiple times should be safe.
+
+	// Reload the state.
+	p2p := &blockingP2P{}
+	mgr = newTestPersistentPeerManager(p2p, persistence)
+	err := mgr.loadReputation()
+	require.NoError(err, "loadReputation")
+	require.Equal(20*time.Millisecond, mgr.avgRequestLatency, "global latency should be restored")
+	require.Contains(mgr.ignoredPeers, freshBadPeer, "recent bad peer should be restored")
+	require.NotContains(mgr.ignoredPeers, staleBadPeer, "stale bad peer should expire")
+	require.Equal([]core.PeerID{freshBadPeer}, p2p.blocked, "restored bad peer should be blocked")
+
+	// Restored statistics should be applied once the peer is added.
+	require.Empty(mgr.peers, "persisted peers should not be tracked until added")
+	mgr.AddPeer(goodPeer)
+	require.Equal(10, mgr.peers[goodPeer].successes, "successes should be restored")
+	require.Equal(1, mgr.peers[goodPeer].failures, "failures should be restored")
+	require.Equal(10*time.Millisecond, mgr.peers[goodPeer].avgRequestLatency, "latency should be restored")
+	require.EqualValues(100, mgr.peers[goodPeer].capacity, "capacity should be restored")
+
+	// Restored bad peers should not be re-added.
+	mgr.AddPeer(freshBadPeer)
+	require.NotContains(mgr.peers, freshBadPeer, "bad peer should not be re-added")
+
+	// Loading a missing state should not fail.
+	mgr = newTestPersistentPeerManager(p2p, &ReputationPersistenceConfig{
+		Path: filepath.Join(t.TempDir(), "missing"),
+	})
+	err = mgr.loadReputation()
+	require.NoError(err, "loadReputation should succeed without persisted state")
+}
+
+func TestPeerManagerReputationSaves(t *testing.T) {
+	require := require.New(t)
+
+	persistence := &ReputationPersistenceConfig{
+		Path:         filepath.Join(t.TempDir(), "reputation"),
+		SaveInterval: time.Millisecond,
+	}
+	mgr := newTestPersistentPeerManager(&blockingP2P{}, persistence)
+	mgr.peers[newTestPeerID(t)] = &peerStats{successes: 1}
+	mgr.saverDoneCh = make(chan struct{})
+	go mgr.reputationSaver()
+
+	// Concurrent saves should not interfere with each other.
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errCh <- mgr.saveReputation()
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(err, "saveReputation")
+	}
+
+	err := mgr.Stop()
+	require.NoError(err, "Stop")
+	select {
+	case <-mgr.saverDoneCh:
+	default:
+		require.Fail("Stop should wait for the periodic saver to exit")
+	}
+}
+
+func TestPeerManagerSavedPeersLimit(t *testing.T) {
+	require := require.New(t)
+
+	mgr := newTestPersistentPeerManager(&blockingP2P{}, &ReputationPersistenceConfig{
+		Path:          filepath.Join(t.TempDir(), "reputation"),
+		MaxSavedPeers: 2,
+	})
+
+	now := time.Now()
+	peers := []core.PeerID{newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)}
+	for i, peerID := range peers {
+		mgr.peers[peerID] = &peerStats{successes: 1, lastSeen: now.Add(time.Duration(i) * time.Second)}
+	}
+	// Remove the most recently seen peer first to make sure eviction is not insertion ordered.
+	for i := len(peers) - 1; i >= 0; i-- {
+		mgr.RemovePeer(peers[i])
+	}
+
+	require.Len(mgr.savedPeers, 2, "saved peers should be bounded")
+	require.NotContains(mgr.savedPeers, peers[0], "least recently seen peer should be forgotten")
+	require.Contains(mgr.savedPeers, peers[1])
+	require.Contains(mgr.savedPeers, peers[2])
+}
@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+
+	"github.com/oasisprotocol/oasis-core/go/common/errors"
+	p2pError "github.com/oasisprotocol/oasis-core/go/worker/common/p2p/error"
+)
+
+var errResponseStreamClosed = fmt.Errorf("rpc: response stream closed")
+
+// ResponseStream is a streaming response to an RPC call.
+type ResponseStream struct {
+	c *client
+
+	stream       network.Stream
+	codec        MessageCodec
+	peerID       core.PeerID
+	method       string
+	maxChunkTime time.Duration
+	latency      time.Duration
+
+	next *Response
+	err  error
+}
+
+// Next decodes the next response chunk into the given value.
+//
+// It returns io.EOF once the whole response has been read successfully. In case the peer failed
+// to produce the response, its error is returned.
+func (rs *ResponseStream) Next(chunk interface{}) error {
+	if rs.err != nil {
+		return rs.err
+	}
+
+	frame := rs.next
+	rs.next = nil
+	if frame == nil {
+		var err error
+		if frame, err = rs.readFrame(); err != nil {
+			rs.fail(err)
+			return err
+		}
+	}
+
+	if !frame.More {
+		if frame.Error != nil {
+			rs.fail(&remoteError{errors.FromCode(frame.Error.Module, frame.Error.Code, frame.Error.Message)})
+			return rs.err
+		}
+		rs.err = io.EOF
+		_ = rs.stream.Close()
+		return rs.err
+	}
+
+	if err := rs.c.codec.Unmarshal(frame.Ok, chunk); err != nil {
+		rs.fail(fmt.Errorf("failed to decode response chunk: %w", err))
+		return rs.err
+	}
+	return nil
+}
+
+// PeerFeedback returns the feedback handle for the peer serving the response.
+func (rs *ResponseStream) PeerFeedback() PeerFeedback {
+	return &peerFeedback{
+		mgr:        rs.c.PeerManager,
+		peerID:     rs.peerID,
+		latency:    rs.latency,
+		protocolID: rs.c.protocolID,
+		method:     rs.method,
+	}
+}
+
+// Close aborts reading the response and releases the underlying stream.
+func (rs *ResponseStream) Close() error {
+	if rs.err != nil {
+		return nil
+	}
+	rs.err = errResponseStreamClosed
+	return rs.stream.Close()
+}
+
+// readFrame reads the next response frame, enforcing the per-chunk read deadline.
+func (rs *ResponseStream) readFrame() (*Response, error) {
+	var frame Response
+	_ = rs.stream.SetReadDeadline(time.Now().Add(rs.maxChunkTime))
+	if err := rs.codec.Read(&frame); err != nil {
+		if err == ErrMessageTooLarge {
+			rs.c.recordBadPeer(rs.peerID, rs.method)
+			return nil, p2pError.Permanent(ErrResponseTooLarge)
+		}
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	_ = rs.stream.SetReadDeadline(time.Time{})
+	return &frame, nil
+}
+
+// fail terminates the response stream with the given error.
+func (rs *ResponseStream) fail(err error) {
+	rs.err = err
+	rs.c.RecordFailure(rs.peerID, rs.latency)
+	recordCallFailure(rs.c.protocolID, rs.method, rs.latency)
+	_ = rs.stream.Close()
+}
+
+func (c *client) CallStream(
+	ctx context.Context,
+	method string,
+	body interface{},
+	maxChunkTime time.Duration,
+	opts ...CallOption,
+) (_ *ResponseStream, err error) {
+	c.logger.Debug("call stream", "method", method)
+
+	ctx, endCall, err := c.beginCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endCall()
+
+	ctx, span := c.startSpan(ctx, "rpc.CallStream", method, "")
+	defer func() { endSpan(span, err) }()
+
+	co := newCallOptions(opts...)
+
+	// Prepare the request.
+	request := Request{
+		Method: method,
+		Body:   c.codec.Marshal(body),
+		Stream: true,
+	}
+
+	peers, err := c.getBestPeers(method, co)
+	if err != nil {
+		return nil, err
+	}
+
+	// Iterate through the prioritized list of peers until one starts responding.
+	var peerErrs []error
+	for _, peer := range peers {
+		var rs *ResponseStream
+		if rs, err = c.openResponseStream(ctx, peer, &request, maxChunkTime, co); err != nil {
+			peerErrs = append(peerErrs, &peerError{peerID: peer, err: err})
+			continue
+		}
+		return rs, nil
+	}
+	return nil, aggregatePeerErrors(peerErrs)
+}
+
+// openResponseStream sends the given streaming request to the given peer and waits for the first
+// response frame.
+func (c *client) openResponseStream(
+	ctx context.Context,
+	peerID core.PeerID,
+	request *Request,
+	maxChunkTime time.Duration,
+	co *CallOptions,
+) (*ResponseStream, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if err := c.verifyPeer(ctx, peerID, request.Method, maxChunkTime); err != nil {
+		return nil, err
+	}
+
+	// Streaming responses are only supported by the current protocol version.
+	stream, err := c.host.NewStream(
+		network.WithNoDial(ctx, "should already have connection"),
+		peerID,
+		c.protocolID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+
+	if traceContext := c.injectTraceContext(ctx); traceContext != nil {
+		traced := *request
+		traced.TraceContext = traceContext
+		request = &traced
+	}
+
+	startTime := time.Now()
+	rs := &ResponseStream{
+		c:            c,
+		stream:       stream,
+		codec:        c.codec.NewMessageCodec(stream, codecModuleName, c.maxResponseSize, c.maxRequestSize),
+		peerID:       peerID,
+		method:       request.Method,
+		maxChunkTime: maxChunkTime,
+	}
+
+	// Send request.
+	_ = stream.SetWriteDeadline(time.Now().Add(c.getWriteDeadline(co)))
+	if err = rs.codec.Write(request); err != nil {
+		_ = stream.Close()
+		if err == ErrMessageTooLarge {
+			return nil, p2pError.Permanent(ErrRequestTooLarge)
+		}
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	_ = stream.SetWriteDeadline(time.Time{})
+
+	// Wait for the first frame so that failing peers can be skipped.
+	frame, err := rs.readFrame()
+	rs.latency = time.Since(startTime)
+	if err != nil {
+		rs.fail(err)
+		return nil, err
+	}
+	if !frame.More && frame.Error != nil {
+		err = &remoteError{errors.FromCode(frame.Error.Module, frame.Error.Code, frame.Error.Message)}
+		rs.fail(err)
+		return nil, err
+	}
+	rs.next = frame
+
+	return rs, nil
+}
@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+	"github.com/oasisprotocol/oasis-core/go/common/version"
+)
+
+// pipeConn is a connection to a fixed remote peer.
+type pipeConn struct {
+	network.Conn
+
+	remotePeer core.PeerID
+}
+
+func (c *pipeConn) RemotePeer() core.PeerID {
+	return c.remotePeer
+}
+
+// pipeStream is a stream backed by an in-memory pipe.
+type pipeStream struct {
+	network.Stream
+
+	pipe     net.Conn
+	protocol protocol.ID
+	conn     *pipeConn
+}
+
+func (s *pipeStream) Read(p []byte) (int, error) {
+	return s.pipe.Read(p)
+}
+
+func (s *pipeStream) Write(p []byte) (int, error) {
+	return s.pipe.Write(p)
+}
+
+func (s *pipeStream) Close() error {
+	return s.pipe.Close()
+}
+
+func (s *pipeStream) SetReadDeadline(t time.Time) error {
+	return s.pipe.SetReadDeadline(t)
+}
+
+func (s *pipeStream) SetWriteDeadline(t time.Time) error {
+	return s.pipe.SetWriteDeadline(t)
+}
+
+func (s *pipeStream) Protocol() protocol.ID {
+	return s.protocol
+}
+
+func (s *pipeStream) Conn() network.Conn {
+	return s.conn
+}
+
+// pipeHost is a host where all peers are served by the given server.
+type pipeHost struct {
+	core.Host
+
+	server Server
+}
+
+func (h *pipeHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	var supported bool
+	for _, pid := range pids {
+		supported = supported || pid == h.server.Protocol()
+	}
+	if !supported {
+		return nil, fmt.Errorf("protocol not supported")
+	}
+
+	clientSide, serverSide := net.Pipe()
+	go h.server.HandleStream(&pipeStream{pipe: serverSide, protocol: h.server.Protocol(), conn: &pipeConn{remotePeer: "client"}})
+	return &pipeStream{pipe: clientSide, protocol: h.server.Protocol(), conn: &pipeConn{remotePeer: p}}, nil
+}
+
+type rangeService struct{}
+
+func (rangeService) HandleRequest(ctx context.Context, method string, body cbor.RawMessage) (interface{}, error) {
+	return nil, ErrMethodNotSupported
+}
+
+func (rangeService) HandleStreamingRequest(ctx context.Context, method string, body cbor.RawMessage, send func(interface{}) error) error {
+	var n int
+	if err := cbor.Unmarshal(body, &n); err != nil {
+		return ErrBadRequest
+	}
+	for i := 0; i < n; i++ {
+		if err := send(i); err != nil {
+			return err
+		}
+	}
+
+	switch method {
+	case "Range":
+		return nil
+	case "Stall":
+		time.Sleep(time.Second)
+		return send(n)
+	default:
+		return ErrMethodNotSupported
+	}
+}
+
+func newPipeClient(srv Server) *client {
+	return &client{
+		PeerManager:     &staticPeerManager{peers: []core.PeerID{"peer-a", "peer-b"}},
+		host:            &pipeHost{server: srv},
+		protocolID:      srv.Protocol(),
+		methodWeighting: make(map[string]PeerWeighting),
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		codec:           CBORCodec,
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+}
+
+func TestClientCallStream(t *testing.T) {
+	require := require.New(t)
+
+	srv := NewServer(common.Namespace{}, "test", version.Version{Major: 1}, rangeService{})
+	c := newPipeClient(srv)
+
+	rs, err := c.CallStream(context.Background(), "Range", 3, time.Second)
+	require.NoError(err, "CallStream")
+	for i := 0; i < 3; i++ {
+		var chunk int
+		err = rs.Next(&chunk)
+		require.NoError(err, "Next")
+		require.Equal(i, chunk, "chunks should be received in order")
+	}
+	var chunk int
+	require.Equal(io.EOF, rs.Next(&chunk), "stream should end after all chunks")
+	require.Equal(io.EOF, rs.Next(&chunk), "stream should remain at its end")
+	require.NoError(rs.Close())
+
+	rs, err = c.CallStream(context.Background(), "Range", 0, time.Second)
+	require.NoError(err, "CallStream")
+	require.Equal(io.EOF, rs.Next(&chunk), "empty stream should end immediately")
+
+	rs, err = c.CallStream(context.Background(), "Unknown", 1, time.Second)
+	require.NoError(err, "CallStream")
+	require.NoError(rs.Next(&chunk), "Next")
+	require.ErrorIs(rs.Next(&chunk), ErrMethodNotSupported, "trailing errors should be returned")
+
+	_, err = c.CallStream(context.Background(), "Unknown", 0, time.Second)
+	require.ErrorIs(err, ErrMethodNotSupported, "errors before the first chunk should fail the call")
+
+	rs, err = c.CallStream(context.Background(), "Stall", 1, 100*time.Millisecond)
+	require.NoError(err, "CallStream")
+	require.NoError(rs.Next(&chunk), "Next")
+	require.Error(rs.Next(&chunk), "chunks should be subject to a read deadline")
+
+	rs, err = c.CallStream(context.Background(), "Range", 10, time.Second)
+	require.NoError(err, "CallStream")
+	require.NoError(rs.Close(), "Close")
+	require.Error(rs.Next(&chunk), "closed streams should not be readable")
+}
+
+func TestClientCallStreamNotSupported(t *testing.T) {
+	require := require.New(t)
+
+	srv := NewServer(common.Namespace{}, "test", version.Version{Major: 1}, echoService{})
+	c := newPipeClient(srv)
+
+	_, err := c.CallStream(context.Background(), "Range", 1, time.Second)
+	require.ErrorIs(err, ErrMethodNotSupported, "services without streaming support should be rejected")
+
+	c.protocolID = NewRuntimeProtocolID(common.Namespace{}, "test", version.Version{Major: 2})
+	c.legacyProtocols = []protocol.ID{srv.Protocol()}
+	_, err = c.CallStream(context.Background(), "Range", 1, time.Second)
+	require.Error(err, "legacy protocol versions should not be used for streaming")
+}
@@ -2,8 +2,11 @@ package rpc
 
 import (
 	"context"
+	"io"
+	"sync"
 	"time"
 
+	core "github.com/libp2p/go-libp2p-core"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/protocol"
 
@@ -18,6 +21,16 @@ const (
 	RequestReadDeadline   = 5 * time.Second
 	RequestHandleTimeout  = 60 * time.Second
 	ResponseWriteDeadline = 60 * time.Second
+
+	// StreamIdleTimeout is the time the server waits for another request on a stream after it has
+	// sent a response. Clients pooling streams should use a shorter idle timeout.
+	StreamIdleTimeout = 10 * time.Second
+
+	// DefaultMaxIdleStreams is the default maximum number of idle streams kept open by the server.
+	DefaultMaxIdleStreams = 256
+	// DefaultMaxIdleStreamsPerPeer is the default maximum number of idle streams kept open by the
+	// server for a single peer.
+	DefaultMaxIdleStreamsPerPeer = 4
 )
 
 // Service is an RPC service implementation.
@@ -26,6 +39,22 @@ type Service interface {
 	HandleRequest(ctx context.Context, method string, body cbor.RawMessage) (interface{}, error)
 }
 
+// CapacityAdvertiser is an optional interface that can be implemented by a Service in order to
+// advertise its serving capacity to clients.
+type CapacityAdvertiser interface {
+	// Capacity returns the relative serving capacity of the service.
+	Capacity() uint64
+}
+
+// StreamingService is an optional interface that can be implemented by a Service in order to
+// support methods with streaming responses.
+type StreamingService interface {
+	// HandleStreamingRequest handles an incoming RPC request with a streaming response, calling
+	// send for each response chunk. Send blocks until the chunk has been written and fails in case
+	// the client is gone, in which case the handler should abort.
+	HandleStreamingRequest(ctx context.Context, method string, body cbor.RawMessage, send func(chunk interface{}) error) error
+}
+
 // Server is an RPC server for the given protocol.
 type Server interface {
 	// Protocol returns the unique protocol identifier.
@@ -41,9 +70,68 @@ type server struct {
 	runtimeID  common.Namespace
 	protocolID protocol.ID
 
+	tracer Tracer
+
+	idleStreams *idleStreamLimiter
+
 	logger *logging.Logger
 }
 
+// idleStreamLimiter bounds the number of streams kept open while waiting for further requests.
+type idleStreamLimiter struct {
+	sync.Mutex
+
+	maxTotal   int
+	maxPerPeer int
+
+	total   int
+	perPeer map[core.PeerID]int
+}
+
+// acquire reserves an idle stream slot for the given peer. It returns false in case the limits
+// have been reached.
+func (l *idleStreamLimiter) acquire(peerID core.PeerID) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.total >= l.maxTotal || l.perPeer[peerID] >= l.maxPerPeer {
+		return false
+	}
+	l.total++
+	l.perPeer[peerID]++
+	return true
+}
+
+// release releases an idle stream slot previously reserved for the given peer.
+func (l *idleStreamLimiter) release(peerID core.PeerID) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.total--
+	if l.perPeer[peerID]--; l.perPeer[peerID] <= 0 {
+		delete(l.perPeer, peerID)
+	}
+}
+
+func newIdleStreamLimiter(maxTotal, maxPerPeer int) *idleStreamLimiter {
+	return &idleStreamLimiter{
+		maxTotal:   maxTotal,
+		maxPerPeer: maxPerPeer,
+		perPeer:    make(map[core.PeerID]int),
+	}
+}
+
+// WithMaxIdleStreams configures the maximum number of idle streams the server keeps open while
+// waiting for further requests, in total and per peer. Streams exceeding the limits are closed
+// after the response has been sent.
+//
+// By default DefaultMaxIdleStreams and DefaultMaxIdleStreamsPerPeer are used.
+func WithMaxIdleStreams(total, perPeer int) ServerOption {
+	return func(s *server) {
+		s.idleStreams = newIdleStreamLimiter(total, perPeer)
+	}
+}
+
 func (s *server) Protocol() protocol.ID {
 	return s.protocolID
 }
@@ -54,14 +142,49 @@ func (s *server) HandleStream(stream network.Stream) {
 	logger := s.logger.With("peer_id", stream.Conn().RemotePeer())
 	codec := cbor.NewMessageCodec(stream, codecModuleName)
 
+	// Serve requests until the client closes the stream or leaves it idle for too long. Clients
+	// that do not pool streams close them after receiving the first response.
+	if !s.handleStreamRequest(logger, stream, codec, RequestReadDeadline, nil) {
+		return
+	}
+
+	// Only keep the stream open for further requests while within the idle stream limits, so
+	// that clients cannot exhaust server resources by holding on to idle streams.
+	peerID := stream.Conn().RemotePeer()
+	for s.idleStreams.acquire(peerID) {
+		release := func() { s.idleStreams.release(peerID) }
+		if !s.handleStreamRequest(logger, stream, codec, StreamIdleTimeout, release) {
+			return
+		}
+	}
+	logger.Debug("closing stream as idle stream limit has been reached")
+}
+
+// handleStreamRequest reads a single request from the given stream and writes the response. It
+// returns true in case the stream can be used for further requests.
+//
+// In case release is non-nil, it is called as soon as the stream stops being idle.
+func (s *server) handleStreamRequest(
+	logger *logging.Logger,
+	stream network.Stream,
+	codec *cbor.MessageCodec,
+	readDeadline time.Duration,
+	release func(),
+) bool {
 	// Read request.
 	var request Request
-	_ = stream.SetReadDeadline(time.Now().Add(RequestReadDeadline))
-	if err := codec.Read(&request); err != nil {
-		logger.Debug("failed to read request",
-			"err", err,
-		)
-		return
+	_ = stream.SetReadDeadline(time.Now().Add(readDeadline))
+	err := codec.Read(&request)
+	if release != nil {
+		release()
+	}
+	if err != nil {
+		if err != io.EOF {
+			logger.Debug("failed to read request",
+				"err", err,
+			)
+		}
+		return false
 	}
 	_ = stream.SetReadDeadline(time.Time{})
 
@@ -69,28 +192,28 @@ func (s *server) HandleStream(stream network.Stream) {
 		"method", request.Method,
 	)
 
+	if request.Stream {
+		s.serveStreamingRequest(logger, stream, codec, &request)
+		// Streams are not reused after streaming responses.
+		return false
+	}
+
 	// Handle request.
-	ctx, cancel := context.WithTimeout(context.Background(), RequestHandleTimeout)
-	rsp, err := s.HandleRequest(ctx, request.Method, request.Body)
-	cancel()
+	rsp, err := s.processRequest(&request, stream.Conn().RemotePeer())
 
 	// Generate response.
 	var response Response
 	switch err {
 	case nil:
-		response.Ok = cbor.Marshal(rsp)
+		response.Ok = rsp
+		response.Compression = request.Compression
 	default:
 		logger.Debug("failed to process request",
 			"err", err,
 			"method", request.Method,
 		)
 
-		module, code := errors.Code(err)
-		response.Error = &Error{
-			Module:  module,
-			Code:    code,
-			Message: err.Error(),
-		}
+		response.Error = newError(err)
 	}
 
 	// Send response.
@@ -99,22 +222,133 @@ func (s *server) HandleStream(stream network.Stream) {
 		logger.Debug("failed to write response",
 			"err", err,
 		)
+		return false
+	}
+	_ = stream.SetWriteDeadline(time.Time{})
+
+	return true
+}
+
+// serveStreamingRequest handles the given request with a streaming response, writing a response
+// frame for each chunk followed by a trailing status frame.
+func (s *server) serveStreamingRequest(
+	logger *logging.Logger,
+	stream network.Stream,
+	codec *cbor.MessageCodec,
+	request *Request,
+) {
+	send := func(chunk interface{}) error {
+		// Writes block until the client reads the chunk, providing backpressure.
+		_ = stream.SetWriteDeadline(time.Now().Add(ResponseWriteDeadline))
+		return codec.Write(&Response{
+			Ok:   cbor.Marshal(chunk),
+			More: true,
+		})
+	}
+
+	var status Response
+	if err := s.processStreamingRequest(request, stream.Conn().RemotePeer(), send); err != nil {
+		logger.Debug("failed to process streaming request",
+			"err", err,
+			"method", request.Method,
+		)
+		status.Error = newError(err)
+	}
+
+	// Send status.
+	_ = stream.SetWriteDeadline(time.Now().Add(ResponseWriteDeadline))
+	if err := codec.Write(&status); err != nil {
+		logger.Debug("failed to write response status",
+			"err", err,
+		)
 		return
 	}
 	_ = stream.SetWriteDeadline(time.Time{})
 }
 
+// processStreamingRequest decompresses the given request and handles it using the streaming
+// service.
+func (s *server) processStreamingRequest(request *Request, peerID core.PeerID, send func(interface{}) error) (err error) {
+	ctx, span := s.startSpan(request, peerID)
+	defer func() { endSpan(span, err) }()
+
+	ss, ok := s.Service.(StreamingService)
+	if !ok {
+		return ErrMethodNotSupported
+	}
+
+	body, err := decompress(request.Compression, request.Body, cbor.DefaultMaxMessageSize)
+	if err != nil {
+		return errors.WithContext(ErrBadRequest, err.Error())
+	}
+
+	// Streaming responses may take arbitrarily long, as long as the client keeps reading.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return ss.HandleStreamingRequest(ctx, request.Method, body, send)
+}
+
+// newError converts the given error into an error response.
+func newError(err error) *Error {
+	module, code := errors.Code(err)
+	return &Error{
+		Module:  module,
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
+// processRequest decompresses the given request, handles it and returns the response compressed
+// using the same codec as the request.
+func (s *server) processRequest(request *Request, peerID core.PeerID) (_ cbor.RawMessage, err error) {
+	ctx, span := s.startSpan(request, peerID)
+	defer func() { endSpan(span, err) }()
+
+	body, err := decompress(request.Compression, request.Body, cbor.DefaultMaxMessageSize)
+	if err != nil {
+		return nil, errors.WithContext(ErrBadRequest, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, RequestHandleTimeout)
+	defer cancel()
+
+	rsp, err := s.handleRequest(ctx, request.Method, body)
+	if err != nil {
+		return nil, err
+	}
+	return compress(request.Compression, cbor.Marshal(rsp))
+}
+
+func (s *server) handleRequest(ctx context.Context, method string, body cbor.RawMessage) (interface{}, error) {
+	switch method {
+	case MethodGetCapacity:
+		ca, ok := s.Service.(CapacityAdvertiser)
+		if !ok {
+			return nil, ErrMethodNotSupported
+		}
+		return &CapacityResponse{Capacity: ca.Capacity()}, nil
+	default:
+		return s.HandleRequest(ctx, method, body)
+	}
+}
+
 // NewServer creates a new RPC server for the given protocol.
-func NewServer(runtimeID common.Namespace, protocolID string, version version.Version, srv Service) Server {
+func NewServer(runtimeID common.Namespace, protocolID string, version version.Version, srv Service, opts ...ServerOption) Server {
 	pid := NewRuntimeProtocolID(runtimeID, protocolID, version)
 
-	return &server{
-		Service:    srv,
-		runtimeID:  runtimeID,
-		protocolID: pid,
+	s := &server{
+		Service:     srv,
+		runtimeID:   runtimeID,
+		protocolID:  pid,
+		idleStreams: newIdleStreamLimiter(DefaultMaxIdleStreams, DefaultMaxIdleStreamsPerPeer),
 		logger: logging.GetLogger("worker/common/p2p/rpc/server").With(
 			"protocol", protocolID,
 			"runtime_id", runtimeID,
 		),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
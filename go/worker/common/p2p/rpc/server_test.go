@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common"
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/version"
+)
+
+func TestIdleStreamLimiter(t *testing.T) {
+	require := require.New(t)
+
+	l := newIdleStreamLimiter(3, 2)
+	require.True(l.acquire("peer-a"))
+	require.True(l.acquire("peer-a"))
+	require.False(l.acquire("peer-a"), "per-peer limit should be enforced")
+	require.True(l.acquire("peer-b"))
+	require.False(l.acquire("peer-c"), "total limit should be enforced")
+
+	l.release("peer-a")
+	require.True(l.acquire("peer-c"), "released slots should be reusable")
+	l.release("peer-b")
+	require.NotContains(l.perPeer, core.PeerID("peer-b"), "peers without idle streams should be removed")
+}
+
+func TestServerIdleStreamLimit(t *testing.T) {
+	require := require.New(t)
+
+	srv := NewServer(common.Namespace{}, "test", version.Version{Major: 1}, echoService{}, WithMaxIdleStreams(1, 1)).(*server)
+
+	openStream := func() *cbor.MessageCodec {
+		clientSide, serverSide := net.Pipe()
+		t.Cleanup(func() { clientSide.Close() })
+		go srv.HandleStream(&pipeStream{pipe: serverSide, protocol: srv.Protocol(), conn: &pipeConn{remotePeer: "client"}})
+		_ = clientSide.SetDeadline(time.Now().Add(time.Second))
+		return cbor.NewMessageCodec(clientSide, "test")
+	}
+	call := func(codec *cbor.MessageCodec) error {
+		if err := codec.Write(&Request{Method: "Echo", Body: cbor.Marshal(42)}); err != nil {
+			return err
+		}
+		var rsp Response
+		return codec.Read(&rsp)
+	}
+
+	first := openStream()
+	require.NoError(call(first), "first request")
+	require.Eventually(func() bool {
+		srv.idleStreams.Lock()
+		defer srv.idleStreams.Unlock()
+		return srv.idleStreams.total == 1
+	}, time.Second, 10*time.Millisecond, "first stream should become idle")
+
+	second := openStream()
+	require.NoError(call(second), "first request on the second stream")
+
+	// The second stream exceeds the idle stream limit so it should be closed after the response.
+	var rsp Response
+	require.Equal(io.EOF, second.Read(&rsp), "streams exceeding the idle limit should be closed")
+
+	// The first stream should still be usable.
+	require.NoError(call(first), "idle stream within the limit should be reused")
+}
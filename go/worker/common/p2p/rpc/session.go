@@ -0,0 +1,154 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+)
+
+// Session is a sequence of related calls (e.g., fetching a proof and then the data it refers to)
+// that are all routed to the same peer.
+//
+// The first call pins the best available peer. In case the pinned peer fails, the session is
+// restarted by transparently failing over to another peer which is then pinned instead. Callers
+// can detect restarts by comparing Generation before and after a call.
+type Session interface {
+	// Call is like Client.Call but routes the call to the pinned peer.
+	//
+	// Responses are never served from the height cache as they may have been obtained from a
+	// different peer.
+	Call(
+		ctx context.Context,
+		method string,
+		body, rsp interface{},
+		maxPeerResponseTime time.Duration,
+		opts ...CallOption,
+	) (PeerFeedback, error)
+
+	// Peer returns the currently pinned peer or an empty identifier in case no peer is pinned.
+	Peer() core.PeerID
+
+	// Generation returns the number of times a peer has been pinned, i.e. it is incremented each
+	// time the session is (re)started.
+	Generation() uint64
+}
+
+type session struct {
+	sync.Mutex
+
+	c *client
+
+	peerID     core.PeerID
+	generation uint64
+}
+
+func (s *session) Peer() core.PeerID {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.peerID
+}
+
+func (s *session) Generation() uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.generation
+}
+
+func (s *session) Call(
+	ctx context.Context,
+	method string,
+	body, rsp interface{},
+	maxPeerResponseTime time.Duration,
+	opts ...CallOption,
+) (pf PeerFeedback, err error) {
+	c := s.c
+	c.logger.Debug("session call", "method", method)
+
+	ctx, endCall, err := c.beginCall(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer endCall()
+
+	ctx, span := c.startSpan(ctx, "rpc.Session.Call", method, "")
+	defer func() { endSpan(span, err) }()
+
+	s.Lock()
+	defer s.Unlock()
+
+	co := newCallOptions(opts...)
+
+	// Prepare the request.
+	request := Request{
+		Method: method,
+		Body:   c.codec.Marshal(body),
+	}
+
+	// Attempt to use the pinned peer first.
+	var peerErrs []error
+	if s.peerID != "" {
+		if _, excluded := co.excludePeers[s.peerID]; !excluded {
+			pf, err = c.callWithRetry(ctx, s.peerID, &request, rsp, maxPeerResponseTime, co)
+			if err == nil {
+				return pf, nil
+			}
+			if ctx.Err() != nil {
+				// Calls cancelled by the caller are not the peer's fault, keep the session.
+				return nil, err
+			}
+			peerErrs = append(peerErrs, &peerError{peerID: s.peerID, err: err})
+		}
+
+		c.logger.Debug("session peer failed, restarting session",
+			"err", err,
+			"method", method,
+			"peer_id", s.peerID,
+		)
+
+		WithExcludePeers(s.peerID)(co)
+		s.peerID = ""
+	}
+
+	peers, err := c.getBestPeers(method, co)
+	switch {
+	case err == ErrAllPeersExcluded && len(peerErrs) > 0:
+		return nil, aggregatePeerErrors(peerErrs)
+	case err != nil:
+		return nil, err
+	}
+
+	// Iterate through the prioritized list of peers and pin the first one that succeeds.
+	for _, peer := range peers {
+		c.logger.Debug("trying peer",
+			"method", method,
+			"peer_id", peer,
+		)
+
+		pf, err = c.callWithRetry(ctx, peer, &request, rsp, maxPeerResponseTime, co)
+		if err != nil {
+			peerErrs = append(peerErrs, &peerError{peerID: peer, err: err})
+			continue
+		}
+
+		s.peerID = peer
+		s.generation++
+		return pf, nil
+	}
+
+	// No peers could be reached to service this request.
+	err = aggregatePeerErrors(peerErrs)
+	c.logger.Debug("no peers could be reached to service session request",
+		"err", err,
+		"method", method,
+	)
+
+	return nil, err
+}
+
+func (c *client) NewSession() Session {
+	return &session{c: c}
+}
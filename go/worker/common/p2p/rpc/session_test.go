@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+)
+
+// identityHost is a host where peers respond with their own identifier unless they are down.
+type identityHost struct {
+	core.Host
+
+	sync.Mutex
+	down      map[core.PeerID]bool
+	contacted []core.PeerID
+}
+
+func (h *identityHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.contacted = append(h.contacted, p)
+	if h.down[p] {
+		return nil, fmt.Errorf("not connected")
+	}
+
+	var rsp bytes.Buffer
+	if err := cbor.NewMessageCodec(&rsp, "test").Write(&Response{Ok: cbor.Marshal(string(p))}); err != nil {
+		return nil, err
+	}
+	return &scriptedStream{response: &rsp}, nil
+}
+
+func TestClientSession(t *testing.T) {
+	require := require.New(t)
+
+	peers := []core.PeerID{"peer-a", "peer-b", "peer-c"}
+	mgr := &staticPeerManager{peers: peers}
+	host := &identityHost{down: make(map[core.PeerID]bool)}
+	c := &client{
+		PeerManager:     mgr,
+		host:            host,
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		codec:           CBORCodec,
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	s := c.NewSession()
+	require.Empty(s.Peer(), "new session should not have a pinned peer")
+	require.EqualValues(0, s.Generation())
+
+	// Calls should be routed to the same peer.
+	for i := 0; i < 3; i++ {
+		var rsp string
+		_, err := s.Call(context.Background(), "Test", nil, &rsp, time.Second)
+		require.NoError(err, "Call")
+		require.EqualValues(peers[0], rsp, "calls should be routed to the pinned peer")
+	}
+	require.EqualValues(peers[0], s.Peer())
+	require.EqualValues(1, s.Generation(), "session should not be restarted")
+
+	// Once the pinned peer fails, the session should fail over to another peer.
+	host.Lock()
+	host.down[peers[0]] = true
+	host.contacted = nil
+	host.Unlock()
+
+	var rsp string
+	_, err := s.Call(context.Background(), "Test", nil, &rsp, time.Second)
+	require.NoError(err, "Call")
+	require.EqualValues(peers[1], rsp, "session should fail over to the next peer")
+	require.EqualValues(peers[1], s.Peer())
+	require.EqualValues(2, s.Generation(), "session should be restarted")
+	require.EqualValues([]core.PeerID{peers[0], peers[1]}, host.contacted, "failed peer should only be contacted once")
+
+	// The new peer should remain pinned even when the original peer recovers.
+	host.Lock()
+	host.down[peers[0]] = false
+	host.Unlock()
+
+	_, err = s.Call(context.Background(), "Test", nil, &rsp, time.Second)
+	require.NoError(err, "Call")
+	require.EqualValues(peers[1], rsp, "calls should be routed to the new pinned peer")
+	require.EqualValues(2, s.Generation(), "session should not be restarted")
+
+	// Failure of all peers should be reported.
+	host.Lock()
+	for _, peer := range peers {
+		host.down[peer] = true
+	}
+	host.Unlock()
+
+	_, err = s.Call(context.Background(), "Test", nil, &rsp, time.Second)
+	require.Error(err, "Call should fail as no peers are reachable")
+	require.Empty(s.Peer(), "session should not have a pinned peer")
+
+	mgr.Lock()
+	defer mgr.Unlock()
+	require.Contains(mgr.failures, peers[0], "failures should be recorded")
+}
@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+type idleStream struct {
+	stream    network.Stream
+	idleSince time.Time
+}
+
+// streamPool is a pool of idle streams to peers that can be reused across calls.
+type streamPool struct {
+	sync.Mutex
+
+	size        int
+	idleTimeout time.Duration
+	streams     map[core.PeerID][]*idleStream
+	closed      bool
+}
+
+// get returns an idle stream to the given peer or nil in case there is none.
+//
+// Streams that have been idle for longer than the idle timeout are discarded.
+func (p *streamPool) get(peerID core.PeerID) network.Stream {
+	p.Lock()
+	defer p.Unlock()
+
+	streams := p.streams[peerID]
+	if len(streams) == 0 {
+		return nil
+	}
+
+	// Prefer the most recently used stream.
+	last := streams[len(streams)-1]
+	if time.Since(last.idleSince) > p.idleTimeout {
+		// Older streams have been idle for even longer.
+		discardStreams(streams)
+		delete(p.streams, peerID)
+		return nil
+	}
+
+	if len(streams) == 1 {
+		delete(p.streams, peerID)
+	} else {
+		p.streams[peerID] = streams[:len(streams)-1]
+	}
+	return last.stream
+}
+
+// put returns the given stream to the pool, closing it in case the pool is full.
+func (p *streamPool) put(peerID core.PeerID, stream network.Stream) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.closed || len(p.streams[peerID]) >= p.size {
+		_ = stream.Close()
+		return
+	}
+	p.streams[peerID] = append(p.streams[peerID], &idleStream{stream, time.Now()})
+}
+
+// remove discards all idle streams to the given peer.
+func (p *streamPool) remove(peerID core.PeerID) {
+	p.Lock()
+	defer p.Unlock()
+
+	discardStreams(p.streams[peerID])
+	delete(p.streams, peerID)
+}
+
+// close discards all idle streams and closes any streams returned afterwards.
+func (p *streamPool) close() {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, streams := range p.streams {
+		discardStreams(streams)
+	}
+	p.streams = make(map[core.PeerID][]*idleStream)
+	p.closed = true
+}
+
+func discardStreams(streams []*idleStream) {
+	for _, s := range streams {
+		_ = s.stream.Close()
+	}
+}
+
+func newStreamPool(size int, idleTimeout time.Duration) *streamPool {
+	return &streamPool{
+		size:        size,
+		idleTimeout: idleTimeout,
+		streams:     make(map[core.PeerID][]*idleStream),
+	}
+}
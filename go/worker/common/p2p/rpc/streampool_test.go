@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/stretchr/testify/require"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/common/logging"
+)
+
+// closeTrackingStream is a scripted stream that tracks whether it has been closed.
+type closeTrackingStream struct {
+	scriptedStream
+
+	closed bool
+}
+
+func (s *closeTrackingStream) Close() error {
+	s.closed = true
+	return nil
+}
+
+// connectedNetwork is a network where all peers are connected.
+type connectedNetwork struct {
+	network.Network
+}
+
+func (n *connectedNetwork) Connectedness(core.PeerID) network.Connectedness {
+	return network.Connected
+}
+
+// poolingHost is a host that opens streams with the given number of pre-recorded responses.
+type poolingHost struct {
+	core.Host
+
+	responses int
+	opened    []*closeTrackingStream
+}
+
+func (h *poolingHost) NewStream(ctx context.Context, p core.PeerID, pids ...protocol.ID) (network.Stream, error) {
+	var rsp bytes.Buffer
+	codec := cbor.NewMessageCodec(&rsp, "test")
+	for i := 0; i < h.responses; i++ {
+		if err := codec.Write(&Response{Ok: cbor.Marshal(42)}); err != nil {
+			return nil, err
+		}
+	}
+
+	stream := &closeTrackingStream{scriptedStream: scriptedStream{response: &rsp}}
+	h.opened = append(h.opened, stream)
+	return stream, nil
+}
+
+func (h *poolingHost) Network() network.Network {
+	return &connectedNetwork{}
+}
+
+func TestClientStreamPool(t *testing.T) {
+	require := require.New(t)
+
+	host := &poolingHost{responses: 2}
+	mgr := &staticPeerManager{peers: []core.PeerID{"peer-a"}}
+	c := &client{
+		PeerManager:     mgr,
+		host:            host,
+		protocolID:      "/test/1.0.0",
+		methodWeighting: make(map[string]PeerWeighting),
+		peerProtocols:   make(map[core.PeerID]protocol.ID),
+		codec:           CBORCodec,
+		maxRequestSize:  DefaultMaxRequestSize,
+		maxResponseSize: DefaultMaxResponseSize,
+		logger:          logging.GetLogger("worker/common/p2p/rpc/client/test"),
+	}
+
+	var rsp int
+	_, err := c.Call(context.Background(), "Test", nil, &rsp, time.Second)
+	require.NoError(err, "Call")
+	_, err = c.Call(context.Background(), "Test", nil, &rsp, time.Second)
+	require.NoError(err, "Call")
+	require.Len(host.opened, 2, "streams should not be reused by default")
+	require.True(host.opened[0].closed, "streams should be closed by default")
+
+	WithStreamPool(1, time.Minute)(c)
+	host.opened = nil
+	for i := 0; i < 2; i++ {
+		_, err = c.Call(context.Background(), "Test", nil, &rsp, time.Second)
+		require.NoError(err, "Call")
+		require.EqualValues(42, rsp)
+	}
+	require.Len(host.opened, 1, "pooled streams should be reused")
+	require.False(host.opened[0].closed, "pooled streams should be kept open")
+
+	// The pooled stream has no more responses, so it should be replaced by a fresh stream.
+	_, err = c.Call(context.Background(), "Test", nil, &rsp, time.Second)
+	require.NoError(err, "Call should fall back to a fresh stream")
+	require.Len(host.opened, 2, "broken pooled streams should be replaced")
+	require.True(host.opened[0].closed, "broken pooled streams should be closed")
+	require.Empty(mgr.failures, "broken pooled streams should not count as peer failures")
+	require.Empty(mgr.badPeers, "broken pooled streams should not count as peer failures")
+
+	err = c.Shutdown(context.Background())
+	require.NoError(err, "Shutdown")
+	require.True(host.opened[1].closed, "pooled streams should be closed on shutdown")
+}
+
+func TestStreamPool(t *testing.T) {
+	require := require.New(t)
+
+	peer := core.PeerID("peer-a")
+	streams := []*closeTrackingStream{{}, {}, {}}
+
+	pool := newStreamPool(2, time.Minute)
+	require.Nil(pool.get(peer), "empty pool should not return streams")
+
+	for _, s := range streams {
+		pool.put(peer, s)
+	}
+	require.True(streams[2].closed, "streams exceeding the pool size should be closed")
+	require.Equal(streams[1], pool.get(peer), "most recently used stream should be preferred")
+	require.Equal(streams[0], pool.get(peer))
+	require.Nil(pool.get(peer))
+
+	pool = newStreamPool(2, 0)
+	pool.put(peer, streams[0])
+	time.Sleep(time.Millisecond)
+	require.Nil(pool.get(peer), "idle streams should expire")
+	require.True(streams[0].closed, "expired streams should be closed")
+
+	streams[1].closed = false
+	pool = newStreamPool(2, time.Minute)
+	pool.close()
+	pool.put(peer, streams[1])
+	require.True(streams[1].closed, "streams returned to a closed pool should be closed")
+	require.Nil(pool.get(peer))
+}
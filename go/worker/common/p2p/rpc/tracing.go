@@ -0,0 +1,183 @@
+package rpc
+
+import (
+	"context"
+
+	core "github.com/libp2p/go-libp2p-core"
+)
+
+// Span attribute keys.
+const (
+	AttributeMethod    = "rpc.method"
+	AttributePeerID    = "rpc.peer_id"
+	AttributeProtocol  = "rpc.protocol"
+	AttributeRuntimeID = "rpc.runtime_id"
+	AttributeOutcome   = "rpc.outcome"
+	AttributeLatency   = "rpc.latency"
+)
+
+// Span outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Span event names.
+const (
+	EventStreamOpened = "stream_opened"
+	EventRequestSent  = "request_sent"
+	EventResponseRead = "response_read"
+)
+
+// Attribute is a span attribute.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer creates tracing spans.
+//
+// The interface is intentionally minimal so that it can be backed by an OpenTelemetry tracer via
+// a thin adapter.
+type Tracer interface {
+	// Start starts a new span as a child of the span in the given context (if any) and returns a
+	// context containing the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// TracePropagator is an optional interface that a Tracer can implement in order to propagate the
+// trace context between the client and the server, so that the server can continue the trace.
+type TracePropagator interface {
+	// Inject returns the serialized trace context of the span in the given context (e.g., the
+	// W3C traceparent and tracestate headers). It returns nil in case there is no span.
+	Inject(ctx context.Context) map[string]string
+
+	// Extract returns a context continuing the trace described by the given serialized trace
+	// context.
+	Extract(ctx context.Context, traceContext map[string]string) context.Context
+}
+
+// Span is a tracing span.
+type Span interface {
+	// SetAttributes sets the given attributes on the span.
+	SetAttributes(attrs ...Attribute)
+
+	// AddEvent adds an event with the given name to the span.
+	AddEvent(name string)
+
+	// RecordError records the given error and marks the span as failed.
+	RecordError(err error)
+
+	// End ends the span.
+	End()
+}
+
+// WithTracer configures the client to create tracing spans around calls using the given tracer.
+//
+// In case the tracer implements TracePropagator, the trace context is propagated to peers that
+// negotiated the client's current protocol version. Peers not supporting trace propagation
+// reject requests with unknown fields, so protocols enabling it should bump their version and
+// register the previous one via WithLegacyVersion.
+//
+// By default tracing is disabled.
+func WithTracer(tracer Tracer) ClientOption {
+	return func(c *client) {
+		c.tracer = tracer
+	}
+}
+
+// ServerOption is an RPC server option.
+type ServerOption func(s *server)
+
+// WithServerTracer configures the server to create tracing spans around handled requests using
+// the given tracer. In case the tracer implements TracePropagator, the server continues traces
+// propagated by clients.
+//
+// By default tracing is disabled.
+func WithServerTracer(tracer Tracer) ServerOption {
+	return func(s *server) {
+		s.tracer = tracer
+	}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(...Attribute) {
+}
+
+func (nopSpan) AddEvent(string) {
+}
+
+func (nopSpan) RecordError(error) {
+}
+
+func (nopSpan) End() {
+}
+
+// startSpan starts a new span for a call of the given method. The peer identifier is optional.
+//
+// In case tracing is disabled, a no-op span is returned without any allocations.
+func (c *client) startSpan(ctx context.Context, name, method string, peerID core.PeerID) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, nopSpan{}
+	}
+
+	attrs := []Attribute{
+		{AttributeMethod, method},
+		{AttributeRuntimeID, c.runtimeID.String()},
+	}
+	if peerID != "" {
+		attrs = append(attrs, Attribute{AttributePeerID, peerID.String()})
+	}
+	return c.tracer.Start(ctx, name, attrs...)
+}
+
+// injectTraceContext returns the serialized trace context of the span in the given context or nil
+// in case trace propagation is disabled.
+func (c *client) injectTraceContext(ctx context.Context) map[string]string {
+	propagator, ok := c.tracer.(TracePropagator)
+	if !ok {
+		return nil
+	}
+	return propagator.Inject(ctx)
+}
+
+// startSpan starts a new span for handling the given request, continuing the trace propagated by
+// the client (if any).
+func (s *server) startSpan(request *Request, peerID core.PeerID) (context.Context, Span) {
+	ctx := context.Background()
+	if s.tracer == nil {
+		return ctx, nopSpan{}
+	}
+
+	if propagator, ok := s.tracer.(TracePropagator); ok && len(request.TraceContext) > 0 {
+		ctx = propagator.Extract(ctx, request.TraceContext)
+	}
+	return s.tracer.Start(ctx, "rpc.HandleRequest",
+		Attribute{AttributeMethod, request.Method},
+		Attribute{AttributeRuntimeID, s.runtimeID.String()},
+		Attribute{AttributePeerID, peerID.String()},
+	)
+}
+
+// isTracing returns true iff the given span is being recorded.
+func isTracing(span Span) bool {
+	_, nop := span.(nopSpan)
+	return !nop
+}
+
+// endSpan records the outcome of the operation covered by the given span and ends it.
+func endSpan(span Span, err error) {
+	defer span.End()
+
+	if !isTracing(span) {
+		return
+	}
+	switch err {
+	case nil:
+		span.SetAttributes(Attribute{AttributeOutcome, OutcomeSuccess})
+	default:
+		span.SetAttributes(Attribute{AttributeOutcome, OutcomeFailure})
+		span.RecordError(err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package tracing implements an OpenTelemetry backed tracer for the P2P RPC client and server.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oasisprotocol/oasis-core/go/worker/common/p2p/rpc"
+)
+
+var (
+	_ rpc.Tracer          = (*tracer)(nil)
+	_ rpc.TracePropagator = (*tracer)(nil)
+)
+
+type tracer struct {
+	tracer     trace.Tracer
+	kind       trace.SpanKind
+	propagator propagation.TextMapPropagator
+}
+
+// Implements rpc.Tracer.
+func (t *tracer) Start(ctx context.Context, name string, attrs ...rpc.Attribute) (context.Context, rpc.Span) {
+	ctx, s := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(t.kind),
+		trace.WithAttributes(convertAttributes(attrs)...),
+	)
+	return ctx, &span{s}
+}
+
+// Implements rpc.TracePropagator.
+func (t *tracer) Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Implements rpc.TracePropagator.
+func (t *tracer) Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	return t.propagator.Extract(ctx, propagation.MapCarrier(traceContext))
+}
+
+type span struct {
+	span trace.Span
+}
+
+// Implements rpc.Span.
+func (s *span) SetAttributes(attrs ...rpc.Attribute) {
+	s.span.SetAttributes(convertAttributes(attrs)...)
+}
+
+// Implements rpc.Span.
+func (s *span) AddEvent(name string) {
+	s.span.AddEvent(name)
+}
+
+// Implements rpc.Span.
+func (s *span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// Implements rpc.Span.
+func (s *span) End() {
+	s.span.End()
+}
+
+// convertAttributes converts the given RPC span attributes into OpenTelemetry attributes.
+func convertAttributes(attrs []rpc.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, convertAttribute(attr))
+	}
+	return kvs
+}
+
+func convertAttribute(attr rpc.Attribute) attribute.KeyValue {
+	switch v := attr.Value.(type) {
+	case string:
+		return attribute.String(attr.Key, v)
+	case bool:
+		return attribute.Bool(attr.Key, v)
+	case int:
+		return attribute.Int(attr.Key, v)
+	case int64:
+		return attribute.Int64(attr.Key, v)
+	case uint64:
+		return attribute.Int64(attr.Key, int64(v))
+	case float64:
+		return attribute.Float64(attr.Key, v)
+	case time.Duration:
+		return attribute.Float64(attr.Key, v.Seconds())
+	default:
+		return attribute.String(attr.Key, fmt.Sprint(v))
+	}
+}
+
+// NewClientTracer returns an RPC client tracer backed by the given OpenTelemetry tracer. All
+// created spans are client spans and the trace context is propagated to peers using the W3C
+// trace context format.
+func NewClientTracer(t trace.Tracer) rpc.Tracer {
+	return &tracer{
+		tracer:     t,
+		kind:       trace.SpanKindClient,
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// NewServerTracer returns an RPC server tracer backed by the given OpenTelemetry tracer. All
+// created spans are server spans continuing the traces propagated by clients using the W3C trace
+// context format.
+func NewServerTracer(t trace.Tracer) rpc.Tracer {
+	return &tracer{
+		tracer:     t,
+		kind:       trace.SpanKindServer,
+		propagator: propagation.TraceContext{},
+	}
+}
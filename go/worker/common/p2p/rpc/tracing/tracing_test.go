@@ -0,0 +1,158 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/oasisprotocol/oasis-core/go/common/cbor"
+	"github.com/oasisprotocol/oasis-core/go/worker/common/p2p/rpc"
+)
+
+// recordingSpan is an OpenTelemetry span that records all operations.
+type recordingSpan struct {
+	trace.Span
+
+	name   string
+	kind   trace.SpanKind
+	sc     trace.SpanContext
+	parent trace.SpanContext
+	attrs  map[attribute.Key]attribute.Value
+	events []string
+	errs   []error
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordingSpan) SpanContext() trace.SpanContext {
+	return s.sc
+}
+
+func (s *recordingSpan) IsRecording() bool {
+	return true
+}
+
+func (s *recordingSpan) SetAttributes(kvs ...attribute.KeyValue) {
+	for _, kv := range kvs {
+		s.attrs[kv.Key] = kv.Value
+	}
+}
+
+func (s *recordingSpan) AddEvent(name string, _ ...trace.EventOption) {
+	s.events = append(s.events, name)
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) {
+	s.status = code
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+// recordingTracer is an OpenTelemetry tracer that records all started spans.
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	parent := trace.SpanContextFromContext(ctx)
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		traceID = trace.TraceID{byte(len(t.spans) + 1)}
+	}
+	s := &recordingSpan{
+		Span: trace.SpanFromContext(ctx),
+		name: name,
+		kind: cfg.SpanKind(),
+		sc: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     trace.SpanID{byte(len(t.spans) + 1)},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		parent: parent,
+		attrs:  make(map[attribute.Key]attribute.Value),
+	}
+	s.SetAttributes(cfg.Attributes()...)
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func TestClientTracer(t *testing.T) {
+	require := require.New(t)
+
+	otelTracer := &recordingTracer{}
+	tracer := NewClientTracer(otelTracer)
+
+	_, span := tracer.Start(context.Background(), "rpc.Call",
+		rpc.Attribute{Key: rpc.AttributeMethod, Value: "Test"},
+		rpc.Attribute{Key: "count", Value: 3},
+	)
+	span.SetAttributes(
+		rpc.Attribute{Key: rpc.AttributeLatency, Value: 0.5},
+		rpc.Attribute{Key: "duration", Value: 2 * time.Second},
+		rpc.Attribute{Key: "other", Value: struct{}{}},
+	)
+	span.AddEvent(rpc.EventStreamOpened)
+	span.RecordError(fmt.Errorf("failed"))
+	span.End()
+
+	require.Len(otelTracer.spans, 1, "a single span should be started")
+	s := otelTracer.spans[0]
+	require.Equal("rpc.Call", s.name)
+	require.Equal(trace.SpanKindClient, s.kind, "client spans should be created")
+	require.Equal("Test", s.attrs[rpc.AttributeMethod].AsString())
+	require.EqualValues(3, s.attrs["count"].AsInt64())
+	require.Equal(0.5, s.attrs[rpc.AttributeLatency].AsFloat64())
+	require.Equal(2.0, s.attrs["duration"].AsFloat64(), "durations should be converted to seconds")
+	require.Equal("{}", s.attrs["other"].AsString(), "unknown values should be formatted")
+	require.Equal([]string{rpc.EventStreamOpened}, s.events)
+	require.Len(s.errs, 1, "error should be recorded")
+	require.Equal(codes.Error, s.status, "span should be marked as failed")
+	require.True(s.ended, "span should be ended")
+}
+
+func TestTracePropagation(t *testing.T) {
+	require := require.New(t)
+
+	clientTracer := NewClientTracer(&recordingTracer{})
+	otelServerTracer := &recordingTracer{}
+	serverTracer := NewServerTracer(otelServerTracer)
+
+	// Without a span there is nothing to propagate.
+	require.Nil(clientTracer.(rpc.TracePropagator).Inject(context.Background()))
+
+	ctx, clientSpan := clientTracer.Start(context.Background(), "rpc.Call")
+	traceContext := clientTracer.(rpc.TracePropagator).Inject(ctx)
+	require.Contains(traceContext, "traceparent", "W3C trace context should be propagated")
+
+	// The trace context is sent over the wire as part of the request.
+	var request rpc.Request
+	err := cbor.Unmarshal(cbor.Marshal(&rpc.Request{Method: "Test", TraceContext: traceContext}), &request)
+	require.NoError(err, "Unmarshal")
+
+	ctx = serverTracer.(rpc.TracePropagator).Extract(context.Background(), request.TraceContext)
+	_, serverSpan := serverTracer.Start(ctx, "rpc.HandleRequest")
+	serverSpan.End()
+	clientSpan.End()
+
+	require.Len(otelServerTracer.spans, 1, "a single server span should be started")
+	s := otelServerTracer.spans[0]
+	require.Equal(trace.SpanKindServer, s.kind, "server spans should be created")
+	clientSC := clientSpan.(*span).span.SpanContext()
+	require.Equal(clientSC.TraceID(), s.parent.TraceID(), "server span should continue the client trace")
+	require.Equal(clientSC.SpanID(), s.parent.SpanID(), "server span should be a child of the client span")
+	require.True(s.parent.IsRemote(), "parent span should be remote")
+	require.Equal(clientSC.TraceID(), s.sc.TraceID())
+}
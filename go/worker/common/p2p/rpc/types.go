@@ -16,14 +16,44 @@ var (
 
 	// ErrBadRequest is an error raised when a given request is malformed.
 	ErrBadRequest = errors.New(ModuleName, 2, "rpc: bad request")
+
+	// ErrShuttingDown is an error raised when a call is made on a client that is shutting down.
+	ErrShuttingDown = errors.New(ModuleName, 3, "rpc: client is shutting down")
+
+	// ErrResponseTooSlow is an error raised when a peer transfers a response slower than the
+	// required minimum speed.
+	ErrResponseTooSlow = errors.New(ModuleName, 4, "rpc: response transfer too slow")
+
+	// ErrRequestTooLarge is the error returned when the request exceeds the maximum request size.
+	ErrRequestTooLarge = errors.New(ModuleName, 5, "rpc: request too large")
+
+	// ErrResponseTooLarge is the error returned when the response exceeds the maximum response size.
+	ErrResponseTooLarge = errors.New(ModuleName, 6, "rpc: response too large")
+
+	// ErrAllPeersExcluded is the error returned when all peers have been excluded from a call.
+	ErrAllPeersExcluded = errors.New(ModuleName, 7, "rpc: all peers excluded")
+
+	// ErrClosed is an error raised when a call is made on a client that has been closed.
+	ErrClosed = errors.New(ModuleName, 8, "rpc: client is closed")
 )
 
+// MethodGetCapacity is the name of the reserved method used to query the serving capacity
+// advertised by a peer.
+const MethodGetCapacity = "__GetCapacity"
+
 // Request is a request sent by the client.
 type Request struct {
 	// Method is the name of the method.
 	Method string `json:"method"`
 	// Body is the method-specific body.
 	Body cbor.RawMessage `json:"body"`
+	// Compression is the compression codec used for the body. In case it is set, the response
+	// body may also be compressed using the same codec.
+	Compression Compression `json:"compression,omitempty"`
+	// TraceContext is the optional serialized trace context of the caller.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+	// Stream indicates that the caller expects a streaming response.
+	Stream bool `json:"stream,omitempty"`
 }
 
 // Error is a message body representing an error.
@@ -44,4 +74,17 @@ type Response struct {
 	Ok cbor.RawMessage `json:"ok,omitempty"`
 	// Error is an error response in case of failure.
 	Error *Error `json:"error,omitempty"`
+	// Compression is the compression codec used for the method-specific response.
+	Compression Compression `json:"compression,omitempty"`
+	// More indicates that the response is a chunk of a streaming response and that more frames
+	// follow. A streaming response is terminated by a frame without this flag, carrying either an
+	// error or no body in case of success.
+	More bool `json:"more,omitempty"`
+}
+
+// CapacityResponse is a response to a MethodGetCapacity request.
+type CapacityResponse struct {
+	// Capacity is the relative serving capacity advertised by the peer (e.g., derived from its
+	// available bandwidth or number of concurrent requests it is willing to serve).
+	Capacity uint64 `json:"capacity"`
 }
@@ -1079,6 +1079,16 @@ func (n *Node) runtimeExecuteTxBatch(
 	inputRoot hash.Hash,
 	inputs transaction.RawBatch,
 ) (*protocol.RuntimeExecuteTxBatchResponse, error) {
+	// Mark the round as in-flight so that draining the runtime waits for it to complete.
+	endRound, err := n.commonNode.Runtime.BeginRound()
+	if err != nil {
+		n.logger.Error("failed to begin runtime round",
+			"err", err,
+		)
+		return nil, err
+	}
+	defer endRound()
+
 	// Fetch any incoming messages.
 	inMsgs, err := n.commonNode.Consensus.RootHash().GetIncomingMessageQueue(ctx, &roothash.InMessageQueueRequest{
 		RuntimeID: n.commonNode.Runtime.ID(),
@@ -848,6 +848,15 @@ func (w *Worker) querySentries() ([]node.ConsensusAddress, []node.TLSAddress) {
 	var tlsAddrs []node.TLSAddress
 	var err error
 
+	var latestHeight int64
+	if blk, berr := w.consensus.GetBlock(w.ctx, consensus.HeightLatest); berr == nil {
+		latestHeight = blk.Height
+	} else {
+		w.logger.Warn("failed to query latest consensus block",
+			"err", berr,
+		)
+	}
+
 	pubKeys := w.identity.GetTLSPubKeys()
 	for _, sentryAddr := range w.sentryAddresses {
 		var client *sentryClient.Client
@@ -880,6 +889,16 @@ func (w *Worker) querySentries() ([]node.ConsensusAddress, []node.TLSAddress) {
 			)
 		}
 
+		// Let sentries know how far along our consensus node is.
+		if latestHeight > 0 {
+			if err = client.ReportUpstreamHeight(w.ctx, latestHeight); err != nil {
+				w.logger.Warn("failed to report consensus height to sentry node",
+					"err", err,
+					"sentry_address", sentryAddr,
+				)
+			}
+		}
+
 		consensusAddrs = append(consensusAddrs, sentryAddresses.Consensus...)
 		tlsAddrs = append(tlsAddrs, sentryAddresses.TLS...)
 	}
@@ -1040,9 +1059,19 @@ func (w *Worker) Name() string {
 func (w *Worker) Start() error {
 	w.logger.Info("starting node registration service")
 
-	// HACK: This can be ok in certain configurations.
-	if !w.entityID.IsValid() || w.registrationSigner == nil {
+	var skipRegistration bool
+	switch {
+	case w.runtimeRegistry != nil && w.runtimeRegistry.Mode() == runtimeRegistry.RuntimeModeMaintenance:
+		// Nodes in maintenance mode intentionally withhold registration.
+		w.logger.Info("node is in maintenance mode, registration is disabled")
+		skipRegistration = true
+	case !w.entityID.IsValid() || w.registrationSigner == nil:
+		// HACK: This can be ok in certain configurations.
 		w.logger.Warn("no entity/signer for this node, registration will NEVER succeed")
+		skipRegistration = true
+	}
+
+	if skipRegistration {
 		// Make sure the node is stopped on quit and that it can still respond to
 		// shutdown requests from the control api.
 		go func() {
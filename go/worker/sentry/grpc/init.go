@@ -145,8 +145,10 @@ func New(backend sentry.LocalBackend, identity *identity.Identity) (*Worker, err
 		upstreamDialer := func(ctx context.Context) (*grpc.ClientConn, error) {
 			upstreamConn, err := initConnection(ctx, logger, identity, backend)
 			if err != nil {
+				backend.SetUpstreamConnectionState(sentry.UpstreamConnectionFailed)
 				return nil, fmt.Errorf("gRPC sentry worker initializing upstream connection failure: %w", err)
 			}
+			backend.SetUpstreamConnectionState(sentry.UpstreamConnectionConnected)
 			return upstreamConn, nil
 		}
 
@@ -53,8 +53,9 @@ func New(
 ) (*Worker, error) {
 	var enabled bool
 	switch commonWorker.RuntimeRegistry.Mode() {
-	case runtimeRegistry.RuntimeModeCompute, runtimeRegistry.RuntimeModeClient:
-		// When configured in compute or stateful client mode, enable the storage worker.
+	case runtimeRegistry.RuntimeModeCompute, runtimeRegistry.RuntimeModeClient, runtimeRegistry.RuntimeModeMaintenance:
+		// When configured in compute, stateful client or maintenance mode, enable the storage
+		// worker.
 		enabled = true
 	default:
 		enabled = false
@@ -359,6 +359,12 @@ pub struct CheckTxMetadata {
 
     #[cbor(optional)]
     pub weights: Option<BTreeMap<TransactionWeight, u64>>,
+
+    #[cbor(optional, default, skip_serializing_if = "Vec::is_empty")]
+    pub sender: Vec<u8>,
+
+    #[cbor(optional, default, skip_serializing_if = "num_traits::Zero::is_zero")]
+    pub sender_seq: u64,
 }
 
 /// Transaction weight kind.